@@ -34,6 +34,7 @@ func main() {
 				TracerProvider:  args.TracerProvider,
 				MeterProvider:   args.MeterProvider,
 				MetricsGatherer: args.MetricsGatherer,
+				MetricReader:    args.MetricReader,
 				BeatMonitoring:  args.BeatMonitoring,
 			})
 		},
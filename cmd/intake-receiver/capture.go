@@ -0,0 +1,211 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// rumFolder holds the name of the folder, relative to the base path,
+	// in which RUM requests are captured.
+	rumFolder = "rum"
+
+	// otlpFolder holds the name of the folder, relative to the base path,
+	// in which OTLP requests are captured.
+	otlpFolder = "otlp"
+)
+
+// otlpHTTPSignals maps OTLP/HTTP paths to the signal they export.
+var otlpHTTPSignals = map[string]string{
+	"/v1/traces":  "traces",
+	"/v1/metrics": "metrics",
+	"/v1/logs":    "logs",
+}
+
+// otlpGRPCSignals maps OTLP/gRPC method paths to the signal they export.
+var otlpGRPCSignals = map[string]string{
+	"/opentelemetry.proto.collector.trace.v1.TraceService/Export":     "traces",
+	"/opentelemetry.proto.collector.metrics.v1.MetricsService/Export": "metrics",
+	"/opentelemetry.proto.collector.logs.v1.LogsService/Export":       "logs",
+}
+
+// capturedRequest holds a request captured as received, with the time it
+// was received, so that it can be replayed faithfully.
+type capturedRequest struct {
+	Timestamp time.Time   `json:"@timestamp"`
+	Method    string      `json:"method"`
+	Path      string      `json:"path"`
+	Protocol  string      `json:"protocol"`
+	Headers   http.Header `json:"headers"`
+
+	// Body holds the request body, as received. It is encoded in
+	// base64, since it may be compressed or binary.
+	Body []byte `json:"body"`
+}
+
+func (h *requestHandler) rumHandler() http.Handler {
+	return logHandler(corsHandler(func(rw http.ResponseWriter, r *http.Request) {
+		code, err := h.handleRUMRequest(r)
+		if err != nil {
+			log.Println("failed handling request", code, err.Error())
+			http.Error(rw, err.Error(), code)
+			return
+		}
+		rw.WriteHeader(code)
+	}))
+}
+
+func (h *requestHandler) handleRUMRequest(r *http.Request) (int, error) {
+	t := time.Now()
+	raw, err := io.ReadAll(r.Body)
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("failed reading request: %v", err)
+	}
+	body, code, err := decodeBody(r.Header.Get("Content-Encoding"), io.NopCloser(bytes.NewReader(raw)))
+	if err != nil {
+		return code, err
+	}
+	var meta metadata
+	if err := h.processBatch(body, io.Discard, &meta); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid request: %v", err)
+	}
+	if meta.IsEmpty() {
+		return http.StatusBadRequest, errors.New("agent not found in metadata")
+	}
+	fileName := filepath.Join(h.basePath, rumFolder, agentFileName(meta))
+	if err := h.capture(fileName, t, r, raw); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusAccepted, nil
+}
+
+func (h *requestHandler) otlpHTTPHandler() http.Handler {
+	return logHandler(func(rw http.ResponseWriter, r *http.Request) {
+		t := time.Now()
+		if r.Method != http.MethodPost {
+			http.Error(rw, "only POST requests are supported", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fileName := filepath.Join(h.basePath, otlpFolder, otlpHTTPSignals[r.URL.Path]+".ndjson")
+		if err := h.capture(fileName, t, r, body); err != nil {
+			log.Println("failed handling request", err.Error())
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// An empty Export*ServiceResponse indicates full success.
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(http.StatusOK)
+			rw.Write([]byte("{}"))
+			return
+		}
+		rw.Header().Set("Content-Type", "application/x-protobuf")
+		rw.WriteHeader(http.StatusOK)
+	})
+}
+
+func (h *requestHandler) otlpGRPCHandler() http.Handler {
+	return logHandler(func(rw http.ResponseWriter, r *http.Request) {
+		t := time.Now()
+		rw.Header().Set("Content-Type", "application/grpc")
+		if r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			http.Error(rw, "gRPC requests must use HTTP/2", http.StatusUnsupportedMediaType)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err == nil {
+			fileName := filepath.Join(h.basePath, otlpFolder, otlpGRPCSignals[r.URL.Path]+".ndjson")
+			err = h.capture(fileName, t, r, body)
+		}
+		if err != nil {
+			log.Println("failed handling request", err.Error())
+			rw.Header().Set(http.TrailerPrefix+"Grpc-Status", "13") // INTERNAL
+			rw.Header().Set(http.TrailerPrefix+"Grpc-Message", err.Error())
+			rw.WriteHeader(http.StatusOK)
+			return
+		}
+		// Respond with a single, empty Export*ServiceResponse message:
+		// a zero compressed flag, followed by a zero message length.
+		rw.Header().Set(http.TrailerPrefix+"Grpc-Status", "0") // OK
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(make([]byte, 5))
+	})
+}
+
+// capture appends the request, with the given body, to fileName.
+//
+// The Authorization header is not captured, to avoid persisting
+// credentials.
+func (h *requestHandler) capture(fileName string, t time.Time, r *http.Request, body []byte) error {
+	headers := r.Header.Clone()
+	headers.Del("Authorization")
+	line, err := json.Marshal(capturedRequest{
+		Timestamp: t,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Protocol:  r.Proto,
+		Headers:   headers,
+		Body:      body,
+	})
+	if err != nil {
+		return err
+	}
+	f, err := h.agentFileMap.Get(fileName)
+	if err != nil {
+		return fmt.Errorf("couldn't retrieve storage file: %s", fileName)
+	}
+	h.agentFileMap.Set(fileName, f)
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed writing to file: %s: %v", fileName, err)
+	}
+	return nil
+}
+
+// corsHandler allows RUM requests from any origin, handling preflight
+// requests.
+func corsHandler(h http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" {
+			rw.Header().Set("Access-Control-Allow-Origin", origin)
+			rw.Header().Set("Vary", "Origin")
+		}
+		if r.Method == http.MethodOptions {
+			rw.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+			rw.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Encoding, Accept")
+			rw.Header().Set("Access-Control-Max-Age", "3600")
+			rw.WriteHeader(http.StatusOK)
+			return
+		}
+		h(rw, r)
+	}
+}
@@ -0,0 +1,171 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, string) {
+	dir := t.TempDir()
+	for _, sub := range []string{rumFolder, otlpFolder} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, sub), 0755))
+	}
+	var files fileMap
+	t.Cleanup(func() {
+		files.m.Range(func(_, v interface{}) bool {
+			v.(*syncFile).Close()
+			return true
+		})
+	})
+	rh := &requestHandler{
+		agentFileMap: &files,
+		basePath:     dir,
+		bufPool:      sync.Pool{New: func() interface{} { return &bytes.Buffer{} }},
+		bytesBufPool: sync.Pool{New: func() interface{} { return make([]byte, maxScannerBufSize) }},
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/intake/v3/rum/events", rh.rumHandler())
+	for p := range otlpHTTPSignals {
+		mux.Handle(p, rh.otlpHTTPHandler())
+	}
+	for p := range otlpGRPCSignals {
+		mux.Handle(p, rh.otlpGRPCHandler())
+	}
+	srv := httptest.NewUnstartedServer(mux)
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetHTTP1(true)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv, dir
+}
+
+func readCaptured(t *testing.T, path string) []capturedRequest {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var captured []capturedRequest
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r capturedRequest
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+		captured = append(captured, r)
+	}
+	require.NoError(t, scanner.Err())
+	return captured
+}
+
+func TestCaptureRUM(t *testing.T) {
+	srv, dir := newTestServer(t)
+
+	payload := `{"m":{"se":{"n":"frontend","a":{"n":"js-base","ve":"5.0.0"}}}}` + "\n" + `{"x":{"id":"a","tid":"b"}}` + "\n"
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	zw.Write([]byte(payload))
+	zw.Close()
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/intake/v3/rum/events", bytes.NewReader(body.Bytes()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, "https://example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+
+	captured := readCaptured(t, filepath.Join(dir, rumFolder, "js-base-5.0.0.ndjson"))
+	require.Len(t, captured, 1)
+	assert.Equal(t, "/intake/v3/rum/events", captured[0].Path)
+	assert.Equal(t, "gzip", captured[0].Headers.Get("Content-Encoding"))
+	assert.Equal(t, "https://example.com", captured[0].Headers.Get("Origin"))
+	assert.Empty(t, captured[0].Headers.Get("Authorization"))
+	assert.Equal(t, body.Bytes(), captured[0].Body)
+	assert.False(t, captured[0].Timestamp.IsZero())
+}
+
+func TestCaptureOTLPHTTP(t *testing.T) {
+	srv, dir := newTestServer(t)
+
+	resp, err := http.Post(srv.URL+"/v1/traces", "application/x-protobuf", bytes.NewReader([]byte{1, 2, 3}))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Post(srv.URL+"/v1/logs", "application/json", bytes.NewReader([]byte(`{"resourceLogs":[]}`)))
+	require.NoError(t, err)
+	respBody, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "{}", string(respBody))
+
+	traces := readCaptured(t, filepath.Join(dir, otlpFolder, "traces.ndjson"))
+	require.Len(t, traces, 1)
+	assert.Equal(t, []byte{1, 2, 3}, traces[0].Body)
+	assert.Equal(t, "application/x-protobuf", traces[0].Headers.Get("Content-Type"))
+
+	logs := readCaptured(t, filepath.Join(dir, otlpFolder, "logs.ndjson"))
+	require.Len(t, logs, 1)
+	assert.Equal(t, `{"resourceLogs":[]}`, string(logs[0].Body))
+}
+
+func TestCaptureOTLPGRPC(t *testing.T) {
+	srv, dir := newTestServer(t)
+
+	transport := &http.Transport{Protocols: new(http.Protocols)}
+	transport.Protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: transport}
+
+	msg := []byte{0, 0, 0, 0, 2, 0xa, 0}
+	req, err := http.NewRequest(http.MethodPost,
+		srv.URL+"/opentelemetry.proto.collector.metrics.v1.MetricsService/Export",
+		bytes.NewReader(msg),
+	)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 2, resp.ProtoMajor)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []byte{0, 0, 0, 0, 0}, respBody)
+	assert.Equal(t, "0", resp.Trailer.Get("Grpc-Status"))
+
+	captured := readCaptured(t, filepath.Join(dir, otlpFolder, "metrics.ndjson"))
+	require.Len(t, captured, 1)
+	assert.Equal(t, "HTTP/2.0", captured[0].Protocol)
+	assert.Equal(t, msg, captured[0].Body)
+}
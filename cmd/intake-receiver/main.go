@@ -44,6 +44,16 @@ import (
 var maxScannerBufSize = 300 * 1024 // APM Server default
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+		err := replayMain(ctx, os.Args[2:])
+		stop()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
 	// Ignored flags, they are just here to allow the `intake-receiver` to be
 	// dropped in as a replacement for APM Server. This means, that all the
 	// config options are ignored.
@@ -60,8 +70,10 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
 	defer stop()
 
-	if err := os.MkdirAll(folder, 0755); err != nil {
-		log.Fatalln(err)
+	for _, dir := range []string{folder, filepath.Join(folder, rumFolder), filepath.Join(folder, otlpFolder)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Fatalln(err)
+		}
 	}
 	var agentFileMap fileMap
 	defer agentFileMap.m.Range(func(_, v interface{}) bool {
@@ -80,13 +92,25 @@ func main() {
 	}
 	mux := http.NewServeMux()
 	mux.Handle("/", rh.rootHandler())
-	// TODO(marclop): intake/v2/rum and /intake/v3/rum/events are not supported.
-	for _, p := range []string{"/intake/v2/events"} {
-		mux.Handle(p, rh.eventHandler())
+	mux.Handle("/intake/v2/events", rh.eventHandler())
+	for _, p := range []string{"/intake/v2/rum/events", "/intake/v3/rum/events"} {
+		mux.Handle(p, rh.rumHandler())
+	}
+	for p := range otlpHTTPSignals {
+		mux.Handle(p, rh.otlpHTTPHandler())
 	}
+	for p := range otlpGRPCSignals {
+		mux.Handle(p, rh.otlpGRPCHandler())
+	}
+
+	// Accept HTTP/2 without TLS, as used by OTLP/gRPC clients.
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
 	srv := http.Server{
 		Addr:        host,
 		Handler:     mux,
+		Protocols:   &protocols,
 		ReadTimeout: 30 * time.Second,
 		BaseContext: func(l net.Listener) context.Context { return ctx },
 	}
@@ -157,27 +181,11 @@ func (h *requestHandler) handleRequest(r *http.Request) (int, error) {
 		h.bufPool.Put(buf)
 	}()
 
-	var err error
-	body := r.Body
-	encoding := r.Header.Get("Content-Encoding")
-	switch encoding {
-	case "deflate":
-		body, err = zlib.NewReader(r.Body)
-		defer body.Close()
-	case "gzip":
-		body, err = gzip.NewReader(r.Body)
-		defer body.Close()
-	case "":
-	default:
-		return http.StatusBadRequest, fmt.Errorf(
-			"Content-Encoding %s not supported", encoding,
-		)
-	}
+	body, code, err := decodeBody(r.Header.Get("Content-Encoding"), r.Body)
 	if err != nil {
-		return http.StatusInternalServerError, fmt.Errorf(
-			"unable to create compressed reader for %s: %v", encoding, err,
-		)
+		return code, err
 	}
+	defer body.Close()
 
 	var meta metadata
 	if err := h.processBatch(body, buf, &meta); err != nil {
@@ -204,11 +212,34 @@ func (h *requestHandler) handleRequest(r *http.Request) (int, error) {
 	return http.StatusAccepted, nil
 }
 
+// decodeBody returns a reader for the body, decompressing it according to
+// the given Content-Encoding.
+func decodeBody(encoding string, body io.ReadCloser) (io.ReadCloser, int, error) {
+	var err error
+	switch encoding {
+	case "deflate":
+		body, err = zlib.NewReader(body)
+	case "gzip":
+		body, err = gzip.NewReader(body)
+	case "":
+	default:
+		return nil, http.StatusBadRequest, fmt.Errorf(
+			"Content-Encoding %s not supported", encoding,
+		)
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf(
+			"unable to create compressed reader for %s: %v", encoding, err,
+		)
+	}
+	return body, 0, nil
+}
+
 func (h *requestHandler) processBatch(body io.ReadCloser, buf io.Writer, meta *metadata) error {
 	byteBuf := h.bytesBufPool.Get().([]byte)
 	defer func() {
 		byteBuf = byteBuf[:0]
-		h.bufPool.Put(byteBuf)
+		h.bytesBufPool.Put(byteBuf)
 	}()
 	defer body.Close()
 	scanner := bufio.NewScanner(body)
@@ -235,8 +266,7 @@ func (h *requestHandler) processBatch(body io.ReadCloser, buf io.Writer, meta *m
 			// Continue scanning, like we do in the APM Server itself.
 			continue
 		}
-		// TODO(marclop) support RUM.
-		decodedMeta = meta.V2.Service.Agent != nil
+		decodedMeta = !meta.IsEmpty()
 	}
 	if err := scanner.Err(); err != nil {
 		return err
@@ -0,0 +1,560 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxReplayErrors holds the maximum number of distinct error responses
+// reported in the replay summary.
+const maxReplayErrors = 10
+
+// idFields holds the names of the event fields holding trace, transaction
+// and span IDs, which are rewritten when replaying to keep traces unique.
+var idFields = []string{"id", "trace_id", "parent_id", "transaction_id"}
+
+type replayConfig struct {
+	target          string
+	folder          string
+	secretToken     string
+	apiKey          string
+	rateMultiplier  float64
+	eventsPerSecond float64
+	concurrency     int
+	iterations      int
+	rewrite         bool
+	timeout         time.Duration
+}
+
+// replayRequest holds the lines of a recorded intake request: the metadata
+// line followed by the events.
+type replayRequest struct {
+	lines  [][]byte
+	events int
+
+	// timestamp holds the earliest event timestamp in the request, in
+	// microseconds since the Unix epoch, or zero if no event has one.
+	// For captured requests, timestamp holds the time the request was
+	// received.
+	timestamp int64
+
+	// captured holds a RUM or OTLP request captured as received, which
+	// is replayed as captured instead of lines.
+	captured *capturedRequest
+}
+
+func replayMain(ctx context.Context, args []string) error {
+	var cfg replayConfig
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.StringVar(&cfg.target, "target", "http://localhost:8200", "URL of the APM Server to replay the events to")
+	fs.StringVar(&cfg.folder, "folder", "events", "The path where the recorded intake events are stored")
+	fs.StringVar(&cfg.secretToken, "secret-token", "", "secret token for the target APM Server")
+	fs.StringVar(&cfg.apiKey, "api-key", "", "API Key for the target APM Server")
+	fs.Float64Var(&cfg.rateMultiplier, "rate-multiplier", 1, "multiplier for the recorded request rate; 0 replays as fast as possible")
+	fs.Float64Var(&cfg.eventsPerSecond, "events-per-second", 0, "fixed event rate, overriding -rate-multiplier if greater than 0")
+	fs.IntVar(&cfg.concurrency, "concurrency", 4, "number of concurrent requests")
+	fs.IntVar(&cfg.iterations, "iterations", 1, "number of times to replay the recorded events")
+	fs.BoolVar(&cfg.rewrite, "rewrite", true, "rewrite timestamps and IDs, keeping replayed traces unique and current")
+	fs.DurationVar(&cfg.timeout, "timeout", 30*time.Second, "timeout for each request")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if cfg.concurrency <= 0 {
+		return errors.New("-concurrency must be greater than 0")
+	}
+	if cfg.rateMultiplier < 0 || cfg.eventsPerSecond < 0 {
+		return errors.New("-rate-multiplier and -events-per-second must not be negative")
+	}
+
+	requests, err := readRecording(cfg.folder)
+	if err != nil {
+		return err
+	}
+	if len(requests) == 0 {
+		return fmt.Errorf("no recorded events found in %s", cfg.folder)
+	}
+	stats := newReplayStats()
+	start := time.Now()
+	for i := 0; i < cfg.iterations && ctx.Err() == nil; i++ {
+		if err := replay(ctx, cfg, requests, stats); err != nil {
+			return err
+		}
+	}
+	stats.print(os.Stdout, time.Since(start))
+	return nil
+}
+
+// readRecording reads the intake v2 requests recorded in the *.ndjson files
+// in folder, and the RUM and OTLP requests captured in its rum and otlp
+// subfolders, ordered by their timestamps.
+func readRecording(folder string) ([]replayRequest, error) {
+	var requests []replayRequest
+	for _, dir := range []struct {
+		path     string
+		readFile func(string) ([]replayRequest, error)
+	}{
+		{path: folder, readFile: readRecordingFile},
+		{path: filepath.Join(folder, rumFolder), readFile: readCapturedFile},
+		{path: filepath.Join(folder, otlpFolder), readFile: readCapturedFile},
+	} {
+		files, err := filepath.Glob(filepath.Join(dir.path, "*.ndjson"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			fileRequests, err := dir.readFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed reading %s: %w", file, err)
+			}
+			requests = append(requests, fileRequests...)
+		}
+	}
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].timestamp < requests[j].timestamp
+	})
+	return requests, nil
+}
+
+func readRecordingFile(file string) ([]replayRequest, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var requests []replayRequest
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, maxScannerBufSize), maxScannerBufSize)
+	for scanner.Scan() {
+		line := bytes.Clone(scanner.Bytes())
+		var event map[string]struct {
+			Timestamp int64 `json:"timestamp"`
+		}
+		if err := json.Unmarshal(line, &event); err != nil {
+			return nil, err
+		}
+		if _, ok := event["metadata"]; ok {
+			requests = append(requests, replayRequest{})
+		} else if len(requests) == 0 {
+			return nil, errors.New("events recorded without metadata")
+		}
+		r := &requests[len(requests)-1]
+		r.lines = append(r.lines, line)
+		for k, v := range event {
+			if k == "metadata" {
+				continue
+			}
+			r.events++
+			if v.Timestamp > 0 && (r.timestamp == 0 || v.Timestamp < r.timestamp) {
+				r.timestamp = v.Timestamp
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	// Requests without timestamped events are replayed after the
+	// preceding request.
+	for i := 1; i < len(requests); i++ {
+		if requests[i].timestamp == 0 {
+			requests[i].timestamp = requests[i-1].timestamp
+		}
+	}
+	return requests, nil
+}
+
+// readCapturedFile reads the requests captured in file, as written by
+// requestHandler.capture.
+func readCapturedFile(file string) ([]replayRequest, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var requests []replayRequest
+	dec := json.NewDecoder(f)
+	for {
+		captured := new(capturedRequest)
+		if err := dec.Decode(captured); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		requests = append(requests, replayRequest{
+			events:    capturedEvents(captured),
+			timestamp: captured.Timestamp.UnixMicro(),
+			captured:  captured,
+		})
+	}
+	return requests, nil
+}
+
+// capturedEvents returns the number of events in a captured request.
+// RUM requests are decoded to count the events following the metadata;
+// OTLP payloads are not decoded, and each counts as a single event.
+func capturedEvents(r *capturedRequest) int {
+	if !isRUMPath(r.Path) {
+		return 1
+	}
+	body, _, err := decodeBody(r.Headers.Get("Content-Encoding"), io.NopCloser(bytes.NewReader(r.Body)))
+	if err != nil {
+		return 0
+	}
+	defer body.Close()
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return 0
+	}
+	return bytes.Count(bytes.TrimSpace(b), []byte{'\n'})
+}
+
+func isRUMPath(path string) bool {
+	return strings.Contains(path, "/rum/")
+}
+
+// recordingStart returns the earliest timestamp of the requests, which
+// must be ordered by timestamp, or zero if none have timestamps.
+func recordingStart(requests []replayRequest) int64 {
+	for _, r := range requests {
+		if r.timestamp > 0 {
+			return r.timestamp
+		}
+	}
+	return 0
+}
+
+// replay sends requests to the target once, at the configured rate.
+func replay(ctx context.Context, cfg replayConfig, requests []replayRequest, stats *replayStats) error {
+	recorded := recordingStart(requests)
+	var rw *rewriter
+	if cfg.rewrite {
+		var err error
+		if rw, err = newRewriter(recorded); err != nil {
+			return err
+		}
+	}
+	client := &http.Client{Timeout: cfg.timeout}
+	// OTLP/gRPC requests must be sent over HTTP/2, which requires
+	// prior knowledge for targets without TLS.
+	var protocols http.Protocols
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+	grpcClient := &http.Client{Timeout: cfg.timeout, Transport: &http.Transport{Protocols: &protocols}}
+	target := strings.TrimSuffix(cfg.target, "/")
+
+	var wg sync.WaitGroup
+	ch := make(chan replayRequest)
+	for i := 0; i < cfg.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range ch {
+				req, err := r.newRequest(ctx, cfg, target, rw)
+				if err != nil {
+					stats.observe(0, 0, r.events, err.Error())
+					continue
+				}
+				if isGRPC(req.Header) {
+					sendReplayRequest(ctx, grpcClient, req, r.events, stats)
+				} else {
+					sendReplayRequest(ctx, client, req, r.events, stats)
+				}
+			}
+		}()
+	}
+	defer func() {
+		close(ch)
+		wg.Wait()
+	}()
+
+	start := time.Now()
+	var events int
+	for _, r := range requests {
+		var wait time.Duration
+		switch {
+		case cfg.eventsPerSecond > 0:
+			wait = time.Duration(float64(events)/cfg.eventsPerSecond*float64(time.Second)) - time.Since(start)
+		case cfg.rateMultiplier > 0 && r.timestamp > 0:
+			offset := time.Duration(r.timestamp-recorded) * time.Microsecond
+			wait = time.Duration(float64(offset)/cfg.rateMultiplier) - time.Since(start)
+		}
+		if wait > 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(wait):
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case ch <- r:
+		}
+		events += r.events
+	}
+	return nil
+}
+
+// body returns the request body, rewritten by rw if it is non-nil.
+func (r replayRequest) body(rw *rewriter) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, line := range r.lines {
+		if rw != nil {
+			var err error
+			if line, err = rw.rewriteLine(line); err != nil {
+				return nil, err
+			}
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// newRequest returns the HTTP request for replaying r to target.
+//
+// Intake v2 requests are sent to /intake/v2/events, with their lines
+// rewritten by rw if it is non-nil. Captured requests are sent with their
+// original method, path, headers and body, and are not rewritten.
+func (r replayRequest) newRequest(ctx context.Context, cfg replayConfig, target string, rw *rewriter) (*http.Request, error) {
+	if r.captured == nil {
+		body, err := r.body(rw)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, target+"/intake/v2/events", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		setAuthorization(req, cfg)
+		return req, nil
+	}
+	captured := r.captured
+	req, err := http.NewRequestWithContext(ctx, captured.Method, target+captured.Path, bytes.NewReader(captured.Body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range captured.Headers {
+		switch http.CanonicalHeaderKey(k) {
+		case "Connection", "Content-Length", "Keep-Alive", "Transfer-Encoding", "Upgrade":
+			// Hop-by-hop headers are set by the client.
+			continue
+		}
+		req.Header[k] = v
+	}
+	// RUM endpoints are unauthenticated.
+	if !isRUMPath(captured.Path) {
+		setAuthorization(req, cfg)
+	}
+	return req, nil
+}
+
+func setAuthorization(req *http.Request, cfg replayConfig) {
+	switch {
+	case cfg.apiKey != "":
+		req.Header.Set("Authorization", "ApiKey "+cfg.apiKey)
+	case cfg.secretToken != "":
+		req.Header.Set("Authorization", "Bearer "+cfg.secretToken)
+	}
+}
+
+func isGRPC(h http.Header) bool {
+	return strings.HasPrefix(h.Get("Content-Type"), "application/grpc")
+}
+
+func sendReplayRequest(ctx context.Context, client *http.Client, req *http.Request, events int, stats *replayStats) {
+	t := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			stats.observe(time.Since(t), 0, events, err.Error())
+		}
+		return
+	}
+	defer resp.Body.Close()
+	var errMessage string
+	if resp.StatusCode >= http.StatusBadRequest {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		errMessage = strings.TrimSpace(string(b))
+	} else {
+		io.Copy(io.Discard, resp.Body)
+	}
+	if errMessage == "" && isGRPC(resp.Header) {
+		// gRPC errors are reported in the trailers, or in the headers
+		// of responses without a body.
+		status, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+		if status == "" {
+			status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+		}
+		if status != "0" {
+			errMessage = fmt.Sprintf("grpc status %s: %s", status, message)
+		}
+	}
+	stats.observe(time.Since(t), resp.StatusCode, events, errMessage)
+}
+
+// rewriter rewrites recorded events, shifting their timestamps to the time
+// of the replay and replacing their IDs with IDs unique to the replay.
+type rewriter struct {
+	salt []byte
+
+	// offset holds the offset added to timestamps, in microseconds.
+	offset int64
+}
+
+func newRewriter(recordingStart int64) (*rewriter, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	rw := &rewriter{salt: salt}
+	if recordingStart > 0 {
+		rw.offset = time.Now().UnixMicro() - recordingStart
+	}
+	return rw, nil
+}
+
+func (rw *rewriter) rewriteLine(line []byte) ([]byte, error) {
+	var event map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(line, &event); err != nil {
+		return nil, err
+	}
+	if _, ok := event["metadata"]; ok {
+		return line, nil
+	}
+	for _, fields := range event {
+		for _, k := range idFields {
+			var id string
+			if err := json.Unmarshal(fields[k], &id); err != nil || id == "" {
+				continue
+			}
+			fields[k], _ = json.Marshal(rw.rewriteID(id))
+		}
+		var timestamp int64
+		if err := json.Unmarshal(fields["timestamp"], &timestamp); err == nil && timestamp > 0 {
+			fields["timestamp"], _ = json.Marshal(timestamp + rw.offset)
+		}
+	}
+	return json.Marshal(event)
+}
+
+// rewriteID returns a hex ID of the same length as id, derived from id and
+// the rewriter's salt, so that references between events are preserved.
+func (rw *rewriter) rewriteID(id string) string {
+	h := sha256.New()
+	h.Write(rw.salt)
+	h.Write([]byte(id))
+	sum := hex.EncodeToString(h.Sum(nil))
+	if len(id) > len(sum) {
+		return id
+	}
+	return sum[:len(id)]
+}
+
+type replayStats struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	statuses  map[int]int
+	errors    map[string]int
+	events    int
+	failed    int
+}
+
+func newReplayStats() *replayStats {
+	return &replayStats{statuses: make(map[int]int), errors: make(map[string]int)}
+}
+
+// observe records the result of a request. status is zero if no response
+// was received.
+func (s *replayStats) observe(latency time.Duration, status, events int, errMessage string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if latency > 0 {
+		s.latencies = append(s.latencies, latency)
+	}
+	if status > 0 {
+		s.statuses[status]++
+	}
+	if errMessage != "" || status == 0 {
+		s.failed += events
+		if _, ok := s.errors[errMessage]; ok || len(s.errors) < maxReplayErrors {
+			s.errors[errMessage]++
+		}
+		return
+	}
+	s.events += events
+}
+
+func (s *replayStats) print(w io.Writer, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sort.Slice(s.latencies, func(i, j int) bool { return s.latencies[i] < s.latencies[j] })
+	fmt.Fprintf(w, "replayed %d requests in %s\n", len(s.latencies), elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "events: %d accepted, %d failed (%.1f/s)\n", s.events, s.failed, float64(s.events)/elapsed.Seconds())
+	if len(s.latencies) > 0 {
+		fmt.Fprintf(w, "latency: p50=%s p90=%s p99=%s max=%s\n",
+			s.percentile(0.5), s.percentile(0.9), s.percentile(0.99),
+			s.latencies[len(s.latencies)-1],
+		)
+	}
+	statuses := make([]int, 0, len(s.statuses))
+	for status := range s.statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	for _, status := range statuses {
+		fmt.Fprintf(w, "status %d: %d\n", status, s.statuses[status])
+	}
+	errMessages := make([]string, 0, len(s.errors))
+	for errMessage := range s.errors {
+		errMessages = append(errMessages, errMessage)
+	}
+	sort.Strings(errMessages)
+	for _, errMessage := range errMessages {
+		fmt.Fprintf(w, "error (%d): %s\n", s.errors[errMessage], errMessage)
+	}
+}
+
+// percentile returns the p-th percentile latency. The latencies must be
+// sorted and non-empty.
+func (s *replayStats) percentile(p float64) time.Duration {
+	i := int(p * float64(len(s.latencies)-1))
+	return s.latencies[i]
+}
@@ -0,0 +1,320 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const recordedMetadata = `{"metadata":{"service":{"name":"svc","agent":{"name":"go","version":"2.0.0"}}}}`
+
+func TestReadRecording(t *testing.T) {
+	dir := t.TempDir()
+	writeRecording(t, dir, "go-2.0.0.ndjson",
+		recordedMetadata,
+		`{"transaction":{"id":"a","trace_id":"t","timestamp":3000}}`,
+		recordedMetadata,
+		`{"span":{"id":"b","trace_id":"t","timestamp":1000}}`,
+		`{"span":{"id":"c","trace_id":"t","timestamp":2000}}`,
+	)
+	writeRecording(t, dir, "python-6.0.0.ndjson",
+		recordedMetadata,
+		`{"error":{"id":"d","timestamp":1500}}`,
+	)
+
+	requests, err := readRecording(dir)
+	require.NoError(t, err)
+	require.Len(t, requests, 3)
+	assert.Equal(t, []int64{1000, 1500, 3000}, []int64{
+		requests[0].timestamp, requests[1].timestamp, requests[2].timestamp,
+	})
+	assert.Equal(t, []int{2, 1, 1}, []int{
+		requests[0].events, requests[1].events, requests[2].events,
+	})
+}
+
+func TestReadRecordingWithoutMetadata(t *testing.T) {
+	dir := t.TempDir()
+	writeRecording(t, dir, "go-2.0.0.ndjson", `{"transaction":{"id":"a"}}`)
+	_, err := readRecording(dir)
+	assert.EqualError(t, err, "failed reading "+filepath.Join(dir, "go-2.0.0.ndjson")+": events recorded without metadata")
+}
+
+func TestRewriter(t *testing.T) {
+	rw, err := newRewriter(1000)
+	require.NoError(t, err)
+	rw.offset = 5000
+
+	line, err := rw.rewriteLine([]byte(`{"span":{"id":"0123456789abcdef","trace_id":"0123456789abcdef0123456789abcdef","parent_id":"fedcba9876543210","name":"x","timestamp":1000}}`))
+	require.NoError(t, err)
+	var event struct {
+		Span struct {
+			ID        string `json:"id"`
+			TraceID   string `json:"trace_id"`
+			ParentID  string `json:"parent_id"`
+			Name      string `json:"name"`
+			Timestamp int64  `json:"timestamp"`
+		} `json:"span"`
+	}
+	require.NoError(t, json.Unmarshal(line, &event))
+	assert.Len(t, event.Span.ID, 16)
+	assert.Len(t, event.Span.TraceID, 32)
+	assert.NotEqual(t, "0123456789abcdef", event.Span.ID)
+	assert.Equal(t, rw.rewriteID("fedcba9876543210"), event.Span.ParentID)
+	assert.Equal(t, "x", event.Span.Name)
+	assert.Equal(t, int64(6000), event.Span.Timestamp)
+
+	// Metadata is left unchanged.
+	line, err = rw.rewriteLine([]byte(recordedMetadata))
+	require.NoError(t, err)
+	assert.Equal(t, recordedMetadata, string(line))
+
+	// Rewriters for different replays produce different IDs.
+	other, err := newRewriter(1000)
+	require.NoError(t, err)
+	assert.NotEqual(t, rw.rewriteID("0123456789abcdef"), other.rewriteID("0123456789abcdef"))
+}
+
+func TestReplay(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/intake/v2/events", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		var buf bytes.Buffer
+		buf.ReadFrom(r.Body)
+		mu.Lock()
+		bodies = append(bodies, buf.String())
+		mu.Unlock()
+		if strings.Contains(buf.String(), "invalid") {
+			http.Error(w, `{"errors":[{"message":"invalid event"}]}`, http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	writeRecording(t, dir, "go-2.0.0.ndjson",
+		recordedMetadata,
+		`{"transaction":{"id":"a","trace_id":"t","timestamp":1000}}`,
+		recordedMetadata,
+		`{"transaction":{"id":"b","trace_id":"t","name":"invalid","timestamp":2000}}`,
+	)
+	requests, err := readRecording(dir)
+	require.NoError(t, err)
+
+	cfg := replayConfig{
+		target:      srv.URL,
+		secretToken: "secret",
+		concurrency: 2,
+	}
+	stats := newReplayStats()
+	require.NoError(t, replay(context.Background(), cfg, requests, stats))
+	require.NoError(t, replay(context.Background(), cfg, requests, stats))
+	assert.Len(t, bodies, 4)
+	for _, body := range bodies {
+		scanner := bufio.NewScanner(strings.NewReader(body))
+		require.True(t, scanner.Scan())
+		assert.Equal(t, recordedMetadata, scanner.Text())
+	}
+
+	var summary bytes.Buffer
+	stats.print(&summary, 0)
+	assert.Contains(t, summary.String(), "replayed 4 requests")
+	assert.Contains(t, summary.String(), "events: 2 accepted, 2 failed")
+	assert.Contains(t, summary.String(), "status 202: 2\n")
+	assert.Contains(t, summary.String(), "status 400: 2\n")
+	assert.Contains(t, summary.String(), `error (2): {"errors":[{"message":"invalid event"}]}`)
+}
+
+func TestReadRecordingCaptured(t *testing.T) {
+	dir := t.TempDir()
+	writeRecording(t, dir, "go-2.0.0.ndjson",
+		recordedMetadata,
+		`{"transaction":{"id":"a","trace_id":"t","timestamp":2000}}`,
+	)
+	writeCaptured(t, filepath.Join(dir, rumFolder), "js-base-5.0.0.ndjson", capturedRequest{
+		Timestamp: time.UnixMicro(3000),
+		Method:    http.MethodPost,
+		Path:      "/intake/v3/rum/events",
+		Headers:   http.Header{"Content-Encoding": {"gzip"}},
+		Body:      gzipBytes(t, `{"m":{}}`+"\n"+`{"x":{}}`+"\n"+`{"y":{}}`+"\n"),
+	})
+	writeCaptured(t, filepath.Join(dir, otlpFolder), "traces.ndjson", capturedRequest{
+		Timestamp: time.UnixMicro(1000),
+		Method:    http.MethodPost,
+		Path:      "/v1/traces",
+		Headers:   http.Header{"Content-Type": {"application/x-protobuf"}},
+		Body:      []byte{1, 2, 3},
+	})
+
+	requests, err := readRecording(dir)
+	require.NoError(t, err)
+	require.Len(t, requests, 3)
+	assert.Equal(t, []int64{1000, 2000, 3000}, []int64{
+		requests[0].timestamp, requests[1].timestamp, requests[2].timestamp,
+	})
+	assert.Equal(t, []int{1, 1, 2}, []int{
+		requests[0].events, requests[1].events, requests[2].events,
+	})
+	require.NotNil(t, requests[0].captured)
+	assert.Equal(t, "/v1/traces", requests[0].captured.Path)
+	assert.Nil(t, requests[1].captured)
+	require.NotNil(t, requests[2].captured)
+	assert.Equal(t, "/intake/v3/rum/events", requests[2].captured.Path)
+}
+
+func TestReplayCaptured(t *testing.T) {
+	type received struct {
+		path            string
+		contentType     string
+		contentEncoding string
+		authorization   string
+		proto           int
+		body            []byte
+	}
+	var mu sync.Mutex
+	var requests []received
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, received{
+			path:            r.URL.Path,
+			contentType:     r.Header.Get("Content-Type"),
+			contentEncoding: r.Header.Get("Content-Encoding"),
+			authorization:   r.Header.Get("Authorization"),
+			proto:           r.ProtoMajor,
+			body:            body,
+		})
+		mu.Unlock()
+		if isGRPC(r.Header) {
+			w.Header().Set("Content-Type", "application/grpc")
+			w.Header().Set(http.TrailerPrefix+"Grpc-Status", "3")
+			w.Header().Set(http.TrailerPrefix+"Grpc-Message", "invalid")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	srv := httptest.NewUnstartedServer(mux)
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetHTTP1(true)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	defer srv.Close()
+
+	rumBody := gzipBytes(t, `{"m":{}}`+"\n"+`{"x":{}}`+"\n")
+	requestsToReplay := []replayRequest{{
+		events: 1,
+		captured: &capturedRequest{
+			Method:  http.MethodPost,
+			Path:    "/intake/v3/rum/events",
+			Headers: http.Header{"Content-Encoding": {"gzip"}, "Content-Length": {"123"}},
+			Body:    rumBody,
+		},
+	}, {
+		events: 1,
+		captured: &capturedRequest{
+			Method:  http.MethodPost,
+			Path:    "/v1/traces",
+			Headers: http.Header{"Content-Type": {"application/x-protobuf"}},
+			Body:    []byte{1, 2, 3},
+		},
+	}, {
+		events: 1,
+		captured: &capturedRequest{
+			Method:   http.MethodPost,
+			Path:     "/opentelemetry.proto.collector.trace.v1.TraceService/Export",
+			Protocol: "HTTP/2.0",
+			Headers:  http.Header{"Content-Type": {"application/grpc"}, "Te": {"trailers"}},
+			Body:     []byte{0, 0, 0, 0, 0},
+		},
+	}}
+	cfg := replayConfig{target: srv.URL, secretToken: "secret", concurrency: 1}
+	stats := newReplayStats()
+	require.NoError(t, replay(context.Background(), cfg, requestsToReplay, stats))
+
+	assert.Equal(t, []received{{
+		path:            "/intake/v3/rum/events",
+		contentEncoding: "gzip",
+		proto:           1,
+		body:            rumBody,
+	}, {
+		path:          "/v1/traces",
+		contentType:   "application/x-protobuf",
+		authorization: "Bearer secret",
+		proto:         1,
+		body:          []byte{1, 2, 3},
+	}, {
+		path:          "/opentelemetry.proto.collector.trace.v1.TraceService/Export",
+		contentType:   "application/grpc",
+		authorization: "Bearer secret",
+		proto:         2,
+		body:          []byte{0, 0, 0, 0, 0},
+	}}, requests)
+
+	var summary bytes.Buffer
+	stats.print(&summary, 0)
+	assert.Contains(t, summary.String(), "events: 2 accepted, 1 failed")
+	assert.Contains(t, summary.String(), "error (1): grpc status 3: invalid")
+}
+
+func writeCaptured(t testing.TB, dir, name string, requests ...capturedRequest) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range requests {
+		require.NoError(t, enc.Encode(r))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0644))
+}
+
+func gzipBytes(t testing.TB, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func writeRecording(t testing.TB, dir, name string, lines ...string) {
+	t.Helper()
+	content := strings.Join(lines, "\n") + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+}
@@ -64,6 +64,10 @@ type ElasticsearchFetcher struct {
 	last  time.Time
 	cache []AgentConfig
 
+	// refreshMu serializes cache refreshes, which may be requested
+	// with Refresh concurrently with the periodic refresh in Run.
+	refreshMu sync.Mutex
+
 	searchSize int
 
 	invalidESCfg     atomic.Bool
@@ -202,6 +206,19 @@ func (f *ElasticsearchFetcher) Run(ctx context.Context) error {
 	}
 }
 
+// Refresh refreshes the cache immediately, rather than waiting for the
+// next periodic refresh by Run.
+func (f *ElasticsearchFetcher) Refresh(ctx context.Context) error {
+	ctx, tx := f.tracer.Start(ctx, "ElasticsearchFetcher.Refresh")
+	defer tx.End()
+	if err := f.refreshCache(ctx); err != nil {
+		tx.RecordError(err)
+		return err
+	}
+	f.logger.Info("refreshed cache on request")
+	return nil
+}
+
 type cacheResult struct {
 	Hits struct {
 		Hits []struct {
@@ -223,6 +240,9 @@ func (f *ElasticsearchFetcher) refreshCache(ctx context.Context) (err error) {
 	ctx, span := f.tracer.Start(ctx, "ElasticsearchFetcher.refreshCache")
 	defer span.End()
 
+	f.refreshMu.Lock()
+	defer f.refreshMu.Unlock()
+
 	scrollID := ""
 	buffer := make([]AgentConfig, 0, len(f.cache))
 
@@ -184,6 +184,16 @@ func TestRefreshCacheScroll(t *testing.T) {
 	require.Equal(t, "second", fetcher.cache[1].ServiceName)
 }
 
+func TestRefresh(t *testing.T) {
+	fetcher := newElasticsearchFetcher(t, sampleHits, 2, tracenoop.NewTracerProvider())
+	require.NoError(t, fetcher.Refresh(context.Background()))
+	require.Len(t, fetcher.cache, 2)
+
+	result, err := fetcher.Fetch(context.Background(), Query{Service: Service{Name: "second"}})
+	require.NoError(t, err)
+	assert.Equal(t, "2da2f86251165ccced5c5e41100a216b0c880db4", result.Source.Etag)
+}
+
 func TestFetchOnCacheNotReady(t *testing.T) {
 	fetcher := newElasticsearchFetcher(t, []map[string]interface{}{}, 1, tracenoop.NewTracerProvider())
 
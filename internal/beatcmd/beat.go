@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"os"
 	"os/user"
 	"runtime"
@@ -36,6 +37,7 @@ import (
 	"go.elastic.co/apm/module/apmotel/v2"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 	"go.opentelemetry.io/otel/trace"
@@ -67,6 +69,7 @@ import (
 	sysinfo "github.com/elastic/go-sysinfo"
 	"github.com/elastic/go-sysinfo/types"
 
+	"github.com/elastic/apm-server/internal/logs"
 	"github.com/elastic/apm-server/internal/version"
 )
 
@@ -87,6 +90,9 @@ type Beat struct {
 	metricReader   *sdkmetric.ManualReader
 	meterProvider  *sdkmetric.MeterProvider
 	metricGatherer *apmotel.Gatherer
+
+	// prometheusMetrics is non-nil if http.prometheus is enabled.
+	prometheusMetrics *prometheusMetrics
 }
 
 // BeatParams holds parameters for NewBeat.
@@ -130,11 +136,20 @@ func NewBeat(args BeatParams) (*Beat, error) {
 		return nil, err
 	}
 
+	promMetrics, err := newPrometheusMetrics(cfg.Prometheus)
+	if err != nil {
+		return nil, err
+	}
+
 	metricReader := sdkmetric.NewManualReader()
-	meterProvider := sdkmetric.NewMeterProvider(
+	meterProviderOptions := []sdkmetric.Option{
 		sdkmetric.WithReader(exporter),
 		sdkmetric.WithReader(metricReader),
-	)
+	}
+	if promMetrics != nil {
+		meterProviderOptions = append(meterProviderOptions, sdkmetric.WithReader(promMetrics.reader))
+	}
+	meterProvider := sdkmetric.NewMeterProvider(meterProviderOptions...)
 	otel.SetMeterProvider(meterProvider)
 
 	b := &Beat{
@@ -161,6 +176,8 @@ func NewBeat(args BeatParams) (*Beat, error) {
 		metricReader:   metricReader,
 		meterProvider:  meterProvider,
 		metricGatherer: &exporter,
+
+		prometheusMetrics: promMetrics,
 	}
 
 	if err := b.init(); err != nil {
@@ -174,7 +191,8 @@ func (b *Beat) init() error {
 	if err := configureLogging(b.Config); err != nil {
 		return fmt.Errorf("failed to configure logging: %w", err)
 	}
-	b.Beat.Info.Logger = logp.NewLogger("")
+	// Debug selectors may be changed at runtime through the admin API.
+	b.Beat.Info.Logger = logp.NewLogger("", logs.WithRuntimeSelectors())
 
 	// log paths values to help with troubleshooting
 	b.Info.Logger.Infof("%s", paths.Paths.String())
@@ -372,10 +390,24 @@ func (b *Beat) Run(ctx context.Context) error {
 		}
 	}
 
+	// If enabled, serve metrics for Prometheus on a dedicated listener.
+	if b.prometheusMetrics != nil {
+		lis, err := net.Listen("tcp", b.prometheusMetrics.addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen for Prometheus metrics: %w", err)
+		}
+		g.Go(func() error {
+			return b.prometheusMetrics.serve(ctx, lis, b.Info.Logger)
+		})
+	}
+
 	slogger := slog.New(zapslog.NewHandler(b.Info.Logger.Core()))
 	g.Go(func() error {
 		return adjustMemlimit(ctx, 30*time.Second, slogger)
 	})
+	g.Go(func() error {
+		return handleLogLevelSignals(ctx, b.Info.Logger)
+	})
 
 	logSystemInfo(b.Info)
 
@@ -405,7 +437,7 @@ func (b *Beat) Run(ctx context.Context) error {
 	}
 
 	if b.Manager.Enabled() {
-		reloader, err := NewReloader(b.Info, b.Registry, b.newRunner, b.meterProvider, b.metricGatherer, b.tracerProvider, b.Monitoring)
+		reloader, err := NewReloader(b.Info, b.Registry, b.newRunner, b.meterProvider, b.metricGatherer, b.metricReader, b.tracerProvider, b.Monitoring)
 		if err != nil {
 			return err
 		}
@@ -427,6 +459,7 @@ func (b *Beat) Run(ctx context.Context) error {
 			TracerProvider:  b.tracerProvider,
 			MeterProvider:   b.meterProvider,
 			MetricsGatherer: b.metricGatherer,
+			MetricReader:    b.metricReader,
 			BeatMonitoring:  b.Monitoring,
 		})
 		if err != nil {
@@ -500,6 +533,20 @@ func (b *Beat) registerStateMetrics() {
 }
 
 func (b *Beat) registerStatsMetrics() {
+	// Only metrics for output.elasticsearch are reported in the libbeat
+	// stats. Named outputs used for output routing are distinguished by
+	// an "output.name" instrumentation scope attribute, and are reported
+	// under output.elasticsearch.outputs.<name>.
+	isOutputElasticsearch := func(scope instrumentation.Scope) bool {
+		return scope.Name == "github.com/elastic/go-docappender" && scope.Attributes.Len() == 0
+	}
+	namedOutput := func(scope instrumentation.Scope) (string, bool) {
+		if scope.Name != "github.com/elastic/go-docappender" {
+			return "", false
+		}
+		name, ok := scope.Attributes.Value("output.name")
+		return name.AsString(), ok
+	}
 	statsRegistry := b.Monitoring.StatsRegistry()
 	libbeatRegistry := statsRegistry.GetOrCreateRegistry("libbeat")
 	monitoring.NewFunc(libbeatRegistry, "output", func(_ monitoring.Mode, v monitoring.Visitor) {
@@ -511,7 +558,7 @@ func (b *Beat) registerStatsMetrics() {
 		defer v.OnRegistryFinished()
 		for _, sm := range rm.ScopeMetrics {
 			switch {
-			case sm.Scope.Name == "github.com/elastic/go-docappender":
+			case isOutputElasticsearch(sm.Scope):
 				monitoring.ReportString(v, "type", "elasticsearch")
 				addDocappenderLibbeatOutputMetrics(context.Background(), v, sm)
 			}
@@ -526,7 +573,7 @@ func (b *Beat) registerStatsMetrics() {
 		defer v.OnRegistryFinished()
 		for _, sm := range rm.ScopeMetrics {
 			switch {
-			case sm.Scope.Name == "github.com/elastic/go-docappender":
+			case isOutputElasticsearch(sm.Scope):
 				addDocappenderLibbeatPipelineMetrics(context.Background(), v, sm)
 			}
 		}
@@ -538,11 +585,28 @@ func (b *Beat) registerStatsMetrics() {
 		}
 		v.OnRegistryStart()
 		defer v.OnRegistryFinished()
+		namedOutputs := make(map[string]metricdata.ScopeMetrics)
 		for _, sm := range rm.ScopeMetrics {
 			switch {
-			case sm.Scope.Name == "github.com/elastic/go-docappender":
+			case isOutputElasticsearch(sm.Scope):
+				addDocappenderOutputElasticsearchMetrics(context.Background(), v, sm)
+			default:
+				if name, ok := namedOutput(sm.Scope); ok {
+					namedOutputs[name] = sm
+				}
+			}
+		}
+		if len(namedOutputs) > 0 {
+			v.OnRegistryStart()
+			v.OnKey("outputs")
+			for name, sm := range namedOutputs {
+				v.OnRegistryStart()
+				v.OnKey(name)
+				addDocappenderLibbeatOutputMetrics(context.Background(), v, sm)
 				addDocappenderOutputElasticsearchMetrics(context.Background(), v, sm)
+				v.OnRegistryFinished()
 			}
+			v.OnRegistryFinished()
 		}
 	})
 	monitoring.NewFunc(statsRegistry, "apm-server", func(_ monitoring.Mode, v monitoring.Visitor) {
@@ -31,6 +31,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
@@ -233,6 +235,79 @@ func TestLibbeatMetrics(t *testing.T) {
 	}, snapshot)
 }
 
+// TestNamedOutputMetrics tests that go-docappender metrics for named
+// outputs are reported under output.elasticsearch.outputs.<name>, and
+// not in the libbeat output metrics.
+func TestNamedOutputMetrics(t *testing.T) {
+	runnerParamsChan := make(chan RunnerParams, 1)
+	beat := newBeat(t, "output.elasticsearch.enabled: true", func(args RunnerParams) (Runner, error) {
+		runnerParamsChan <- args
+		return runnerFunc(func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}), nil
+	})
+	stop := runBeat(t, beat)
+	defer func() { assert.NoError(t, stop()) }()
+	args := <-runnerParamsChan
+
+	esClient := docappendertest.NewMockElasticsearchClient(t, func(w http.ResponseWriter, r *http.Request) {
+		_, result := docappendertest.DecodeBulkRequest(r)
+		json.NewEncoder(w).Encode(result)
+	})
+	appender, err := docappender.New(esClient, docappender.Config{
+		MeterProvider: namedMeterProvider{MeterProvider: args.MeterProvider, name: "archive"},
+		FlushBytes:    1,
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, appender.Close(context.Background()))
+	}()
+
+	const totalRequests = 2
+	for range totalRequests {
+		require.NoError(t, appender.Add(context.Background(), "index", strings.NewReader("{}")))
+	}
+
+	statsRegistry := beat.Monitoring.StatsRegistry()
+	var archive map[string]any
+	assert.Eventually(t, func() bool {
+		snapshot := monitoring.CollectStructSnapshot(statsRegistry.GetRegistry("output"), monitoring.Full, false)
+		elasticsearch, _ := snapshot["elasticsearch"].(map[string]any)
+		outputs, _ := elasticsearch["outputs"].(map[string]any)
+		archive, _ = outputs["archive"].(map[string]any)
+		events, _ := archive["events"].(map[string]any)
+		return events["acked"] == int64(totalRequests)
+	}, 10*time.Second, 50*time.Millisecond)
+
+	events := archive["events"].(map[string]any)
+	assert.Equal(t, int64(totalRequests), events["total"])
+	assert.Equal(t, int64(totalRequests), events["batches"])
+	assert.Equal(t, int64(0), events["failed"])
+	assert.Equal(t, int64(0), events["active"])
+	assert.Contains(t, archive, "write")
+	bulkRequests := archive["bulk_requests"].(map[string]any)
+	assert.Equal(t, int64(totalRequests), bulkRequests["completed"])
+	assert.Contains(t, archive, "indexers")
+
+	// Named outputs are not reported as the libbeat output.
+	snapshot := monitoring.CollectStructSnapshot(statsRegistry.GetRegistry("libbeat"), monitoring.Full, false)
+	output, _ := snapshot["output"].(map[string]any)
+	assert.NotContains(t, output, "type")
+}
+
+// namedMeterProvider adds an "output.name" instrumentation scope
+// attribute to all meters, as the server does for named outputs.
+type namedMeterProvider struct {
+	metric.MeterProvider
+	name string
+}
+
+func (mp namedMeterProvider) Meter(name string, opts ...metric.MeterOption) metric.Meter {
+	opts = append(opts, metric.WithInstrumentationAttributes(attribute.String("output.name", mp.name)))
+	return mp.MeterProvider.Meter(name, opts...)
+}
+
 // TestAddAPMServerMetrics tests basic functionality of the metrics collection and reporting
 func TestAddAPMServerMetrics(t *testing.T) {
 	r := monitoring.NewRegistry()
@@ -423,7 +498,7 @@ func TestRunManager_Reloader(t *testing.T) {
 			}
 			return nil
 		}), nil
-	}, nil, nil, nil, beat.NewMonitoring())
+	}, nil, nil, nil, nil, beat.NewMonitoring())
 	require.NoError(t, err)
 
 	agentInfo := &proto.AgentInfo{
@@ -553,7 +628,7 @@ func TestRunManager_Reloader_newRunnerError(t *testing.T) {
 		Logger: logptest.NewTestingLogger(t, "beat"),
 	}, registry, func(_ RunnerParams) (Runner, error) {
 		return nil, errors.New("newRunner error")
-	}, nil, nil, nil, beat.NewMonitoring())
+	}, nil, nil, nil, nil, beat.NewMonitoring())
 	require.NoError(t, err)
 
 	onObserved := func(observed *proto.CheckinObserved, currentIdx int) {
@@ -79,6 +79,7 @@ func NewRootCommand(beatParams BeatParams) *cobra.Command {
 	}
 	rootCommand.AddCommand(versionCommand)
 	rootCommand.AddCommand(genTestCmd(beatParams))
+	rootCommand.AddCommand(genDeadLetterCmd())
 
 	return rootCommand
 }
@@ -44,6 +44,7 @@ type Config struct {
 	HTTP          *config.C     `config:"http"`
 	HTTPPprof     *pprof.Config `config:"http.pprof"`
 	BufferConfig  *config.C     `config:"http.buffer"`
+	Prometheus    *config.C     `config:"http.prometheus"`
 	Logging       *config.C     `config:"logging"`
 	MetricLogging *config.C     `config:"logging.metrics"`
 
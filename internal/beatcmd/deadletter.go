@@ -0,0 +1,107 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package beatcmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/paths"
+
+	beaterconfig "github.com/elastic/apm-server/internal/beater/config"
+	"github.com/elastic/apm-server/internal/deadletter"
+	"github.com/elastic/apm-server/internal/elasticsearch"
+)
+
+func genDeadLetterCmd() *cobra.Command {
+	deadLetterCmd := &cobra.Command{
+		Use:   "dead-letter",
+		Short: "Manage documents rejected by Elasticsearch",
+	}
+	deadLetterCmd.AddCommand(newDeadLetterReplayCommand())
+	return deadLetterCmd
+}
+
+func newDeadLetterReplayCommand() *cobra.Command {
+	var dir string
+	command := &cobra.Command{
+		Use:   "replay",
+		Short: "Replay dead-lettered documents to Elasticsearch",
+		Long: `Replay dead-lettered documents to Elasticsearch, using the configured Elasticsearch output.
+
+Files are removed once all of their documents have been indexed. Documents that
+are rejected again are kept, so replay may be retried after addressing the cause.
+APM Server should be stopped, or dead_letter disabled, while replaying, as the most
+recent dead-letter file may otherwise still be written to.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, _, err := LoadConfig()
+			if err != nil {
+				return err
+			}
+			if cfg.Output.Name() != "elasticsearch" {
+				return errors.New("replaying dead-lettered documents requires the Elasticsearch output")
+			}
+			logger := logp.NewLogger("")
+			esOutputConfig := cfg.Output.Config()
+			apmServerConfig, err := beaterconfig.NewConfig(cfg.APMServer, esOutputConfig, logger)
+			if err != nil {
+				return err
+			}
+			if dir == "" {
+				dir = apmServerConfig.DeadLetter.Path
+			}
+			if dir == "" {
+				dir = paths.Resolve(paths.Data, deadletter.DirName)
+			}
+
+			esConfig := elasticsearch.DefaultConfig()
+			if err := esOutputConfig.Unpack(esConfig); err != nil {
+				return fmt.Errorf("failed to unpack Elasticsearch output config: %w", err)
+			}
+			client, err := elasticsearch.NewClient(esConfig, logger)
+			if err != nil {
+				return err
+			}
+			files, err := deadletter.Files(dir)
+			if err != nil {
+				return err
+			}
+
+			var total deadletter.ReplayStats
+			for _, file := range files {
+				stats, err := deadletter.ReplayFile(cmd.Context(), client, file)
+				total.Replayed += stats.Replayed
+				total.Failed += stats.Failed
+				if err != nil {
+					return fmt.Errorf("failed to replay %s: %w", file, err)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s: replayed %d, rejected %d\n", file, stats.Replayed, stats.Failed)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Replayed %d documents from %d files\n", total.Replayed, len(files))
+			if total.Failed > 0 {
+				return fmt.Errorf("%d documents were rejected again", total.Failed)
+			}
+			return nil
+		},
+	}
+	command.Flags().StringVar(&dir, "path", "", "Directory containing dead-letter files (defaults to apm-server.dead_letter.path)")
+	return command
+}
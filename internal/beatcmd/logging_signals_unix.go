@@ -0,0 +1,58 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !windows
+
+package beatcmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/elastic/apm-server/internal/logs"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// handleLogLevelSignals enables debug logging for all selectors on SIGUSR1,
+// and reverts it on SIGUSR2, until ctx is cancelled. Debug logging enabled
+// by SIGUSR1 is reverted automatically after logs.DefaultRevertAfter.
+func handleLogLevelSignals(ctx context.Context, logger *logp.Logger) error {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(c)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case sig := <-c:
+			logger.Infof("received %s", sig)
+			if sig == syscall.SIGUSR2 {
+				logs.RevertLevelOverride()
+				continue
+			}
+			if _, err := logs.SetLevelOverride(
+				zapcore.DebugLevel, nil, logs.DefaultRevertAfter,
+			); err != nil {
+				logger.Errorf("failed to enable debug logging: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package beatcmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const prometheusMetricsPath = "/metrics"
+
+// prometheusConfig holds configuration for serving APM Server's own
+// metrics in the Prometheus and OpenMetrics exposition formats.
+type prometheusConfig struct {
+	Enabled bool   `config:"enabled"`
+	Host    string `config:"host"`
+	Port    int    `config:"port"`
+}
+
+func defaultPrometheusConfig() prometheusConfig {
+	return prometheusConfig{
+		Host: "localhost",
+		Port: 9464,
+	}
+}
+
+// prometheusMetrics exposes metrics recorded with the OpenTelemetry
+// MeterProvider on a dedicated HTTP listener, for scraping by Prometheus.
+type prometheusMetrics struct {
+	addr     string
+	registry *prometheus.Registry
+	reader   sdkmetric.Reader
+}
+
+// newPrometheusMetrics returns a new prometheusMetrics for cfg, or nil if
+// the Prometheus metrics endpoint is not enabled. The returned reader must
+// be registered with the MeterProvider.
+func newPrometheusMetrics(cfg *config.C) (*prometheusMetrics, error) {
+	promConfig := defaultPrometheusConfig()
+	if cfg != nil {
+		if err := cfg.Unpack(&promConfig); err != nil {
+			return nil, fmt.Errorf("failed to unpack http.prometheus config: %w", err)
+		}
+	}
+	if !promConfig.Enabled {
+		return nil, nil
+	}
+	registry := prometheus.NewRegistry()
+	reader, err := otelprometheus.New(otelprometheus.WithRegisterer(registry))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Prometheus exporter: %w", err)
+	}
+	return &prometheusMetrics{
+		addr:     net.JoinHostPort(promConfig.Host, strconv.Itoa(promConfig.Port)),
+		registry: registry,
+		reader:   reader,
+	}, nil
+}
+
+// serve serves metrics on lis until ctx is cancelled.
+func (p *prometheusMetrics) serve(ctx context.Context, lis net.Listener, logger *logp.Logger) error {
+	mux := http.NewServeMux()
+	mux.Handle(prometheusMetricsPath, promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{
+		EnableOpenMetrics: true,
+		ErrorLog:          promErrorLogger{logger},
+	}))
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	logger.Infof("Serving Prometheus metrics on http://%s%s", lis.Addr(), prometheusMetricsPath)
+	if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// promErrorLogger adapts a logp.Logger to promhttp.Logger.
+type promErrorLogger struct {
+	logger *logp.Logger
+}
+
+func (l promErrorLogger) Println(v ...interface{}) {
+	l.logger.Error(v...)
+}
@@ -0,0 +1,98 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package beatcmd
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestPrometheusMetricsDisabled(t *testing.T) {
+	promMetrics, err := newPrometheusMetrics(nil)
+	require.NoError(t, err)
+	assert.Nil(t, promMetrics)
+
+	promMetrics, err = newPrometheusMetrics(config.MustNewConfigFrom(map[string]interface{}{
+		"enabled": false,
+	}))
+	require.NoError(t, err)
+	assert.Nil(t, promMetrics)
+}
+
+func TestPrometheusMetricsConfig(t *testing.T) {
+	promMetrics, err := newPrometheusMetrics(config.MustNewConfigFrom(map[string]interface{}{
+		"enabled": true,
+	}))
+	require.NoError(t, err)
+	require.NotNil(t, promMetrics)
+	assert.Equal(t, "localhost:9464", promMetrics.addr)
+
+	promMetrics, err = newPrometheusMetrics(config.MustNewConfigFrom(map[string]interface{}{
+		"enabled": true,
+		"host":    "0.0.0.0",
+		"port":    1234,
+	}))
+	require.NoError(t, err)
+	require.NotNil(t, promMetrics)
+	assert.Equal(t, "0.0.0.0:1234", promMetrics.addr)
+}
+
+func TestPrometheusMetricsServe(t *testing.T) {
+	promMetrics, err := newPrometheusMetrics(config.MustNewConfigFrom(map[string]interface{}{
+		"enabled": true,
+	}))
+	require.NoError(t, err)
+
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(promMetrics.reader))
+	defer meterProvider.Shutdown(context.Background())
+	counter, err := meterProvider.Meter("test").Int64Counter("http.server.request.count")
+	require.NoError(t, err)
+	counter.Add(context.Background(), 3)
+
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	errch := make(chan error, 1)
+	go func() { errch <- promMetrics.serve(ctx, lis, logptest.NewTestingLogger(t, "")) }()
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+lis.Addr().String()+"/metrics", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "application/openmetrics-text")
+	assert.Contains(t, string(body), "http_server_request_count_total{")
+	assert.Contains(t, string(body), "# EOF")
+
+	cancel()
+	assert.NoError(t, <-errch)
+}
@@ -25,6 +25,7 @@ import (
 
 	"go.elastic.co/apm/module/apmotel/v2"
 	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 
@@ -70,6 +71,10 @@ type RunnerParams struct {
 
 	MetricsGatherer *apmotel.Gatherer
 
+	// MetricReader holds an sdkmetric.Reader that can be used for
+	// collecting the metrics registered through MeterProvider.
+	MetricReader sdkmetric.Reader
+
 	BeatMonitoring beat.Monitoring
 }
 
@@ -81,7 +86,7 @@ type Runner interface {
 
 // NewReloader returns a new Reloader which creates Runners using the provided
 // beat.Info and NewRunnerFunc.
-func NewReloader(info beat.Info, registry *reload.Registry, newRunner NewRunnerFunc, meterProvider metric.MeterProvider, metricGatherer *apmotel.Gatherer, tracerProvider trace.TracerProvider, beatMonitoring beat.Monitoring) (*Reloader, error) {
+func NewReloader(info beat.Info, registry *reload.Registry, newRunner NewRunnerFunc, meterProvider metric.MeterProvider, metricGatherer *apmotel.Gatherer, metricReader sdkmetric.Reader, tracerProvider trace.TracerProvider, beatMonitoring beat.Monitoring) (*Reloader, error) {
 	r := &Reloader{
 		info:      info,
 		logger:    info.Logger,
@@ -91,6 +96,7 @@ func NewReloader(info beat.Info, registry *reload.Registry, newRunner NewRunnerF
 		tracerProvider: tracerProvider,
 		meterProvider:  meterProvider,
 		metricGatherer: metricGatherer,
+		metricReader:   metricReader,
 		beatMonitoring: beatMonitoring,
 	}
 	if err := registry.RegisterList(reload.InputRegName, reloadableListFunc(r.reloadInputs)); err != nil {
@@ -115,6 +121,7 @@ type Reloader struct {
 	tracerProvider trace.TracerProvider
 	meterProvider  metric.MeterProvider
 	metricGatherer *apmotel.Gatherer
+	metricReader   sdkmetric.Reader
 	beatMonitoring beat.Monitoring
 
 	runner     Runner
@@ -270,6 +277,7 @@ func (r *Reloader) reload(inputConfig, outputConfig, apmTracingConfig *config.C)
 		TracerProvider:  r.tracerProvider,
 		MeterProvider:   r.meterProvider,
 		MetricsGatherer: r.metricGatherer,
+		MetricReader:    r.metricReader,
 		BeatMonitoring:  r.beatMonitoring,
 	})
 	if err != nil {
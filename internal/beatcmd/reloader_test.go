@@ -75,7 +75,7 @@ func TestReloader(t *testing.T) {
 			<-ctx.Done()
 			return nil
 		}), nil
-	}, nil, nil, nil, beat.NewMonitoring())
+	}, nil, nil, nil, nil, beat.NewMonitoring())
 	require.NoError(t, err)
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -163,7 +163,7 @@ func TestReloaderNewRunnerParams(t *testing.T) {
 			<-ctx.Done()
 			return nil
 		}), nil
-	}, nil, nil, nil, beat.NewMonitoring())
+	}, nil, nil, nil, nil, beat.NewMonitoring())
 	require.NoError(t, err)
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -0,0 +1,205 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package beater
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/elastic/apm-server/internal/agentcfg"
+	"github.com/elastic/apm-server/internal/beater/admin"
+	"github.com/elastic/apm-server/internal/beater/config"
+	"github.com/elastic/apm-server/internal/beater/drain"
+	"github.com/elastic/apm-server/internal/beater/middleware"
+	"github.com/elastic/apm-server/internal/capture"
+	"github.com/elastic/apm-server/internal/logs"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// listenAdmin starts the listener for the admin API, returning nil
+// if the admin API is disabled.
+func listenAdmin(cfg *config.Config, logger *logp.Logger) (*serverListener, error) {
+	if !cfg.Admin.Enabled {
+		return nil, nil
+	}
+	host := cfg.Admin.Host
+	if url, err := url.Parse(host); err != nil || url.Scheme != "unix" {
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, config.DefaultAdminPort)
+		}
+	}
+	listener, err := listen(cfg, host, 0, logger.With(logp.String("listener", "admin")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to start admin listener: %w", err)
+	}
+	return &serverListener{
+		Listener: listener,
+		name:     "admin",
+		host:     host,
+		tls:      cfg.Admin.TLS,
+	}, nil
+}
+
+// runAdminServer serves the admin API on listener until ctx is cancelled.
+func (s *Runner) runAdminServer(ctx context.Context, listener serverListener, registry *admin.Registry) error {
+	handler := admin.NewHandler(registry, s.config.Admin.SecretToken, s.logger)
+	server, err := newHTTPServer(s.logger, s.config, handler, listener)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		stopctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+		defer cancel()
+		server.stop(stopctx)
+	}()
+	if err := server.start(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// registerAdminOperations registers admin operations for the server's
+// components. Operations for optional components, such as the source map
+// cache and tail-based sampling, are registered where they are created.
+func registerAdminOperations(
+	registry *admin.Registry,
+	drainer *drain.Drainer,
+	rumKillSwitch *middleware.KillSwitch,
+	agentConfigFetcher *agentcfg.ElasticsearchFetcher,
+	capturer *capture.Capturer,
+) {
+	registry.Register(
+		"agent_config.refresh",
+		"Refresh the agent configuration cache from Elasticsearch.",
+		func(ctx context.Context, _ url.Values) (any, error) {
+			return nil, agentConfigFetcher.Refresh(ctx)
+		},
+	)
+	registry.Register(
+		"intake.capture.start",
+		"Capture intake requests matching all of the given service.name, agent.name, "+
+			"client.ip and api_key.id for the given duration (default 5m), "+
+			"along with the resulting errors, replacing any capture in progress.",
+		func(_ context.Context, params url.Values) (any, error) {
+			filter := capture.Filter{
+				ServiceName: params.Get("service.name"),
+				AgentName:   params.Get("agent.name"),
+				APIKeyID:    params.Get("api_key.id"),
+			}
+			if params.Has("client.ip") {
+				ip, err := netip.ParseAddr(params.Get("client.ip"))
+				if err != nil {
+					return nil, fmt.Errorf("%w: client.ip: %w", admin.ErrInvalidParameter, err)
+				}
+				filter.ClientIP = ip
+			}
+			duration := capture.DefaultDuration
+			if params.Has("duration") {
+				d, err := time.ParseDuration(params.Get("duration"))
+				if err != nil {
+					return nil, fmt.Errorf("%w: duration: %w", admin.ErrInvalidParameter, err)
+				}
+				duration = d
+			}
+			status, err := capturer.Start(filter, duration)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", admin.ErrInvalidParameter, err)
+			}
+			return status, nil
+		},
+	)
+	registry.Register(
+		"intake.capture.status",
+		"Return the status of intake request capture.",
+		func(context.Context, url.Values) (any, error) {
+			return capturer.Status(), nil
+		},
+	)
+	registry.Register(
+		"intake.capture.stop",
+		"Stop capturing intake requests.",
+		func(context.Context, url.Values) (any, error) {
+			return capturer.Stop(), nil
+		},
+	)
+	registry.Register(
+		"logging.revert",
+		"Revert any log level override set with logging.set_level.",
+		func(context.Context, url.Values) (any, error) {
+			return logs.RevertLevelOverride(), nil
+		},
+	)
+	registry.Register(
+		"logging.set_level",
+		"Set the log level (level=debug|info|warn|error) and/or the comma-separated "+
+			"debug selectors (selectors=a,b) until reverted, automatically after "+
+			"revert_after (default 15m, at most 24h), and return the resulting configuration.",
+		func(_ context.Context, params url.Values) (any, error) {
+			level := logp.GetLevel()
+			if params.Has("level") {
+				if err := level.UnmarshalText([]byte(params.Get("level"))); err != nil {
+					return nil, fmt.Errorf("%w: level: %w", admin.ErrInvalidParameter, err)
+				}
+			}
+			selectors := logs.RuntimeSelectors()
+			if params.Has("selectors") {
+				selectors = strings.Split(params.Get("selectors"), ",")
+			}
+			revertAfter := logs.DefaultRevertAfter
+			if params.Has("revert_after") {
+				d, err := time.ParseDuration(params.Get("revert_after"))
+				if err != nil {
+					return nil, fmt.Errorf("%w: revert_after: %w", admin.ErrInvalidParameter, err)
+				}
+				revertAfter = d
+			}
+			state, err := logs.SetLevelOverride(level, selectors, revertAfter)
+			if err != nil {
+				return nil, fmt.Errorf("%w: revert_after: %w", admin.ErrInvalidParameter, err)
+			}
+			return state, nil
+		},
+	)
+	registry.Register(
+		"rum.kill_switch",
+		"Enable or disable the RUM endpoints (enabled=true|false).",
+		func(_ context.Context, params url.Values) (any, error) {
+			enabled, err := admin.ParseBool(params, "enabled")
+			if err != nil {
+				return nil, err
+			}
+			rumKillSwitch.SetEnabled(enabled)
+			return map[string]bool{"enabled": enabled}, nil
+		},
+	)
+	registry.Register(
+		"server.drain",
+		"Stop reporting ready and reject new intake requests, finishing in-flight requests.",
+		func(context.Context, url.Values) (any, error) {
+			drainer.Drain()
+			return map[string]int64{"in_flight": drainer.InFlight()}, nil
+		},
+	)
+}
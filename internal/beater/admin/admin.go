@@ -0,0 +1,113 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package admin provides an authenticated API for performing operations
+// on a running APM Server, such as flushing caches or changing the log
+// level, without reloading configuration or restarting the server.
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidParameter is returned, wrapped, by operations when they are
+// invoked with missing or invalid parameters.
+var ErrInvalidParameter = errors.New("invalid parameter")
+
+// OperationFunc performs an admin operation with the given parameters,
+// returning a JSON-encodable result.
+type OperationFunc func(ctx context.Context, params url.Values) (any, error)
+
+// Operation describes a registered admin operation.
+type Operation struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	fn OperationFunc
+}
+
+// Registry holds the admin operations which may be invoked through the
+// admin API.
+//
+// Registry is safe for concurrent use.
+type Registry struct {
+	mu         sync.RWMutex
+	operations map[string]Operation
+}
+
+// NewRegistry returns a new Registry with no operations.
+func NewRegistry() *Registry {
+	return &Registry{operations: make(map[string]Operation)}
+}
+
+// Register registers an operation with the given name and description.
+//
+// Register panics if an operation with the same name is already registered.
+func (r *Registry) Register(name, description string, fn OperationFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.operations[name]; ok {
+		panic(fmt.Sprintf("admin operation %q already registered", name))
+	}
+	r.operations[name] = Operation{Name: name, Description: description, fn: fn}
+}
+
+// Operations returns the registered operations, sorted by name.
+func (r *Registry) Operations() []Operation {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	operations := make([]Operation, 0, len(r.operations))
+	for _, op := range r.operations {
+		operations = append(operations, op)
+	}
+	slices.SortFunc(operations, func(a, b Operation) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return operations
+}
+
+// Lookup returns the operation with the given name, if registered.
+func (r *Registry) Lookup(name string) (Operation, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	op, ok := r.operations[name]
+	return op, ok
+}
+
+// Invoke performs the operation with the given parameters.
+func (op Operation) Invoke(ctx context.Context, params url.Values) (any, error) {
+	return op.fn(ctx, params)
+}
+
+// ParseBool parses the boolean parameter with the given name, returning
+// an error wrapping ErrInvalidParameter if it is missing or invalid.
+func ParseBool(params url.Values, name string) (bool, error) {
+	v := params.Get(name)
+	switch strings.ToLower(v) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("%w: %s must be true or false, got %q", ErrInvalidParameter, name, v)
+}
@@ -0,0 +1,120 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package admin_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/elastic/apm-server/internal/beater/admin"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestHandler(t *testing.T) {
+	registry := admin.NewRegistry()
+	registry.Register("toggle", "toggles something", func(ctx context.Context, params url.Values) (any, error) {
+		enabled, err := admin.ParseBool(params, "enabled")
+		if err != nil {
+			return nil, err
+		}
+		return map[string]bool{"enabled": enabled}, nil
+	})
+	registry.Register("broken", "always fails", func(context.Context, url.Values) (any, error) {
+		return nil, errors.New("boom")
+	})
+	assert.Panics(t, func() { registry.Register("broken", "", nil) })
+
+	core, observed := observer.New(zapcore.DebugLevel)
+	logger := logptest.NewTestingLogger(t, "", zap.WrapCore(func(in zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(in, core)
+	}))
+	h := admin.NewHandler(registry, "abc123", logger)
+
+	serve := func(method, target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(http.MethodGet, admin.OperationsPath, "abc123")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"operations":[
+		{"name":"broken","description":"always fails"},
+		{"name":"toggle","description":"toggles something"}
+	]}`, w.Body.String())
+
+	w = serve(http.MethodGet, admin.OperationsPath, "wrong")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	for _, test := range []struct {
+		target  string
+		token   string
+		status  int
+		body    string
+		outcome string
+	}{{
+		target: "/toggle?enabled=true", token: "abc123", status: http.StatusOK,
+		body: `{"operation":"toggle","result":{"enabled":true}}`, outcome: "success",
+	}, {
+		target: "/toggle?enabled=maybe", token: "abc123", status: http.StatusBadRequest,
+		body: `{"error":"invalid parameter: enabled must be true or false, got \"maybe\""}`, outcome: "failure",
+	}, {
+		target: "/broken", token: "abc123", status: http.StatusInternalServerError,
+		body: `{"error":"boom"}`, outcome: "failure",
+	}, {
+		target: "/unknown", token: "abc123", status: http.StatusNotFound,
+		body: `{"error":"unknown operation"}`, outcome: "failure",
+	}, {
+		target: "/toggle?enabled=true", token: "", status: http.StatusUnauthorized,
+		body: `{"error":"authentication failed: missing or invalid secret token"}`, outcome: "failure",
+	}} {
+		t.Run(fmt.Sprintf("%s_%d", strings.TrimPrefix(test.target, "/"), test.status), func(t *testing.T) {
+			w := serve(http.MethodPost, admin.OperationsPath+test.target, test.token)
+			assert.Equal(t, test.status, w.Code)
+			assert.JSONEq(t, test.body, w.Body.String())
+
+			var entries []observer.LoggedEntry
+			for _, entry := range observed.TakeAll() {
+				if entry.LoggerName == "audit" {
+					entries = append(entries, entry)
+				}
+			}
+			require.Len(t, entries, 1)
+			fields := entries[0].ContextMap()
+			assert.Equal(t, test.outcome, fields["event.outcome"])
+			assert.Equal(t, int64(test.status), fields["http.response.status_code"])
+			assert.Equal(t, strings.SplitN(strings.TrimPrefix(test.target, "/"), "?", 2)[0], fields["event.action"])
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/elastic/apm-server/internal/beater/auth"
+	"github.com/elastic/apm-server/internal/beater/headers"
+	"github.com/elastic/apm-server/internal/logs"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const (
+	// OperationsPath is the path for listing admin operations.
+	OperationsPath = "/admin/v1/operations"
+
+	// operationPathPrefix is the prefix of the path for invoking an
+	// admin operation, followed by the operation name.
+	operationPathPrefix = OperationsPath + "/"
+)
+
+// NewHandler returns an http.Handler serving the admin API for the
+// operations registered in registry.
+//
+// All requests must carry the secret token in a Bearer Authorization
+// header. Operations are listed with GET OperationsPath, and invoked
+// with POST OperationsPath/<name>, passing parameters in the query
+// string or form body. Every invocation, including those rejected due
+// to failed authentication, is recorded in the audit log.
+func NewHandler(registry *Registry, secretToken string, logger *logp.Logger) http.Handler {
+	h := &handler{
+		registry:    registry,
+		secretToken: secretToken,
+		logger:      logger.Named(logs.Admin),
+		auditLogger: logger.Named(logs.Audit),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+OperationsPath, h.listOperations)
+	mux.HandleFunc("POST "+operationPathPrefix+"{name}", h.invokeOperation)
+	return mux
+}
+
+type handler struct {
+	registry    *Registry
+	secretToken string
+	logger      *logp.Logger
+	auditLogger *logp.Logger
+}
+
+func (h *handler) authorized(r *http.Request) bool {
+	kind, token := auth.ParseAuthorizationHeader(r.Header.Get(headers.Authorization))
+	return kind == headers.Bearer && subtle.ConstantTimeCompare([]byte(token), []byte(h.secretToken)) == 1
+}
+
+func (h *handler) listOperations(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		h.writeError(w, http.StatusUnauthorized, errUnauthorized)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, map[string]any{"operations": h.registry.Operations()})
+}
+
+func (h *handler) invokeOperation(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	name := r.PathValue("name")
+	status, result, err := h.invoke(r, name)
+
+	auditLogger := h.auditLogger.With(
+		logp.String("event.action", name),
+		logp.String("source.address", r.RemoteAddr),
+		logp.String("user_agent.original", r.UserAgent()),
+		logp.Any("admin.params", r.Form),
+		logp.Int("http.response.status_code", status),
+		logp.Duration("event.duration", time.Since(start)),
+	)
+	if err != nil {
+		auditLogger.With(
+			logp.String("event.outcome", "failure"),
+			logp.Error(err),
+		).Warn("admin operation failed")
+		h.writeError(w, status, err)
+		return
+	}
+	auditLogger.With(logp.String("event.outcome", "success")).Info("admin operation succeeded")
+	h.writeJSON(w, status, map[string]any{"operation": name, "result": result})
+}
+
+// invoke authenticates the request and invokes the named operation,
+// returning the HTTP status code along with the result or error.
+func (h *handler) invoke(r *http.Request, name string) (int, any, error) {
+	if !h.authorized(r) {
+		return http.StatusUnauthorized, nil, errUnauthorized
+	}
+	op, ok := h.registry.Lookup(name)
+	if !ok {
+		return http.StatusNotFound, nil, errUnknownOperation
+	}
+	if err := r.ParseForm(); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	result, err := op.Invoke(r.Context(), r.Form)
+	if err != nil {
+		if errors.Is(err, ErrInvalidParameter) {
+			return http.StatusBadRequest, nil, err
+		}
+		return http.StatusInternalServerError, nil, err
+	}
+	return http.StatusOK, result, nil
+}
+
+var (
+	errUnauthorized     = errors.New("authentication failed: missing or invalid secret token")
+	errUnknownOperation = errors.New("unknown operation")
+)
+
+func (h *handler) writeError(w http.ResponseWriter, status int, err error) {
+	h.writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (h *handler) writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set(headers.ContentType, "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(body); err != nil {
+		h.logger.With(logp.Error(err)).Error("failed to write admin API response")
+	}
+}
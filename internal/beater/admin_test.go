@@ -0,0 +1,113 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package beater
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+
+	"github.com/elastic/apm-server/internal/beater/admin"
+	"github.com/elastic/apm-server/internal/beater/config"
+	"github.com/elastic/apm-server/internal/beater/drain"
+	"github.com/elastic/apm-server/internal/beater/middleware"
+	"github.com/elastic/apm-server/internal/capture"
+)
+
+func TestAdminServer(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Admin.Enabled = true
+	cfg.Admin.Host = "localhost:0"
+	cfg.Admin.SecretToken = "abc123"
+
+	logger := logptest.NewTestingLogger(t, "")
+	listener, err := listenAdmin(cfg, logger)
+	require.NoError(t, err)
+	require.NotNil(t, listener)
+	defer listener.Close()
+
+	drainer := drain.New(0)
+	rumKillSwitch := middleware.NewKillSwitch(true)
+	registry := admin.NewRegistry()
+	capturer, err := capture.New(capture.Config{
+		Dir: t.TempDir(), MaxFileSize: 1024, MaxFiles: 1, MaxBodySize: 1024, MaxDuration: time.Hour,
+	})
+	require.NoError(t, err)
+	defer capturer.Stop()
+	registerAdminOperations(registry, drainer, rumKillSwitch, nil, capturer)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runner := &Runner{config: cfg, logger: logger}
+	done := make(chan error, 1)
+	go func() { done <- runner.runAdminServer(ctx, *listener, registry) }()
+	defer func() {
+		cancel()
+		assert.NoError(t, <-done)
+	}()
+
+	post := func(path string) (int, string) {
+		req, err := http.NewRequest(http.MethodPost, "http://"+listener.Addr().String()+admin.OperationsPath+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer abc123")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := post("/rum.kill_switch?enabled=false")
+	assert.Equal(t, http.StatusOK, status, body)
+	assert.False(t, rumKillSwitch.Enabled())
+
+	status, body = post("/rum.kill_switch")
+	assert.Equal(t, http.StatusBadRequest, status, body)
+
+	status, body = post("/logging.set_level?level=debug&revert_after=48h")
+	assert.Equal(t, http.StatusBadRequest, status, body)
+
+	status, body = post("/intake.capture.start?duration=1m")
+	assert.Equal(t, http.StatusBadRequest, status, body) // empty filter
+
+	status, body = post("/intake.capture.start?agent.name=python&duration=1m")
+	assert.Equal(t, http.StatusOK, status, body)
+	assert.True(t, capturer.Status().Active)
+
+	status, body = post("/intake.capture.stop")
+	assert.Equal(t, http.StatusOK, status, body)
+	assert.False(t, capturer.Status().Active)
+
+	status, body = post("/server.drain")
+	assert.Equal(t, http.StatusOK, status, body)
+	assert.JSONEq(t, `{"operation":"server.drain","result":{"in_flight":0}}`, body)
+	assert.True(t, drainer.IsDraining())
+}
+
+func TestListenAdminDisabled(t *testing.T) {
+	listener, err := listenAdmin(config.DefaultConfig(), logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	assert.Nil(t, listener)
+}
@@ -0,0 +1,315 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package intake
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+	"hash/fnv"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/elastic/apm-data/input/elasticapm"
+)
+
+const (
+	validationErrorPrefix = "validation error: "
+	decodeErrorPrefix     = "decode error: data read error: "
+)
+
+var (
+	requiredFieldRegexp  = regexp.MustCompile(`^'([^']+)' required$`)
+	validationRuleRegexp = regexp.MustCompile(`^validation rule '([^']+)' violated`)
+	decodeFieldRegexp    = regexp.MustCompile(`^v\d+\.[A-Za-z]+\.([A-Z][A-Za-z0-9]*)$`)
+)
+
+// errorDetails describes an invalid event in an intake request.
+//
+// Path and Constraint are derived from the error message on a
+// best-effort basis, and are empty if they cannot be determined.
+type errorDetails struct {
+	// Line holds the 1-based line number of the invalid event in the
+	// request body, or 0 if it is unknown.
+	Line int `json:"line,omitempty"`
+
+	// EventType holds the type of the invalid event, such as "span",
+	// taken from the first key of the event.
+	EventType string `json:"event_type,omitempty"`
+
+	// Path holds the dot-separated JSON path of the invalid field.
+	Path string `json:"path,omitempty"`
+
+	// Constraint holds the constraint violated by the invalid field,
+	// such as "required" or "maxLength(1024)".
+	Constraint string `json:"constraint,omitempty"`
+}
+
+// streamErrors returns the errors in streamResult followed by
+// streamErr, if non-nil.
+func streamErrors(streamResult elasticapm.Result, streamErr error) []error {
+	errs := streamResult.Errors
+	if streamErr != nil {
+		errs = append(errs[:len(errs):len(errs)], streamErr)
+	}
+	return errs
+}
+
+// describeErrors returns errorDetails for each of errs. The details
+// for errors other than elasticapm.InvalidInputError are nil.
+//
+// If lines is non-nil, it is used to determine the line numbers of
+// invalid events.
+func describeErrors(errs []error, lines *lineIndex) []*errorDetails {
+	details := make([]*errorDetails, len(errs))
+	for i, err := range errs {
+		var invalidInput *elasticapm.InvalidInputError
+		if !errors.As(err, &invalidInput) {
+			continue
+		}
+		d := describeInvalidInput(invalidInput.Message, invalidInput.Document)
+		if lines != nil {
+			d.Line = lines.errorLine(i, invalidInput)
+		}
+		details[i] = &d
+	}
+	return details
+}
+
+// describeInvalidInput returns errorDetails for an invalid event,
+// given its error message and document.
+func describeInvalidInput(message, document string) errorDetails {
+	d := errorDetails{EventType: eventType(document)}
+	switch {
+	case strings.HasPrefix(message, validationErrorPrefix):
+		// Validation errors have the form "validation error: a: b: 'c' required",
+		// or "validation error: a: b: 'c': validation rule 'rule' violated".
+		var path []string
+		segments := strings.Split(strings.TrimPrefix(message, validationErrorPrefix), ": ")
+		for i, segment := range segments {
+			if name, ok := strings.CutPrefix(segment, "'"); ok && strings.Index(name, "'") == len(name)-1 {
+				path = append(path, name[:len(name)-1])
+				continue
+			}
+			if !strings.ContainsAny(segment, " '") {
+				path = append(path, segment)
+				continue
+			}
+			if m := requiredFieldRegexp.FindStringSubmatch(segment); m != nil {
+				path = append(path, m[1])
+				d.Constraint = "required"
+			} else if m := validationRuleRegexp.FindStringSubmatch(segment); m != nil {
+				d.Constraint = m[1]
+			} else {
+				d.Constraint = strings.Join(segments[i:], ": ")
+			}
+			break
+		}
+		d.Path = strings.Join(path, ".")
+	case strings.HasPrefix(message, decodeErrorPrefix):
+		// Decode errors have the form "decode error: data read error:
+		// v2.spanRoot.Span: v2.span.TraceID: ReadString: ..., error found in ...",
+		// identifying fields by their Go struct field names.
+		var path []string
+		segments := strings.Split(strings.TrimPrefix(message, decodeErrorPrefix), ": ")
+		for i, segment := range segments {
+			m := decodeFieldRegexp.FindStringSubmatch(segment)
+			if m == nil {
+				constraint := strings.Join(segments[i:], ": ")
+				constraint, _, _ = strings.Cut(constraint, ", error found in ")
+				d.Constraint = constraint
+				break
+			}
+			if i == 0 && strings.Contains(segment, "Root.") {
+				// The root object's field is the event type.
+				path = append(path, d.EventType)
+				continue
+			}
+			path = append(path, snakeCase(m[1]))
+		}
+		if len(path) > 0 && path[0] != "" {
+			d.Path = strings.Join(path, ".")
+		}
+	}
+	return d
+}
+
+// eventType returns the first key of the JSON object in document,
+// in the same way that the intake processor identifies event types.
+func eventType(document string) string {
+	i := strings.IndexAny(document, `"'`)
+	if i == -1 {
+		return ""
+	}
+	key := document[i+1:]
+	end := strings.IndexByte(key, document[i])
+	if end == -1 {
+		return ""
+	}
+	return key[:end]
+}
+
+// snakeCase converts a Go field name such as "TraceID" to the
+// equivalent JSON field name, such as "trace_id".
+func snakeCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// lineIndex is an io.Writer which records the hash and length of each
+// line written to it, for identifying the line numbers of documents
+// reported in errors without retaining the request body.
+//
+// lineIndex is written to as the stream decoder reads the request body.
+// The decoder only reads more once it has decoded every complete line
+// read so far, so when Write is called, the errors for those lines have
+// been reported. Write matches them to their lines if errors is non-nil,
+// and then drops the lines. Memory use is therefore bounded by the
+// decoder's buffer size, not by the length of the stream.
+type lineIndex struct {
+	// errors, if non-nil, returns the errors reported so far, in order.
+	errors func() []error
+
+	// errorLines holds the line numbers of the errors matched
+	// during Write, in the order they were reported.
+	errorLines []int
+
+	lines []indexedLine
+	hash  hash.Hash64
+	len   int
+
+	// dropped holds the number of lines dropped from the start of lines.
+	dropped int
+
+	// next holds the index of the line following the line
+	// most recently found, as errors are reported in order.
+	next int
+}
+
+type indexedLine struct {
+	sum uint64
+	len int
+}
+
+func (ix *lineIndex) Write(p []byte) (int, error) {
+	if ix.hash == nil {
+		ix.hash = fnv.New64a()
+	}
+	if ix.errors != nil {
+		ix.resolveErrors()
+	}
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i == -1 {
+			ix.hash.Write(p)
+			ix.len += len(p)
+			break
+		}
+		ix.hash.Write(p[:i])
+		ix.len += i
+		ix.endLine()
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// resolveErrors matches the errors reported since it was last called
+// to their lines, and drops the lines that can no longer be matched.
+func (ix *lineIndex) resolveErrors() {
+	for _, err := range ix.errors()[len(ix.errorLines):] {
+		var line int
+		var invalidInput *elasticapm.InvalidInputError
+		if errors.As(err, &invalidInput) {
+			if line = ix.findLine(invalidInput.Document, invalidInput.TooLarge); line == 0 {
+				// The line has not been completely written yet, as
+				// happens for lines that are too large: keep the lines
+				// following the line most recently found, and retry on
+				// the next write.
+				ix.drop(ix.next)
+				return
+			}
+		}
+		ix.errorLines = append(ix.errorLines, line)
+	}
+	ix.drop(len(ix.lines))
+}
+
+func (ix *lineIndex) drop(n int) {
+	ix.dropped += n
+	ix.lines = append(ix.lines[:0], ix.lines[n:]...)
+	ix.next = max(ix.next-n, 0)
+}
+
+func (ix *lineIndex) endLine() {
+	ix.lines = append(ix.lines, indexedLine{sum: ix.hash.Sum64(), len: ix.len})
+	ix.hash.Reset()
+	ix.len = 0
+}
+
+// errorLine returns the 1-based line number of the document of the i'th
+// error reported, or 0 if it is unknown.
+func (ix *lineIndex) errorLine(i int, err *elasticapm.InvalidInputError) int {
+	if i < len(ix.errorLines) {
+		return ix.errorLines[i]
+	}
+	return ix.find(err.Document, err.TooLarge)
+}
+
+// find returns the 1-based line number of the first line matching
+// document following the line most recently found, or 0 if there is
+// no such line. If tooLarge is true, document holds a prefix of the
+// line, and the first longer line is matched.
+//
+// find must only be called once the whole request body has been written.
+func (ix *lineIndex) find(document string, tooLarge bool) int {
+	if ix.len > 0 {
+		// The final line is not newline-terminated.
+		ix.endLine()
+	}
+	return ix.findLine(document, tooLarge)
+}
+
+func (ix *lineIndex) findLine(document string, tooLarge bool) int {
+	var sum uint64
+	if !tooLarge {
+		h := fnv.New64a()
+		h.Write([]byte(document))
+		sum = h.Sum64()
+	}
+	for i := ix.next; i < len(ix.lines); i++ {
+		line := ix.lines[i]
+		if (tooLarge && line.len > len(document)) || (!tooLarge && line.len == len(document) && line.sum == sum) {
+			ix.next = i + 1
+			return ix.dropped + i + 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,136 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package intake
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-data/input/elasticapm"
+)
+
+func TestDescribeInvalidInput(t *testing.T) {
+	for name, tc := range map[string]struct {
+		message  string
+		document string
+		expected errorDetails
+	}{
+		"required": {
+			message:  "validation error: transaction: 'span_count' required",
+			document: `{"transaction":{}}`,
+			expected: errorDetails{EventType: "transaction", Path: "transaction.span_count", Constraint: "required"},
+		},
+		"validation_rule": {
+			message:  "validation error: span: context: 'tags': validation rule 'inputTypesVals(string;bool;number)' violated for key a",
+			document: `{"span":{}}`,
+			expected: errorDetails{EventType: "span", Path: "span.context.tags", Constraint: "inputTypesVals(string;bool;number)"},
+		},
+		"other_validation": {
+			message:  "validation error: error: requires at least one of the fields 'exception;log'",
+			document: `{"error":{}}`,
+			expected: errorDetails{EventType: "error", Path: "error", Constraint: "requires at least one of the fields 'exception;log'"},
+		},
+		"decode": {
+			message: "decode error: data read error: v2.metricsetRoot.Metricset: v2.metricset.Samples: " +
+				"v2.metricsetSampleValue.Value: readNumberAsString: invalid number, error found in #10 byte of ...",
+			document: `{"metricset":{}}`,
+			expected: errorDetails{EventType: "metricset", Path: "metricset.samples.value", Constraint: "readNumberAsString: invalid number"},
+		},
+		"decode_snake_case": {
+			message:  `decode error: data read error: v2.transactionRoot.Transaction: v2.transaction.TraceID: ReadString: expects " or n, but found 1`,
+			document: `{"transaction":{}}`,
+			expected: errorDetails{EventType: "transaction", Path: "transaction.trace_id", Constraint: `ReadString: expects " or n, but found 1`},
+		},
+		"unrecognized": {
+			message:  `did not recognize object type: "tennis-court"`,
+			document: `{"tennis-court":{}}`,
+			expected: errorDetails{EventType: "tennis-court"},
+		},
+		"invalid_json": {
+			message:  "decode error: data read error: v2.metadataRoot.Metadata: v2.metadata.readFieldHash: expect :,",
+			document: `not json`,
+			expected: errorDetails{Constraint: "v2.metadata.readFieldHash: expect :,"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, describeInvalidInput(tc.message, tc.document))
+		})
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	for in, expected := range map[string]string{
+		"Samples":     "samples",
+		"TraceID":     "trace_id",
+		"SpanCount":   "span_count",
+		"HTTPRequest": "http_request",
+		"Ipv4":        "ipv4",
+	} {
+		assert.Equal(t, expected, snakeCase(in), in)
+	}
+}
+
+func TestLineIndex(t *testing.T) {
+	var ix lineIndex
+	body := "metadata\nline\n\n" + strings.Repeat("x", 10) + "\nline\nlast"
+	// Write in small chunks, as lines may span writes.
+	for len(body) > 0 {
+		n := min(len(body), 3)
+		ix.Write([]byte(body[:n]))
+		body = body[n:]
+	}
+	assert.Equal(t, 2, ix.find("line", false))
+	assert.Equal(t, 4, ix.find("xxxxx", true)) // too large, truncated
+	assert.Equal(t, 5, ix.find("line", false))
+	assert.Equal(t, 0, ix.find("line", false))
+	assert.Equal(t, 6, ix.find("last", false))
+}
+
+func TestLineIndexDropsDecodedLines(t *testing.T) {
+	var errs []error
+	ix := lineIndex{errors: func() []error { return errs }}
+	invalid := func(document string, tooLarge bool) error {
+		return &elasticapm.InvalidInputError{Document: document, TooLarge: tooLarge}
+	}
+
+	// Each write follows the decoding of the lines written before it.
+	ix.Write([]byte("metadata\nvalid\ninvalid\n"))
+	errs = append(errs, invalid("invalid", false))
+	ix.Write([]byte("valid\n" + strings.Repeat("x", 6)))
+	assert.Len(t, ix.lines, 1)
+	errs = append(errs, invalid(strings.Repeat("x", 8), true)) // too large, not yet terminated
+	ix.Write([]byte(strings.Repeat("x", 6) + "\ninvalid\n"))
+	assert.Len(t, ix.lines, 3)
+	errs = append(errs, invalid("invalid", false))
+	for range 100 {
+		ix.Write([]byte("valid\n"))
+	}
+	assert.Len(t, ix.lines, 1)
+	errs = append(errs, invalid("last", false))
+	ix.Write([]byte("last"))
+
+	assert.Equal(t, []int{3, 5, 6}, ix.errorLines)
+	for i, line := range []int{3, 5, 6, 107} {
+		var invalidInput *elasticapm.InvalidInputError
+		require.ErrorAs(t, errs[i], &invalidInput)
+		assert.Equal(t, line, ix.errorLine(i, invalidInput))
+	}
+}
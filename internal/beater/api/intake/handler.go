@@ -21,24 +21,35 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
 
 	"github.com/elastic/apm-data/input/elasticapm"
 	"github.com/elastic/apm-data/model/modelpb"
 	"github.com/elastic/apm-data/model/modelprocessor"
 	"github.com/elastic/apm-server/internal/beater/auth"
+	"github.com/elastic/apm-server/internal/beater/drain"
 	"github.com/elastic/apm-server/internal/beater/headers"
 	"github.com/elastic/apm-server/internal/beater/ratelimit"
 	"github.com/elastic/apm-server/internal/beater/request"
+	"github.com/elastic/apm-server/internal/capture"
 	"github.com/elastic/apm-server/internal/publish"
+	"github.com/elastic/elastic-agent-libs/logp"
 )
 
 const (
 	batchSize = 10
+
+	// invalidEventLogBurst is the maximum number of invalid events
+	// logged at once, after which one is logged per second.
+	invalidEventLogBurst = 10
 )
 
 var (
@@ -53,13 +64,17 @@ var (
 type RequestMetadataFunc func(*request.Context) *modelpb.APMEvent
 
 // Handler returns a request.Handler for managing intake requests for backend and rum events.
-func Handler(mp metric.MeterProvider, tp trace.TracerProvider, handler elasticapm.StreamHandler, requestMetadataFunc RequestMetadataFunc, batchProcessor modelpb.BatchProcessor) request.Handler {
+//
+// If capturer is non-nil, requests matching its filter are captured along
+// with the resulting errors while capture is in progress.
+func Handler(mp metric.MeterProvider, tp trace.TracerProvider, handler elasticapm.StreamHandler, requestMetadataFunc RequestMetadataFunc, batchProcessor modelpb.BatchProcessor, capturer *capture.Capturer) request.Handler {
 	meter := mp.Meter("github.com/elastic/apm-server/internal/beater/api/intake")
 	eventsAccepted, _ := meter.Int64Counter("apm-server.processor.stream.accepted")
 	eventsInvalid, _ := meter.Int64Counter("apm-server.processor.stream.errors.invalid")
 	eventsTooLarge, _ := meter.Int64Counter("apm-server.processor.stream.errors.toolarge")
 
 	batchProcessor = modelprocessor.NewTracer("intake.ProcessBatch", batchProcessor, modelprocessor.WithTracerProvider(tp))
+	invalidEventLogLimiter := rate.NewLimiter(rate.Every(time.Second), invalidEventLogBurst)
 
 	return func(c *request.Context) {
 		if err := validateRequest(c); err != nil {
@@ -74,22 +89,103 @@ func Handler(mp metric.MeterProvider, tp trace.TracerProvider, handler elasticap
 			return
 		}
 
+		// If verbose errors are requested, index the lines of the
+		// request body to report the line numbers of invalid events.
 		var result elasticapm.Result
+		var lines *lineIndex
+		body := io.Reader(c.Request.Body)
+		if verbose, _ := strconv.ParseBool(c.Request.Header.Get(headers.VerboseErrors)); verbose {
+			lines = &lineIndex{errors: func() []error { return result.Errors }}
+			body = io.TeeReader(body, lines)
+		}
+
+		var apiKeyID string
+		if c.Authentication.APIKey != nil {
+			apiKeyID = c.Authentication.APIKey.ID
+		}
+		captured, body := capturer.Begin(c.Request.URL.Path, c.ClientIP, apiKeyID, body)
+
+		// Once the server is draining, the stream is stopped after the
+		// batch being processed, which is accepted. The remainder of
+		// the stream is not read, and the request is rejected so that
+		// the client knows not all events were accepted.
+		var stopped int
+		streamProcessor := modelpb.ProcessBatchFunc(func(ctx context.Context, b *modelpb.Batch) error {
+			err := batchProcessor.ProcessBatch(ctx, b)
+			if errors.Is(err, drain.ErrStopStream) {
+				stopped = len(*b)
+			}
+			return err
+		})
+
 		err := handler.HandleStream(
 			c.Request.Context(),
 			requestMetadataFunc(c),
-			c.Request.Body,
+			body,
 			batchSize,
-			batchProcessor,
+			streamProcessor,
 			&result,
 		)
+		if errors.Is(err, drain.ErrStopStream) {
+			result.Accepted += stopped
+			err = drain.ErrDraining
+		}
 		eventsAccepted.Add(context.Background(), int64(result.Accepted))
 		eventsInvalid.Add(context.Background(), int64(result.Invalid))
 		eventsTooLarge.Add(context.Background(), int64(result.TooLarge))
-		writeStreamResult(c, result, err)
+		errs := streamErrors(result, err)
+		details := describeErrors(errs, lines)
+		logInvalidEvents(c, invalidEventLogLimiter, errs, details)
+		if lines == nil {
+			// Details are only included in the response
+			// if verbose errors are requested.
+			details = nil
+		}
+		writeStreamResult(c, result, err, details)
+		if captured != nil {
+			captured.End(c.Result.StatusCode, result.Accepted, captureErrors(errs))
+		}
 	}
 }
 
+// logInvalidEvents logs the details of invalid events, limited by
+// limiter so that a misbehaving agent cannot flood the logs.
+func logInvalidEvents(c *request.Context, limiter *rate.Limiter, errs []error, details []*errorDetails) {
+	if c.Logger == nil {
+		return
+	}
+	for i, d := range details {
+		if d == nil || !limiter.Allow() {
+			continue
+		}
+		logger := c.Logger.With(
+			logp.String("error.message", errs[i].Error()),
+			logp.String("intake.event_type", d.EventType),
+		)
+		if d.Line > 0 {
+			logger = logger.With(logp.Int("intake.line", d.Line))
+		}
+		if d.Path != "" {
+			logger = logger.With(logp.String("intake.path", d.Path))
+		}
+		if d.Constraint != "" {
+			logger = logger.With(logp.String("intake.constraint", d.Constraint))
+		}
+		logger.Warn("invalid event")
+	}
+}
+
+// captureErrors returns the errors resulting from a captured request,
+// formatted as they are in the response.
+func captureErrors(errs []error) []capture.Error {
+	captureErrs := make([]capture.Error, len(errs))
+	for i, err := range errs {
+		_, jsonErr := processStreamError(err)
+		captureErrs[i] = capture.Error{Message: jsonErr.Message, Document: jsonErr.Document}
+	}
+	return captureErrs
+}
+
 func validateRequest(c *request.Context) error {
 	if c.Request.Method != http.MethodPost {
 		return errMethodNotAllowed
@@ -104,10 +200,13 @@ func validateRequest(c *request.Context) error {
 }
 
 func writeError(c *request.Context, err error) {
-	writeStreamResult(c, elasticapm.Result{}, err)
+	writeStreamResult(c, elasticapm.Result{}, err, nil)
 }
 
-func writeStreamResult(c *request.Context, streamResult elasticapm.Result, streamErr error) {
+// writeStreamResult writes the result of processing an event stream. If
+// details is non-nil, it holds the details for each of the errors in
+// streamResult followed by streamErr, which are included in the response.
+func writeStreamResult(c *request.Context, streamResult elasticapm.Result, streamErr error, details []*errorDetails) {
 	statusCode := http.StatusAccepted
 	id := request.IDResponseValidAccepted
 	jsonResult := jsonResult{Accepted: streamResult.Accepted}
@@ -123,6 +222,12 @@ func writeStreamResult(c *request.Context, streamResult elasticapm.Result, strea
 
 	processError := func(err error) {
 		errID, jsonErr := processStreamError(err)
+		if i := len(jsonResult.Errors); i < len(details) && details[i] != nil {
+			jsonErr.Line = details[i].Line
+			jsonErr.EventType = details[i].EventType
+			jsonErr.Path = details[i].Path
+			jsonErr.Constraint = details[i].Constraint
+		}
 		errStatusCode := errStatusCode(errID)
 		jsonResult.Errors = append(jsonResult.Errors, jsonErr)
 		errorMessages = append(errorMessages, jsonErr.Message)
@@ -168,6 +273,9 @@ func processStreamError(err error) (request.ResultID, jsonError) {
 		case errors.Is(err, publish.ErrChannelClosed):
 			errID = request.IDResponseErrorsShuttingDown
 			err = errServerShuttingDown
+		case errors.Is(err, drain.ErrDraining):
+			errID = request.IDResponseErrorsShuttingDown
+			err = drain.ErrDraining
 		case errors.Is(err, publish.ErrFull):
 			errID = request.IDResponseErrorsFullQueue
 		case errors.Is(err, errMethodNotAllowed):
@@ -223,4 +331,11 @@ type jsonResult struct {
 type jsonError struct {
 	Message  string `json:"message"`
 	Document string `json:"document,omitempty"`
+
+	// The following fields are set for invalid events
+	// if verbose errors are requested.
+	Line       int    `json:"line,omitempty"`
+	EventType  string `json:"event_type,omitempty"`
+	Path       string `json:"path,omitempty"`
+	Constraint string `json:"constraint,omitempty"`
 }
@@ -22,13 +22,16 @@ import (
 	"compress/gzip"
 	"compress/zlib"
 	"context"
+	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -36,16 +39,23 @@ import (
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 	tracenoop "go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 	"golang.org/x/sync/semaphore"
 
 	"github.com/elastic/apm-data/input/elasticapm"
 	"github.com/elastic/apm-data/model/modelpb"
+	"github.com/elastic/apm-server/internal/beater/auth"
 	"github.com/elastic/apm-server/internal/beater/config"
+	"github.com/elastic/apm-server/internal/beater/drain"
 	"github.com/elastic/apm-server/internal/beater/headers"
 	"github.com/elastic/apm-server/internal/beater/monitoringtest"
 	"github.com/elastic/apm-server/internal/beater/request"
+	"github.com/elastic/apm-server/internal/capture"
 	"github.com/elastic/apm-server/internal/model/modelprocessor"
 	"github.com/elastic/apm-server/internal/publish"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
 )
 
 // TODO: these tests should be rewritten to use a mock StreamHandler
@@ -111,6 +121,12 @@ func TestIntakeHandler(t *testing.T) {
 				return publish.ErrChannelClosed
 			}),
 			code: http.StatusServiceUnavailable, id: request.IDResponseErrorsShuttingDown},
+		"Draining": {
+			path: "errors.ndjson",
+			batchProcessor: modelpb.ProcessBatchFunc(func(context.Context, *modelpb.Batch) error {
+				return drain.ErrDraining
+			}),
+			code: http.StatusServiceUnavailable, id: request.IDResponseErrorsShuttingDown},
 		"FullQueueLegacy": {
 			path: "errors.ndjson",
 			batchProcessor: modelpb.ProcessBatchFunc(func(context.Context, *modelpb.Batch) error {
@@ -146,7 +162,7 @@ func TestIntakeHandler(t *testing.T) {
 			tc.setup(t)
 
 			// call handler
-			h := Handler(metricnoop.NewMeterProvider(), tracenoop.NewTracerProvider(), tc.processor, emptyRequestMetadata, tc.batchProcessor)
+			h := Handler(metricnoop.NewMeterProvider(), tracenoop.NewTracerProvider(), tc.processor, emptyRequestMetadata, tc.batchProcessor, nil)
 			h(tc.c)
 
 			require.Equal(t, string(tc.id), string(tc.c.Result.ID))
@@ -167,6 +183,39 @@ func TestIntakeHandler(t *testing.T) {
 	}
 }
 
+func TestIntakeHandlerDraining(t *testing.T) {
+	lines := []string{`{"metadata":{"service":{"name":"svc","agent":{"name":"python","version":"1.0"}}}}`}
+	for i := 0; i < batchSize+5; i++ {
+		lines = append(lines, `{"transaction":{"id":"abc","trace_id":"def","type":"t","duration":1,"span_count":{"started":1}}}`)
+	}
+	body := strings.Join(lines, "\n")
+
+	var processed int
+	drainer := drain.New(time.Second)
+	drainer.Drain()
+	tc := testcaseIntakeHandler{
+		r: httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)),
+		batchProcessor: drainer.BatchProcessor(modelpb.ProcessBatchFunc(func(_ context.Context, b *modelpb.Batch) error {
+			processed += len(*b)
+			return nil
+		})),
+	}
+	tc.setup(t)
+	h := Handler(metricnoop.NewMeterProvider(), tracenoop.NewTracerProvider(), tc.processor, emptyRequestMetadata, tc.batchProcessor, nil)
+	h(tc.c)
+
+	// The in-flight batch is processed and accepted, and then
+	// the stream is stopped without reading the remainder.
+	assert.Equal(t, batchSize, processed)
+	assert.Equal(t, http.StatusServiceUnavailable, tc.w.Code)
+	var result jsonResult
+	require.NoError(t, json.Unmarshal(tc.w.Body.Bytes(), &result))
+	assert.Equal(t, jsonResult{
+		Accepted: batchSize,
+		Errors:   []jsonError{{Message: drain.ErrDraining.Error()}},
+	}, result)
+}
+
 func TestIntakeHandlerMonitoring(t *testing.T) {
 	streamHandler := streamHandlerFunc(func(
 		ctx context.Context,
@@ -189,7 +238,7 @@ func TestIntakeHandlerMonitoring(t *testing.T) {
 	))
 	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
 
-	h := Handler(mp, tracenoop.NewTracerProvider(), streamHandler, emptyRequestMetadata, modelprocessor.Nop{})
+	h := Handler(mp, tracenoop.NewTracerProvider(), streamHandler, emptyRequestMetadata, modelprocessor.Nop{}, nil)
 	req := httptest.NewRequest("POST", "/", nil)
 	c := request.NewContext()
 	c.Reset(httptest.NewRecorder(), req)
@@ -216,12 +265,102 @@ func TestIntakeHandlerContentType(t *testing.T) {
 		}
 
 		tc.setup(t)
-		h := Handler(metricnoop.NewMeterProvider(), tracenoop.NewTracerProvider(), tc.processor, emptyRequestMetadata, tc.batchProcessor)
+		h := Handler(metricnoop.NewMeterProvider(), tracenoop.NewTracerProvider(), tc.processor, emptyRequestMetadata, tc.batchProcessor, nil)
 		h(tc.c)
 		assert.Equal(t, tc.code, tc.w.Code, tc.c.Result.Err)
 	}
 }
 
+func TestIntakeHandlerCapture(t *testing.T) {
+	dir := t.TempDir()
+	capturer, err := capture.New(capture.Config{
+		Dir: dir, MaxFileSize: 1 << 20, MaxFiles: 1, MaxBodySize: 1 << 20, MaxDuration: time.Hour,
+	})
+	require.NoError(t, err)
+	_, err = capturer.Start(capture.Filter{AgentName: "elastic-node", APIKeyID: "key"}, time.Hour)
+	require.NoError(t, err)
+	defer capturer.Stop()
+
+	for _, apiKeyID := range []string{"other", "key"} {
+		tc := testcaseIntakeHandler{path: "invalid-event.ndjson"}
+		tc.setup(t)
+		tc.c.Authentication.APIKey = &auth.APIKeyAuthenticationDetails{ID: apiKeyID}
+		h := Handler(metricnoop.NewMeterProvider(), tracenoop.NewTracerProvider(), tc.processor, emptyRequestMetadata, tc.batchProcessor, capturer)
+		h(tc.c)
+		assert.Equal(t, http.StatusBadRequest, tc.w.Code)
+	}
+	assert.Equal(t, 1, capturer.Status().Captured)
+
+	files, err := filepath.Glob(filepath.Join(dir, capture.FilePrefix+"-*"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	var record capture.Record
+	require.NoError(t, json.Unmarshal(data, &record))
+	assert.Equal(t, "key", record.APIKeyID)
+	assert.Equal(t, "1234_service-12a3", record.ServiceName)
+	assert.Equal(t, http.StatusBadRequest, record.StatusCode)
+	require.Len(t, record.Errors, 1)
+	assert.Contains(t, record.Errors[0].Message, "decode error")
+	expectedBody, err := os.ReadFile("../../../../testdata/intake-v2/invalid-event.ndjson")
+	require.NoError(t, err)
+	assert.Equal(t, string(expectedBody), record.Body)
+}
+
+func TestIntakeHandlerVerboseErrors(t *testing.T) {
+	body := strings.Join([]string{
+		`{"metadata":{"service":{"name":"svc","agent":{"name":"python","version":"1.0"}}}}`,
+		`{"transaction":{"id":"abc","trace_id":"def","type":"t","duration":1,"span_count":{"started":1}}}`,
+		``,
+		`{"transaction":{"id":"abc","trace_id":"def","type":"t","duration":1}}`,
+		`{"transaction":{"id":"abc","trace_id":"def","type":"t","duration":1,"span_count":{"started":1},"outcome":"zzz"}}`,
+	}, "\n")
+
+	for _, verbose := range []bool{false, true} {
+		core, observed := observer.New(zapcore.DebugLevel)
+		tc := testcaseIntakeHandler{r: httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))}
+		if verbose {
+			tc.r.Header.Set(headers.VerboseErrors, "true")
+		}
+		tc.setup(t)
+		tc.c.Logger = logptest.NewTestingLogger(t, "", zap.WrapCore(func(in zapcore.Core) zapcore.Core {
+			return zapcore.NewTee(in, core)
+		}))
+		h := Handler(metricnoop.NewMeterProvider(), tracenoop.NewTracerProvider(), tc.processor, emptyRequestMetadata, tc.batchProcessor, nil)
+		h(tc.c)
+		require.Equal(t, http.StatusBadRequest, tc.w.Code)
+
+		var result jsonResult
+		require.NoError(t, json.Unmarshal(tc.w.Body.Bytes(), &result))
+		require.Len(t, result.Errors, 2)
+		if !verbose {
+			assert.Zero(t, result.Errors[0].Line)
+			assert.Empty(t, result.Errors[0].Path)
+		} else {
+			assert.Equal(t, 4, result.Errors[0].Line)
+			assert.Equal(t, "transaction", result.Errors[0].EventType)
+			assert.Equal(t, "transaction.span_count", result.Errors[0].Path)
+			assert.Equal(t, "required", result.Errors[0].Constraint)
+			assert.Equal(t, 5, result.Errors[1].Line)
+			assert.Equal(t, "transaction.outcome", result.Errors[1].Path)
+			assert.Equal(t, "enum(enumOutcome)", result.Errors[1].Constraint)
+		}
+
+		// Invalid events are logged regardless of verbosity.
+		entries := observed.FilterMessage("invalid event").AllUntimed()
+		require.Len(t, entries, 2)
+		fields := entries[0].ContextMap()
+		assert.Equal(t, "transaction.span_count", fields["intake.path"])
+		assert.Equal(t, "required", fields["intake.constraint"])
+		if verbose {
+			assert.EqualValues(t, 4, fields["intake.line"])
+		} else {
+			assert.NotContains(t, fields, "intake.line")
+		}
+	}
+}
+
 type testcaseIntakeHandler struct {
 	c              *request.Context
 	w              *httptest.ResponseRecorder
@@ -41,12 +41,19 @@ import (
 	"github.com/elastic/apm-server/internal/beater/api/root"
 	"github.com/elastic/apm-server/internal/beater/auth"
 	"github.com/elastic/apm-server/internal/beater/config"
+	"github.com/elastic/apm-server/internal/beater/drain"
+	"github.com/elastic/apm-server/internal/beater/health"
+	"github.com/elastic/apm-server/internal/beater/jaeger"
 	"github.com/elastic/apm-server/internal/beater/middleware"
 	"github.com/elastic/apm-server/internal/beater/otlp"
+	"github.com/elastic/apm-server/internal/beater/prometheus"
 	"github.com/elastic/apm-server/internal/beater/ratelimit"
 	"github.com/elastic/apm-server/internal/beater/request"
+	"github.com/elastic/apm-server/internal/beater/zipkin"
+	"github.com/elastic/apm-server/internal/capture"
 	"github.com/elastic/apm-server/internal/logs"
 	srvmodelprocessor "github.com/elastic/apm-server/internal/model/modelprocessor"
+	"github.com/elastic/apm-server/internal/netutil"
 	"github.com/elastic/apm-server/internal/sourcemap"
 	"github.com/elastic/apm-server/internal/version"
 )
@@ -54,6 +61,10 @@ import (
 const (
 	// RootPath defines the server's root path
 	RootPath = "/"
+	// HealthzPath defines the path for checking the server process is alive
+	HealthzPath = "/healthz"
+	// ReadyzPath defines the path for checking the server is ready to receive requests
+	ReadyzPath = "/readyz"
 
 	// Backend routes
 
@@ -77,6 +88,15 @@ const (
 	OTLPMetricsIntakePath = "/v1/metrics"
 	// OTLPLogsIntakePath defines the path to ingest OpenTelemetry logs (HTTP Collector)
 	OTLPLogsIntakePath = "/v1/logs"
+
+	// JaegerTracesIntakePath defines the path to ingest Thrift-encoded Jaeger traces (HTTP Collector)
+	JaegerTracesIntakePath = "/api/traces"
+	// JaegerSamplingPath defines the path to query for Jaeger remote sampling strategies
+	JaegerSamplingPath = "/sampling"
+	// PrometheusRemoteWritePath defines the path to ingest Prometheus remote-write requests
+	PrometheusRemoteWritePath = "/api/v1/write"
+	// ZipkinSpansIntakePath defines the path to ingest JSON-encoded Zipkin v2 spans
+	ZipkinSpansIntakePath = "/api/v2/spans"
 )
 
 // NewMux creates a new gorilla/mux router, with routes registered for handling the
@@ -89,14 +109,31 @@ func NewMux(
 	ratelimitStore *ratelimit.Store,
 	sourcemapFetcher sourcemap.Fetcher,
 	publishReady func() bool,
+	healthChecker *health.Checker,
+	drainer *drain.Drainer,
+	rumKillSwitch *middleware.KillSwitch,
+	capturer *capture.Capturer,
 	semaphore input.Semaphore,
 	meterProvider metric.MeterProvider,
 	traceProvider trace.TracerProvider,
 	logger *logp.Logger,
 	statsRegistry *monitoring.Registry,
 ) (*http.ServeMux, error) {
-	pool := request.NewContextPool()
+	trustedProxies, err := netutil.ParseTrustedProxies(beaterConfig.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	pool := request.NewContextPool(trustedProxies)
 	logger = logger.Named(logs.Handler)
+	if healthChecker == nil {
+		healthChecker = health.NewChecker()
+	}
+	if drainer == nil {
+		drainer = drain.New(0)
+	}
+	if rumKillSwitch == nil {
+		rumKillSwitch = middleware.NewKillSwitch(beaterConfig.RumConfig.Enabled)
+	}
 	router := http.NewServeMux()
 
 	builder := routeBuilder{
@@ -106,6 +143,9 @@ func NewMux(
 		ratelimitStore:   ratelimitStore,
 		sourcemapFetcher: sourcemapFetcher,
 		intakeSemaphore:  semaphore,
+		drainer:          drainer,
+		rumKillSwitch:    rumKillSwitch,
+		capturer:         capturer,
 		logger:           logger,
 	}
 
@@ -123,18 +163,27 @@ func NewMux(
 	}
 
 	otlpHandlers := otlp.NewHTTPHandlers(zapLogger, batchProcessor, semaphore, meterProvider, traceProvider)
+	jaegerHandler := jaeger.NewHTTPHandler(zapLogger, batchProcessor, semaphore, traceProvider)
+	zipkinHandler := zipkin.NewHTTPHandler(zapLogger, batchProcessor, semaphore, traceProvider)
+	prometheusHandler := prometheus.NewHTTPHandler(zapLogger, batchProcessor, semaphore, traceProvider)
 	rumIntakeHandler := builder.rumIntakeHandler(meterProvider, traceProvider)
 	routeMap := []route{
 		{RootPath, func() (request.Handler, error) { return notFoundHandler, nil }},
 		{RootPath + "{$}", builder.rootHandler(publishReady, meterProvider, tracenoop.NewTracerProvider())}, // do not trace root handler
+		{HealthzPath, builder.healthHandler(root.LivenessHandler(), meterProvider)},
+		{ReadyzPath, builder.healthHandler(root.ReadinessHandler(healthChecker), meterProvider)},
 		{AgentConfigPath, builder.backendAgentConfigHandler(fetcher, meterProvider, traceProvider)},
 		{AgentConfigRUMPath, builder.rumAgentConfigHandler(fetcher, meterProvider, traceProvider)},
 		{IntakeRUMPath, rumIntakeHandler},
 		{IntakeRUMV3Path, rumIntakeHandler},
 		{IntakePath, builder.backendIntakeHandler("apm-server.server.", meterProvider, traceProvider)},
-		{OTLPTracesIntakePath, builder.otlpHandler(otlpHandlers.HandleTraces, "apm-server.otlp.http.traces.", meterProvider, traceProvider)},
-		{OTLPMetricsIntakePath, builder.otlpHandler(otlpHandlers.HandleMetrics, "apm-server.otlp.http.metrics.", meterProvider, traceProvider)},
-		{OTLPLogsIntakePath, builder.otlpHandler(otlpHandlers.HandleLogs, "apm-server.otlp.http.logs.", meterProvider, traceProvider)},
+		{OTLPTracesIntakePath, builder.httpHandler(otlpHandlers.HandleTraces, "apm-server.otlp.http.traces.", meterProvider, traceProvider)},
+		{OTLPMetricsIntakePath, builder.httpHandler(otlpHandlers.HandleMetrics, "apm-server.otlp.http.metrics.", meterProvider, traceProvider)},
+		{OTLPLogsIntakePath, builder.httpHandler(otlpHandlers.HandleLogs, "apm-server.otlp.http.logs.", meterProvider, traceProvider)},
+		{JaegerTracesIntakePath, builder.httpHandler(jaegerHandler, "apm-server.jaeger.http.", meterProvider, traceProvider)},
+		{JaegerSamplingPath, builder.httpHandler(jaeger.NewSamplingHTTPHandler(fetcher), "apm-server.jaeger.http.sampling.", meterProvider, traceProvider)},
+		{ZipkinSpansIntakePath, builder.httpHandler(zipkinHandler, "apm-server.zipkin.http.", meterProvider, traceProvider)},
+		{PrometheusRemoteWritePath, builder.httpHandler(prometheusHandler, "apm-server.prometheus.http.remote_write.", meterProvider, traceProvider)},
 	}
 
 	for _, route := range routeMap {
@@ -143,6 +192,12 @@ func NewMux(
 			return nil, err
 		}
 		logger.Infof("Path %s added to request handler", route.path)
+		if route.path == PrometheusRemoteWritePath {
+			// The Prometheus remote-write handler decodes
+			// its own snappy-compressed request bodies.
+			router.Handle(route.path, pool.RawBodyHTTPHandler(h))
+			continue
+		}
 		router.Handle(route.path, pool.HTTPHandler(h))
 	}
 	if beaterConfig.Expvar.Enabled {
@@ -171,17 +226,26 @@ type routeBuilder struct {
 	sourcemapFetcher sourcemap.Fetcher
 	intakeProcessor  *elasticapm.Processor
 	intakeSemaphore  input.Semaphore
+	drainer          *drain.Drainer
+	rumKillSwitch    *middleware.KillSwitch
+	capturer         *capture.Capturer
 	logger           *logp.Logger
 }
 
 func (r *routeBuilder) backendIntakeHandler(metricsPrefix string, mp metric.MeterProvider, tp trace.TracerProvider) func() (request.Handler, error) {
 	return func() (request.Handler, error) {
-		h := intake.Handler(mp, tp, r.intakeProcessor, backendRequestMetadataFunc(r.cfg), r.batchProcessor)
-		return middleware.Wrap(h, backendMiddleware(r.cfg, r.authenticator, r.ratelimitStore, metricsPrefix, mp, tp, r.logger)...)
+		h := intake.Handler(mp, tp, r.intakeProcessor, backendRequestMetadataFunc(r.cfg), r.drainer.BatchProcessor(r.batchProcessor), r.capturer)
+		return middleware.Wrap(h, append(
+			backendMiddleware(r.cfg, r.authenticator, r.ratelimitStore, metricsPrefix, mp, tp, r.logger),
+			middleware.DrainMiddleware(r.drainer),
+		)...)
 	}
 }
 
-func (r *routeBuilder) otlpHandler(handler http.HandlerFunc, metricsPrefix string, mp metric.MeterProvider, tp trace.TracerProvider) func() (request.Handler, error) {
+// httpHandler wraps a plain http.HandlerFunc, such as those used for
+// OpenTelemetry, Jaeger, Zipkin, and Prometheus intake, with the backend
+// middleware.
+func (r *routeBuilder) httpHandler(handler http.HandlerFunc, metricsPrefix string, mp metric.MeterProvider, tp trace.TracerProvider) func() (request.Handler, error) {
 	return func() (request.Handler, error) {
 		h := func(c *request.Context) {
 			handler(c.ResponseWriter, c.Request)
@@ -220,8 +284,11 @@ func (r *routeBuilder) rumIntakeHandler(mp metric.MeterProvider, tp trace.Tracer
 			batchProcessors = append(batchProcessors, modelprocessor.SetCulprit{})
 		}
 		batchProcessors = append(batchProcessors, r.batchProcessor) // r.batchProcessor always goes last
-		h := intake.Handler(mp, tp, r.intakeProcessor, rumRequestMetadataFunc(r.cfg), batchProcessors)
-		return middleware.Wrap(h, rumMiddleware(r.cfg, r.authenticator, r.ratelimitStore, "apm-server.server.", mp, tp, r.logger)...)
+		h := intake.Handler(mp, tp, r.intakeProcessor, rumRequestMetadataFunc(r.cfg), r.drainer.BatchProcessor(batchProcessors), r.capturer)
+		return middleware.Wrap(h, append(
+			r.rumMiddleware(r.cfg, r.authenticator, r.ratelimitStore, "apm-server.server.", mp, tp, r.logger),
+			middleware.DrainMiddleware(r.drainer),
+		)...)
 	}
 }
 
@@ -235,6 +302,14 @@ func (r *routeBuilder) rootHandler(publishReady func() bool, mp metric.MeterProv
 	}
 }
 
+// healthHandler wraps a health handler with the root middleware. Health
+// requests are not traced, as they are expected to be frequent.
+func (r *routeBuilder) healthHandler(h request.Handler, mp metric.MeterProvider) func() (request.Handler, error) {
+	return func() (request.Handler, error) {
+		return middleware.Wrap(h, rootMiddleware(r.cfg, r.authenticator, mp, tracenoop.NewTracerProvider(), r.logger)...)
+	}
+}
+
 func (r *routeBuilder) backendAgentConfigHandler(f agentcfg.Fetcher, mp metric.MeterProvider, tp trace.TracerProvider) func() (request.Handler, error) {
 	return func() (request.Handler, error) {
 		return agentConfigHandler(r.cfg, r.authenticator, r.ratelimitStore, backendMiddleware, f, mp, tp, r.logger)
@@ -243,10 +318,19 @@ func (r *routeBuilder) backendAgentConfigHandler(f agentcfg.Fetcher, mp metric.M
 
 func (r *routeBuilder) rumAgentConfigHandler(f agentcfg.Fetcher, mp metric.MeterProvider, tp trace.TracerProvider) func() (request.Handler, error) {
 	return func() (request.Handler, error) {
-		return agentConfigHandler(r.cfg, r.authenticator, r.ratelimitStore, rumMiddleware, f, mp, tp, r.logger)
+		return agentConfigHandler(r.cfg, r.authenticator, r.ratelimitStore, r.rumMiddleware, f, mp, tp, r.logger)
 	}
 }
 
+// rumMiddleware returns the RUM middleware followed by the RUM kill switch,
+// which may be toggled at runtime.
+func (r *routeBuilder) rumMiddleware(cfg *config.Config, authenticator *auth.Authenticator, ratelimitStore *ratelimit.Store, metricsPrefix string, mp metric.MeterProvider, tp trace.TracerProvider, logger *logp.Logger) []middleware.Middleware {
+	return append(
+		rumMiddleware(cfg, authenticator, ratelimitStore, metricsPrefix, mp, tp, logger),
+		middleware.RuntimeKillSwitchMiddleware(r.rumKillSwitch, rumDisabledMessage),
+	)
+}
+
 type middlewareFunc func(*config.Config, *auth.Authenticator, *ratelimit.Store, string, metric.MeterProvider, trace.TracerProvider, *logp.Logger) []middleware.Middleware
 
 func agentConfigHandler(
@@ -282,18 +366,19 @@ func backendMiddleware(cfg *config.Config, authenticator *auth.Authenticator, ra
 	return backendMiddleware
 }
 
+const rumDisabledMessage = "RUM endpoint is disabled. " +
+	"Configure the `apm-server.rum` section in apm-server.yml to enable ingestion of RUM events. " +
+	"If you are not using the RUM agent, you can safely ignore this error."
+
+// rumMiddleware returns the RUM middleware, excluding the RUM kill switch.
 func rumMiddleware(cfg *config.Config, authenticator *auth.Authenticator, ratelimitStore *ratelimit.Store, metricsPrefix string, mp metric.MeterProvider, tp trace.TracerProvider, logger *logp.Logger) []middleware.Middleware {
-	msg := "RUM endpoint is disabled. " +
-		"Configure the `apm-server.rum` section in apm-server.yml to enable ingestion of RUM events. " +
-		"If you are not using the RUM agent, you can safely ignore this error."
-	rumMiddleware := append(apmMiddleware(mp, tp, metricsPrefix, logger),
+	return append(apmMiddleware(mp, tp, metricsPrefix, logger),
 		middleware.ResponseHeadersMiddleware(cfg.ResponseHeaders),
 		middleware.ResponseHeadersMiddleware(cfg.RumConfig.ResponseHeaders),
 		middleware.CORSMiddleware(cfg.RumConfig.AllowOrigins, cfg.RumConfig.AllowHeaders),
 		middleware.AuthMiddleware(authenticator, true),
 		middleware.AnonymousRateLimitMiddleware(ratelimitStore),
 	)
-	return append(rumMiddleware, middleware.KillSwitchMiddleware(cfg.RumConfig.Enabled, msg))
 }
 
 func rootMiddleware(cfg *config.Config, authenticator *auth.Authenticator, mp metric.MeterProvider, tp trace.TracerProvider, logger *logp.Logger) []middleware.Middleware {
@@ -0,0 +1,74 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-server/internal/beater/config"
+	"github.com/elastic/apm-server/internal/beater/headers"
+	"github.com/elastic/apm-server/internal/beater/health"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestHealthHandlers(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.AgentAuth.SecretToken = "1234"
+
+	checker := health.NewChecker()
+	check := checker.Register("publish_ready")
+	check.Set(errors.New("license expired"))
+	_, mux, err := muxBuilder{
+		HealthChecker: checker,
+		Logger:        logptest.NewTestingLogger(t, ""),
+	}.build(cfg)
+	require.NoError(t, err)
+
+	serve := func(path string, header map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, requestWithHeader(httptest.NewRequest(http.MethodGet, path, nil), header))
+		return w
+	}
+	authorized := map[string]string{headers.Authorization: "Bearer 1234"}
+
+	rec := serve(HealthzPath, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serve(ReadyzPath, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "license expired")
+
+	rec = serve(ReadyzPath, authorized)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"last_error":"license expired"`)
+
+	check.Set(nil)
+	rec = serve(ReadyzPath, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Invalid credentials are treated as anonymous, as for the root endpoint.
+	rec = serve(ReadyzPath, map[string]string{headers.Authorization: "Bearer wrong"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "publish_ready")
+}
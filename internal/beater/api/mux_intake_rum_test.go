@@ -107,6 +107,30 @@ func TestRUMHandler_KillSwitchMiddleware(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, http.StatusAccepted, rec.Code)
 	})
+
+	t.Run("Runtime", func(t *testing.T) {
+		killSwitch := middleware.NewKillSwitch(true)
+		_, h, err := muxBuilder{
+			RUMKillSwitch: killSwitch,
+			Logger:        logptest.NewTestingLogger(t, ""),
+		}.build(cfgEnabledRUM())
+		require.NoError(t, err)
+
+		for _, enabled := range []bool{false, true} {
+			killSwitch.SetEnabled(enabled)
+			for _, path := range []string{IntakeRUMPath, AgentConfigRUMPath} {
+				req := httptest.NewRequest(http.MethodPost, path, nil)
+				req.Header.Set(headers.ContentType, "application/x-ndjson")
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, req)
+				if enabled {
+					assert.NotEqual(t, http.StatusForbidden, w.Code, path)
+				} else {
+					assert.Equal(t, http.StatusForbidden, w.Code, path)
+				}
+			}
+		}
+	})
 }
 
 func TestRUMHandler_CORSMiddleware(t *testing.T) {
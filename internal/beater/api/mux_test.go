@@ -38,6 +38,9 @@ import (
 	"github.com/elastic/apm-server/internal/agentcfg"
 	"github.com/elastic/apm-server/internal/beater/auth"
 	"github.com/elastic/apm-server/internal/beater/config"
+	"github.com/elastic/apm-server/internal/beater/drain"
+	"github.com/elastic/apm-server/internal/beater/health"
+	"github.com/elastic/apm-server/internal/beater/middleware"
 	"github.com/elastic/apm-server/internal/beater/monitoringtest"
 	"github.com/elastic/apm-server/internal/beater/ratelimit"
 	"github.com/elastic/apm-server/internal/beater/request"
@@ -159,6 +162,9 @@ func newTestMux(t *testing.T, cfg *config.Config) (http.Handler, sdkmetric.Reade
 
 type muxBuilder struct {
 	SourcemapFetcher sourcemap.Fetcher
+	HealthChecker    *health.Checker
+	Drainer          *drain.Drainer
+	RUMKillSwitch    *middleware.KillSwitch
 	Managed          bool
 	Logger           *logp.Logger
 }
@@ -182,6 +188,10 @@ func (m muxBuilder) build(cfg *config.Config) (sdkmetric.Reader, http.Handler, e
 		ratelimitStore,
 		m.SourcemapFetcher,
 		func() bool { return true },
+		m.HealthChecker,
+		m.Drainer,
+		m.RUMKillSwitch,
+		nil,
 		semaphore.NewWeighted(1),
 		mp,
 		noop.NewTracerProvider(),
@@ -0,0 +1,73 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package root
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/elastic/apm-server/internal/beater/auth"
+	"github.com/elastic/apm-server/internal/beater/health"
+	"github.com/elastic/apm-server/internal/beater/request"
+)
+
+// LivenessHandler returns a handler which reports that the server
+// process is alive, responding to all GET and HEAD requests with 200.
+func LivenessHandler() request.Handler {
+	return func(c *request.Context) {
+		if !checkHealthMethod(c) {
+			return
+		}
+		c.Result.SetDefault(request.IDResponseValidOK)
+		c.WriteResult()
+	}
+}
+
+// ReadinessHandler returns a handler which reports whether the server is
+// ready to receive requests, responding with 200 if it is and 503 if not.
+// The state of each check is included for authenticated requests.
+func ReadinessHandler(checker *health.Checker) request.Handler {
+	return func(c *request.Context) {
+		if !checkHealthMethod(c) {
+			return
+		}
+		status := checker.Status()
+		if status.Ready {
+			c.Result.SetDefault(request.IDResponseValidOK)
+		} else {
+			c.Result.SetDefault(request.IDResponseErrorsServiceUnavailable)
+		}
+		if c.Authentication.Method != auth.MethodAnonymous {
+			c.Result.Body = status
+		}
+		c.WriteResult()
+	}
+}
+
+func checkHealthMethod(c *request.Context) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead:
+		return true
+	}
+	c.Result.SetWithError(
+		request.IDResponseErrorsMethodNotAllowed,
+		errors.New("only GET and HEAD requests are allowed"),
+	)
+	c.WriteResult()
+	return false
+}
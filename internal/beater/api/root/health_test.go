@@ -0,0 +1,76 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package root
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-server/internal/beater/auth"
+	"github.com/elastic/apm-server/internal/beater/health"
+)
+
+func TestLivenessHandler(t *testing.T) {
+	c, w := rootTestContext()
+	LivenessHandler()(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "", w.Body.String())
+}
+
+func TestReadinessHandler(t *testing.T) {
+	checker := health.NewChecker()
+	check := checker.Register("publish_ready")
+	check.Set(errors.New("license expired"))
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		c, w := rootTestContext()
+		c.Authentication.Method = auth.MethodAnonymous
+		ReadinessHandler(checker)(c)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.NotContains(t, w.Body.String(), "license expired")
+	})
+
+	t.Run("authenticated", func(t *testing.T) {
+		c, w := rootTestContext()
+		c.Authentication.Method = auth.MethodNone
+		ReadinessHandler(checker)(c)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+		var status health.Status
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+		assert.False(t, status.Ready)
+		require.Len(t, status.Checks, 1)
+		assert.Equal(t, "publish_ready", status.Checks[0].Name)
+		assert.Equal(t, health.StateUnhealthy, status.Checks[0].State)
+		assert.Equal(t, "license expired", status.Checks[0].LastError)
+	})
+
+	t.Run("ready", func(t *testing.T) {
+		check.Set(nil)
+		c, w := rootTestContext()
+		c.Authentication.Method = auth.MethodAnonymous
+		ReadinessHandler(checker)(c)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "", w.Body.String())
+	})
+}
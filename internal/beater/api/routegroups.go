@@ -0,0 +1,67 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/elastic/apm-server/internal/beater/config"
+	"github.com/elastic/apm-server/internal/beater/request"
+)
+
+// RouteGroup returns the route group for the given request path, as
+// defined by config.RouteGroups, or the empty string if the path does not
+// belong to any route group.
+func RouteGroup(cfg *config.Config, path string) string {
+	switch path {
+	case IntakePath, AgentConfigPath,
+		OTLPTracesIntakePath, OTLPMetricsIntakePath, OTLPLogsIntakePath,
+		JaegerTracesIntakePath, JaegerSamplingPath,
+		ZipkinSpansIntakePath, PrometheusRemoteWritePath:
+		return config.RouteGroupIntake
+	case IntakeRUMPath, IntakeRUMV3Path, AgentConfigRUMPath:
+		return config.RouteGroupRUM
+	}
+	if cfg.Expvar.Enabled && path == cfg.Expvar.URL {
+		return config.RouteGroupDebug
+	}
+	if strings.HasPrefix(path, "/debug/pprof/") {
+		return config.RouteGroupDebug
+	}
+	return ""
+}
+
+// FilterRouteGroups wraps h, a handler returned by NewMux, such that
+// only requests for the given route groups are served. Requests for
+// other route groups are responded to with 404 Not Found, as for unknown
+// paths. Requests for
+// paths that do not belong to any route group, such as the root path,
+// are always passed through to h.
+func FilterRouteGroups(h http.Handler, cfg *config.Config, groups []string) http.Handler {
+	notFound := request.NewContextPool(nil).HTTPHandler(notFoundHandler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		group := RouteGroup(cfg, r.URL.Path)
+		if group != "" && !slices.Contains(groups, group) {
+			notFound.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
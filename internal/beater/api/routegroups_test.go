@@ -0,0 +1,73 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-server/internal/beater/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestRouteGroup(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Expvar.Enabled = true
+	for path, expected := range map[string]string{
+		"/":                  "",
+		"/unknown":           "",
+		IntakePath:           config.RouteGroupIntake,
+		AgentConfigPath:      config.RouteGroupIntake,
+		OTLPTracesIntakePath: config.RouteGroupIntake,
+		IntakeRUMPath:        config.RouteGroupRUM,
+		IntakeRUMV3Path:      config.RouteGroupRUM,
+		AgentConfigRUMPath:   config.RouteGroupRUM,
+		"/debug/vars":        config.RouteGroupDebug,
+		"/debug/pprof/heap":  config.RouteGroupDebug,
+	} {
+		assert.Equal(t, expected, RouteGroup(cfg, path), path)
+	}
+}
+
+func TestFilterRouteGroups(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Expvar.Enabled = true
+	_, mux, err := muxBuilder{Logger: logptest.NewTestingLogger(t, "")}.build(cfg)
+	require.NoError(t, err)
+	h := FilterRouteGroups(mux, cfg, []string{config.RouteGroupDebug})
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := serve("/debug/vars")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serve(AgentConfigPath)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, `{"error":"404 page not found"}`+"\n", w.Body.String())
+
+	w = serve(RootPath)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
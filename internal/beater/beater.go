@@ -23,9 +23,10 @@ import (
 	"errors"
 	"fmt"
 	"hash"
-	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"regexp"
 	"runtime"
 	"strconv"
 	"time"
@@ -35,8 +36,10 @@ import (
 	"go.elastic.co/apm/module/apmotel/v2"
 	"go.elastic.co/apm/v2"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/trace"
 	tracenoop "go.opentelemetry.io/otel/trace/noop"
 	"go.uber.org/zap"
@@ -56,22 +59,34 @@ import (
 	agentconfig "github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/elastic-agent-libs/monitoring"
+	"github.com/elastic/elastic-agent-libs/paths"
+	"github.com/elastic/elastic-transport-go/v8/elastictransport"
 	"github.com/elastic/go-docappender/v2"
 	"github.com/elastic/go-ucfg"
 
 	"github.com/elastic/apm-data/model/modelpb"
 	"github.com/elastic/apm-data/model/modelprocessor"
 	"github.com/elastic/apm-server/internal/agentcfg"
+	"github.com/elastic/apm-server/internal/beater/admin"
 	"github.com/elastic/apm-server/internal/beater/auth"
 	"github.com/elastic/apm-server/internal/beater/config"
+	"github.com/elastic/apm-server/internal/beater/drain"
+	"github.com/elastic/apm-server/internal/beater/health"
 	"github.com/elastic/apm-server/internal/beater/interceptors"
+	"github.com/elastic/apm-server/internal/beater/middleware"
 	"github.com/elastic/apm-server/internal/beater/ratelimit"
+	"github.com/elastic/apm-server/internal/capture"
+	"github.com/elastic/apm-server/internal/deadletter"
 	"github.com/elastic/apm-server/internal/elasticsearch"
 	"github.com/elastic/apm-server/internal/fips140"
 	"github.com/elastic/apm-server/internal/kibana"
 	srvmodelprocessor "github.com/elastic/apm-server/internal/model/modelprocessor"
+	"github.com/elastic/apm-server/internal/model/processors"
+	"github.com/elastic/apm-server/internal/netutil"
+	"github.com/elastic/apm-server/internal/otlpexport"
 	"github.com/elastic/apm-server/internal/publish"
 	"github.com/elastic/apm-server/internal/sourcemap"
+	"github.com/elastic/apm-server/internal/spool"
 	"github.com/elastic/apm-server/internal/version"
 )
 
@@ -89,8 +104,14 @@ type Runner struct {
 	tracerProvider trace.TracerProvider
 	meterProvider  metric.MeterProvider
 	metricGatherer *apmotel.Gatherer
+	metricReader   sdkmetric.Reader
 	beatMonitoring beat.Monitoring
-	listener       net.Listener
+	listeners      []serverListener
+	adminListener  *serverListener
+
+	// outputFlush tracks requests to Elasticsearch made by docappenders,
+	// for flushing the output while draining.
+	outputFlush *outputFlushWaiter
 }
 
 // RunnerParams holds parameters for NewRunner.
@@ -113,6 +134,10 @@ type RunnerParams struct {
 	// MetricsGatherer holds an apmotel.Gatherer
 	MetricsGatherer *apmotel.Gatherer
 
+	// MetricReader holds an sdkmetric.Reader for collecting metrics
+	// registered through MeterProvider, used for self-instrumentation.
+	MetricReader sdkmetric.Reader
+
 	// BeatMonitoring holds beat monitoring
 	BeatMonitoring beat.Monitoring
 
@@ -156,13 +181,20 @@ func NewRunner(args RunnerParams) (*Runner, error) {
 		cfg.DataStreams.Namespace = unpackedConfig.DataStream.Namespace
 	}
 
-	// We start the listener in the constructor, before Run is invoked,
+	// We start the listeners in the constructor, before Run is invoked,
 	// to ensure zero downtime while any existing Runner is stopped.
 	logger := args.Logger.Named("beater")
-	listener, err := listen(cfg, logger)
+	listeners, err := listenAll(cfg, logger)
 	if err != nil {
 		return nil, err
 	}
+	adminListener, err := listenAdmin(cfg, logger)
+	if err != nil {
+		for _, l := range listeners {
+			l.Close()
+		}
+		return nil, err
+	}
 	return &Runner{
 		wrapServer: args.WrapServer,
 		logger:     logger,
@@ -175,14 +207,24 @@ func NewRunner(args RunnerParams) (*Runner, error) {
 		tracerProvider: args.TracerProvider,
 		meterProvider:  args.MeterProvider,
 		metricGatherer: args.MetricsGatherer,
+		metricReader:   args.MetricReader,
 		beatMonitoring: args.BeatMonitoring,
-		listener:       listener,
+		listeners:      listeners,
+		adminListener:  adminListener,
+		outputFlush:    &outputFlushWaiter{},
 	}, nil
 }
 
 // Run runs the server, blocking until ctx is cancelled.
 func (s *Runner) Run(ctx context.Context) error {
-	defer s.listener.Close()
+	defer func() {
+		for _, l := range s.listeners {
+			l.Close()
+		}
+		if s.adminListener != nil {
+			s.adminListener.Close()
+		}
+	}()
 	g, ctx := errgroup.WithContext(ctx)
 	meter := s.meterProvider.Meter("github.com/elastic/apm-server/internal/beater")
 
@@ -195,9 +237,9 @@ func (s *Runner) Run(ctx context.Context) error {
 		<-ctx.Done()
 		s.logger.Infof(
 			"stopping apm-server... waiting maximum of %s for queues to drain",
-			s.config.ShutdownTimeout,
+			s.config.Drain.Timeout+s.config.ShutdownTimeout,
 		)
-		time.AfterFunc(s.config.ShutdownTimeout, cancel)
+		time.AfterFunc(s.config.Drain.Timeout+s.config.ShutdownTimeout, cancel)
 	}()
 
 	if s.config.Pprof.Enabled {
@@ -297,20 +339,61 @@ func (s *Runner) Run(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	otel.SetTracerProvider(tracerProvider)
-
 	s.tracerProvider = tracerProvider
+	if s.config.SelfInstrumentation.Enabled {
+		selfInstrumentation, err := newSelfInstrumentation(s.config.SelfInstrumentation, s.metricReader, s.logger)
+		if err != nil {
+			return err
+		}
+		// Shut down self-instrumentation last, so that spans recorded
+		// while flushing the output are exported.
+		defer func() {
+			if err := selfInstrumentation.shutdown(backgroundContext); err != nil {
+				s.logger.With(logp.Error(err)).Warn("failed to shut down self-instrumentation")
+			}
+		}()
+		g.Go(func() error {
+			return selfInstrumentation.runMetrics(ctx)
+		})
+		s.tracerProvider = selfInstrumentation.tracerProvider
+	}
+	otel.SetTracerProvider(s.tracerProvider)
 
 	tracer.RegisterMetricsGatherer(s.metricGatherer)
 
+	// Track the health of the server's dependencies, for reporting
+	// readiness. The server is no longer ready once it starts shutting
+	// down, so orchestrators stop sending requests to it.
+	healthChecker := health.NewChecker()
+	publishReadyCheck := healthChecker.Register("publish_ready")
+	if err := s.registerOutputHealthProbe(healthChecker); err != nil {
+		return err
+	}
+	g.Go(func() error {
+		return healthChecker.Run(ctx, s.config.WaitReadyInterval)
+	})
+	// The server stops reporting ready as soon as it starts draining,
+	// which may happen before shutdown if draining is triggered
+	// explicitly.
+	drainer := drain.New(s.config.Drain.RetryAfter)
+	adminRegistry := admin.NewRegistry()
+	g.Go(func() error {
+		select {
+		case <-ctx.Done():
+		case <-drainer.Draining():
+		}
+		healthChecker.SetShuttingDown()
+		return nil
+	})
+
 	// Ensure the libbeat output and go-elasticsearch clients do not index
 	// any events to Elasticsearch before the integration is ready.
 	publishReady := make(chan struct{})
-	drain := make(chan struct{})
+	dropEvents := make(chan struct{})
 	g.Go(func() error {
-		if err := s.waitReady(ctx); err != nil {
+		if err := s.waitReady(ctx, publishReadyCheck); err != nil {
 			// One or more preconditions failed; drop events.
-			close(drain)
+			close(dropEvents)
 			return fmt.Errorf("error waiting for server to be ready: %w", err)
 		}
 		// All preconditions have been met; start indexing documents
@@ -335,7 +418,7 @@ func (s *Runner) Run(ctx context.Context) error {
 		if err != nil {
 			return nil, err
 		}
-		transport := &waitReadyRoundTripper{Transport: httpTransport, ready: publishReady, drain: drain}
+		transport := &waitReadyRoundTripper{Transport: httpTransport, ready: publishReady, drain: dropEvents}
 		return elasticsearch.NewClientParams(elasticsearch.ClientParams{
 			Config:    cfg,
 			Transport: transport,
@@ -351,6 +434,7 @@ func (s *Runner) Run(ctx context.Context) error {
 		fetcher, cancel, err := newSourcemapFetcher(
 			s.config.RumConfig.SourceMapping,
 			kibanaClient, newElasticsearchClient,
+			adminRegistry,
 			s.tracerProvider,
 			s.logger,
 		)
@@ -363,7 +447,7 @@ func (s *Runner) Run(ctx context.Context) error {
 
 	// Create the runServer function. We start with newBaseRunServer, and then
 	// wrap depending on the configuration in order to inject behaviour.
-	runServer := newBaseRunServer(s.listener)
+	runServer := newBaseRunServer(s.listeners)
 	authenticator, err := auth.NewAuthenticator(s.config.AgentAuth, s.logger)
 	if err != nil {
 		return err
@@ -378,13 +462,18 @@ func (s *Runner) Run(ctx context.Context) error {
 		return err
 	}
 
+	trustedProxies, err := netutil.ParseTrustedProxies(s.config.TrustedProxies)
+	if err != nil {
+		return err
+	}
+
 	// Note that we intentionally do not use a grpc.Creds ServerOption
 	// even if TLS is enabled, as TLS is handled by the net/http server.
 	gRPCLogger := s.logger.Named("grpc")
 	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(
 		interceptors.Tracing(s.tracerProvider),
 		interceptors.Recover(),
-		interceptors.ClientMetadata(),
+		interceptors.ClientMetadata(trustedProxies),
 		interceptors.Logging(gRPCLogger),
 		interceptors.Metrics(gRPCLogger, s.meterProvider),
 		interceptors.Timeout(),
@@ -392,14 +481,36 @@ func (s *Runner) Run(ctx context.Context) error {
 		interceptors.AnonymousRateLimit(ratelimitStore),
 	))
 
+	deadLetterWriter, err := s.newDeadLetterWriter()
+	if err != nil {
+		return err
+	}
+	if deadLetterWriter != nil {
+		defer deadLetterWriter.Close()
+	}
+
 	// Create the BatchProcessor chain that is used to process all events,
 	// including the metrics aggregated by APM Server.
 	finalBatchProcessor, closeFinalBatchProcessor, err := s.newFinalBatchProcessor(
-		tracer, newElasticsearchClient, memLimitGB, s.logger, s.tracerProvider, s.meterProvider,
+		tracer, newElasticsearchClient, memLimitGB, deadLetterWriter, s.logger, s.tracerProvider, s.meterProvider,
+		s.config.Spool.Enabled,
 	)
 	if err != nil {
 		return err
 	}
+	if s.config.Spool.Enabled {
+		finalBatchProcessor, closeFinalBatchProcessor, err = s.newSpoolBatchProcessor(
+			ctx, finalBatchProcessor, closeFinalBatchProcessor, s.logger, s.meterProvider,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	// When draining, wait for documents buffered by the Elasticsearch
+	// output to be indexed. Flushers added later by WrapServer, such as
+	// for tail-sampling, are flushed first. Spooled events are durable,
+	// and are not waited for.
+	drainer.AddFlusher("output", s.outputFlush.wait)
 	transactionsDroppedCounter, err := meter.Int64Counter("apm-server.sampling.transactions_dropped")
 	if err != nil {
 		return err
@@ -410,6 +521,7 @@ func (s *Runner) Run(ctx context.Context) error {
 		// aggregated metrics are also processed.
 		newObserverBatchProcessor(),
 		&modelprocessor.SetDataStream{Namespace: s.config.DataStreams.Namespace},
+		newDataStreamRouter(s.config.DataStreams),
 		srvmodelprocessor.NewEventCounter(s.meterProvider),
 
 		// The server always drops non-RUM unsampled transactions. We store RUM unsampled
@@ -424,7 +536,7 @@ func (s *Runner) Run(ctx context.Context) error {
 		finalBatchProcessor,
 	}
 
-	agentConfigFetcher, fetcherRunFunc, err := newAgentConfigFetcher(
+	agentConfigFetcher, esAgentConfigFetcher, err := newAgentConfigFetcher(
 		ctx,
 		s.config,
 		kibanaClient,
@@ -436,11 +548,9 @@ func (s *Runner) Run(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	if fetcherRunFunc != nil {
-		g.Go(func() error {
-			return fetcherRunFunc(ctx)
-		})
-	}
+	g.Go(func() error {
+		return esAgentConfigFetcher.Run(ctx)
+	})
 
 	agentConfigReporter := agentcfg.NewReporter(
 		agentConfigFetcher,
@@ -451,6 +561,19 @@ func (s *Runner) Run(ctx context.Context) error {
 		return agentConfigReporter.Run(ctx)
 	})
 
+	// The RUM endpoints may be enabled or disabled at runtime
+	// through the admin API.
+	rumKillSwitch := middleware.NewKillSwitch(s.config.RumConfig.Enabled)
+
+	// Intake requests may be captured for debugging, by starting
+	// capture through the admin API.
+	capturer, err := s.newCapturer()
+	if err != nil {
+		return err
+	}
+	defer capturer.Stop()
+	registerAdminOperations(adminRegistry, drainer, rumKillSwitch, esAgentConfigFetcher, capturer)
+
 	// Create the runServer function. We start with newBaseRunServer, and then
 	// wrap depending on the configuration in order to inject behaviour.
 	serverParams := ServerParams{
@@ -468,6 +591,11 @@ func (s *Runner) Run(ctx context.Context) error {
 		KibanaClient:           kibanaClient,
 		NewElasticsearchClient: newElasticsearchClient,
 		GRPCServer:             grpcServer,
+		HealthChecker:          healthChecker,
+		Drainer:                drainer,
+		RUMKillSwitch:          rumKillSwitch,
+		Capturer:               capturer,
+		AdminRegistry:          adminRegistry,
 		Semaphore:              semaphore.NewWeighted(int64(s.config.MaxConcurrentDecoders)),
 		BeatMonitoring:         s.beatMonitoring,
 	}
@@ -492,7 +620,17 @@ func (s *Runner) Run(ctx context.Context) error {
 		// Add a model processor that removes `event.received`, which is added by
 		// apm-data, but which we don't yet map.
 		modelprocessor.RemoveEventReceived{},
-
+	}
+	if len(s.config.Redaction.Rules) > 0 {
+		redactor, err := newRedactor(s.config.Redaction, s.meterProvider)
+		if err != nil {
+			return fmt.Errorf("failed to create redactor: %w", err)
+		}
+		// Redact personal data before any fields are derived from it,
+		// e.g. the error message from the exception message.
+		preBatchProcessors = append(preBatchProcessors, redactor)
+	}
+	preBatchProcessors = append(preBatchProcessors,
 		// Pre-process events before they are sent to the final processors for
 		// aggregation, sampling, and indexing.
 		modelprocessor.SetHostHostname{},
@@ -503,23 +641,51 @@ func (s *Runner) Run(ctx context.Context) error {
 			},
 		},
 		modelprocessor.SetErrorMessage{},
-	}
+	)
 	if s.config.DefaultServiceEnvironment != "" {
 		preBatchProcessors = append(preBatchProcessors, &modelprocessor.SetDefaultServiceEnvironment{
 			DefaultServiceEnvironment: s.config.DefaultServiceEnvironment,
 		})
 	}
+	if s.config.ParseUserAgent {
+		preBatchProcessors = append(preBatchProcessors, srvmodelprocessor.SetUserAgentName{})
+	}
+	if s.config.GeoIPDatabasePath != "" {
+		geoIP, err := srvmodelprocessor.NewGeoIP(s.config.GeoIPDatabasePath, s.logger.Named("geoip"))
+		if err != nil {
+			return err
+		}
+		g.Go(func() error {
+			return geoIP.Run(ctx)
+		})
+		preBatchProcessors = append(preBatchProcessors, geoIP)
+	}
+	if len(s.config.Processors) > 0 {
+		// Apply user-defined processors after the server's own pre-processing,
+		// so they observe the same fields as are indexed.
+		processorPipeline, err := processors.New(s.config.Processors, s.meterProvider)
+		if err != nil {
+			return fmt.Errorf("failed to create processors: %w", err)
+		}
+		preBatchProcessors = append(preBatchProcessors, processorPipeline)
+	}
 	serverParams.BatchProcessor = append(preBatchProcessors, serverParams.BatchProcessor)
 
 	// Start the main server and the optional server for self-instrumentation.
 	g.Go(func() error {
 		return runServer(ctx, serverParams)
 	})
+	if s.adminListener != nil {
+		g.Go(func() error {
+			return s.runAdminServer(ctx, *s.adminListener, adminRegistry)
+		})
+	}
 	closeTracerProcessor := func(context.Context) error { return nil }
 	if tracerServerListener != nil {
 		// use a batch processor without tracing to prevent the tracing processor from sending traces to itself
 		finalTracerBatchProcessor, closeTracerFinalBatchProcessor, err := s.newFinalBatchProcessor(
-			tracer, newElasticsearchClient, memLimitGB, s.logger, tracenoop.NewTracerProvider(), metricnoop.NewMeterProvider(),
+			tracer, newElasticsearchClient, memLimitGB, deadLetterWriter, s.logger, tracenoop.NewTracerProvider(), metricnoop.NewMeterProvider(),
+			false,
 		)
 		if err != nil {
 			return err
@@ -528,6 +694,7 @@ func (s *Runner) Run(ctx context.Context) error {
 		tracerBatchProcessor := modelprocessor.Chained{
 			newObserverBatchProcessor(),
 			&modelprocessor.SetDataStream{Namespace: s.config.DataStreams.Namespace},
+			newDataStreamRouter(s.config.DataStreams),
 			finalTracerBatchProcessor,
 		}
 
@@ -551,11 +718,54 @@ func (s *Runner) Run(ctx context.Context) error {
 	}
 
 	result := g.Wait()
+	s.logger.Info("flushing buffered events to the output")
 	closeErr := closeFinalBatchProcessor(backgroundContext)
 	closeTracerErr := closeTracerProcessor(backgroundContext)
 	return errors.Join(result, closeErr, closeTracerErr)
 }
 
+// newDataStreamRouter returns a model.BatchProcessor which overrides
+// the data stream namespace and dataset of events according to the
+// data stream routing rules in cfg.
+func newDataStreamRouter(cfg config.DataStreamsConfig) *srvmodelprocessor.DataStreamRouter {
+	rules := make([]srvmodelprocessor.DataStreamRoutingRule, len(cfg.Routing))
+	for i, rule := range cfg.Routing {
+		rules[i] = srvmodelprocessor.DataStreamRoutingRule{
+			EventMatcher: srvmodelprocessor.EventMatcher{
+				ServiceName:        rule.ServiceName,
+				ServiceEnvironment: rule.ServiceEnvironment,
+				AgentName:          rule.AgentName,
+				DataStreamType:     rule.DataStreamType,
+				Labels:             rule.Labels,
+			},
+			Namespace: rule.Namespace,
+			Dataset:   rule.Dataset,
+		}
+	}
+	return &srvmodelprocessor.DataStreamRouter{Rules: rules}
+}
+
+// newRedactor returns a model.BatchProcessor which redacts personal
+// data from events, according to the configured redaction rules.
+func newRedactor(cfg config.RedactionConfig, mp metric.MeterProvider) (*processors.Redactor, error) {
+	rules := make([]processors.RedactionRule, len(cfg.Rules))
+	for i, rule := range cfg.Rules {
+		rules[i] = processors.RedactionRule{
+			Fields:      rule.Fields,
+			Keys:        rule.Keys,
+			Hash:        rule.Action == config.RedactionActionHash,
+			Replacement: rule.Replacement,
+		}
+		if rule.Pattern != "" {
+			rules[i].Pattern = regexp.MustCompile(rule.Pattern) // validated by config
+		}
+		if rule.HashKey != "" {
+			rules[i].HashKey = []byte(rule.HashKey)
+		}
+	}
+	return processors.NewRedactor(rules, mp)
+}
+
 // newInstrumentation is a thin wrapper around libbeat instrumentation that
 // sets missing tracer configuration from elastic agent.
 func newInstrumentation(rawConfig *agentconfig.C, logger *logp.Logger) (instrumentation.Instrumentation, error) {
@@ -647,22 +857,55 @@ func linearScaledValue(perGBIncrement, memLimitGB, constant float64) int {
 	return int(memLimitGB*perGBIncrement + constant)
 }
 
-// waitReady waits until the server is ready to index events.
-func (s *Runner) waitReady(
-	ctx context.Context,
-) error {
-	var preconditions []func(context.Context) error
-	var esOutputClient *elasticsearch.Client
-	if s.elasticsearchOutputConfig != nil {
-		esConfig := elasticsearch.DefaultConfig()
-		err := s.elasticsearchOutputConfig.Unpack(&esConfig)
+// newElasticsearchOutputClient returns a client for the Elasticsearch output,
+// or nil if the output is not Elasticsearch. The returned client does not wait
+// for the server to be ready, and must not be used for indexing.
+func (s *Runner) newElasticsearchOutputClient() (*elasticsearch.Client, error) {
+	if s.elasticsearchOutputConfig == nil {
+		return nil, nil
+	}
+	esConfig := elasticsearch.DefaultConfig()
+	if err := s.elasticsearchOutputConfig.Unpack(&esConfig); err != nil {
+		return nil, err
+	}
+	return elasticsearch.NewClient(esConfig, s.logger)
+}
+
+// registerOutputHealthProbe registers a health probe which checks that the
+// Elasticsearch output is reachable, if the output is Elasticsearch.
+func (s *Runner) registerOutputHealthProbe(checker *health.Checker) error {
+	esOutputClient, err := s.newElasticsearchOutputClient()
+	if err != nil || esOutputClient == nil {
+		return err
+	}
+	checker.RegisterProbe("output", func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, "/", nil)
 		if err != nil {
 			return err
 		}
-		esOutputClient, err = elasticsearch.NewClient(esConfig, s.logger)
+		resp, err := esOutputClient.Perform(req)
 		if err != nil {
-			return err
+			return fmt.Errorf("error reaching Elasticsearch output: %w", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode > 299 {
+			return fmt.Errorf("error reaching Elasticsearch output: status_code=%d", resp.StatusCode)
 		}
+		return nil
+	})
+	return nil
+}
+
+// waitReady waits until the server is ready to index events, reporting
+// the result of each attempt to readyCheck.
+func (s *Runner) waitReady(
+	ctx context.Context,
+	readyCheck *health.Check,
+) error {
+	var preconditions []func(context.Context) error
+	esOutputClient, err := s.newElasticsearchOutputClient()
+	if err != nil {
+		return err
 	}
 
 	// libbeat and go-elasticsearch both ensure a minimum level of Basic.
@@ -700,14 +943,17 @@ func (s *Runner) waitReady(
 	}
 
 	if len(preconditions) == 0 {
+		readyCheck.Set(nil)
 		return nil
 	}
 	check := func(ctx context.Context) error {
 		for _, pre := range preconditions {
 			if err := pre(ctx); err != nil {
+				readyCheck.Set(err)
 				return err
 			}
 		}
+		readyCheck.Set(nil)
 		return nil
 	}
 	return waitReady(ctx, s.config.WaitReadyInterval, s.tracerProvider, s.logger, check)
@@ -715,15 +961,34 @@ func (s *Runner) waitReady(
 
 // newFinalBatchProcessor returns the final model.BatchProcessor that publishes events,
 // and a cleanup function which should be called on server shutdown. If the output is
-// "elasticsearch", then we use docappender; otherwise we use the libbeat publisher.
+// "elasticsearch", then we use docappender; if the output is "otlp", then we use the
+// OTLP exporter; otherwise we use the libbeat publisher.
+//
+// If deadLetter is non-nil, documents rejected by Elasticsearch are written to it.
+//
+// If output routing rules are configured, events matching a rule are sent to the
+// named Elasticsearch output of that rule, and all other events are sent to the
+// "elasticsearch" output.
+//
+// If synchronous is true, events are indexed into Elasticsearch with a syncIndexer
+// in place of docappender, such that ProcessBatch returns only once the events have
+// been indexed. This is used for delivering spooled events.
 func (s *Runner) newFinalBatchProcessor(
 	tracer *apm.Tracer,
 	newElasticsearchClient func(*elasticsearch.Config, *logp.Logger) (*elasticsearch.Client, error),
 	memLimit float64,
+	deadLetter *deadletter.Writer,
 	logger *logp.Logger,
 	tp trace.TracerProvider,
 	mp metric.MeterProvider,
+	synchronous bool,
 ) (modelpb.BatchProcessor, func(context.Context) error, error) {
+	if s.elasticsearchOutputConfig == nil && len(s.config.OutputRouting.Rules) > 0 {
+		logger.Warn("output_routing is only supported with the Elasticsearch output, ignoring output_routing config")
+	}
+	if s.outputConfig.Name() == otlpOutputName {
+		return s.newOTLPFinalBatchProcessor(logger, mp)
+	}
 	if s.elasticsearchOutputConfig == nil {
 		s.beatMonitoring.StatsRegistry().Remove("libbeat")
 		libbeatMonitoringRegistry := s.beatMonitoring.StatsRegistry().GetOrCreateRegistry("libbeat")
@@ -735,24 +1000,248 @@ func (s *Runner) newFinalBatchProcessor(
 	outputRegistry.Clear()
 	monitoring.NewString(outputRegistry, "name").Set("elasticsearch")
 
-	// Create the docappender and Elasticsearch config
-	appenderCfg, esCfg, err := s.newDocappenderConfig(tp, mp, memLimit)
+	// newOutput returns the processor for an Elasticsearch output, and
+	// a function for closing it.
+	newOutput := func(
+		esOutputConfig *agentconfig.C, logger *logp.Logger, mp metric.MeterProvider,
+	) (modelpb.BatchProcessor, func(context.Context) error, error) {
+		if synchronous {
+			indexer, err := s.newSyncIndexer(
+				esOutputConfig, newElasticsearchClient, memLimit, deadLetter, logger, tp, mp,
+			)
+			if err != nil {
+				return nil, nil, err
+			}
+			return indexer, func(context.Context) error { return nil }, nil
+		}
+		appender, err := s.newDocappender(
+			esOutputConfig, newElasticsearchClient, memLimit, deadLetter, logger, tp, mp,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		return newDocappenderBatchProcessor(appender), appender.Close, nil
+	}
+
+	output, closeOutput, err := newOutput(s.elasticsearchOutputConfig, logger, mp)
 	if err != nil {
 		return nil, nil, err
 	}
+	if len(s.config.OutputRouting.Rules) == 0 {
+		return output, closeOutput, nil
+	}
+
+	// Create an output for each named output, with metrics
+	// distinguished by an instrumentation scope attribute.
+	closers := []func(context.Context) error{closeOutput}
+	closeOutputs := func(ctx context.Context) error {
+		var errs []error
+		for _, closeFunc := range closers {
+			if err := closeFunc(ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+	outputs := make(map[string]modelpb.BatchProcessor)
+	for name, outputConfig := range s.config.OutputRouting.Outputs {
+		namedOutput, closeNamedOutput, err := newOutput(
+			outputConfig,
+			logger.With(logp.String("output.name", name)),
+			namedOutputMeterProvider{MeterProvider: mp, name: name},
+		)
+		if err != nil {
+			closeOutputs(context.Background())
+			return nil, nil, fmt.Errorf("failed to create output %q: %w", name, err)
+		}
+		closers = append(closers, closeNamedOutput)
+		outputs[name] = namedOutput
+	}
+	routes := make([]outputRoute, len(s.config.OutputRouting.Rules))
+	for i, rule := range s.config.OutputRouting.Rules {
+		routes[i] = outputRoute{
+			matcher: srvmodelprocessor.EventMatcher{
+				ServiceName:        rule.ServiceName,
+				ServiceEnvironment: rule.ServiceEnvironment,
+				DataStreamType:     rule.DataStreamType,
+				Labels:             rule.Labels,
+			},
+			processor: outputs[rule.Output],
+		}
+	}
+	return newOutputRoutingBatchProcessor(routes, output), closeOutputs, nil
+}
+
+// newSyncIndexer returns a syncIndexer which synchronously indexes
+// events into the Elasticsearch cluster configured by esOutputConfig.
+func (s *Runner) newSyncIndexer(
+	esOutputConfig *agentconfig.C,
+	newElasticsearchClient func(*elasticsearch.Config, *logp.Logger) (*elasticsearch.Client, error),
+	memLimit float64,
+	deadLetter *deadletter.Writer,
+	logger *logp.Logger,
+	tp trace.TracerProvider,
+	mp metric.MeterProvider,
+) (*syncIndexer, error) {
+	appenderCfg, esCfg, err := s.newDocappenderConfig(esOutputConfig, tp, mp, memLimit)
+	if err != nil {
+		return nil, err
+	}
 	client, err := newElasticsearchClient(esCfg, logger)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	var transport elastictransport.Interface = client
+	if deadLetter != nil {
+		transport = deadletter.NewTransport(client, deadLetter, logger)
 	}
-	appender, err := docappender.New(client, appenderCfg)
+	return newSyncIndexer(
+		docappender.BulkIndexerConfigFrom(transport, appenderCfg),
+		appenderCfg.FlushBytes, logger, mp,
+	)
+}
+
+// newDocappender returns a docappender.Appender which indexes
+// events into the Elasticsearch cluster configured by esOutputConfig.
+func (s *Runner) newDocappender(
+	esOutputConfig *agentconfig.C,
+	newElasticsearchClient func(*elasticsearch.Config, *logp.Logger) (*elasticsearch.Client, error),
+	memLimit float64,
+	deadLetter *deadletter.Writer,
+	logger *logp.Logger,
+	tp trace.TracerProvider,
+	mp metric.MeterProvider,
+) (*docappender.Appender, error) {
+	// Create the docappender and Elasticsearch config
+	appenderCfg, esCfg, err := s.newDocappenderConfig(esOutputConfig, tp, mp, memLimit)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
+	client, err := newElasticsearchClient(esCfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	var transport elastictransport.Interface = client
+	if deadLetter != nil {
+		transport = deadletter.NewTransport(client, deadLetter, logger)
+	}
+	transport = s.outputFlush.wrap(transport, appenderCfg.FlushInterval)
+	return docappender.New(transport, appenderCfg)
+}
+
+// namedOutputMeterProvider is a metric.MeterProvider which adds the
+// output name as an instrumentation scope attribute to all meters,
+// so metrics for named outputs are reported separately from those of
+// output.elasticsearch.
+type namedOutputMeterProvider struct {
+	metric.MeterProvider
+	name string
+}
+
+func (mp namedOutputMeterProvider) Meter(name string, opts ...metric.MeterOption) metric.Meter {
+	opts = append(opts, metric.WithInstrumentationAttributes(attribute.String("output.name", mp.name)))
+	return mp.MeterProvider.Meter(name, opts...)
+}
+
+// newDeadLetterWriter returns a deadletter.Writer for storing documents
+// rejected by Elasticsearch, or nil if dead-lettering is disabled or the
+// output is not Elasticsearch.
+func (s *Runner) newDeadLetterWriter() (*deadletter.Writer, error) {
+	if !s.config.DeadLetter.Enabled {
+		return nil, nil
+	}
+	if s.elasticsearchOutputConfig == nil {
+		s.logger.Warn("dead_letter is only supported with the Elasticsearch output, ignoring dead_letter config")
+		return nil, nil
+	}
+	dir := s.config.DeadLetter.Path
+	if dir == "" {
+		dir = paths.Resolve(paths.Data, deadletter.DirName)
+	}
+	w, err := deadletter.NewWriter(deadletter.Config{
+		Dir:           dir,
+		MaxFileSize:   uint(s.config.DeadLetter.MaxFileSizeParsed),
+		MaxFiles:      s.config.DeadLetter.MaxFiles,
+		Logger:        s.logger.Named("deadletter"),
+		MeterProvider: s.meterProvider,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dead-letter writer: %w", err)
+	}
+	return w, nil
+}
 
-	return newDocappenderBatchProcessor(appender), appender.Close, nil
+// newCapturer returns a capture.Capturer for capturing intake requests
+// for debugging.
+func (s *Runner) newCapturer() (*capture.Capturer, error) {
+	dir := s.config.DebugCapture.Path
+	if dir == "" {
+		dir = paths.Resolve(paths.Logs, capture.DirName)
+	}
+	c, err := capture.New(capture.Config{
+		Dir:         dir,
+		MaxFileSize: uint(s.config.DebugCapture.MaxFileSizeParsed),
+		MaxFiles:    s.config.DebugCapture.MaxFiles,
+		MaxBodySize: int(s.config.DebugCapture.MaxBodySizeParsed),
+		MaxDuration: s.config.DebugCapture.MaxDuration,
+		Logger:      s.logger.Named("capture"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create debug capturer: %w", err)
+	}
+	return c, nil
+}
+
+// spoolDir is the directory under path.data in which events are spooled,
+// if apm-server.spool.path is not set.
+const spoolDir = "spool"
+
+// newSpoolBatchProcessor returns a model.BatchProcessor that durably spools
+// events on disk before they are passed on to the final batch processor, and
+// a cleanup function which should be called on server shutdown in place of
+// the final batch processor's. Events remaining in the spool on shutdown are
+// delivered after the server is restarted.
+func (s *Runner) newSpoolBatchProcessor(
+	ctx context.Context,
+	final modelpb.BatchProcessor,
+	closeFinal func(context.Context) error,
+	logger *logp.Logger,
+	mp metric.MeterProvider,
+) (modelpb.BatchProcessor, func(context.Context) error, error) {
+	if s.elasticsearchOutputConfig == nil {
+		logger.Warn("spool is only supported with the Elasticsearch output, ignoring spool config")
+		return final, closeFinal, nil
+	}
+	dir := s.config.Spool.Path
+	if dir == "" {
+		dir = paths.Resolve(paths.Data, spoolDir)
+	}
+	sp, err := spool.New(ctx, spool.Config{
+		Dir:           dir,
+		MaxSize:       s.config.Spool.MaxSizeParsed,
+		Processor:     final,
+		Logger:        logger.Named("spool"),
+		MeterProvider: mp,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create spool: %w", err)
+	}
+	runCtx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- sp.Run(runCtx)
+	}()
+	closeSpool := func(ctx context.Context) error {
+		cancel()
+		runErr := <-done
+		return errors.Join(runErr, sp.Close(), closeFinal(ctx))
+	}
+	return newSpoolBatchProcessor(sp), closeSpool, nil
 }
 
-func (s *Runner) newDocappenderConfig(tp trace.TracerProvider, mp metric.MeterProvider, memLimit float64) (
+func (s *Runner) newDocappenderConfig(
+	esOutputConfig *agentconfig.C, tp trace.TracerProvider, mp metric.MeterProvider, memLimit float64,
+) (
 	docappender.Config, *elasticsearch.Config, error,
 ) {
 	esConfig := struct {
@@ -771,7 +1260,7 @@ func (s *Runner) newDocappenderConfig(tp trace.TracerProvider, mp metric.MeterPr
 	}
 	esConfig.MaxIdleConnsPerHost = 10
 
-	if err := s.elasticsearchOutputConfig.Unpack(&esConfig); err != nil {
+	if err := esOutputConfig.Unpack(&esConfig); err != nil {
 		return docappender.Config{}, nil, err
 	}
 
@@ -853,6 +1342,30 @@ func docappenderConfig(
 	return opts
 }
 
+const otlpOutputName = "otlp"
+
+// newOTLPFinalBatchProcessor returns a model.BatchProcessor that converts
+// events to OTLP and exports them to the receiver configured by output.otlp.
+func (s *Runner) newOTLPFinalBatchProcessor(
+	logger *logp.Logger,
+	mp metric.MeterProvider,
+) (modelpb.BatchProcessor, func(context.Context) error, error) {
+	stateRegistry := s.beatMonitoring.StateRegistry()
+	outputRegistry := stateRegistry.GetOrCreateRegistry("output")
+	outputRegistry.Clear()
+	monitoring.NewString(outputRegistry, "name").Set(otlpOutputName)
+
+	cfg := otlpexport.DefaultConfig()
+	if err := s.outputConfig.Config().Unpack(&cfg); err != nil {
+		return nil, nil, fmt.Errorf("failed to unpack otlp output config: %w", err)
+	}
+	exporter, err := otlpexport.New(cfg, logger.Named("otlp"), mp)
+	if err != nil {
+		return nil, nil, err
+	}
+	return exporter, exporter.Close, nil
+}
+
 func (s *Runner) newLibbeatFinalBatchProcessor(
 	tracer *apm.Tracer,
 	libbeatMonitoringRegistry *monitoring.Registry,
@@ -925,6 +1438,7 @@ func newSourcemapFetcher(
 	cfg config.SourceMapping,
 	kibanaClient *kibana.Client,
 	newElasticsearchClient func(*elasticsearch.Config, *logp.Logger) (*elasticsearch.Client, error),
+	adminRegistry *admin.Registry,
 	tp trace.TracerProvider,
 	logger *logp.Logger,
 ) (sourcemap.Fetcher, context.CancelFunc, error) {
@@ -951,6 +1465,13 @@ func newSourcemapFetcher(
 		return nil, nil, err
 	}
 	sourcemapFetcher := sourcemap.NewSourcemapFetcher(metadataFetcher, cachingFetcher, logger)
+	adminRegistry.Register(
+		"sourcemap.purge_cache",
+		"Remove all parsed source maps from the in-memory cache.",
+		func(context.Context, url.Values) (any, error) {
+			return map[string]int{"purged": cachingFetcher.Purge()}, nil
+		},
+	)
 
 	fetchers = append(fetchers, sourcemapFetcher)
 
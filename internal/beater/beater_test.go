@@ -38,6 +38,7 @@ import (
 	"go.opentelemetry.io/otel/trace/noop"
 	"go.uber.org/zap"
 
+	"github.com/elastic/apm-server/internal/beater/admin"
 	"github.com/elastic/apm-server/internal/beater/config"
 	"github.com/elastic/apm-server/internal/elasticsearch"
 	agentconfig "github.com/elastic/elastic-agent-libs/config"
@@ -77,6 +78,7 @@ func TestStoreUsesRUMElasticsearchConfig(t *testing.T) {
 	_, cancel, err := newSourcemapFetcher(
 		cfg.RumConfig.SourceMapping,
 		nil, elasticsearch.NewClient,
+		admin.NewRegistry(),
 		noop.NewTracerProvider(),
 		logptest.NewTestingLogger(t, ""),
 	)
@@ -182,7 +184,7 @@ func TestRunnerNewDocappenderConfig(t *testing.T) {
 				elasticsearchOutputConfig: agentconfig.NewConfig(),
 				logger:                    logptest.NewTestingLogger(t, "test"),
 			}
-			docCfg, esCfg, err := r.newDocappenderConfig(nil, nil, c.memSize)
+			docCfg, esCfg, err := r.newDocappenderConfig(r.elasticsearchOutputConfig, nil, nil, c.memSize)
 			require.NoError(t, err)
 			assert.Equal(t, docappender.Config{
 				Logger:                zap.New(r.logger.Core(), zap.WithCaller(true)),
@@ -215,7 +217,7 @@ func TestRunnerNewDocappenderConfig(t *testing.T) {
 				}),
 				logger: logptest.NewTestingLogger(t, "test"),
 			}
-			docCfg, esCfg, err := r.newDocappenderConfig(nil, nil, c.memSize)
+			docCfg, esCfg, err := r.newDocappenderConfig(r.elasticsearchOutputConfig, nil, nil, c.memSize)
 			require.NoError(t, err)
 			assert.Equal(t, docappender.Config{
 				Logger:                zap.New(r.logger.Core(), zap.WithCaller(true)),
@@ -0,0 +1,58 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"errors"
+	"net"
+
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+// DefaultAdminPort is the default port for the admin API listener.
+const DefaultAdminPort = "8203"
+
+// AdminConfig holds configuration for the admin API, which is served
+// on its own listener.
+type AdminConfig struct {
+	// Enabled controls whether the admin API is served.
+	Enabled bool `config:"enabled"`
+
+	// Host holds the address to listen on, with the same format as
+	// apm-server.host. If no port is specified, DefaultAdminPort is used.
+	Host string `config:"host"`
+
+	// TLS holds the TLS configuration for the admin listener. The TLS
+	// configuration of apm-server.ssl is not inherited.
+	TLS *tlscommon.ServerConfig `config:"ssl"`
+
+	// SecretToken holds the token which requests to the admin API
+	// must carry in a Bearer Authorization header.
+	SecretToken string `config:"secret_token"`
+}
+
+func (c *AdminConfig) Validate() error {
+	if c.Enabled && c.SecretToken == "" {
+		return errors.New("secret_token must be set when the admin API is enabled")
+	}
+	return nil
+}
+
+func defaultAdminConfig() AdminConfig {
+	return AdminConfig{Host: net.JoinHostPort("127.0.0.1", DefaultAdminPort)}
+}
@@ -0,0 +1,50 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestAdminConfig(t *testing.T) {
+	c, err := NewConfig(config.MustNewConfigFrom(map[string]interface{}{
+		"admin": map[string]interface{}{
+			"enabled":      true,
+			"secret_token": "abc123",
+		},
+	}), nil, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	assert.Equal(t, AdminConfig{
+		Enabled:     true,
+		Host:        "127.0.0.1:8203",
+		SecretToken: "abc123",
+	}, c.Admin)
+}
+
+func TestAdminConfigInvalid(t *testing.T) {
+	_, err := NewConfig(config.MustNewConfigFrom(map[string]interface{}{
+		"admin.enabled": true,
+	}), nil, logptest.NewTestingLogger(t, ""))
+	assert.ErrorContains(t, err, "secret_token must be set when the admin API is enabled")
+}
@@ -18,6 +18,7 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"time"
@@ -43,25 +44,39 @@ type Config struct {
 	// AgentAuth holds agent auth config.
 	AgentAuth AgentAuth `config:"auth"`
 
-	MaxHeaderSize             int                     `config:"max_header_size"`
-	IdleTimeout               time.Duration           `config:"idle_timeout"`
-	ReadTimeout               time.Duration           `config:"read_timeout"`
-	WriteTimeout              time.Duration           `config:"write_timeout"`
-	MaxEventSize              int                     `config:"max_event_size"`
-	ShutdownTimeout           time.Duration           `config:"shutdown_timeout"`
-	TLS                       *tlscommon.ServerConfig `config:"ssl"`
-	MaxConnections            int                     `config:"max_connections"`
-	ResponseHeaders           map[string][]string     `config:"response_headers"`
-	Expvar                    ExpvarConfig            `config:"expvar"`
-	Pprof                     PprofConfig             `config:"pprof"`
-	AugmentEnabled            bool                    `config:"capture_personal_data"`
-	RumConfig                 RumConfig               `config:"rum"`
-	Kibana                    KibanaConfig            `config:"kibana"`
-	AgentConfig               AgentConfig             `config:"agent.config"`
-	Aggregation               AggregationConfig       `config:"aggregation"`
-	Sampling                  SamplingConfig          `config:"sampling"`
-	DataStreams               DataStreamsConfig       `config:"data_streams"`
-	DefaultServiceEnvironment string                  `config:"default_service_environment"`
+	MaxHeaderSize             int                       `config:"max_header_size"`
+	IdleTimeout               time.Duration             `config:"idle_timeout"`
+	ReadTimeout               time.Duration             `config:"read_timeout"`
+	WriteTimeout              time.Duration             `config:"write_timeout"`
+	MaxEventSize              int                       `config:"max_event_size"`
+	ShutdownTimeout           time.Duration             `config:"shutdown_timeout"`
+	Drain                     DrainConfig               `config:"drain"`
+	TLS                       *tlscommon.ServerConfig   `config:"ssl"`
+	MaxConnections            int                       `config:"max_connections"`
+	TrustedProxies            TrustedProxies            `config:"trusted_proxies"`
+	ProxyProtocol             bool                      `config:"proxy_protocol"`
+	Listeners                 ListenersConfig           `config:"listeners"`
+	Admin                     AdminConfig               `config:"admin"`
+	ResponseHeaders           map[string][]string       `config:"response_headers"`
+	Expvar                    ExpvarConfig              `config:"expvar"`
+	Pprof                     PprofConfig               `config:"pprof"`
+	AugmentEnabled            bool                      `config:"capture_personal_data"`
+	ParseUserAgent            bool                      `config:"parse_user_agent"`
+	GeoIPDatabasePath         string                    `config:"geoip.database_path"`
+	RumConfig                 RumConfig                 `config:"rum"`
+	Kibana                    KibanaConfig              `config:"kibana"`
+	AgentConfig               AgentConfig               `config:"agent.config"`
+	Aggregation               AggregationConfig         `config:"aggregation"`
+	Sampling                  SamplingConfig            `config:"sampling"`
+	DataStreams               DataStreamsConfig         `config:"data_streams"`
+	Spool                     SpoolConfig               `config:"spool"`
+	DeadLetter                DeadLetterConfig          `config:"dead_letter"`
+	DebugCapture              DebugCaptureConfig        `config:"debug_capture"`
+	SelfInstrumentation       SelfInstrumentationConfig `config:"self_instrumentation"`
+	OutputRouting             OutputRoutingConfig       `config:"output_routing"`
+	Processors                []*config.C               `config:"processors"`
+	Redaction                 RedactionConfig           `config:"redaction"`
+	DefaultServiceEnvironment string                    `config:"default_service_environment"`
 
 	// WaitReadyInterval holds the interval for checks when waiting for
 	// the integration package to be installed, and for checking the
@@ -93,6 +108,12 @@ func NewConfig(ucfg *config.C, outputESCfg *config.C, logger *logp.Logger) (*Con
 		return nil, err
 	}
 
+	if c.RumConfig.Enabled && c.RumConfig.HTTP3.Enabled {
+		if _, tls := c.RUMListener(); !tls.IsEnabled() {
+			return nil, errors.New("rum.http3 requires TLS to be enabled for the listener serving RUM endpoints")
+		}
+	}
+
 	if err := c.AgentAuth.setAnonymousDefaults(logger, c.RumConfig.Enabled); err != nil {
 		return nil, err
 	}
@@ -119,19 +140,25 @@ func DefaultConfig() *Config {
 		WriteTimeout:    30 * time.Second,
 		MaxEventSize:    300 * 1024, // 300 kb
 		ShutdownTimeout: 30 * time.Second,
+		Drain:           defaultDrainConfig(),
 		AugmentEnabled:  true,
 		Expvar: ExpvarConfig{
 			Enabled: false,
 			URL:     "/debug/vars",
 		},
-		Pprof:             PprofConfig{Enabled: false},
-		RumConfig:         defaultRum(),
-		Kibana:            defaultKibanaConfig(),
-		AgentConfig:       defaultAgentConfig(),
-		Aggregation:       defaultAggregationConfig(),
-		Sampling:          defaultSamplingConfig(),
-		DataStreams:       defaultDataStreamsConfig(),
-		AgentAuth:         defaultAgentAuth(),
-		WaitReadyInterval: 5 * time.Second,
+		Pprof:               PprofConfig{Enabled: false},
+		RumConfig:           defaultRum(),
+		Kibana:              defaultKibanaConfig(),
+		AgentConfig:         defaultAgentConfig(),
+		Aggregation:         defaultAggregationConfig(),
+		Sampling:            defaultSamplingConfig(),
+		DataStreams:         defaultDataStreamsConfig(),
+		Spool:               defaultSpoolConfig(),
+		Admin:               defaultAdminConfig(),
+		DeadLetter:          defaultDeadLetterConfig(),
+		DebugCapture:        defaultDebugCaptureConfig(),
+		SelfInstrumentation: defaultSelfInstrumentationConfig(),
+		AgentAuth:           defaultAgentAuth(),
+		WaitReadyInterval:   5 * time.Second,
 	}
 }
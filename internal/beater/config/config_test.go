@@ -185,13 +185,17 @@ func TestUnpackConfig(t *testing.T) {
 		},
 		"overwrite default": {
 			inpCfg: map[string]interface{}{
-				"host":                    "localhost:3000",
-				"max_header_size":         8,
-				"max_event_size":          100,
-				"idle_timeout":            5 * time.Second,
-				"read_timeout":            3 * time.Second,
-				"write_timeout":           4 * time.Second,
-				"shutdown_timeout":        9 * time.Second,
+				"host":             "localhost:3000",
+				"max_header_size":  8,
+				"max_event_size":   100,
+				"idle_timeout":     5 * time.Second,
+				"read_timeout":     3 * time.Second,
+				"write_timeout":    4 * time.Second,
+				"shutdown_timeout": 9 * time.Second,
+				"drain": map[string]interface{}{
+					"timeout":     5 * time.Second,
+					"retry_after": 2 * time.Second,
+				},
 				"capture_personal_data":   true,
 				"max_concurrent_decoders": 100,
 				"auth": map[string]interface{}{
@@ -266,15 +270,31 @@ func TestUnpackConfig(t *testing.T) {
 					},
 				},
 				"default_service_environment": "overridden",
+				"spool": map[string]interface{}{
+					"enabled":  true,
+					"path":     "/var/lib/apm-server/spool",
+					"max_size": "10GB",
+				},
+				"dead_letter": map[string]interface{}{
+					"enabled":       true,
+					"path":          "/var/lib/apm-server/deadletter",
+					"max_file_size": "1MB",
+					"max_files":     3,
+				},
 			},
 			outCfg: &Config{
-				Host:                  "localhost:3000",
-				MaxHeaderSize:         8,
-				MaxEventSize:          100,
-				IdleTimeout:           5000000000,
-				ReadTimeout:           3000000000,
-				WriteTimeout:          4000000000,
-				ShutdownTimeout:       9000000000,
+				Host:            "localhost:3000",
+				MaxHeaderSize:   8,
+				MaxEventSize:    100,
+				IdleTimeout:     5000000000,
+				ReadTimeout:     3000000000,
+				WriteTimeout:    4000000000,
+				ShutdownTimeout: 9000000000,
+				Drain: DrainConfig{
+					Timeout:    5 * time.Second,
+					RetryAfter: 2 * time.Second,
+				},
+				Admin:                 defaultAdminConfig(),
 				MaxConcurrentDecoders: 100,
 				AgentAuth: AgentAuth{
 					SecretToken: "1234random",
@@ -382,7 +402,22 @@ func TestUnpackConfig(t *testing.T) {
 				DataStreams: DataStreamsConfig{
 					Namespace: "default",
 				},
-				WaitReadyInterval: 5 * time.Second,
+				Spool: SpoolConfig{
+					Enabled:       true,
+					Path:          "/var/lib/apm-server/spool",
+					MaxSize:       "10GB",
+					MaxSizeParsed: 10000000000,
+				},
+				DeadLetter: DeadLetterConfig{
+					Enabled:           true,
+					Path:              "/var/lib/apm-server/deadletter",
+					MaxFileSize:       "1MB",
+					MaxFileSizeParsed: 1000000,
+					MaxFiles:          3,
+				},
+				DebugCapture:        defaultDebugCaptureConfig(),
+				SelfInstrumentation: defaultSelfInstrumentationConfig(),
+				WaitReadyInterval:   5 * time.Second,
 			},
 		},
 		"merge config with default": {
@@ -440,6 +475,8 @@ func TestUnpackConfig(t *testing.T) {
 				ReadTimeout:     30000000000,
 				WriteTimeout:    30000000000,
 				ShutdownTimeout: 30000000000,
+				Drain:           defaultDrainConfig(),
+				Admin:           defaultAdminConfig(),
 				AgentAuth: AgentAuth{
 					SecretToken: "1234random",
 					APIKey: APIKeyAgentAuth{
@@ -514,7 +551,20 @@ func TestUnpackConfig(t *testing.T) {
 				DataStreams: DataStreamsConfig{
 					Namespace: "foo",
 				},
-				WaitReadyInterval: 5 * time.Second,
+				Spool: SpoolConfig{
+					Enabled:       false,
+					MaxSize:       "1gb",
+					MaxSizeParsed: 1000000000,
+				},
+				DeadLetter: DeadLetterConfig{
+					Enabled:           false,
+					MaxFileSize:       "100mb",
+					MaxFileSizeParsed: 100000000,
+					MaxFiles:          10,
+				},
+				DebugCapture:        defaultDebugCaptureConfig(),
+				SelfInstrumentation: defaultSelfInstrumentationConfig(),
+				WaitReadyInterval:   5 * time.Second,
 			},
 		},
 		"kibana trailing slash": {
@@ -17,9 +17,102 @@
 
 package config
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// maxDataStreamPartLength holds the maximum length, in bytes,
+// of a data stream dataset or namespace.
+const maxDataStreamPartLength = 100
+
 // DataStreamsConfig holds data streams configuration.
 type DataStreamsConfig struct {
 	Namespace string `config:"namespace"`
+
+	// Routing holds rules for overriding the namespace and dataset of
+	// matching events. Rules are evaluated in order, and only the first
+	// matching rule is applied.
+	Routing []DataStreamRoutingRule `config:"routing"`
+}
+
+// DataStreamRoutingRule holds a rule for overriding the data stream
+// namespace and dataset of matching events.
+//
+// An event matches a rule if it matches all of the rule's conditions.
+// Conditions with multiple values match if any of the values match.
+type DataStreamRoutingRule struct {
+	ServiceName        []string          `config:"service.name"`
+	ServiceEnvironment []string          `config:"service.environment"`
+	AgentName          []string          `config:"agent.name"`
+	DataStreamType     []string          `config:"data_stream.type"`
+	Labels             map[string]string `config:"labels"`
+
+	// Namespace holds the namespace for matching events, if non-empty.
+	Namespace string `config:"namespace"`
+
+	// Dataset holds the dataset for matching events, if non-empty.
+	Dataset string `config:"dataset"`
+}
+
+func (c *DataStreamsConfig) Validate() error {
+	for i, rule := range c.Routing {
+		if rule.Namespace == "" && rule.Dataset == "" {
+			return fmt.Errorf("routing rule %d: namespace or dataset must be specified", i)
+		}
+		if rule.Namespace != "" {
+			if err := validateDataStreamPart(rule.Namespace); err != nil {
+				return fmt.Errorf("routing rule %d: invalid namespace %q: %w", i, rule.Namespace, err)
+			}
+		}
+		if rule.Dataset != "" {
+			if err := validateDataStreamPart(rule.Dataset); err != nil {
+				return fmt.Errorf("routing rule %d: invalid dataset %q: %w", i, rule.Dataset, err)
+			}
+		}
+		if err := validateRuleConditions(
+			rule.ServiceName, rule.ServiceEnvironment, rule.AgentName, rule.DataStreamType, rule.Labels,
+		); err != nil {
+			return fmt.Errorf("routing rule %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// validateRuleConditions returns an error if a routing rule has no
+// conditions, and so would match every event. It is shared by data
+// stream routing and output routing rules.
+func validateRuleConditions(
+	serviceName, serviceEnvironment, agentName, dataStreamType []string,
+	labels map[string]string,
+) error {
+	if len(serviceName) == 0 &&
+		len(serviceEnvironment) == 0 &&
+		len(agentName) == 0 &&
+		len(dataStreamType) == 0 &&
+		len(labels) == 0 {
+		return errors.New("at least one condition must be specified")
+	}
+	return nil
+}
+
+// validateDataStreamPart validates a data stream dataset or namespace
+// against the data stream naming scheme's constraints.
+func validateDataStreamPart(s string) error {
+	if len(s) > maxDataStreamPartLength {
+		return fmt.Errorf("must not be longer than %d bytes", maxDataStreamPartLength)
+	}
+	if strings.ToLower(s) != s {
+		return errors.New("must be lowercase")
+	}
+	if i := strings.IndexAny(s, `\/*?"<>| ,#:-`); i >= 0 {
+		return fmt.Errorf("must not contain %q", s[i])
+	}
+	if s[0] == '_' || s[0] == '+' || s[0] == '.' {
+		return fmt.Errorf("must not start with %q", s[0])
+	}
+	return nil
 }
 
 func defaultDataStreamsConfig() DataStreamsConfig {
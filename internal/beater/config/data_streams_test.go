@@ -0,0 +1,84 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestDataStreamsRoutingConfig(t *testing.T) {
+	c, err := NewConfig(config.MustNewConfigFrom(map[string]interface{}{
+		"data_streams.routing": []map[string]interface{}{{
+			"service.name": []string{"checkout"},
+			"agent.name":   []string{"java"},
+			"namespace":    "teama",
+		}},
+	}), nil, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	assert.Equal(t, []DataStreamRoutingRule{{
+		ServiceName: []string{"checkout"},
+		AgentName:   []string{"java"},
+		Namespace:   "teama",
+	}}, c.DataStreams.Routing)
+}
+
+func TestDataStreamsRoutingConfigValidation(t *testing.T) {
+	for name, test := range map[string]struct {
+		rule   map[string]interface{}
+		expect string
+	}{
+		"NoNamespaceOrDataset": {
+			rule:   map[string]interface{}{"service.name": "foo"},
+			expect: "routing rule 0: namespace or dataset must be specified",
+		},
+		"NoConditions": {
+			rule:   map[string]interface{}{"namespace": "teama"},
+			expect: "routing rule 0: at least one condition must be specified",
+		},
+		"UppercaseNamespace": {
+			rule:   map[string]interface{}{"namespace": "TeamA"},
+			expect: `routing rule 0: invalid namespace "TeamA": must be lowercase`,
+		},
+		"HyphenatedNamespace": {
+			rule:   map[string]interface{}{"namespace": "team-a"},
+			expect: `routing rule 0: invalid namespace "team-a": must not contain '-'`,
+		},
+		"InvalidDatasetPrefix": {
+			rule:   map[string]interface{}{"dataset": "_apm"},
+			expect: `routing rule 0: invalid dataset "_apm": must not start with '_'`,
+		},
+		"LongDataset": {
+			rule:   map[string]interface{}{"dataset": string(make([]byte, 101))},
+			expect: "must not be longer than 100 bytes",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewConfig(config.MustNewConfigFrom(map[string]interface{}{
+				"data_streams.routing": []map[string]interface{}{test.rule},
+			}), nil, logptest.NewTestingLogger(t, ""))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.expect)
+		})
+	}
+}
@@ -0,0 +1,89 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// DeadLetterConfig holds configuration for storing documents
+// rejected by Elasticsearch in local files.
+type DeadLetterConfig struct {
+	Enabled bool `config:"enabled"`
+
+	// Path holds the directory in which dead-letter files are written.
+	// If empty, the "deadletter" directory under path.data is used.
+	Path string `config:"path"`
+
+	// MaxFileSize holds the size at which dead-letter files are rotated.
+	MaxFileSize       string `config:"max_file_size"`
+	MaxFileSizeParsed uint64
+
+	// MaxFiles holds the maximum number of dead-letter files to retain.
+	MaxFiles uint `config:"max_files"`
+}
+
+func (c *DeadLetterConfig) Unpack(in *config.C) error {
+	type deadLetterConfig DeadLetterConfig
+	cfg := deadLetterConfig(defaultDeadLetterConfig())
+	if err := in.Unpack(&cfg); err != nil {
+		return fmt.Errorf("error unpacking dead_letter config: %w", err)
+	}
+	size, err := humanize.ParseBytes(cfg.MaxFileSize)
+	if err != nil {
+		return fmt.Errorf("error parsing dead_letter max file size: %w", err)
+	}
+	cfg.MaxFileSizeParsed = size
+	*c = DeadLetterConfig(cfg)
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("invalid dead_letter config: %w", err)
+	}
+	return nil
+}
+
+func (c *DeadLetterConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.MaxFileSizeParsed == 0 {
+		return errors.New("max_file_size must be greater than zero")
+	}
+	if c.MaxFiles == 0 {
+		return errors.New("max_files must be greater than zero")
+	}
+	return nil
+}
+
+func defaultDeadLetterConfig() DeadLetterConfig {
+	cfg := DeadLetterConfig{
+		Enabled:     false,
+		MaxFileSize: "100mb",
+		MaxFiles:    10,
+	}
+	parsed, err := humanize.ParseBytes(cfg.MaxFileSize)
+	if err != nil {
+		panic(err)
+	}
+	cfg.MaxFileSizeParsed = parsed
+	return cfg
+}
@@ -0,0 +1,108 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// DebugCaptureConfig holds configuration for capturing intake requests
+// for debugging. Capture is started at runtime through the admin API.
+type DebugCaptureConfig struct {
+	// Path holds the directory in which capture files are written.
+	// If empty, the "capture" directory under path.logs is used.
+	Path string `config:"path"`
+
+	// MaxFileSize holds the size at which capture files are rotated.
+	MaxFileSize       string `config:"max_file_size"`
+	MaxFileSizeParsed uint64
+
+	// MaxFiles holds the maximum number of capture files to retain.
+	MaxFiles uint `config:"max_files"`
+
+	// MaxBodySize holds the maximum number of bytes of each request
+	// body to capture. Longer bodies are truncated.
+	MaxBodySize       string `config:"max_body_size"`
+	MaxBodySizeParsed uint64
+
+	// MaxDuration holds the maximum duration for which capture may
+	// be started.
+	MaxDuration time.Duration `config:"max_duration"`
+}
+
+func (c *DebugCaptureConfig) Unpack(in *config.C) error {
+	type debugCaptureConfig DebugCaptureConfig
+	cfg := debugCaptureConfig(defaultDebugCaptureConfig())
+	if err := in.Unpack(&cfg); err != nil {
+		return fmt.Errorf("error unpacking debug_capture config: %w", err)
+	}
+	size, err := humanize.ParseBytes(cfg.MaxFileSize)
+	if err != nil {
+		return fmt.Errorf("error parsing debug_capture max file size: %w", err)
+	}
+	cfg.MaxFileSizeParsed = size
+	size, err = humanize.ParseBytes(cfg.MaxBodySize)
+	if err != nil {
+		return fmt.Errorf("error parsing debug_capture max body size: %w", err)
+	}
+	cfg.MaxBodySizeParsed = size
+	*c = DebugCaptureConfig(cfg)
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("invalid debug_capture config: %w", err)
+	}
+	return nil
+}
+
+func (c *DebugCaptureConfig) Validate() error {
+	if c.MaxFileSizeParsed == 0 {
+		return errors.New("max_file_size must be greater than zero")
+	}
+	if c.MaxFiles == 0 {
+		return errors.New("max_files must be greater than zero")
+	}
+	if c.MaxBodySizeParsed == 0 {
+		return errors.New("max_body_size must be greater than zero")
+	}
+	if c.MaxDuration <= 0 {
+		return errors.New("max_duration must be greater than zero")
+	}
+	return nil
+}
+
+func defaultDebugCaptureConfig() DebugCaptureConfig {
+	cfg := DebugCaptureConfig{
+		MaxFileSize: "10mb",
+		MaxFiles:    5,
+		MaxBodySize: "1mb",
+		MaxDuration: time.Hour,
+	}
+	var err error
+	if cfg.MaxFileSizeParsed, err = humanize.ParseBytes(cfg.MaxFileSize); err != nil {
+		panic(err)
+	}
+	if cfg.MaxBodySizeParsed, err = humanize.ParseBytes(cfg.MaxBodySize); err != nil {
+		panic(err)
+	}
+	return cfg
+}
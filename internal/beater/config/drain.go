@@ -0,0 +1,38 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import "time"
+
+// DrainConfig holds configuration for draining in-flight intake
+// requests before the server shuts down.
+type DrainConfig struct {
+	// Timeout holds the maximum duration to wait for in-flight intake
+	// requests to complete on shutdown, before stopping the server.
+	// If Timeout is zero, the server is stopped without draining.
+	Timeout time.Duration `config:"timeout" validate:"min=0"`
+
+	// RetryAfter holds the duration which clients are asked to wait,
+	// with the Retry-After header, before retrying requests rejected
+	// while draining.
+	RetryAfter time.Duration `config:"retry_after" validate:"min=0"`
+}
+
+func defaultDrainConfig() DrainConfig {
+	return DrainConfig{RetryAfter: 10 * time.Second}
+}
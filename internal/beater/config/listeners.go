@@ -0,0 +1,119 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+const (
+	// RouteGroupIntake identifies the backend agent endpoints: intake,
+	// agent configuration, OTLP, Jaeger, Zipkin, Prometheus remote-write,
+	// and gRPC.
+	RouteGroupIntake = "intake"
+
+	// RouteGroupRUM identifies the RUM intake and agent configuration
+	// endpoints.
+	RouteGroupRUM = "rum"
+
+	// RouteGroupDebug identifies the expvar and pprof endpoints.
+	RouteGroupDebug = "debug"
+)
+
+// RouteGroups holds all known route groups.
+var RouteGroups = []string{RouteGroupIntake, RouteGroupRUM, RouteGroupDebug}
+
+// ListenersConfig holds configuration for additional listeners.
+//
+// Route groups that are not served by any additional listener
+// are served by the listener for apm-server.host.
+type ListenersConfig []ListenerConfig
+
+// ListenerConfig holds configuration for an additional listener,
+// serving a subset of the server's routes.
+type ListenerConfig struct {
+	// Name holds a unique name for the listener, used in logs.
+	Name string `config:"name" validate:"required"`
+
+	// Host holds the address to listen on, with the same
+	// format as apm-server.host.
+	Host string `config:"host" validate:"required"`
+
+	// TLS holds the TLS configuration for the listener. The TLS
+	// configuration of apm-server.ssl is not inherited.
+	TLS *tlscommon.ServerConfig `config:"ssl"`
+
+	// MaxConnections holds the maximum number of concurrent
+	// connections accepted by the listener, or zero for unlimited.
+	MaxConnections int `config:"max_connections"`
+
+	// Routes holds the route groups served by the listener.
+	Routes []string `config:"routes" validate:"required"`
+}
+
+func (c ListenersConfig) Validate() error {
+	names := make(map[string]bool)
+	groups := make(map[string]string)
+	for i, l := range c {
+		if names[l.Name] {
+			return fmt.Errorf("listener %d: duplicate name %q", i, l.Name)
+		}
+		names[l.Name] = true
+		if l.MaxConnections < 0 {
+			return fmt.Errorf("listener %q: max_connections must not be negative", l.Name)
+		}
+		for _, group := range l.Routes {
+			if !slices.Contains(RouteGroups, group) {
+				return fmt.Errorf("listener %q: unknown route group %q, expected one of %v", l.Name, group, RouteGroups)
+			}
+			if other, ok := groups[group]; ok {
+				return fmt.Errorf("listener %q: route group %q is already served by listener %q", l.Name, group, other)
+			}
+			groups[group] = l.Name
+		}
+	}
+	return nil
+}
+
+// UnclaimedRouteGroups returns the route groups which are not served by
+// any of the listeners, and are therefore served by apm-server.host.
+func (c ListenersConfig) UnclaimedRouteGroups() []string {
+	var unclaimed []string
+	for _, group := range RouteGroups {
+		if !slices.ContainsFunc(c, func(l ListenerConfig) bool {
+			return slices.Contains(l.Routes, group)
+		}) {
+			unclaimed = append(unclaimed, group)
+		}
+	}
+	return unclaimed
+}
+
+// RUMListener returns the host and TLS configuration of the listener
+// serving the RUM route group.
+func (c *Config) RUMListener() (host string, tls *tlscommon.ServerConfig) {
+	for _, l := range c.Listeners {
+		if slices.Contains(l.Routes, RouteGroupRUM) {
+			return l.Host, l.TLS
+		}
+	}
+	return c.Host, c.TLS
+}
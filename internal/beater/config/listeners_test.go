@@ -0,0 +1,93 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestListenersConfig(t *testing.T) {
+	c, err := NewConfig(config.MustNewConfigFrom(map[string]interface{}{
+		"listeners": []map[string]interface{}{{
+			"name":            "rum",
+			"host":            "0.0.0.0:8201",
+			"max_connections": 100,
+			"routes":          []string{"rum"},
+		}, {
+			"name":   "debug",
+			"host":   "localhost:8202",
+			"routes": []string{"debug"},
+		}},
+	}), nil, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	assert.Equal(t, ListenersConfig{{
+		Name:           "rum",
+		Host:           "0.0.0.0:8201",
+		MaxConnections: 100,
+		Routes:         []string{RouteGroupRUM},
+	}, {
+		Name:   "debug",
+		Host:   "localhost:8202",
+		Routes: []string{RouteGroupDebug},
+	}}, c.Listeners)
+	assert.Equal(t, []string{RouteGroupIntake}, c.Listeners.UnclaimedRouteGroups())
+}
+
+func TestListenersConfigInvalid(t *testing.T) {
+	for name, test := range map[string]struct {
+		listeners []map[string]interface{}
+		expected  string
+	}{
+		"missing_routes": {
+			listeners: []map[string]interface{}{{"name": "a", "host": "localhost:8201"}},
+			expected:  "missing required field",
+		},
+		"unknown_group": {
+			listeners: []map[string]interface{}{{"name": "a", "host": "localhost:8201", "routes": []string{"admin"}}},
+			expected:  `listener "a": unknown route group "admin"`,
+		},
+		"duplicate_name": {
+			listeners: []map[string]interface{}{
+				{"name": "a", "host": "localhost:8201", "routes": []string{"rum"}},
+				{"name": "a", "host": "localhost:8202", "routes": []string{"debug"}},
+			},
+			expected: `listener 1: duplicate name "a"`,
+		},
+		"duplicate_group": {
+			listeners: []map[string]interface{}{
+				{"name": "a", "host": "localhost:8201", "routes": []string{"rum"}},
+				{"name": "b", "host": "localhost:8202", "routes": []string{"debug", "rum"}},
+			},
+			expected: `listener "b": route group "rum" is already served by listener "a"`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewConfig(config.MustNewConfigFrom(map[string]interface{}{
+				"listeners": test.listeners,
+			}), nil, logptest.NewTestingLogger(t, ""))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.expected)
+		})
+	}
+}
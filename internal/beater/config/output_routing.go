@@ -0,0 +1,69 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// OutputRoutingConfig holds configuration for routing events to
+// additional, named Elasticsearch outputs.
+type OutputRoutingConfig struct {
+	// Outputs holds named Elasticsearch outputs, keyed by name. Each
+	// output accepts the same settings as output.elasticsearch.
+	Outputs map[string]*config.C `config:"outputs"`
+
+	// Rules holds the routing rules, which are evaluated in order.
+	// Events are sent to the output of the first matching rule, and
+	// events matching no rule are sent to output.elasticsearch.
+	Rules []OutputRoutingRule `config:"rules"`
+}
+
+// OutputRoutingRule holds a rule for routing events to a named output.
+//
+// An event matches a rule if it matches all of the rule's conditions.
+// Conditions with multiple values match if any of the values match.
+type OutputRoutingRule struct {
+	// Output holds the name of the output to which matching
+	// events are sent.
+	Output string `config:"output"`
+
+	ServiceName        []string          `config:"service.name"`
+	ServiceEnvironment []string          `config:"service.environment"`
+	DataStreamType     []string          `config:"data_stream.type"`
+	Labels             map[string]string `config:"labels"`
+}
+
+func (c *OutputRoutingConfig) Validate() error {
+	for i, rule := range c.Rules {
+		if rule.Output == "" {
+			return fmt.Errorf("rule %d: output must be specified", i)
+		}
+		if _, ok := c.Outputs[rule.Output]; !ok {
+			return fmt.Errorf("rule %d: undefined output %q", i, rule.Output)
+		}
+		if err := validateRuleConditions(
+			rule.ServiceName, rule.ServiceEnvironment, nil, rule.DataStreamType, rule.Labels,
+		); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return nil
+}
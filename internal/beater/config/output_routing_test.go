@@ -0,0 +1,75 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestOutputRoutingConfig(t *testing.T) {
+	c, err := NewConfig(config.MustNewConfigFrom(map[string]interface{}{
+		"output_routing.outputs.loadtest.hosts": []string{"loadtest:9200"},
+		"output_routing.rules": []map[string]interface{}{{
+			"output":              "loadtest",
+			"service.environment": []string{"loadtest"},
+			"labels":              map[string]interface{}{"team": "perf"},
+		}},
+	}), nil, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	assert.Contains(t, c.OutputRouting.Outputs, "loadtest")
+	assert.Equal(t, []OutputRoutingRule{{
+		Output:             "loadtest",
+		ServiceEnvironment: []string{"loadtest"},
+		Labels:             map[string]string{"team": "perf"},
+	}}, c.OutputRouting.Rules)
+}
+
+func TestOutputRoutingConfigValidation(t *testing.T) {
+	for name, test := range map[string]struct {
+		rule   map[string]interface{}
+		expect string
+	}{
+		"NoOutput": {
+			rule:   map[string]interface{}{"service.name": "foo"},
+			expect: "rule 0: output must be specified",
+		},
+		"UndefinedOutput": {
+			rule:   map[string]interface{}{"output": "other", "service.name": "foo"},
+			expect: `rule 0: undefined output "other"`,
+		},
+		"NoConditions": {
+			rule:   map[string]interface{}{"output": "loadtest"},
+			expect: "rule 0: at least one condition must be specified",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewConfig(config.MustNewConfigFrom(map[string]interface{}{
+				"output_routing.outputs.loadtest.hosts": []string{"loadtest:9200"},
+				"output_routing.rules":                  []map[string]interface{}{test.rule},
+			}), nil, logptest.NewTestingLogger(t, ""))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.expect)
+		})
+	}
+}
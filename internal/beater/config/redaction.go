@@ -0,0 +1,95 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+const (
+	// RedactionActionMask replaces redacted values with a fixed replacement.
+	RedactionActionMask = "mask"
+
+	// RedactionActionHash replaces redacted values with their hex-encoded
+	// SHA-256 hash, or HMAC-SHA256 hash if a hash key is configured.
+	RedactionActionHash = "hash"
+)
+
+// RedactionConfig holds configuration for redacting personal data
+// from events before they are indexed.
+type RedactionConfig struct {
+	// Rules holds the redaction rules, applied to each event in order.
+	Rules []RedactionRule `config:"rules"`
+}
+
+// RedactionRule holds a rule for redacting the values of one or more fields.
+type RedactionRule struct {
+	// Fields holds the fields whose values should be redacted, e.g.
+	// "http.request.headers", "url.query" or "span.db.statement".
+	Fields []string `config:"fields" validate:"required"`
+
+	// Keys optionally restricts redaction of key/value fields, such as
+	// headers, cookies and labels, to the given keys. Keys are matched
+	// case-insensitively.
+	Keys []string `config:"keys"`
+
+	// Pattern optionally restricts redaction to the parts of values
+	// matching the regular expression. If Pattern is empty, whole
+	// values are redacted.
+	Pattern string `config:"pattern"`
+
+	// Action holds the redaction action: "mask" or "hash".
+	// The default is "mask".
+	Action string `config:"action"`
+
+	// Replacement holds the replacement for masked values.
+	// The default is "[REDACTED]".
+	Replacement string `config:"replacement"`
+
+	// HashKey holds an optional key for keyed hashing of values,
+	// preventing hashes of low-entropy values from being reversed.
+	HashKey string `config:"hash_key"`
+}
+
+func (c *RedactionConfig) Validate() error {
+	for i, rule := range c.Rules {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("redaction rule %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (r *RedactionRule) validate() error {
+	if r.Pattern != "" {
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+	switch r.Action {
+	case "", RedactionActionMask, RedactionActionHash:
+	default:
+		return fmt.Errorf("invalid action %q, must be one of %q or %q", r.Action, RedactionActionMask, RedactionActionHash)
+	}
+	if r.HashKey != "" && r.Action != RedactionActionHash {
+		return errors.New("hash_key may only be specified with the hash action")
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestRedactionConfig(t *testing.T) {
+	c, err := NewConfig(config.MustNewConfigFrom(map[string]interface{}{
+		"redaction.rules": []map[string]interface{}{{
+			"fields": []string{"http.request.headers"},
+			"keys":   []string{"Authorization"},
+		}, {
+			"fields":   []string{"span.db.statement"},
+			"pattern":  `'[^']*'`,
+			"action":   "hash",
+			"hash_key": "secret",
+		}},
+	}), nil, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	assert.Equal(t, []RedactionRule{{
+		Fields: []string{"http.request.headers"},
+		Keys:   []string{"Authorization"},
+	}, {
+		Fields:  []string{"span.db.statement"},
+		Pattern: `'[^']*'`,
+		Action:  RedactionActionHash,
+		HashKey: "secret",
+	}}, c.Redaction.Rules)
+}
+
+func TestRedactionConfigValidation(t *testing.T) {
+	for name, test := range map[string]struct {
+		rule   map[string]interface{}
+		expect string
+	}{
+		"NoFields": {
+			rule:   map[string]interface{}{"action": "mask"},
+			expect: "missing required field accessing 'redaction.rules.0.fields'",
+		},
+		"InvalidPattern": {
+			rule:   map[string]interface{}{"fields": []string{"url.query"}, "pattern": "("},
+			expect: "redaction rule 0: invalid pattern",
+		},
+		"InvalidAction": {
+			rule:   map[string]interface{}{"fields": []string{"url.query"}, "action": "drop"},
+			expect: `redaction rule 0: invalid action "drop"`,
+		},
+		"HashKeyWithMask": {
+			rule:   map[string]interface{}{"fields": []string{"url.query"}, "hash_key": "secret"},
+			expect: "redaction rule 0: hash_key may only be specified with the hash action",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewConfig(config.MustNewConfigFrom(map[string]interface{}{
+				"redaction.rules": []map[string]interface{}{test.rule},
+			}), nil, logptest.NewTestingLogger(t, ""))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.expect)
+		})
+	}
+}
@@ -46,6 +46,16 @@ type RumConfig struct {
 	LibraryPattern      string              `config:"library_pattern"`
 	ExcludeFromGrouping string              `config:"exclude_from_grouping"`
 	SourceMapping       SourceMapping       `config:"source_mapping"`
+	HTTP3               HTTP3Config         `config:"http3"`
+}
+
+// HTTP3Config holds configuration for serving the RUM endpoints over HTTP/3.
+type HTTP3Config struct {
+	Enabled bool `config:"enabled"`
+
+	// Host holds the UDP address to listen on. If Host is empty,
+	// the host of the listener serving the RUM endpoints is used.
+	Host string `config:"host"`
 }
 
 // SourceMapping holds sourcemap config information
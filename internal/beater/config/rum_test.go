@@ -49,3 +49,32 @@ func TestDefaultRum(t *testing.T) {
 	c := DefaultConfig()
 	assert.Equal(t, defaultRum(), c.RumConfig)
 }
+
+func TestRumHTTP3RequiresTLS(t *testing.T) {
+	_, err := NewConfig(config.MustNewConfigFrom(map[string]interface{}{
+		"rum.enabled":       true,
+		"rum.http3.enabled": true,
+	}), nil, logptest.NewTestingLogger(t, ""))
+	require.Error(t, err)
+	assert.EqualError(t, err, "rum.http3 requires TLS to be enabled for the listener serving RUM endpoints")
+
+	c, err := NewConfig(config.MustNewConfigFrom(map[string]interface{}{
+		"rum.enabled":       true,
+		"rum.http3.enabled": true,
+		"rum.http3.host":    "0.0.0.0:443",
+		"listeners": []map[string]interface{}{{
+			"name":   "rum",
+			"host":   "0.0.0.0:8201",
+			"routes": []string{"rum"},
+			"ssl": map[string]interface{}{
+				"certificate": "../../testdata/tls/certificate.pem",
+				"key":         "../../testdata/tls/key.pem",
+			},
+		}},
+	}), nil, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	assert.Equal(t, HTTP3Config{Enabled: true, Host: "0.0.0.0:443"}, c.RumConfig.HTTP3)
+	host, tls := c.RUMListener()
+	assert.Equal(t, "0.0.0.0:8201", host)
+	assert.True(t, tls.IsEnabled())
+}
@@ -0,0 +1,75 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastic/apm-server/internal/otlpexport"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// SelfInstrumentationConfig holds configuration for exporting the
+// server's own traces and metrics via OTLP, independent of the output.
+type SelfInstrumentationConfig struct {
+	Enabled bool `config:"enabled"`
+
+	// SamplingRate holds the ratio of root traces to sample, between
+	// 0 and 1. Traces with a sampled parent are always sampled.
+	SamplingRate float64 `config:"sampling_rate"`
+
+	// MetricsInterval holds the interval at which metrics are exported.
+	MetricsInterval time.Duration `config:"metrics_interval"`
+
+	// OTLP holds the configuration for the OTLP receiver, or local
+	// file, to which traces and metrics are exported.
+	OTLP otlpexport.Config `config:"otlp"`
+}
+
+func (c *SelfInstrumentationConfig) Unpack(in *config.C) error {
+	type selfInstrumentationConfig SelfInstrumentationConfig
+	cfg := selfInstrumentationConfig(defaultSelfInstrumentationConfig())
+	if err := in.Unpack(&cfg); err != nil {
+		return fmt.Errorf("error unpacking self_instrumentation config: %w", err)
+	}
+	*c = SelfInstrumentationConfig(cfg)
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("invalid self_instrumentation config: %w", err)
+	}
+	return nil
+}
+
+func (c *SelfInstrumentationConfig) Validate() error {
+	if c.SamplingRate < 0 || c.SamplingRate > 1 {
+		return errors.New("sampling_rate must be between 0 and 1")
+	}
+	if c.MetricsInterval <= 0 {
+		return errors.New("metrics_interval must be greater than zero")
+	}
+	return nil
+}
+
+func defaultSelfInstrumentationConfig() SelfInstrumentationConfig {
+	return SelfInstrumentationConfig{
+		SamplingRate:    1.0,
+		MetricsInterval: 30 * time.Second,
+		OTLP:            otlpexport.DefaultConfig(),
+	}
+}
@@ -0,0 +1,82 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-server/internal/otlpexport"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestSelfInstrumentationConfig(t *testing.T) {
+	c, err := NewConfig(config.MustNewConfigFrom(map[string]interface{}{
+		"self_instrumentation": map[string]interface{}{
+			"enabled":          true,
+			"sampling_rate":    0.5,
+			"metrics_interval": "10s",
+			"otlp": map[string]interface{}{
+				"protocol": "file",
+				"path":     "/var/lib/apm-server/otlp",
+			},
+		},
+	}), nil, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+
+	otlp := otlpexport.DefaultConfig()
+	otlp.Protocol = otlpexport.ProtocolFile
+	otlp.Path = "/var/lib/apm-server/otlp"
+	assert.Equal(t, SelfInstrumentationConfig{
+		Enabled:         true,
+		SamplingRate:    0.5,
+		MetricsInterval: 10 * time.Second,
+		OTLP:            otlp,
+	}, c.SelfInstrumentation)
+}
+
+func TestSelfInstrumentationConfigInvalid(t *testing.T) {
+	for name, test := range map[string]struct {
+		config map[string]interface{}
+		err    string
+	}{
+		"sampling_rate": {
+			config: map[string]interface{}{"sampling_rate": 1.5},
+			err:    "sampling_rate must be between 0 and 1",
+		},
+		"metrics_interval": {
+			config: map[string]interface{}{"metrics_interval": "0s"},
+			err:    "metrics_interval must be greater than zero",
+		},
+		"otlp": {
+			config: map[string]interface{}{"otlp.protocol": "file"},
+			err:    "path must be specified for the file protocol",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewConfig(config.MustNewConfigFrom(map[string]interface{}{
+				"self_instrumentation": test.config,
+			}), nil, logptest.NewTestingLogger(t, ""))
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dustin/go-humanize"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// SpoolConfig holds configuration for the durable on-disk spool that
+// sits between event processing and the Elasticsearch output.
+type SpoolConfig struct {
+	Enabled bool `config:"enabled"`
+
+	// Path holds the directory in which spooled events are stored.
+	// If empty, the "spool" directory under path.data is used.
+	Path string `config:"path"`
+
+	// MaxSize is the user-configured limit on the size of spooled
+	// events on disk. When the limit is reached, new events are
+	// rejected until the output has caught up.
+	MaxSize       string `config:"max_size"`
+	MaxSizeParsed uint64
+}
+
+func (c *SpoolConfig) Unpack(in *config.C) error {
+	type spoolConfig SpoolConfig
+	cfg := spoolConfig(defaultSpoolConfig())
+	if err := in.Unpack(&cfg); err != nil {
+		return fmt.Errorf("error unpacking spool config: %w", err)
+	}
+	limit, err := humanize.ParseBytes(cfg.MaxSize)
+	if err != nil {
+		return fmt.Errorf("error parsing spool max size: %w", err)
+	}
+	cfg.MaxSizeParsed = limit
+	*c = SpoolConfig(cfg)
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("invalid spool config: %w", err)
+	}
+	return nil
+}
+
+func (c *SpoolConfig) Validate() error {
+	if c.Enabled && c.MaxSizeParsed == 0 {
+		return errors.New("max_size must be greater than zero")
+	}
+	return nil
+}
+
+func defaultSpoolConfig() SpoolConfig {
+	cfg := SpoolConfig{
+		Enabled: false,
+		MaxSize: "1gb",
+	}
+	parsed, err := humanize.ParseBytes(cfg.MaxSize)
+	if err != nil {
+		panic(err)
+	}
+	cfg.MaxSizeParsed = parsed
+	return cfg
+}
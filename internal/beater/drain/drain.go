@@ -0,0 +1,218 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package drain coordinates draining in-flight intake requests
+// before the server shuts down.
+package drain
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/apm-data/model/modelpb"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+var (
+	// ErrDraining is returned for requests rejected because the
+	// server is draining.
+	ErrDraining = errors.New("server is draining")
+
+	// ErrStopStream is returned by the batch processor returned by
+	// Drainer.BatchProcessor, after processing a batch, to stop reading
+	// a stream once the server is draining.
+	ErrStopStream = errors.New("server is draining, stream stopped")
+)
+
+// Drainer tracks in-flight streaming requests, and signals them to
+// finish once the server starts draining.
+//
+// Drainer is safe for concurrent use.
+type Drainer struct {
+	retryAfter time.Duration
+	once       sync.Once
+	draining   chan struct{}
+	inflight   atomic.Int64
+
+	mu       sync.Mutex
+	flushers []flusher
+
+	completeOnce sync.Once
+	completed    chan struct{}
+	completeErr  error
+}
+
+type flusher struct {
+	name  string
+	flush func(context.Context) error
+}
+
+// New returns a new Drainer. Requests rejected while draining are
+// asked to retry after retryAfter.
+func New(retryAfter time.Duration) *Drainer {
+	return &Drainer{
+		retryAfter: retryAfter,
+		draining:   make(chan struct{}),
+		completed:  make(chan struct{}),
+	}
+}
+
+// RetryAfter returns the duration after which clients should retry
+// requests rejected while draining.
+func (d *Drainer) RetryAfter() time.Duration {
+	return d.retryAfter
+}
+
+// Drain starts draining. Drain may be called multiple times.
+func (d *Drainer) Drain() {
+	d.once.Do(func() { close(d.draining) })
+}
+
+// Draining returns a channel which is closed when draining starts.
+func (d *Drainer) Draining() <-chan struct{} {
+	return d.draining
+}
+
+// IsDraining reports whether the server is draining.
+func (d *Drainer) IsDraining() bool {
+	select {
+	case <-d.draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// Acquire records the start of a streaming request, returning false if
+// the server is draining and the request should be rejected. If Acquire
+// returns true, Release must be called when the request completes.
+func (d *Drainer) Acquire() bool {
+	d.inflight.Add(1)
+	if d.IsDraining() {
+		d.inflight.Add(-1)
+		return false
+	}
+	return true
+}
+
+// Release records the completion of a streaming request.
+func (d *Drainer) Release() {
+	d.inflight.Add(-1)
+}
+
+// InFlight returns the number of in-flight streaming requests.
+func (d *Drainer) InFlight() int64 {
+	return d.inflight.Load()
+}
+
+// BatchProcessor returns a modelpb.BatchProcessor which passes batches
+// to next. Once the server is draining, the batch processor returns
+// ErrStopStream after successfully processing a batch. This causes
+// in-flight streams to finish at the next batch boundary, without
+// losing the batch that was being processed.
+func (d *Drainer) BatchProcessor(next modelpb.BatchProcessor) modelpb.BatchProcessor {
+	return modelpb.ProcessBatchFunc(func(ctx context.Context, b *modelpb.Batch) error {
+		if err := next.ProcessBatch(ctx, b); err != nil {
+			return err
+		}
+		if d.IsDraining() {
+			return ErrStopStream
+		}
+		return nil
+	})
+}
+
+// AddFlusher adds a function to call for flushing buffered events once
+// in-flight requests have been drained, such as tail-sampling decisions
+// or documents buffered for the output.
+//
+// Flushers are called in the reverse order to which they are added, so
+// components which send events to others should be added after them.
+func (d *Drainer) AddFlusher(name string, flush func(context.Context) error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.flushers = append(d.flushers, flusher{name: name, flush: flush})
+}
+
+// Complete waits for in-flight streaming requests to complete and then
+// calls the flushers, logging progress. Complete should be called after
+// Drain.
+//
+// The drain is completed only once, using the first caller's context;
+// subsequent calls wait for it to complete, or for ctx to be cancelled.
+func (d *Drainer) Complete(ctx context.Context, logger *logp.Logger) error {
+	d.completeOnce.Do(func() {
+		go func() {
+			defer close(d.completed)
+			d.completeErr = d.complete(ctx, logger)
+		}()
+	})
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-d.completed:
+		return d.completeErr
+	}
+}
+
+func (d *Drainer) complete(ctx context.Context, logger *logp.Logger) error {
+	// Flush regardless of whether all requests have completed,
+	// so the events from those that have are not held back.
+	errs := []error{d.Wait(ctx, logger)}
+	d.mu.Lock()
+	flushers := d.flushers
+	d.mu.Unlock()
+	for i := len(flushers) - 1; i >= 0; i-- {
+		f := flushers[i]
+		logger.Infof("draining: flushing %s", f.name)
+		if err := f.flush(ctx); err != nil {
+			logger.With(logp.Error(err)).Warnf("draining: failed to flush %s", f.name)
+			errs = append(errs, err)
+			continue
+		}
+		logger.Infof("draining: flushed %s", f.name)
+	}
+	return errors.Join(errs...)
+}
+
+// Wait waits for in-flight streaming requests to complete, or for ctx
+// to be cancelled, logging progress every second.
+func (d *Drainer) Wait(ctx context.Context, logger *logp.Logger) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	var lastLogged time.Time
+	for {
+		n := d.InFlight()
+		if n == 0 {
+			logger.Info("drained all in-flight requests")
+			return nil
+		}
+		if time.Since(lastLogged) >= time.Second {
+			logger.Infof("draining: waiting for %d in-flight requests", n)
+			lastLogged = time.Now()
+		}
+		select {
+		case <-ctx.Done():
+			logger.Warnf("drain deadline exceeded with %d in-flight requests", n)
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
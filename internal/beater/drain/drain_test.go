@@ -0,0 +1,90 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package drain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-data/model/modelpb"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestDrainer(t *testing.T) {
+	d := New(time.Second)
+	assert.False(t, d.IsDraining())
+	require.True(t, d.Acquire())
+	assert.Equal(t, int64(1), d.InFlight())
+
+	d.Drain()
+	d.Drain() // idempotent
+	assert.True(t, d.IsDraining())
+	assert.False(t, d.Acquire())
+	assert.Equal(t, int64(1), d.InFlight())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	logger := logptest.NewTestingLogger(t, "")
+	assert.ErrorIs(t, d.Wait(ctx, logger), context.DeadlineExceeded)
+
+	d.Release()
+	assert.NoError(t, d.Wait(context.Background(), logger))
+}
+
+func TestDrainerBatchProcessor(t *testing.T) {
+	d := New(time.Second)
+	var processed int
+	processor := d.BatchProcessor(modelpb.ProcessBatchFunc(func(context.Context, *modelpb.Batch) error {
+		processed++
+		return nil
+	}))
+
+	batch := modelpb.Batch{{}}
+	require.NoError(t, processor.ProcessBatch(context.Background(), &batch))
+	d.Drain()
+	// The batch is processed before the stream is stopped.
+	assert.ErrorIs(t, processor.ProcessBatch(context.Background(), &batch), ErrStopStream)
+	assert.Equal(t, 2, processed)
+}
+
+func TestDrainerComplete(t *testing.T) {
+	d := New(time.Second)
+	var flushed []string
+	d.AddFlusher("output", func(context.Context) error {
+		flushed = append(flushed, "output")
+		return nil
+	})
+	d.AddFlusher("sampler", func(context.Context) error {
+		flushed = append(flushed, "sampler")
+		return errors.New("boom")
+	})
+	d.Drain()
+
+	logger := logptest.NewTestingLogger(t, "")
+	assert.EqualError(t, d.Complete(context.Background(), logger), "boom")
+	assert.Equal(t, []string{"sampler", "output"}, flushed)
+
+	// The drain is only completed once.
+	assert.EqualError(t, d.Complete(context.Background(), logger), "boom")
+	assert.Len(t, flushed, 2)
+}
@@ -36,7 +36,9 @@ const (
 	Etag                       = "Etag"
 	IfNoneMatch                = "If-None-Match"
 	Origin                     = "Origin"
+	RetryAfter                 = "Retry-After"
 	UserAgent                  = "User-Agent"
+	VerboseErrors              = "Elastic-Apm-Verbose-Errors"
 	Vary                       = "Vary"
 	XContentTypeOptions        = "X-Content-Type-Options"
 )
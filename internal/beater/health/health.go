@@ -0,0 +1,188 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package health tracks the health of the APM Server's dependencies,
+// for determining whether the server is ready to receive requests.
+package health
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// State describes the state of a health check.
+type State string
+
+const (
+	// StatePending is the state of a check that has not yet been run.
+	StatePending State = "pending"
+
+	// StateHealthy is the state of a check that last succeeded.
+	StateHealthy State = "healthy"
+
+	// StateUnhealthy is the state of a check that last failed.
+	StateUnhealthy State = "unhealthy"
+)
+
+// Checker tracks the state of named health checks. The server is
+// ready when all checks are healthy, and it is not shutting down.
+//
+// Checker is safe for concurrent use.
+type Checker struct {
+	mu           sync.RWMutex
+	checks       []*Check
+	shuttingDown atomic.Bool
+}
+
+// NewChecker returns a new Checker with no checks.
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// Register registers a check with the given name, whose state is
+// reported by calling Check.Set. The check is initially pending.
+func (c *Checker) Register(name string) *Check {
+	return c.register(name, nil)
+}
+
+// RegisterProbe registers a check with the given name, whose state is
+// determined by periodically calling probe while Run is running.
+func (c *Checker) RegisterProbe(name string, probe func(context.Context) error) *Check {
+	return c.register(name, probe)
+}
+
+func (c *Checker) register(name string, probe func(context.Context) error) *Check {
+	check := &Check{name: name, probe: probe, state: StatePending, since: time.Now()}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check)
+	return check
+}
+
+// Run calls the registered probes every interval, with a timeout of
+// interval, until ctx is cancelled.
+func (c *Checker) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c.mu.RLock()
+		checks := slices.Clone(c.checks)
+		c.mu.RUnlock()
+		for _, check := range checks {
+			if check.probe == nil {
+				continue
+			}
+			probeCtx, cancel := context.WithTimeout(ctx, interval)
+			check.Set(check.probe(probeCtx))
+			cancel()
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// SetShuttingDown marks the server as shutting down, after which
+// it is no longer ready.
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Ready reports whether the server is ready to receive requests.
+func (c *Checker) Ready() bool {
+	return c.Status().Ready
+}
+
+// Status returns the current status of the server and its checks.
+func (c *Checker) Status() Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	status := Status{
+		Ready:        !c.shuttingDown.Load(),
+		ShuttingDown: c.shuttingDown.Load(),
+		Checks:       make([]CheckStatus, len(c.checks)),
+	}
+	for i, check := range c.checks {
+		status.Checks[i] = check.status()
+		if status.Checks[i].State != StateHealthy {
+			status.Ready = false
+		}
+	}
+	return status
+}
+
+// Check is a named health check registered with a Checker.
+type Check struct {
+	name  string
+	probe func(context.Context) error
+
+	mu    sync.Mutex
+	state State
+	err   error
+	since time.Time
+}
+
+// Set records the result of the check: healthy if err is nil,
+// and unhealthy otherwise.
+func (c *Check) Set(err error) {
+	state := StateHealthy
+	if err != nil {
+		state = StateUnhealthy
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if state != c.state {
+		c.since = time.Now()
+	}
+	c.state = state
+	if err != nil {
+		c.err = err
+	}
+}
+
+func (c *Check) status() CheckStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := CheckStatus{Name: c.name, State: c.state, Since: c.since}
+	if c.err != nil {
+		status.LastError = c.err.Error()
+	}
+	return status
+}
+
+// Status describes the readiness of the server.
+type Status struct {
+	Ready        bool          `json:"ready"`
+	ShuttingDown bool          `json:"shutting_down"`
+	Checks       []CheckStatus `json:"checks"`
+}
+
+// CheckStatus describes the state of a single check.
+type CheckStatus struct {
+	Name  string    `json:"name"`
+	State State     `json:"state"`
+	Since time.Time `json:"since"`
+
+	// LastError holds the most recent error reported by the check,
+	// which is retained after the check becomes healthy again.
+	LastError string `json:"last_error,omitempty"`
+}
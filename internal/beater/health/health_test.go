@@ -0,0 +1,75 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecker(t *testing.T) {
+	c := NewChecker()
+	assert.True(t, c.Ready())
+
+	check := c.Register("publish_ready")
+	assert.False(t, c.Ready())
+	assert.Equal(t, StatePending, c.Status().Checks[0].State)
+
+	check.Set(errors.New("license expired"))
+	status := c.Status()
+	assert.False(t, status.Ready)
+	assert.Equal(t, StateUnhealthy, status.Checks[0].State)
+	assert.Equal(t, "license expired", status.Checks[0].LastError)
+
+	check.Set(nil)
+	status = c.Status()
+	assert.True(t, status.Ready)
+	assert.Equal(t, StateHealthy, status.Checks[0].State)
+	assert.Equal(t, "license expired", status.Checks[0].LastError)
+
+	c.SetShuttingDown()
+	status = c.Status()
+	assert.False(t, status.Ready)
+	assert.True(t, status.ShuttingDown)
+}
+
+func TestCheckerRunProbes(t *testing.T) {
+	c := NewChecker()
+	probeErr := errors.New("output unreachable")
+	c.RegisterProbe("output", func(ctx context.Context) error {
+		_, ok := ctx.Deadline()
+		assert.True(t, ok)
+		return probeErr
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Run(ctx, time.Millisecond) }()
+	assert.Eventually(t, func() bool {
+		return c.Status().Checks[0].State == StateUnhealthy
+	}, 10*time.Second, time.Millisecond)
+	assert.Equal(t, "output unreachable", c.Status().Checks[0].LastError)
+
+	cancel()
+	require.NoError(t, <-done)
+}
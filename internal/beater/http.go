@@ -19,39 +19,76 @@ package beater
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 
 	"github.com/libp2p/go-reuseport"
+	"github.com/quic-go/quic-go/http3"
 	"go.uber.org/zap"
 	"golang.org/x/net/netutil"
 
+	"github.com/elastic/apm-server/internal/beater/api"
 	"github.com/elastic/apm-server/internal/beater/config"
+	srvnetutil "github.com/elastic/apm-server/internal/netutil"
 	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
 	"github.com/elastic/gmux"
 )
 
+// serverListener holds a listener along with the TLS configuration
+// and route groups used for serving requests accepted by it.
+type serverListener struct {
+	net.Listener
+
+	// name holds the name of the listener, or the empty
+	// string for the apm-server.host listener.
+	name   string
+	host   string
+	tls    *tlscommon.ServerConfig
+	routes []string
+
+	// packetConn holds a UDP connection for serving the RUM route
+	// group over HTTP/3, or nil if HTTP/3 is disabled.
+	packetConn net.PacketConn
+}
+
+// Close closes the listener, and the HTTP/3 connection if any.
+func (l serverListener) Close() error {
+	if l.packetConn != nil {
+		l.packetConn.Close()
+	}
+	return l.Listener.Close()
+}
+
 type httpServer struct {
 	*http.Server
 	cfg          *config.Config
 	logger       *logp.Logger
+	tls          *tlscommon.ServerConfig
 	grpcListener net.Listener
 	httpListener net.Listener
+
+	http3Server *http3.Server
+	packetConn  net.PacketConn
 }
 
 func newHTTPServer(
 	logger *logp.Logger,
 	cfg *config.Config,
 	handler http.Handler,
-	listener net.Listener,
+	listener serverListener,
 ) (*httpServer, error) {
+	if listener.name != "" {
+		logger = logger.With(logp.String("listener", listener.name))
+	}
 
 	server := &http.Server{
-		Addr:           cfg.Host,
+		Addr:           listener.host,
 		Handler:        handler,
 		IdleTimeout:    cfg.IdleTimeout,
 		ReadTimeout:    cfg.ReadTimeout,
@@ -60,40 +97,60 @@ func newHTTPServer(
 		ErrorLog:       newErrorLog(logger),
 	}
 
-	if cfg.TLS.IsEnabled() {
-		tlsServerConfig, err := tlscommon.LoadTLSServerConfig(cfg.TLS, logger)
+	if listener.tls.IsEnabled() {
+		tlsServerConfig, err := tlscommon.LoadTLSServerConfig(listener.tls, logger)
 		if err != nil {
 			return nil, err
 		}
 		server.TLSConfig = tlsServerConfig.BuildServerConfig("")
 	}
 
-	// Configure the server with gmux. The returned net.Listener will receive
-	// gRPC connections, while all other requests will be handled by s.Handler.
+	// Configure the server with gmux if the listener serves intake routes.
+	// The returned net.Listener will receive gRPC connections, while all
+	// other requests will be handled by s.Handler.
 	//
 	// grpcListener is closed when the HTTP server is shutdown.
-	grpcListener, err := gmux.ConfigureServer(server, nil)
-	if err != nil {
-		return nil, err
+	var grpcListener net.Listener
+	if slices.Contains(listener.routes, config.RouteGroupIntake) {
+		var err error
+		grpcListener, err = gmux.ConfigureServer(server, nil)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return &httpServer{server, cfg, logger, grpcListener, listener}, nil
-}
-
-func (h *httpServer) start() error {
-	if h.cfg.RumConfig.Enabled {
-		h.logger.Info("RUM endpoints enabled!")
-		for _, s := range h.cfg.RumConfig.AllowOrigins {
-			if s == "*" {
-				h.logger.Warn("CORS related setting `apm-server.rum.allow_origins` allows all origins. Consider more restrictive setting for production use.")
-				break
-			}
+	// Serve the RUM route group over HTTP/3, and advertise it
+	// to clients of the TCP listener with the Alt-Svc header.
+	var http3Server *http3.Server
+	if listener.packetConn != nil {
+		http3Server = &http3.Server{
+			Handler:        api.FilterRouteGroups(handler, cfg, []string{config.RouteGroupRUM}),
+			TLSConfig:      http3.ConfigureTLSConfig(server.TLSConfig),
+			IdleTimeout:    cfg.IdleTimeout,
+			MaxHeaderBytes: cfg.MaxHeaderSize,
 		}
-	} else {
-		h.logger.Info("RUM endpoints disabled.")
+		server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// SetQUICHeaders fails only if the HTTP/3
+			// server is not yet serving, which is benign.
+			_ = http3Server.SetQUICHeaders(w.Header())
+			handler.ServeHTTP(w, r)
+		})
 	}
 
-	if h.cfg.TLS.IsEnabled() {
+	return &httpServer{
+		Server:       server,
+		cfg:          cfg,
+		logger:       logger,
+		tls:          listener.tls,
+		grpcListener: grpcListener,
+		httpListener: listener.Listener,
+		http3Server:  http3Server,
+		packetConn:   listener.packetConn,
+	}, nil
+}
+
+func (h *httpServer) start() error {
+	if h.tls.IsEnabled() {
 		h.logger.Info("SSL enabled.")
 		return h.ServeTLS(h.httpListener, "", "")
 	}
@@ -105,8 +162,19 @@ func (h *httpServer) start() error {
 	return h.Serve(h.httpListener)
 }
 
+// startHTTP3 serves the RUM route group over HTTP/3.
+func (h *httpServer) startHTTP3() error {
+	h.logger.Infof("HTTP/3 enabled for RUM endpoints on: %s", h.packetConn.LocalAddr())
+	return h.http3Server.Serve(h.packetConn)
+}
+
 func (h *httpServer) stop(ctx context.Context) {
 	h.logger.Infof("Stop listening on: %s", h.Server.Addr)
+	if h.http3Server != nil {
+		if err := h.http3Server.Shutdown(ctx); err != nil {
+			h.logger.Errorf("error stopping http/3 server: %s", err.Error())
+		}
+	}
 	if err := h.Shutdown(ctx); err != nil {
 		h.logger.Errorf("error stopping http server: %s", err.Error())
 		if err := h.Close(); err != nil {
@@ -115,15 +183,83 @@ func (h *httpServer) stop(ctx context.Context) {
 	}
 }
 
-// listen starts the listener for bt.config.Host.
-func listen(cfg *config.Config, logger *logp.Logger) (net.Listener, error) {
+// listenAll starts the listener for cfg.Host, followed by the listeners
+// for cfg.Listeners. The cfg.Host listener serves all route groups not
+// served by one of cfg.Listeners.
+func listenAll(cfg *config.Config, logger *logp.Logger) ([]serverListener, error) {
+	listener, err := listen(cfg, cfg.Host, cfg.MaxConnections, logger)
+	if err != nil {
+		return nil, err
+	}
+	listeners := []serverListener{{
+		Listener: listener,
+		host:     cfg.Host,
+		tls:      cfg.TLS,
+		routes:   cfg.Listeners.UnclaimedRouteGroups(),
+	}}
+	for _, lcfg := range cfg.Listeners {
+		listener, err := listen(cfg, lcfg.Host, lcfg.MaxConnections, logger.With(logp.String("listener", lcfg.Name)))
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("failed to start listener %q: %w", lcfg.Name, err)
+		}
+		listeners = append(listeners, serverListener{
+			Listener: listener,
+			name:     lcfg.Name,
+			host:     lcfg.Host,
+			tls:      lcfg.TLS,
+			routes:   lcfg.Routes,
+		})
+	}
+	if cfg.RumConfig.Enabled && cfg.RumConfig.HTTP3.Enabled {
+		if err := listenHTTP3(cfg, listeners, logger); err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+	}
+	return listeners, nil
+}
+
+// listenHTTP3 starts the UDP listener for serving the RUM route group
+// over HTTP/3, and associates it with the listener serving RUM over TCP.
+func listenHTTP3(cfg *config.Config, listeners []serverListener, logger *logp.Logger) error {
+	i := slices.IndexFunc(listeners, func(l serverListener) bool {
+		return slices.Contains(l.routes, config.RouteGroupRUM)
+	})
+	addr := cfg.RumConfig.HTTP3.Host
+	if addr == "" {
+		// Listen on the same port as the RUM TCP listener by default.
+		tcpAddr := listeners[i].Addr()
+		if network := tcpAddr.Network(); network != "tcp" {
+			return fmt.Errorf("rum.http3.host must be set when RUM endpoints are served on %s", network)
+		}
+		addr = tcpAddr.String()
+	} else if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, config.DefaultPort)
+	}
+	conn, err := reuseport.ListenPacket("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to start HTTP/3 listener: %w", err)
+	}
+	logger.Infof("Listening for HTTP/3 on: %s", conn.LocalAddr())
+	listeners[i].packetConn = conn
+	return nil
+}
+
+// listen starts a listener for host, limited to maxConnections
+// concurrent connections if maxConnections is greater than zero.
+func listen(cfg *config.Config, host string, maxConnections int, logger *logp.Logger) (net.Listener, error) {
 	var listener net.Listener
-	url, err := url.Parse(cfg.Host)
+	url, err := url.Parse(host)
 	if err == nil && url.Scheme == "unix" {
 		// SO_REUSEPORT does not support unix sockets
 		listener, err = net.Listen("unix", url.Path)
 	} else {
-		addr := cfg.Host
+		addr := host
 		if _, _, err := net.SplitHostPort(addr); err != nil {
 			// Tack on a port if SplitHostPort fails on what should be a
 			// tcp network address. If splitting failed because there were
@@ -142,9 +278,21 @@ func listen(cfg *config.Config, logger *logp.Logger) (net.Listener, error) {
 	} else {
 		logger.Infof("Listening on: %s:%s", network, addr.String())
 	}
-	if cfg.MaxConnections > 0 {
-		logger.Infof("Connection limit set to: %d", cfg.MaxConnections)
-		listener = netutil.LimitListener(listener, cfg.MaxConnections)
+	if cfg.ProxyProtocol {
+		trustedProxies, err := srvnetutil.ParseTrustedProxies(cfg.TrustedProxies)
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+		if len(trustedProxies) == 0 {
+			logger.Warn("PROXY protocol is enabled without trusted_proxies; any client may set its address.")
+		}
+		logger.Info("PROXY protocol enabled")
+		listener = srvnetutil.ProxyProtocolListener(listener, trustedProxies, cfg.ReadTimeout)
+	}
+	if maxConnections > 0 {
+		logger.Infof("Connection limit set to: %d", maxConnections)
+		listener = netutil.LimitListener(listener, maxConnections)
 	}
 	return listener, nil
 }
@@ -0,0 +1,96 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package beater
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+
+	"github.com/elastic/apm-server/internal/beater/api"
+	"github.com/elastic/apm-server/internal/beater/config"
+)
+
+func TestHTTPServerRUMHTTP3(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Host = "localhost:0"
+	cfg.TLS = &tlscommon.ServerConfig{
+		Certificate: tlscommon.CertificateConfig{
+			Certificate: "../../testdata/tls/certificate.pem",
+			Key:         "../../testdata/tls/key.pem",
+		},
+	}
+	cfg.RumConfig.Enabled = true
+	cfg.RumConfig.HTTP3.Enabled = true
+
+	logger := logptest.NewTestingLogger(t, "")
+	listeners, err := listenAll(cfg, logger)
+	require.NoError(t, err)
+	require.Len(t, listeners, 1)
+	require.NotNil(t, listeners[0].packetConn)
+	defer listeners[0].Close()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Proto)
+	})
+	srv, err := newHTTPServer(logger, cfg, handler, listeners[0])
+	require.NoError(t, err)
+	go srv.start()
+	go srv.startHTTP3()
+	defer srv.stop(t.Context())
+
+	tlsClientConfig := &tls.Config{InsecureSkipVerify: true}
+	baseURL := "https://" + listeners[0].Addr().String()
+	_, port, err := net.SplitHostPort(listeners[0].packetConn.LocalAddr().String())
+	require.NoError(t, err)
+
+	get := func(client *http.Client, path string) (*http.Response, string) {
+		resp, err := client.Get(baseURL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(body)
+	}
+
+	// Only RUM routes are served over HTTP/3.
+	transport := &http3.Transport{TLSClientConfig: tlsClientConfig}
+	defer transport.Close()
+	h3Client := &http.Client{Transport: transport}
+	resp, body := get(h3Client, api.IntakeRUMPath)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "HTTP/3.0", body)
+	resp, _ = get(h3Client, api.IntakePath)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// The TCP listener advertises HTTP/3 with the Alt-Svc header.
+	tcpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsClientConfig}}
+	resp, body = get(tcpClient, api.IntakeRUMPath)
+	assert.Equal(t, "HTTP/1.1", body)
+	assert.Contains(t, resp.Header.Get("Alt-Svc"), fmt.Sprintf(`h3=":%s"`, port))
+}
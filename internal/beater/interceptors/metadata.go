@@ -34,7 +34,9 @@ import (
 // extracts metadata relating to the gRPC client, and adds it to the context.
 //
 // Metadata can be extracted from context using ClientMetadataFromContext.
-func ClientMetadata() grpc.UnaryServerInterceptor {
+// The client address is derived from request headers according to
+// trustedProxies; see netutil.TrustedProxies.ClientAddr.
+func ClientMetadata(trustedProxies netutil.TrustedProxies) grpc.UnaryServerInterceptor {
 	return func(
 		ctx context.Context,
 		req interface{},
@@ -53,7 +55,7 @@ func ClientMetadata() grpc.UnaryServerInterceptor {
 				values.UserAgent = ua[0]
 			}
 			// Account for `forwarded`, `x-real-ip`, `x-forwarded-for` headers
-			if ip, port := netutil.ClientAddrFromHeaders(http.Header(md)); ip.IsValid() {
+			if ip, port := trustedProxies.ClientAddr(values.ClientIP, http.Header(md)); ip.IsValid() {
 				// this is forcing 16-byte representation even for IPv4
 				// TODO: move to AsSlice and investigate the test failure
 				sliceIP := ip.As16()
@@ -38,7 +38,7 @@ func TestClientMetadata(t *testing.T) {
 		Port: 1111,
 	}
 
-	interceptor := ClientMetadata()
+	interceptor := ClientMetadata(nil)
 
 	for _, test := range []struct {
 		peer     *peer.Peer
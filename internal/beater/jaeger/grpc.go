@@ -0,0 +1,80 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package jaeger
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/apm-data/input"
+	"github.com/elastic/apm-data/input/otlp"
+	"github.com/elastic/apm-data/model/modelpb"
+	"github.com/elastic/apm-data/model/modelprocessor"
+	"github.com/elastic/apm-server/internal/agentcfg"
+	"github.com/elastic/apm-server/internal/beater/jaeger/jaegerpb"
+)
+
+// RegisterGRPCServices registers Jaeger gRPC services with the given gRPC server.
+func RegisterGRPCServices(
+	grpcServer *grpc.Server,
+	logger *zap.Logger,
+	processor modelpb.BatchProcessor,
+	semaphore input.Semaphore,
+	fetcher agentcfg.Fetcher,
+	tp trace.TracerProvider,
+) {
+	consumer := newConsumer(logger, processor, semaphore, tp)
+	jaegerpb.RegisterCollectorServiceServer(grpcServer, &grpcCollector{consumer: consumer})
+	jaegerpb.RegisterSamplingManagerServer(grpcServer, &samplingManager{fetcher: fetcher})
+}
+
+func newConsumer(logger *zap.Logger, processor modelpb.BatchProcessor, semaphore input.Semaphore, tp trace.TracerProvider) *otlp.Consumer {
+	return otlp.NewConsumer(otlp.ConsumerConfig{
+		Processor:     modelprocessor.NewTracer("jaeger.ProcessBatch", processor, modelprocessor.WithTracerProvider(tp)),
+		Logger:        logger,
+		Semaphore:     semaphore,
+		TraceProvider: tp,
+	})
+}
+
+// grpcCollector implements jaegerpb.CollectorServiceServer, translating
+// Jaeger spans to OpenTelemetry traces and passing them to an OTLP consumer.
+type grpcCollector struct {
+	consumer *otlp.Consumer
+}
+
+// PostSpans implements the Jaeger CollectorService.PostSpans method.
+func (c *grpcCollector) PostSpans(ctx context.Context, r *jaegerpb.PostSpansRequest) (*jaegerpb.PostSpansResponse, error) {
+	if r.Batch == nil || len(r.Batch.Spans) == 0 {
+		return &jaegerpb.PostSpansResponse{}, nil
+	}
+	result, err := c.consumer.ConsumeTracesWithResult(ctx, batchToTraces(r.Batch))
+	if err != nil {
+		return nil, err
+	}
+	if result.RejectedSpans > 0 {
+		// The Jaeger protocol has no notion of partial success.
+		return nil, status.Error(codes.InvalidArgument, result.ErrorMessage)
+	}
+	return &jaegerpb.PostSpansResponse{}, nil
+}
@@ -0,0 +1,214 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package jaeger_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/zap"
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/elastic/apm-data/model/modelpb"
+	"github.com/elastic/apm-server/internal/agentcfg"
+	"github.com/elastic/apm-server/internal/beater/auth"
+	"github.com/elastic/apm-server/internal/beater/config"
+	"github.com/elastic/apm-server/internal/beater/interceptors"
+	"github.com/elastic/apm-server/internal/beater/jaeger"
+	"github.com/elastic/apm-server/internal/beater/jaeger/jaegerpb"
+	"github.com/elastic/apm-server/internal/beater/monitoringtest"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestPostSpansGRPC(t *testing.T) {
+	var batches []modelpb.Batch
+	var reportError error
+	var batchProcessor modelpb.ProcessBatchFunc = func(ctx context.Context, batch *modelpb.Batch) error {
+		batches = append(batches, batch.Clone())
+		return reportError
+	}
+
+	reader := sdkmetric.NewManualReader(sdkmetric.WithTemporalitySelector(
+		func(ik sdkmetric.InstrumentKind) metricdata.Temporality {
+			return metricdata.DeltaTemporality
+		},
+	))
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	conn := newGRPCServer(t, batchProcessor, mp)
+	client := jaegerpb.NewCollectorServiceClient(conn)
+
+	startTime := time.Unix(1700000000, 0).UTC()
+	request := &jaegerpb.PostSpansRequest{
+		Batch: &jaegerpb.Batch{
+			Process: &jaegerpb.Process{
+				ServiceName: "service-name",
+				Tags: []*jaegerpb.KeyValue{
+					{Key: "jaeger.version", VStr: "Go-2.30.0"},
+					{Key: "hostname", VStr: "host-name"},
+				},
+			},
+			Spans: []*jaegerpb.Span{{
+				TraceId:       []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 2},
+				SpanId:        []byte{0, 0, 0, 0, 0, 0, 0, 3},
+				OperationName: "GET /",
+				StartTime:     timestamppb.New(startTime),
+				Duration:      durationpb.New(time.Second),
+				Tags: []*jaegerpb.KeyValue{
+					{Key: "span.kind", VStr: "server"},
+					{Key: "http.status_code", VType: jaegerpb.ValueType_INT64, VInt64: 200},
+				},
+			}},
+		},
+	}
+	_, err := client.PostSpans(context.Background(), request)
+	require.NoError(t, err)
+	require.Len(t, batches, 1)
+	require.Len(t, batches[0], 1)
+
+	event := batches[0][0]
+	assert.Equal(t, modelpb.TransactionEventType, event.Type())
+	assert.Equal(t, "service-name", event.GetService().GetName())
+	assert.Equal(t, "Jaeger/Go", event.GetAgent().GetName())
+	assert.Equal(t, "2.30.0", event.GetAgent().GetVersion())
+	assert.Equal(t, "host-name", event.GetHost().GetHostname())
+	assert.Equal(t, "00000000000000010000000000000002", event.GetTrace().GetId())
+	assert.Equal(t, "0000000000000003", event.GetTransaction().GetId())
+	assert.Equal(t, "GET /", event.GetTransaction().GetName())
+	assert.Equal(t, uint64(time.Second), event.GetEvent().GetDuration())
+
+	reportError = errors.New("failed to publish events")
+	_, err = client.PostSpans(context.Background(), request)
+	assert.Error(t, err)
+	errStatus := status.Convert(err)
+	assert.Equal(t, "failed to publish events", errStatus.Message())
+	require.Len(t, batches, 2)
+
+	// Empty batches are accepted without invoking the processor.
+	_, err = client.PostSpans(context.Background(), &jaegerpb.PostSpansRequest{})
+	assert.NoError(t, err)
+	require.Len(t, batches, 2)
+
+	monitoringtest.ExpectContainOtelMetrics(t, reader, map[string]any{
+		"apm-server.jaeger.grpc.collect.request.count":         3,
+		"apm-server.jaeger.grpc.collect.response.valid.count":  2,
+		"apm-server.jaeger.grpc.collect.response.count":        3,
+		"apm-server.jaeger.grpc.collect.response.errors.count": 1,
+	})
+}
+
+func TestGetSamplingStrategyGRPC(t *testing.T) {
+	var queries []agentcfg.Query
+	var fetcher fetcherFunc = func(ctx context.Context, query agentcfg.Query) (agentcfg.Result, error) {
+		queries = append(queries, query)
+		switch query.Service.Name {
+		case "configured":
+			return agentcfg.Result{Source: agentcfg.Source{
+				Settings: agentcfg.Settings{"transaction_sample_rate": "0.25"},
+				Etag:     "abc",
+			}}, nil
+		case "unconfigured":
+			return agentcfg.Result{Source: agentcfg.Source{Settings: agentcfg.Settings{}}}, nil
+		}
+		return agentcfg.Result{}, errors.New("fetcher failed")
+	}
+
+	reader := sdkmetric.NewManualReader(sdkmetric.WithTemporalitySelector(
+		func(ik sdkmetric.InstrumentKind) metricdata.Temporality {
+			return metricdata.DeltaTemporality
+		},
+	))
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	conn := newGRPCServerWithFetcher(t, modelpb.ProcessBatchFunc(func(context.Context, *modelpb.Batch) error { return nil }), fetcher, mp)
+	client := jaegerpb.NewSamplingManagerClient(conn)
+
+	strategy, err := client.GetSamplingStrategy(context.Background(), &jaegerpb.SamplingStrategyParameters{ServiceName: "configured"})
+	require.NoError(t, err)
+	assert.Equal(t, jaegerpb.SamplingStrategyType_PROBABILISTIC, strategy.StrategyType)
+	assert.Equal(t, 0.25, strategy.ProbabilisticSampling.SamplingRate)
+	assert.Nil(t, strategy.OperationSampling)
+
+	// Services without a configured sampling rate are sampled at the default rate.
+	strategy, err = client.GetSamplingStrategy(context.Background(), &jaegerpb.SamplingStrategyParameters{ServiceName: "unconfigured"})
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, strategy.ProbabilisticSampling.SamplingRate)
+	_, err = client.GetSamplingStrategy(context.Background(), &jaegerpb.SamplingStrategyParameters{ServiceName: "unknown"})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	_, err = client.GetSamplingStrategy(context.Background(), &jaegerpb.SamplingStrategyParameters{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Jaeger clients do not send Etags, so queries must be marked as applied.
+	require.Len(t, queries, 3)
+	for _, query := range queries {
+		assert.True(t, query.MarkAsAppliedByAgent)
+	}
+
+	monitoringtest.ExpectContainOtelMetrics(t, reader, map[string]any{
+		"apm-server.jaeger.grpc.sampling.request.count":         4,
+		"apm-server.jaeger.grpc.sampling.response.valid.count":  2,
+		"apm-server.jaeger.grpc.sampling.response.count":        4,
+		"apm-server.jaeger.grpc.sampling.response.errors.count": 2,
+	})
+}
+
+type fetcherFunc func(context.Context, agentcfg.Query) (agentcfg.Result, error)
+
+func (f fetcherFunc) Fetch(ctx context.Context, query agentcfg.Query) (agentcfg.Result, error) {
+	return f(ctx, query)
+}
+
+func newGRPCServer(t *testing.T, batchProcessor modelpb.BatchProcessor, mp metric.MeterProvider) *grpc.ClientConn {
+	return newGRPCServerWithFetcher(t, batchProcessor, agentcfg.NewEmptyFetcher(), mp)
+}
+
+func newGRPCServerWithFetcher(t *testing.T, batchProcessor modelpb.BatchProcessor, fetcher agentcfg.Fetcher, mp metric.MeterProvider) *grpc.ClientConn {
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	logger := logptest.NewTestingLogger(t, "jaeger.grpc.test")
+	authenticator, err := auth.NewAuthenticator(config.AgentAuth{}, logger)
+	require.NoError(t, err)
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		interceptors.Metrics(logger, mp),
+		interceptors.Auth(authenticator),
+	))
+	semaphore := semaphore.NewWeighted(1)
+	jaeger.RegisterGRPCServices(srv, zap.NewNop(), batchProcessor, semaphore, fetcher, noop.NewTracerProvider())
+
+	go srv.Serve(lis)
+	t.Cleanup(srv.GracefulStop)
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
@@ -0,0 +1,93 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package jaeger
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/elastic/apm-data/input"
+	"github.com/elastic/apm-data/input/otlp"
+	"github.com/elastic/apm-data/model/modelpb"
+)
+
+// maxBodySize limits the size of a Thrift-encoded request body.
+const maxBodySize = 32 * 1024 * 1024
+
+// Content types accepted by the Jaeger collector's HTTP Thrift endpoint.
+var thriftContentTypes = map[string]struct{}{
+	"application/x-thrift":                 {},
+	"application/vnd.apache.thrift.binary": {},
+}
+
+// NewHTTPHandler returns an http.HandlerFunc that receives Thrift-encoded
+// Jaeger batches, as sent by Jaeger clients to the collector's /api/traces
+// endpoint, and processes them with an OTLP consumer.
+func NewHTTPHandler(logger *zap.Logger, processor modelpb.BatchProcessor, semaphore input.Semaphore, tp trace.TracerProvider) http.HandlerFunc {
+	h := httpHandler{consumer: newConsumer(logger, processor, semaphore, tp)}
+	return h.handle
+}
+
+type httpHandler struct {
+	consumer *otlp.Consumer
+}
+
+func (h httpHandler) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, fmt.Sprintf("method %s not supported", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid content type: %s", err), http.StatusBadRequest)
+		return
+	}
+	if _, ok := thriftContentTypes[contentType]; !ok {
+		http.Error(w, fmt.Sprintf("unsupported content type %q", contentType), http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read request body: %s", err), http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxBodySize {
+		http.Error(w, fmt.Sprintf("request body exceeds %d bytes", maxBodySize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	batch, err := decodeThriftBatch(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result, err := h.consumer.ConsumeTracesWithResult(r.Context(), batchToTraces(batch))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.RejectedSpans > 0 {
+		http.Error(w, result.ErrorMessage, http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,120 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package jaeger
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/zap"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/elastic/apm-data/model/modelpb"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	var batches []modelpb.Batch
+	var batchProcessor modelpb.ProcessBatchFunc = func(ctx context.Context, batch *modelpb.Batch) error {
+		batches = append(batches, *batch)
+		return nil
+	}
+	handler := NewHTTPHandler(zap.NewNop(), batchProcessor, semaphore.NewWeighted(1), noop.NewTracerProvider())
+
+	var w thriftWriter
+	w.fieldHeader(thriftStruct, 1)
+	w.fieldHeader(thriftString, 1)
+	w.string("service-name")
+	w.stop()
+	w.fieldHeader(thriftList, 2)
+	w.listHeader(thriftStruct, 1)
+	w.fieldHeader(thriftI64, 1)
+	w.i64(1)
+	w.fieldHeader(thriftI64, 3)
+	w.i64(2)
+	w.fieldHeader(thriftString, 5)
+	w.string("operation")
+	w.stop()
+	w.stop()
+	payload := w.Bytes()
+
+	for name, test := range map[string]struct {
+		method      string
+		contentType string
+		body        []byte
+		status      int
+	}{
+		"valid": {
+			method:      http.MethodPost,
+			contentType: "application/x-thrift",
+			body:        payload,
+			status:      http.StatusAccepted,
+		},
+		"apache_thrift_content_type": {
+			method:      http.MethodPost,
+			contentType: "application/vnd.apache.thrift.binary",
+			body:        payload,
+			status:      http.StatusAccepted,
+		},
+		"method_not_allowed": {
+			method:      http.MethodGet,
+			contentType: "application/x-thrift",
+			status:      http.StatusMethodNotAllowed,
+		},
+		"unsupported_content_type": {
+			method:      http.MethodPost,
+			contentType: "application/json",
+			body:        []byte("{}"),
+			status:      http.StatusUnsupportedMediaType,
+		},
+		"invalid_payload": {
+			method:      http.MethodPost,
+			contentType: "application/x-thrift",
+			body:        []byte{thriftStruct},
+			status:      http.StatusBadRequest,
+		},
+		"body_too_large": {
+			method:      http.MethodPost,
+			contentType: "application/x-thrift",
+			body:        make([]byte, maxBodySize+1),
+			status:      http.StatusRequestEntityTooLarge,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			batches = nil
+			req := httptest.NewRequest(test.method, "/api/traces", bytes.NewReader(test.body))
+			req.Header.Set("Content-Type", test.contentType)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			assert.Equal(t, test.status, rec.Code, rec.Body.String())
+			if test.status == http.StatusAccepted {
+				require.Len(t, batches, 1)
+				require.Len(t, batches[0], 1)
+				assert.Equal(t, "service-name", batches[0][0].GetService().GetName())
+				assert.Equal(t, "operation", batches[0][0].GetTransaction().GetName())
+			} else {
+				assert.Empty(t, batches)
+			}
+		})
+	}
+}
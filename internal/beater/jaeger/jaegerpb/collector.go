@@ -0,0 +1,106 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package jaegerpb
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+)
+
+// CollectorServicePostSpansMethod is the full gRPC method name of
+// CollectorService.PostSpans.
+const CollectorServicePostSpansMethod = "/jaeger.api_v2.CollectorService/PostSpans"
+
+// PostSpansRequest is the request message for CollectorService.PostSpans.
+type PostSpansRequest struct {
+	Batch *Batch `protobuf:"bytes,1,opt,name=batch,proto3" json:"batch,omitempty"`
+}
+
+func (m *PostSpansRequest) Reset()         { *m = PostSpansRequest{} }
+func (m *PostSpansRequest) String() string { return fmt.Sprintf("%+v", *m) }
+func (*PostSpansRequest) ProtoMessage()    {}
+
+// PostSpansResponse is the response message for CollectorService.PostSpans.
+type PostSpansResponse struct{}
+
+func (m *PostSpansResponse) Reset()         { *m = PostSpansResponse{} }
+func (m *PostSpansResponse) String() string { return "{}" }
+func (*PostSpansResponse) ProtoMessage()    {}
+
+// CollectorServiceServer is the server API for the Jaeger CollectorService.
+type CollectorServiceServer interface {
+	PostSpans(context.Context, *PostSpansRequest) (*PostSpansResponse, error)
+}
+
+// RegisterCollectorServiceServer registers srv with s.
+func RegisterCollectorServiceServer(s grpc.ServiceRegistrar, srv CollectorServiceServer) {
+	s.RegisterService(&collectorServiceDesc, srv)
+}
+
+// CollectorServiceClient is the client API for the Jaeger CollectorService.
+type CollectorServiceClient interface {
+	PostSpans(ctx context.Context, in *PostSpansRequest, opts ...grpc.CallOption) (*PostSpansResponse, error)
+}
+
+type collectorServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewCollectorServiceClient returns a CollectorServiceClient using cc.
+func NewCollectorServiceClient(cc grpc.ClientConnInterface) CollectorServiceClient {
+	return &collectorServiceClient{cc}
+}
+
+func (c *collectorServiceClient) PostSpans(ctx context.Context, in *PostSpansRequest, opts ...grpc.CallOption) (*PostSpansResponse, error) {
+	out := new(PostSpansResponse)
+	if err := c.cc.Invoke(ctx, CollectorServicePostSpansMethod, in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func collectorServicePostSpansHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(PostSpansRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CollectorServiceServer).PostSpans(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CollectorServicePostSpansMethod,
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(CollectorServiceServer).PostSpans(ctx, req.(*PostSpansRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var collectorServiceDesc = grpc.ServiceDesc{
+	ServiceName: "jaeger.api_v2.CollectorService",
+	HandlerType: (*CollectorServiceServer)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "PostSpans",
+		Handler:    collectorServicePostSpansHandler,
+	}},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "collector.proto",
+}
@@ -0,0 +1,131 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package jaegerpb holds Go types for the subset of the Jaeger api_v2
+// protocol that is served by APM Server.
+//
+// The types are wire-compatible with the messages defined in jaeger-idl's
+// model.proto, collector.proto, and sampling.proto, and are encoded using
+// the struct tags understood by google.golang.org/protobuf.
+package jaegerpb
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ValueType identifies the type of a KeyValue's value.
+type ValueType int32
+
+const (
+	ValueType_STRING  ValueType = 0
+	ValueType_BOOL    ValueType = 1
+	ValueType_INT64   ValueType = 2
+	ValueType_FLOAT64 ValueType = 3
+	ValueType_BINARY  ValueType = 4
+)
+
+// SpanRefType identifies the relationship between a span and a referenced span.
+type SpanRefType int32
+
+const (
+	SpanRefType_CHILD_OF     SpanRefType = 0
+	SpanRefType_FOLLOWS_FROM SpanRefType = 1
+)
+
+// KeyValue is a typed key/value pair, used for span tags, log fields,
+// and process tags.
+type KeyValue struct {
+	Key      string    `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	VType    ValueType `protobuf:"varint,2,opt,name=v_type,json=vType,proto3,enum=jaeger.api_v2.ValueType" json:"v_type,omitempty"`
+	VStr     string    `protobuf:"bytes,3,opt,name=v_str,json=vStr,proto3" json:"v_str,omitempty"`
+	VBool    bool      `protobuf:"varint,4,opt,name=v_bool,json=vBool,proto3" json:"v_bool,omitempty"`
+	VInt64   int64     `protobuf:"varint,5,opt,name=v_int64,json=vInt64,proto3" json:"v_int64,omitempty"`
+	VFloat64 float64   `protobuf:"fixed64,6,opt,name=v_float64,json=vFloat64,proto3" json:"v_float64,omitempty"`
+	VBinary  []byte    `protobuf:"bytes,7,opt,name=v_binary,json=vBinary,proto3" json:"v_binary,omitempty"`
+}
+
+func (m *KeyValue) Reset()         { *m = KeyValue{} }
+func (m *KeyValue) String() string { return fmt.Sprintf("%+v", *m) }
+func (*KeyValue) ProtoMessage()    {}
+
+// Log is a timestamped set of fields recorded during a span.
+type Log struct {
+	Timestamp *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Fields    []*KeyValue            `protobuf:"bytes,2,rep,name=fields,proto3" json:"fields,omitempty"`
+}
+
+func (m *Log) Reset()         { *m = Log{} }
+func (m *Log) String() string { return fmt.Sprintf("%+v", *m) }
+func (*Log) ProtoMessage()    {}
+
+// SpanRef is a reference from a span to another span.
+type SpanRef struct {
+	TraceId []byte      `protobuf:"bytes,1,opt,name=trace_id,json=traceId,proto3" json:"trace_id,omitempty"`
+	SpanId  []byte      `protobuf:"bytes,2,opt,name=span_id,json=spanId,proto3" json:"span_id,omitempty"`
+	RefType SpanRefType `protobuf:"varint,3,opt,name=ref_type,json=refType,proto3,enum=jaeger.api_v2.SpanRefType" json:"ref_type,omitempty"`
+}
+
+func (m *SpanRef) Reset()         { *m = SpanRef{} }
+func (m *SpanRef) String() string { return fmt.Sprintf("%+v", *m) }
+func (*SpanRef) ProtoMessage()    {}
+
+// Process describes the traced process, i.e. the service emitting spans.
+type Process struct {
+	ServiceName string      `protobuf:"bytes,1,opt,name=service_name,json=serviceName,proto3" json:"service_name,omitempty"`
+	Tags        []*KeyValue `protobuf:"bytes,2,rep,name=tags,proto3" json:"tags,omitempty"`
+}
+
+func (m *Process) Reset()         { *m = Process{} }
+func (m *Process) String() string { return fmt.Sprintf("%+v", *m) }
+func (*Process) ProtoMessage()    {}
+
+// Span is a single Jaeger span.
+//
+// TraceId holds 16 bytes, and SpanId holds 8 bytes, both big-endian.
+type Span struct {
+	TraceId       []byte                 `protobuf:"bytes,1,opt,name=trace_id,json=traceId,proto3" json:"trace_id,omitempty"`
+	SpanId        []byte                 `protobuf:"bytes,2,opt,name=span_id,json=spanId,proto3" json:"span_id,omitempty"`
+	OperationName string                 `protobuf:"bytes,3,opt,name=operation_name,json=operationName,proto3" json:"operation_name,omitempty"`
+	References    []*SpanRef             `protobuf:"bytes,4,rep,name=references,proto3" json:"references,omitempty"`
+	Flags         uint32                 `protobuf:"varint,5,opt,name=flags,proto3" json:"flags,omitempty"`
+	StartTime     *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=start_time,json=startTime,proto3" json:"start_time,omitempty"`
+	Duration      *durationpb.Duration   `protobuf:"bytes,7,opt,name=duration,proto3" json:"duration,omitempty"`
+	Tags          []*KeyValue            `protobuf:"bytes,8,rep,name=tags,proto3" json:"tags,omitempty"`
+	Logs          []*Log                 `protobuf:"bytes,9,rep,name=logs,proto3" json:"logs,omitempty"`
+	Process       *Process               `protobuf:"bytes,10,opt,name=process,proto3" json:"process,omitempty"`
+	ProcessId     string                 `protobuf:"bytes,11,opt,name=process_id,json=processId,proto3" json:"process_id,omitempty"`
+	Warnings      []string               `protobuf:"bytes,12,rep,name=warnings,proto3" json:"warnings,omitempty"`
+}
+
+func (m *Span) Reset()         { *m = Span{} }
+func (m *Span) String() string { return fmt.Sprintf("%+v", *m) }
+func (*Span) ProtoMessage()    {}
+
+// Batch is a collection of spans reported by a single process.
+//
+// A span's own Process, if set, takes precedence over the batch's.
+type Batch struct {
+	Spans   []*Span  `protobuf:"bytes,1,rep,name=spans,proto3" json:"spans,omitempty"`
+	Process *Process `protobuf:"bytes,2,opt,name=process,proto3" json:"process,omitempty"`
+}
+
+func (m *Batch) Reset()         { *m = Batch{} }
+func (m *Batch) String() string { return fmt.Sprintf("%+v", *m) }
+func (*Batch) ProtoMessage()    {}
@@ -0,0 +1,166 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package jaegerpb
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+)
+
+// SamplingManagerGetSamplingStrategyMethod is the full gRPC method name of
+// SamplingManager.GetSamplingStrategy.
+const SamplingManagerGetSamplingStrategyMethod = "/jaeger.api_v2.SamplingManager/GetSamplingStrategy"
+
+// SamplingStrategyType identifies the type of a sampling strategy.
+type SamplingStrategyType int32
+
+const (
+	SamplingStrategyType_PROBABILISTIC SamplingStrategyType = 0
+	SamplingStrategyType_RATE_LIMITING SamplingStrategyType = 1
+)
+
+// ProbabilisticSamplingStrategy samples traces with a fixed probability.
+//
+// The JSON encoding of sampling messages matches that served by Jaeger's
+// HTTP sampling endpoint. Zero values are not omitted, as clients may not
+// treat a missing sampling rate or strategy type as zero.
+type ProbabilisticSamplingStrategy struct {
+	SamplingRate float64 `protobuf:"fixed64,1,opt,name=samplingRate,proto3" json:"samplingRate"`
+}
+
+func (m *ProbabilisticSamplingStrategy) Reset()         { *m = ProbabilisticSamplingStrategy{} }
+func (m *ProbabilisticSamplingStrategy) String() string { return fmt.Sprintf("%+v", *m) }
+func (*ProbabilisticSamplingStrategy) ProtoMessage()    {}
+
+// RateLimitingSamplingStrategy samples a fixed number of traces per second.
+type RateLimitingSamplingStrategy struct {
+	MaxTracesPerSecond int32 `protobuf:"varint,1,opt,name=maxTracesPerSecond,proto3" json:"maxTracesPerSecond"`
+}
+
+func (m *RateLimitingSamplingStrategy) Reset()         { *m = RateLimitingSamplingStrategy{} }
+func (m *RateLimitingSamplingStrategy) String() string { return fmt.Sprintf("%+v", *m) }
+func (*RateLimitingSamplingStrategy) ProtoMessage()    {}
+
+// OperationSamplingStrategy is a sampling strategy for a single operation.
+type OperationSamplingStrategy struct {
+	Operation             string                         `protobuf:"bytes,1,opt,name=operation,proto3" json:"operation"`
+	ProbabilisticSampling *ProbabilisticSamplingStrategy `protobuf:"bytes,2,opt,name=probabilisticSampling,proto3" json:"probabilisticSampling,omitempty"`
+}
+
+func (m *OperationSamplingStrategy) Reset()         { *m = OperationSamplingStrategy{} }
+func (m *OperationSamplingStrategy) String() string { return fmt.Sprintf("%+v", *m) }
+func (*OperationSamplingStrategy) ProtoMessage()    {}
+
+// PerOperationSamplingStrategies holds sampling strategies for individual
+// operations, and the defaults for all other operations.
+type PerOperationSamplingStrategies struct {
+	DefaultSamplingProbability       float64                      `protobuf:"fixed64,1,opt,name=defaultSamplingProbability,proto3" json:"defaultSamplingProbability"`
+	DefaultLowerBoundTracesPerSecond float64                      `protobuf:"fixed64,2,opt,name=defaultLowerBoundTracesPerSecond,proto3" json:"defaultLowerBoundTracesPerSecond"`
+	PerOperationStrategies           []*OperationSamplingStrategy `protobuf:"bytes,3,rep,name=perOperationStrategies,proto3" json:"perOperationStrategies"`
+	DefaultUpperBoundTracesPerSecond float64                      `protobuf:"fixed64,4,opt,name=defaultUpperBoundTracesPerSecond,proto3" json:"defaultUpperBoundTracesPerSecond,omitempty"`
+}
+
+func (m *PerOperationSamplingStrategies) Reset()         { *m = PerOperationSamplingStrategies{} }
+func (m *PerOperationSamplingStrategies) String() string { return fmt.Sprintf("%+v", *m) }
+func (*PerOperationSamplingStrategies) ProtoMessage()    {}
+
+// SamplingStrategyResponse is the response message for
+// SamplingManager.GetSamplingStrategy.
+type SamplingStrategyResponse struct {
+	StrategyType          SamplingStrategyType            `protobuf:"varint,1,opt,name=strategyType,proto3,enum=jaeger.api_v2.SamplingStrategyType" json:"strategyType"`
+	ProbabilisticSampling *ProbabilisticSamplingStrategy  `protobuf:"bytes,2,opt,name=probabilisticSampling,proto3" json:"probabilisticSampling,omitempty"`
+	RateLimitingSampling  *RateLimitingSamplingStrategy   `protobuf:"bytes,3,opt,name=rateLimitingSampling,proto3" json:"rateLimitingSampling,omitempty"`
+	OperationSampling     *PerOperationSamplingStrategies `protobuf:"bytes,4,opt,name=operationSampling,proto3" json:"operationSampling,omitempty"`
+}
+
+func (m *SamplingStrategyResponse) Reset()         { *m = SamplingStrategyResponse{} }
+func (m *SamplingStrategyResponse) String() string { return fmt.Sprintf("%+v", *m) }
+func (*SamplingStrategyResponse) ProtoMessage()    {}
+
+// SamplingStrategyParameters is the request message for
+// SamplingManager.GetSamplingStrategy.
+type SamplingStrategyParameters struct {
+	ServiceName string `protobuf:"bytes,1,opt,name=serviceName,proto3" json:"serviceName,omitempty"`
+}
+
+func (m *SamplingStrategyParameters) Reset()         { *m = SamplingStrategyParameters{} }
+func (m *SamplingStrategyParameters) String() string { return fmt.Sprintf("%+v", *m) }
+func (*SamplingStrategyParameters) ProtoMessage()    {}
+
+// SamplingManagerServer is the server API for the Jaeger SamplingManager.
+type SamplingManagerServer interface {
+	GetSamplingStrategy(context.Context, *SamplingStrategyParameters) (*SamplingStrategyResponse, error)
+}
+
+// RegisterSamplingManagerServer registers srv with s.
+func RegisterSamplingManagerServer(s grpc.ServiceRegistrar, srv SamplingManagerServer) {
+	s.RegisterService(&samplingManagerDesc, srv)
+}
+
+// SamplingManagerClient is the client API for the Jaeger SamplingManager.
+type SamplingManagerClient interface {
+	GetSamplingStrategy(ctx context.Context, in *SamplingStrategyParameters, opts ...grpc.CallOption) (*SamplingStrategyResponse, error)
+}
+
+type samplingManagerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewSamplingManagerClient returns a SamplingManagerClient using cc.
+func NewSamplingManagerClient(cc grpc.ClientConnInterface) SamplingManagerClient {
+	return &samplingManagerClient{cc}
+}
+
+func (c *samplingManagerClient) GetSamplingStrategy(ctx context.Context, in *SamplingStrategyParameters, opts ...grpc.CallOption) (*SamplingStrategyResponse, error) {
+	out := new(SamplingStrategyResponse)
+	if err := c.cc.Invoke(ctx, SamplingManagerGetSamplingStrategyMethod, in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func samplingManagerGetSamplingStrategyHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := new(SamplingStrategyParameters)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SamplingManagerServer).GetSamplingStrategy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SamplingManagerGetSamplingStrategyMethod,
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		return srv.(SamplingManagerServer).GetSamplingStrategy(ctx, req.(*SamplingStrategyParameters))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var samplingManagerDesc = grpc.ServiceDesc{
+	ServiceName: "jaeger.api_v2.SamplingManager",
+	HandlerType: (*SamplingManagerServer)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "GetSamplingStrategy",
+		Handler:    samplingManagerGetSamplingStrategyHandler,
+	}},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "sampling.proto",
+}
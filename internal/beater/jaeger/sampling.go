@@ -0,0 +1,153 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package jaeger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/apm-server/internal/agentcfg"
+	"github.com/elastic/apm-server/internal/beater/auth"
+	"github.com/elastic/apm-server/internal/beater/jaeger/jaegerpb"
+)
+
+const (
+	// transactionSampleRateSetting is the agent configuration setting
+	// holding the default sampling rate for the service.
+	transactionSampleRateSetting = "transaction_sample_rate"
+
+	// defaultSampleRate is the sampling rate used for services without
+	// a configured transaction_sample_rate. This matches the Elastic APM
+	// agents.
+	defaultSampleRate = 1.0
+)
+
+var errServiceNameRequired = errors.New("service name is required")
+
+// NewSamplingHTTPHandler returns an http.HandlerFunc that serves Jaeger
+// remote sampling strategies for the service identified by the "service"
+// query parameter, in the JSON format used by Jaeger's /sampling endpoint.
+//
+// Strategies are derived from agent central configuration.
+func NewSamplingHTTPHandler(fetcher agentcfg.Fetcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, fmt.Sprintf("method %s not supported", r.Method), http.StatusMethodNotAllowed)
+			return
+		}
+		strategy, err := fetchSamplingStrategy(r.Context(), fetcher, r.URL.Query().Get("service"))
+		if err != nil {
+			var statusCode int
+			switch {
+			case errors.Is(err, errServiceNameRequired):
+				statusCode = http.StatusBadRequest
+			case errors.Is(err, auth.ErrUnauthorized):
+				statusCode = http.StatusForbidden
+			default:
+				statusCode = http.StatusServiceUnavailable
+			}
+			http.Error(w, err.Error(), statusCode)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(strategy)
+	}
+}
+
+// samplingManager implements jaegerpb.SamplingManagerServer, serving
+// sampling strategies derived from agent central configuration.
+type samplingManager struct {
+	fetcher agentcfg.Fetcher
+}
+
+// GetSamplingStrategy implements the Jaeger SamplingManager.GetSamplingStrategy method.
+func (s *samplingManager) GetSamplingStrategy(
+	ctx context.Context,
+	params *jaegerpb.SamplingStrategyParameters,
+) (*jaegerpb.SamplingStrategyResponse, error) {
+	strategy, err := fetchSamplingStrategy(ctx, s.fetcher, params.ServiceName)
+	if err != nil {
+		switch {
+		case errors.Is(err, errServiceNameRequired):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, auth.ErrUnauthorized):
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return strategy, nil
+}
+
+// fetchSamplingStrategy fetches agent configuration for the service, and
+// translates its sampling settings into a Jaeger sampling strategy.
+func fetchSamplingStrategy(ctx context.Context, fetcher agentcfg.Fetcher, service string) (*jaegerpb.SamplingStrategyResponse, error) {
+	if service == "" {
+		return nil, errServiceNameRequired
+	}
+	if err := auth.Authorize(ctx, auth.ActionAgentConfig, auth.Resource{ServiceName: service}); err != nil {
+		return nil, err
+	}
+	result, err := fetcher.Fetch(ctx, agentcfg.Query{
+		Service: agentcfg.Service{Name: service},
+		// Jaeger clients do not send an Etag, so there is no way to
+		// know whether they have applied the configuration. Assume
+		// that they do so as soon as it has been delivered.
+		MarkAsAppliedByAgent: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fetching sampling rate failed: %w", err)
+	}
+	return samplingStrategy(service, result.Source.Settings)
+}
+
+// samplingStrategy translates agent configuration settings into a
+// probabilistic sampling strategy. Services without a configured
+// transaction_sample_rate are given the default rate, as used by the
+// Elastic APM agents.
+func samplingStrategy(service string, settings agentcfg.Settings) (*jaegerpb.SamplingStrategyResponse, error) {
+	rate := defaultSampleRate
+	if setting, ok := settings[transactionSampleRateSetting]; ok {
+		var err error
+		if rate, err = parseSampleRate(setting); err != nil {
+			return nil, fmt.Errorf("invalid %s for service %q: %w", transactionSampleRateSetting, service, err)
+		}
+	}
+	return &jaegerpb.SamplingStrategyResponse{
+		StrategyType:          jaegerpb.SamplingStrategyType_PROBABILISTIC,
+		ProbabilisticSampling: &jaegerpb.ProbabilisticSamplingStrategy{SamplingRate: rate},
+	}, nil
+}
+
+func parseSampleRate(s string) (float64, error) {
+	rate, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, err
+	}
+	if rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("sample rate %v out of range [0, 1]", rate)
+	}
+	return rate, nil
+}
@@ -0,0 +1,153 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package jaeger
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-server/internal/agentcfg"
+	"github.com/elastic/apm-server/internal/beater/auth"
+	"github.com/elastic/apm-server/internal/beater/jaeger/jaegerpb"
+)
+
+func TestSamplingStrategy(t *testing.T) {
+	for name, test := range map[string]struct {
+		settings agentcfg.Settings
+		expected *jaegerpb.SamplingStrategyResponse
+		err      string
+	}{
+		"transaction_sample_rate": {
+			settings: agentcfg.Settings{"transaction_sample_rate": "0.5"},
+			expected: &jaegerpb.SamplingStrategyResponse{
+				StrategyType:          jaegerpb.SamplingStrategyType_PROBABILISTIC,
+				ProbabilisticSampling: &jaegerpb.ProbabilisticSamplingStrategy{SamplingRate: 0.5},
+			},
+		},
+		"unconfigured": {
+			settings: agentcfg.Settings{"capture_body": "all"},
+			expected: &jaegerpb.SamplingStrategyResponse{
+				StrategyType:          jaegerpb.SamplingStrategyType_PROBABILISTIC,
+				ProbabilisticSampling: &jaegerpb.ProbabilisticSamplingStrategy{SamplingRate: 1},
+			},
+		},
+		"invalid_rate": {
+			settings: agentcfg.Settings{"transaction_sample_rate": "abc"},
+			err:      `invalid transaction_sample_rate for service "svc": strconv.ParseFloat: parsing "abc": invalid syntax`,
+		},
+		"rate_out_of_range": {
+			settings: agentcfg.Settings{"transaction_sample_rate": "1.5"},
+			err:      `invalid transaction_sample_rate for service "svc": sample rate 1.5 out of range [0, 1]`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			strategy, err := samplingStrategy("svc", test.settings)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, strategy)
+		})
+	}
+}
+
+func TestSamplingHTTPHandler(t *testing.T) {
+	fetcher := fetcherFunc(func(ctx context.Context, query agentcfg.Query) (agentcfg.Result, error) {
+		assert.True(t, query.MarkAsAppliedByAgent)
+		if query.Service.Name == "unavailable" {
+			return agentcfg.Result{}, fmt.Errorf("fetcher failed")
+		}
+		return agentcfg.Result{Source: agentcfg.Source{
+			Settings: agentcfg.Settings{"transaction_sample_rate": "0"},
+		}}, nil
+	})
+	handler := NewSamplingHTTPHandler(fetcher)
+
+	for name, test := range map[string]struct {
+		method     string
+		target     string
+		authorizer authorizerFunc
+		status     int
+		body       string
+	}{
+		"valid": {
+			target: "/sampling?service=svc",
+			status: http.StatusOK,
+			body:   `{"strategyType":0,"probabilisticSampling":{"samplingRate":0}}` + "\n",
+		},
+		"missing_service": {
+			target: "/sampling",
+			status: http.StatusBadRequest,
+		},
+		"method_not_allowed": {
+			method: http.MethodPost,
+			target: "/sampling?service=svc",
+			status: http.StatusMethodNotAllowed,
+		},
+		"unauthorized": {
+			target: "/sampling?service=svc",
+			authorizer: func(context.Context, auth.Action, auth.Resource) error {
+				return auth.ErrUnauthorized
+			},
+			status: http.StatusForbidden,
+		},
+		"unavailable": {
+			target: "/sampling?service=unavailable",
+			status: http.StatusServiceUnavailable,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			method := test.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			authorizer := test.authorizer
+			if authorizer == nil {
+				authorizer = func(context.Context, auth.Action, auth.Resource) error { return nil }
+			}
+			req := httptest.NewRequest(method, test.target, nil)
+			req = req.WithContext(auth.ContextWithAuthorizer(req.Context(), authorizer))
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			assert.Equal(t, test.status, rec.Code)
+			if test.body != "" {
+				assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+				assert.Equal(t, test.body, rec.Body.String())
+			}
+		})
+	}
+}
+
+type fetcherFunc func(context.Context, agentcfg.Query) (agentcfg.Result, error)
+
+func (f fetcherFunc) Fetch(ctx context.Context, query agentcfg.Query) (agentcfg.Result, error) {
+	return f(ctx, query)
+}
+
+type authorizerFunc func(context.Context, auth.Action, auth.Resource) error
+
+func (f authorizerFunc) Authorize(ctx context.Context, action auth.Action, resource auth.Resource) error {
+	return f(ctx, action, resource)
+}
@@ -0,0 +1,472 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package jaeger
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/elastic/apm-server/internal/beater/jaeger/jaegerpb"
+)
+
+// Thrift binary protocol type identifiers.
+const (
+	thriftStop   = 0
+	thriftBool   = 2
+	thriftByte   = 3
+	thriftDouble = 4
+	thriftI16    = 6
+	thriftI32    = 8
+	thriftI64    = 10
+	thriftString = 11
+	thriftStruct = 12
+	thriftMap    = 13
+	thriftSet    = 14
+	thriftList   = 15
+)
+
+// Jaeger Thrift tag types. Note that these differ from the
+// numbering used by jaegerpb.ValueType.
+const (
+	thriftTagTypeString = 0
+	thriftTagTypeDouble = 1
+	thriftTagTypeBool   = 2
+	thriftTagTypeLong   = 3
+	thriftTagTypeBinary = 4
+)
+
+// maxThriftNesting limits the depth of nested structures when skipping
+// unknown fields, to protect against maliciously crafted payloads.
+const maxThriftNesting = 64
+
+var errThriftTruncated = errors.New("unexpected end of thrift payload")
+
+// decodeThriftBatch decodes a jaeger.thrift Batch, encoded with the
+// Thrift binary protocol, into a jaegerpb.Batch.
+func decodeThriftBatch(data []byte) (*jaegerpb.Batch, error) {
+	r := thriftReader{data: data}
+	batch := &jaegerpb.Batch{}
+	err := r.readStruct(func(id int16, typ byte) error {
+		switch {
+		case id == 1 && typ == thriftStruct:
+			process, err := r.readProcess()
+			if err != nil {
+				return err
+			}
+			batch.Process = process
+		case id == 2 && typ == thriftList:
+			return r.readList(thriftStruct, func() error {
+				span, err := r.readSpan()
+				if err != nil {
+					return err
+				}
+				batch.Spans = append(batch.Spans, span)
+				return nil
+			})
+		default:
+			return r.skip(typ, 0)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode thrift batch: %w", err)
+	}
+	return batch, nil
+}
+
+type thriftReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *thriftReader) next(n int) ([]byte, error) {
+	if n < 0 || len(r.data)-r.pos < n {
+		return nil, errThriftTruncated
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *thriftReader) readByte() (byte, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *thriftReader) readI16() (int16, error) {
+	b, err := r.next(2)
+	if err != nil {
+		return 0, err
+	}
+	return int16(binary.BigEndian.Uint16(b)), nil
+}
+
+func (r *thriftReader) readI32() (int32, error) {
+	b, err := r.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return int32(binary.BigEndian.Uint32(b)), nil
+}
+
+func (r *thriftReader) readI64() (int64, error) {
+	b, err := r.next(8)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(b)), nil
+}
+
+func (r *thriftReader) readDouble() (float64, error) {
+	v, err := r.readI64()
+	return math.Float64frombits(uint64(v)), err
+}
+
+func (r *thriftReader) readBool() (bool, error) {
+	b, err := r.readByte()
+	return b != 0, err
+}
+
+func (r *thriftReader) readBinary() ([]byte, error) {
+	n, err := r.readI32()
+	if err != nil {
+		return nil, err
+	}
+	return r.next(int(n))
+}
+
+func (r *thriftReader) readString() (string, error) {
+	b, err := r.readBinary()
+	return string(b), err
+}
+
+// readStruct reads struct fields until a stop field is encountered,
+// calling f for each field. f must consume the field's value.
+func (r *thriftReader) readStruct(f func(id int16, typ byte) error) error {
+	for {
+		typ, err := r.readByte()
+		if err != nil {
+			return err
+		}
+		if typ == thriftStop {
+			return nil
+		}
+		id, err := r.readI16()
+		if err != nil {
+			return err
+		}
+		if err := f(id, typ); err != nil {
+			return err
+		}
+	}
+}
+
+// readList reads a list header, checks that the element type matches
+// elemType, and then calls f for each element.
+func (r *thriftReader) readList(elemType byte, f func() error) error {
+	typ, err := r.readByte()
+	if err != nil {
+		return err
+	}
+	n, err := r.readI32()
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return fmt.Errorf("invalid thrift list size %d", n)
+	}
+	if typ != elemType {
+		for i := int32(0); i < n; i++ {
+			if err := r.skip(typ, 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for i := int32(0); i < n; i++ {
+		if err := f(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skip consumes a value of the given type.
+func (r *thriftReader) skip(typ byte, depth int) error {
+	if depth > maxThriftNesting {
+		return errors.New("thrift payload nesting too deep")
+	}
+	var err error
+	switch typ {
+	case thriftBool, thriftByte:
+		_, err = r.next(1)
+	case thriftI16:
+		_, err = r.next(2)
+	case thriftI32:
+		_, err = r.next(4)
+	case thriftDouble, thriftI64:
+		_, err = r.next(8)
+	case thriftString:
+		_, err = r.readBinary()
+	case thriftStruct:
+		err = r.readStruct(func(_ int16, typ byte) error {
+			return r.skip(typ, depth+1)
+		})
+	case thriftMap:
+		var keyType, valueType byte
+		var n int32
+		if keyType, err = r.readByte(); err != nil {
+			return err
+		}
+		if valueType, err = r.readByte(); err != nil {
+			return err
+		}
+		if n, err = r.readI32(); err != nil {
+			return err
+		}
+		for i := int32(0); i < n && err == nil; i++ {
+			if err = r.skip(keyType, depth+1); err == nil {
+				err = r.skip(valueType, depth+1)
+			}
+		}
+	case thriftSet, thriftList:
+		var elemType byte
+		var n int32
+		if elemType, err = r.readByte(); err != nil {
+			return err
+		}
+		if n, err = r.readI32(); err != nil {
+			return err
+		}
+		for i := int32(0); i < n && err == nil; i++ {
+			err = r.skip(elemType, depth+1)
+		}
+	default:
+		err = fmt.Errorf("unknown thrift type %d", typ)
+	}
+	return err
+}
+
+func (r *thriftReader) readProcess() (*jaegerpb.Process, error) {
+	process := &jaegerpb.Process{}
+	err := r.readStruct(func(id int16, typ byte) (err error) {
+		switch {
+		case id == 1 && typ == thriftString:
+			process.ServiceName, err = r.readString()
+		case id == 2 && typ == thriftList:
+			process.Tags, err = r.readTags()
+		default:
+			err = r.skip(typ, 0)
+		}
+		return err
+	})
+	return process, err
+}
+
+func (r *thriftReader) readTags() ([]*jaegerpb.KeyValue, error) {
+	var tags []*jaegerpb.KeyValue
+	err := r.readList(thriftStruct, func() error {
+		tag, err := r.readTag()
+		if err != nil {
+			return err
+		}
+		tags = append(tags, tag)
+		return nil
+	})
+	return tags, err
+}
+
+func (r *thriftReader) readTag() (*jaegerpb.KeyValue, error) {
+	kv := &jaegerpb.KeyValue{}
+	var tagType int32
+	err := r.readStruct(func(id int16, typ byte) (err error) {
+		switch {
+		case id == 1 && typ == thriftString:
+			kv.Key, err = r.readString()
+		case id == 2 && typ == thriftI32:
+			tagType, err = r.readI32()
+		case id == 3 && typ == thriftString:
+			kv.VStr, err = r.readString()
+		case id == 4 && typ == thriftDouble:
+			kv.VFloat64, err = r.readDouble()
+		case id == 5 && typ == thriftBool:
+			kv.VBool, err = r.readBool()
+		case id == 6 && typ == thriftI64:
+			kv.VInt64, err = r.readI64()
+		case id == 7 && typ == thriftString:
+			kv.VBinary, err = r.readBinary()
+		default:
+			err = r.skip(typ, 0)
+		}
+		return err
+	})
+	switch tagType {
+	case thriftTagTypeDouble:
+		kv.VType = jaegerpb.ValueType_FLOAT64
+	case thriftTagTypeBool:
+		kv.VType = jaegerpb.ValueType_BOOL
+	case thriftTagTypeLong:
+		kv.VType = jaegerpb.ValueType_INT64
+	case thriftTagTypeBinary:
+		kv.VType = jaegerpb.ValueType_BINARY
+	default:
+		kv.VType = jaegerpb.ValueType_STRING
+	}
+	return kv, err
+}
+
+func (r *thriftReader) readSpan() (*jaegerpb.Span, error) {
+	var traceIDLow, traceIDHigh, spanID, parentSpanID, startTime, duration int64
+	span := &jaegerpb.Span{}
+	err := r.readStruct(func(id int16, typ byte) (err error) {
+		switch {
+		case id == 1 && typ == thriftI64:
+			traceIDLow, err = r.readI64()
+		case id == 2 && typ == thriftI64:
+			traceIDHigh, err = r.readI64()
+		case id == 3 && typ == thriftI64:
+			spanID, err = r.readI64()
+		case id == 4 && typ == thriftI64:
+			parentSpanID, err = r.readI64()
+		case id == 5 && typ == thriftString:
+			span.OperationName, err = r.readString()
+		case id == 6 && typ == thriftList:
+			err = r.readList(thriftStruct, func() error {
+				ref, err := r.readSpanRef()
+				if err != nil {
+					return err
+				}
+				span.References = append(span.References, ref)
+				return nil
+			})
+		case id == 7 && typ == thriftI32:
+			var flags int32
+			flags, err = r.readI32()
+			span.Flags = uint32(flags)
+		case id == 8 && typ == thriftI64:
+			startTime, err = r.readI64()
+		case id == 9 && typ == thriftI64:
+			duration, err = r.readI64()
+		case id == 10 && typ == thriftList:
+			span.Tags, err = r.readTags()
+		case id == 11 && typ == thriftList:
+			err = r.readList(thriftStruct, func() error {
+				log, err := r.readLog()
+				if err != nil {
+					return err
+				}
+				span.Logs = append(span.Logs, log)
+				return nil
+			})
+		default:
+			err = r.skip(typ, 0)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	span.TraceId = traceIDBytes(traceIDHigh, traceIDLow)
+	span.SpanId = spanIDBytes(spanID)
+	span.StartTime = timestamppb.New(time.UnixMicro(startTime))
+	span.Duration = durationpb.New(time.Duration(duration) * time.Microsecond)
+	if parentSpanID != 0 && !hasChildOfReference(span) {
+		// Thrift spans record the parent span separately, while
+		// in the protobuf model the parent is a CHILD_OF reference.
+		span.References = append([]*jaegerpb.SpanRef{{
+			TraceId: span.TraceId,
+			SpanId:  spanIDBytes(parentSpanID),
+			RefType: jaegerpb.SpanRefType_CHILD_OF,
+		}}, span.References...)
+	}
+	return span, nil
+}
+
+func (r *thriftReader) readSpanRef() (*jaegerpb.SpanRef, error) {
+	var traceIDLow, traceIDHigh, spanID int64
+	ref := &jaegerpb.SpanRef{}
+	err := r.readStruct(func(id int16, typ byte) (err error) {
+		switch {
+		case id == 1 && typ == thriftI32:
+			var refType int32
+			refType, err = r.readI32()
+			ref.RefType = jaegerpb.SpanRefType(refType)
+		case id == 2 && typ == thriftI64:
+			traceIDLow, err = r.readI64()
+		case id == 3 && typ == thriftI64:
+			traceIDHigh, err = r.readI64()
+		case id == 4 && typ == thriftI64:
+			spanID, err = r.readI64()
+		default:
+			err = r.skip(typ, 0)
+		}
+		return err
+	})
+	ref.TraceId = traceIDBytes(traceIDHigh, traceIDLow)
+	ref.SpanId = spanIDBytes(spanID)
+	return ref, err
+}
+
+func (r *thriftReader) readLog() (*jaegerpb.Log, error) {
+	var timestamp int64
+	log := &jaegerpb.Log{}
+	err := r.readStruct(func(id int16, typ byte) (err error) {
+		switch {
+		case id == 1 && typ == thriftI64:
+			timestamp, err = r.readI64()
+		case id == 2 && typ == thriftList:
+			log.Fields, err = r.readTags()
+		default:
+			err = r.skip(typ, 0)
+		}
+		return err
+	})
+	log.Timestamp = timestamppb.New(time.UnixMicro(timestamp))
+	return log, err
+}
+
+func hasChildOfReference(span *jaegerpb.Span) bool {
+	for _, ref := range span.References {
+		if ref.RefType == jaegerpb.SpanRefType_CHILD_OF {
+			return true
+		}
+	}
+	return false
+}
+
+func traceIDBytes(high, low int64) []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b[:8], uint64(high))
+	binary.BigEndian.PutUint64(b[8:], uint64(low))
+	return b
+}
+
+func spanIDBytes(id int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(id))
+	return b
+}
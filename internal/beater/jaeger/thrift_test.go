@@ -0,0 +1,188 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package jaeger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-server/internal/beater/jaeger/jaegerpb"
+)
+
+func TestDecodeThriftBatch(t *testing.T) {
+	var w thriftWriter
+	w.fieldHeader(thriftStruct, 1) // process
+	w.fieldHeader(thriftString, 1)
+	w.string("service-name")
+	w.fieldHeader(thriftList, 2)
+	w.listHeader(thriftStruct, 2)
+	w.stringTag("jaeger.version", "Go-2.30.0")
+	w.fieldHeader(thriftString, 1)
+	w.string("ratio")
+	w.fieldHeader(thriftI32, 2)
+	w.i32(thriftTagTypeDouble)
+	w.fieldHeader(thriftDouble, 4)
+	w.i64(int64(math.Float64bits(0.5)))
+	w.stop()
+	w.stop() // end process
+
+	w.fieldHeader(thriftList, 2) // spans
+	w.listHeader(thriftStruct, 1)
+	w.fieldHeader(thriftI64, 1)
+	w.i64(2) // traceIdLow
+	w.fieldHeader(thriftI64, 2)
+	w.i64(1) // traceIdHigh
+	w.fieldHeader(thriftI64, 3)
+	w.i64(3) // spanId
+	w.fieldHeader(thriftI64, 4)
+	w.i64(4) // parentSpanId
+	w.fieldHeader(thriftString, 5)
+	w.string("GET /")
+	w.fieldHeader(thriftI32, 7)
+	w.i32(1)
+	w.fieldHeader(thriftI64, 8)
+	w.i64(1700000000000000)
+	w.fieldHeader(thriftI64, 9)
+	w.i64(1500)
+	w.fieldHeader(thriftList, 10)
+	w.listHeader(thriftStruct, 1)
+	w.stringTag("span.kind", "client")
+	w.fieldHeader(thriftList, 11)
+	w.listHeader(thriftStruct, 1)
+	w.fieldHeader(thriftI64, 1)
+	w.i64(1700000000000500)
+	w.fieldHeader(thriftList, 2)
+	w.listHeader(thriftStruct, 1)
+	w.stringTag("event", "retry")
+	w.stop()                     // end log
+	w.fieldHeader(thriftMap, 99) // unknown field, skipped
+	w.byte(thriftString)
+	w.byte(thriftI32)
+	w.i32(1)
+	w.string("key")
+	w.i32(123)
+	w.stop() // end span
+	w.stop() // end batch
+
+	batch, err := decodeThriftBatch(w.Bytes())
+	require.NoError(t, err)
+
+	assert.Equal(t, &jaegerpb.Process{
+		ServiceName: "service-name",
+		Tags: []*jaegerpb.KeyValue{
+			{Key: "jaeger.version", VType: jaegerpb.ValueType_STRING, VStr: "Go-2.30.0"},
+			{Key: "ratio", VType: jaegerpb.ValueType_FLOAT64, VFloat64: 0.5},
+		},
+	}, batch.Process)
+
+	require.Len(t, batch.Spans, 1)
+	span := batch.Spans[0]
+	traceID := []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 2}
+	assert.Equal(t, traceID, span.TraceId)
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 3}, span.SpanId)
+	assert.Equal(t, "GET /", span.OperationName)
+	assert.Equal(t, uint32(1), span.Flags)
+	assert.Equal(t, time.UnixMicro(1700000000000000).UTC(), span.StartTime.AsTime())
+	assert.Equal(t, 1500*time.Microsecond, span.Duration.AsDuration())
+	assert.Equal(t, []*jaegerpb.SpanRef{{
+		TraceId: traceID,
+		SpanId:  []byte{0, 0, 0, 0, 0, 0, 0, 4},
+		RefType: jaegerpb.SpanRefType_CHILD_OF,
+	}}, span.References)
+	assert.Equal(t, []*jaegerpb.KeyValue{
+		{Key: "span.kind", VType: jaegerpb.ValueType_STRING, VStr: "client"},
+	}, span.Tags)
+	require.Len(t, span.Logs, 1)
+	assert.Equal(t, time.UnixMicro(1700000000000500).UTC(), span.Logs[0].Timestamp.AsTime())
+	assert.Equal(t, []*jaegerpb.KeyValue{
+		{Key: "event", VType: jaegerpb.ValueType_STRING, VStr: "retry"},
+	}, span.Logs[0].Fields)
+}
+
+func TestDecodeThriftBatchInvalid(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"empty":     {},
+		"truncated": {thriftStruct, 0, 1, thriftString, 0, 1, 0, 0, 0, 10, 'a'},
+		"unknown":   {99, 0, 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := decodeThriftBatch(data)
+			assert.Error(t, err)
+		})
+	}
+
+	// Deeply nested structures must be rejected rather than recursed into.
+	var w thriftWriter
+	for i := 0; i < maxThriftNesting+2; i++ {
+		w.fieldHeader(thriftStruct, 99)
+	}
+	_, err := decodeThriftBatch(w.Bytes())
+	assert.EqualError(t, err, "failed to decode thrift batch: thrift payload nesting too deep")
+}
+
+// thriftWriter encodes values using the Thrift binary protocol.
+type thriftWriter struct {
+	bytes.Buffer
+}
+
+func (w *thriftWriter) byte(v byte) {
+	w.WriteByte(v)
+}
+
+func (w *thriftWriter) i32(v int32) {
+	w.Write(binary.BigEndian.AppendUint32(nil, uint32(v)))
+}
+
+func (w *thriftWriter) i64(v int64) {
+	w.Write(binary.BigEndian.AppendUint64(nil, uint64(v)))
+}
+
+func (w *thriftWriter) string(v string) {
+	w.i32(int32(len(v)))
+	w.WriteString(v)
+}
+
+func (w *thriftWriter) fieldHeader(typ byte, id int16) {
+	w.WriteByte(typ)
+	w.Write(binary.BigEndian.AppendUint16(nil, uint16(id)))
+}
+
+func (w *thriftWriter) listHeader(elemType byte, n int32) {
+	w.WriteByte(elemType)
+	w.i32(n)
+}
+
+func (w *thriftWriter) stop() {
+	w.WriteByte(thriftStop)
+}
+
+func (w *thriftWriter) stringTag(key, value string) {
+	w.fieldHeader(thriftString, 1)
+	w.string(key)
+	w.fieldHeader(thriftI32, 2)
+	w.i32(thriftTagTypeString)
+	w.fieldHeader(thriftString, 3)
+	w.string(value)
+	w.stop()
+}
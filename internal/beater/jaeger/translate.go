@@ -0,0 +1,258 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package jaeger
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/elastic/apm-server/internal/beater/jaeger/jaegerpb"
+)
+
+const (
+	// Jaeger clients record their language and version in the "jaeger.version"
+	// process tag, e.g. "Go-2.30.0". apm-data identifies Jaeger clients by the
+	// OpenCensus exporter version resource attribute, with a "Jaeger-" prefix.
+	tagJaegerVersion         = "jaeger.version"
+	attributeExporterVersion = "opencensus.exporterversion"
+	exporterVersionPrefix    = "Jaeger-"
+	tagHostname              = "hostname"
+	attributeHostName        = "host.name"
+	attributeServiceName     = "service.name"
+	tagSpanKind              = "span.kind"
+	tagError                 = "error"
+	tagStatusCode            = "otel.status_code"
+	tagStatusDescription     = "otel.status_description"
+	tagW3CTraceState         = "w3c.tracestate"
+	tagScopeName             = "otel.scope.name"
+	tagScopeVersion          = "otel.scope.version"
+	tagLibraryName           = "otel.library.name"
+	tagLibraryVersion        = "otel.library.version"
+	logFieldEvent            = "event"
+	statusCodeOK             = "OK"
+	statusCodeError          = "ERROR"
+	spanKindClient           = "client"
+	spanKindServer           = "server"
+	spanKindProducer         = "producer"
+	spanKindConsumer         = "consumer"
+	spanKindInternal         = "internal"
+)
+
+// batchToTraces translates a Jaeger batch into OpenTelemetry traces, so that
+// they may be processed by the same consumer as OTLP traces.
+//
+// Spans are grouped into a resource per distinct process: spans without
+// their own process are assigned the batch's process.
+func batchToTraces(batch *jaegerpb.Batch) ptrace.Traces {
+	traces := ptrace.NewTraces()
+	if batch == nil {
+		return traces
+	}
+	resources := make(map[*jaegerpb.Process]ptrace.ResourceSpans)
+	scopes := make(map[scopeKey]ptrace.SpanSlice)
+	for _, span := range batch.Spans {
+		if span == nil {
+			continue
+		}
+		process := span.Process
+		if process == nil {
+			process = batch.Process
+		}
+		key := spanScope(process, span)
+		spans, ok := scopes[key]
+		if !ok {
+			rs, ok := resources[process]
+			if !ok {
+				rs = traces.ResourceSpans().AppendEmpty()
+				translateProcess(process, rs.Resource())
+				resources[process] = rs
+			}
+			ss := rs.ScopeSpans().AppendEmpty()
+			ss.Scope().SetName(key.name)
+			ss.Scope().SetVersion(key.version)
+			spans = ss.Spans()
+			scopes[key] = spans
+		}
+		translateSpan(span, spans.AppendEmpty())
+	}
+	return traces
+}
+
+// scopeKey identifies the process and instrumentation scope of a span.
+type scopeKey struct {
+	process *jaegerpb.Process
+	name    string
+	version string
+}
+
+func spanScope(process *jaegerpb.Process, span *jaegerpb.Span) scopeKey {
+	key := scopeKey{process: process}
+	for _, tag := range span.Tags {
+		switch tag.Key {
+		case tagScopeName, tagLibraryName:
+			key.name = tag.VStr
+		case tagScopeVersion, tagLibraryVersion:
+			key.version = tag.VStr
+		}
+	}
+	return key
+}
+
+func translateProcess(process *jaegerpb.Process, out pcommon.Resource) {
+	attrs := out.Attributes()
+	if process == nil {
+		return
+	}
+	if process.ServiceName != "" {
+		attrs.PutStr(attributeServiceName, process.ServiceName)
+	}
+	for _, tag := range process.Tags {
+		switch tag.Key {
+		case tagJaegerVersion:
+			attrs.PutStr(attributeExporterVersion, exporterVersionPrefix+tag.VStr)
+		case tagHostname:
+			attrs.PutStr(attributeHostName, tag.VStr)
+		default:
+			putKeyValue(attrs, tag)
+		}
+	}
+}
+
+func translateSpan(span *jaegerpb.Span, out ptrace.Span) {
+	out.SetTraceID(traceID(span.TraceId))
+	out.SetSpanID(spanID(span.SpanId))
+	out.SetName(span.OperationName)
+	out.SetFlags(span.Flags)
+
+	start := span.StartTime.AsTime()
+	out.SetStartTimestamp(pcommon.NewTimestampFromTime(start))
+	out.SetEndTimestamp(pcommon.NewTimestampFromTime(start.Add(span.Duration.AsDuration())))
+
+	var parentSet bool
+	for _, ref := range span.References {
+		if !parentSet && ref.RefType == jaegerpb.SpanRefType_CHILD_OF && string(ref.TraceId) == string(span.TraceId) {
+			out.SetParentSpanID(spanID(ref.SpanId))
+			parentSet = true
+			continue
+		}
+		link := out.Links().AppendEmpty()
+		link.SetTraceID(traceID(ref.TraceId))
+		link.SetSpanID(spanID(ref.SpanId))
+		if ref.RefType == jaegerpb.SpanRefType_FOLLOWS_FROM {
+			link.Attributes().PutStr("opentracing.ref_type", "follows_from")
+		} else {
+			link.Attributes().PutStr("opentracing.ref_type", "child_of")
+		}
+	}
+
+	var errorTag, statusCode, statusDescription string
+	attrs := out.Attributes()
+	for _, tag := range span.Tags {
+		switch tag.Key {
+		case tagSpanKind:
+			out.SetKind(spanKind(tag.VStr))
+		case tagStatusCode:
+			statusCode = strings.ToUpper(tag.VStr)
+		case tagStatusDescription:
+			statusDescription = tag.VStr
+		case tagW3CTraceState:
+			out.TraceState().FromRaw(tag.VStr)
+		case tagScopeName, tagScopeVersion, tagLibraryName, tagLibraryVersion:
+			// Recorded as the span's instrumentation scope.
+		case tagError:
+			if (tag.VType == jaegerpb.ValueType_BOOL && tag.VBool) ||
+				(tag.VType == jaegerpb.ValueType_STRING && tag.VStr == "true") {
+				errorTag = statusCodeError
+			}
+		default:
+			putKeyValue(attrs, tag)
+		}
+	}
+	switch {
+	case statusCode == statusCodeError, statusCode == "" && errorTag == statusCodeError:
+		out.Status().SetCode(ptrace.StatusCodeError)
+		out.Status().SetMessage(statusDescription)
+	case statusCode == statusCodeOK:
+		out.Status().SetCode(ptrace.StatusCodeOk)
+	}
+
+	for _, log := range span.Logs {
+		event := out.Events().AppendEmpty()
+		event.SetTimestamp(pcommon.NewTimestampFromTime(log.Timestamp.AsTime()))
+		eventAttrs := event.Attributes()
+		for _, field := range log.Fields {
+			if field.Key == logFieldEvent && field.VType == jaegerpb.ValueType_STRING {
+				event.SetName(field.VStr)
+				continue
+			}
+			putKeyValue(eventAttrs, field)
+		}
+	}
+}
+
+func spanKind(kind string) ptrace.SpanKind {
+	switch kind {
+	case spanKindClient:
+		return ptrace.SpanKindClient
+	case spanKindServer:
+		return ptrace.SpanKindServer
+	case spanKindProducer:
+		return ptrace.SpanKindProducer
+	case spanKindConsumer:
+		return ptrace.SpanKindConsumer
+	case spanKindInternal:
+		return ptrace.SpanKindInternal
+	}
+	return ptrace.SpanKindUnspecified
+}
+
+func putKeyValue(attrs pcommon.Map, kv *jaegerpb.KeyValue) {
+	switch kv.VType {
+	case jaegerpb.ValueType_STRING:
+		attrs.PutStr(kv.Key, kv.VStr)
+	case jaegerpb.ValueType_BOOL:
+		attrs.PutBool(kv.Key, kv.VBool)
+	case jaegerpb.ValueType_INT64:
+		attrs.PutInt(kv.Key, kv.VInt64)
+	case jaegerpb.ValueType_FLOAT64:
+		attrs.PutDouble(kv.Key, kv.VFloat64)
+	case jaegerpb.ValueType_BINARY:
+		// Byte attributes are not indexed, so record binary values as hex.
+		attrs.PutStr(kv.Key, hex.EncodeToString(kv.VBinary))
+	}
+}
+
+func traceID(b []byte) pcommon.TraceID {
+	var id pcommon.TraceID
+	// Jaeger may send 8-byte trace IDs; right-align them.
+	if len(b) <= len(id) {
+		copy(id[len(id)-len(b):], b)
+	}
+	return id
+}
+
+func spanID(b []byte) pcommon.SpanID {
+	var id pcommon.SpanID
+	if len(b) <= len(id) {
+		copy(id[len(id)-len(b):], b)
+	}
+	return id
+}
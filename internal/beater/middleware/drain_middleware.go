@@ -0,0 +1,74 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/elastic/apm-server/internal/beater/drain"
+	"github.com/elastic/apm-server/internal/beater/headers"
+	"github.com/elastic/apm-server/internal/beater/request"
+)
+
+// DrainMiddleware returns a Middleware which tracks in-flight streaming
+// requests with d, and responds with 503 Service Unavailable to requests
+// received while the server is draining.
+//
+// Responses with status 503 while the server is draining, including those
+// for in-flight requests stopped by d.BatchProcessor, have the Retry-After
+// header set.
+func DrainMiddleware(d *drain.Drainer) Middleware {
+	retryAfter := strconv.Itoa(int(d.RetryAfter().Seconds()))
+	return func(h request.Handler) (request.Handler, error) {
+		return func(c *request.Context) {
+			if !d.Acquire() {
+				c.ResponseWriter.Header().Set(headers.RetryAfter, retryAfter)
+				c.Result.SetWithError(request.IDResponseErrorsShuttingDown, drain.ErrDraining)
+				c.WriteResult()
+				return
+			}
+			defer d.Release()
+			c.ResponseWriter = &drainResponseWriter{
+				ResponseWriter: c.ResponseWriter,
+				drainer:        d,
+				retryAfter:     retryAfter,
+			}
+			h(c)
+		}, nil
+	}
+}
+
+type drainResponseWriter struct {
+	http.ResponseWriter
+	drainer    *drain.Drainer
+	retryAfter string
+}
+
+func (w *drainResponseWriter) WriteHeader(statusCode int) {
+	if statusCode == http.StatusServiceUnavailable && w.drainer.IsDraining() {
+		w.Header().Set(headers.RetryAfter, w.retryAfter)
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Unwrap returns the underlying http.ResponseWriter, for use
+// with http.ResponseController.
+func (w *drainResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
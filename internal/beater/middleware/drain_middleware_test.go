@@ -0,0 +1,65 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-server/internal/beater/drain"
+	"github.com/elastic/apm-server/internal/beater/headers"
+	"github.com/elastic/apm-server/internal/beater/request"
+)
+
+func TestDrainMiddleware(t *testing.T) {
+	d := drain.New(5 * time.Second)
+	serve := func(h request.Handler) *httptest.ResponseRecorder {
+		wrapped, err := DrainMiddleware(d)(h)
+		require.NoError(t, err)
+		c := request.NewContext()
+		w := httptest.NewRecorder()
+		c.Reset(w, httptest.NewRequest(http.MethodPost, "/", nil))
+		wrapped(c)
+		return w
+	}
+
+	// Requests are tracked while in flight. When the server starts
+	// draining, in-flight requests failing with 503 have Retry-After set.
+	w := serve(func(c *request.Context) {
+		assert.Equal(t, int64(1), d.InFlight())
+		d.Drain()
+		c.Result.SetWithError(request.IDResponseErrorsShuttingDown, drain.ErrDraining)
+		c.WriteResult()
+	})
+	assert.Equal(t, int64(0), d.InFlight())
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "5", w.Header().Get(headers.RetryAfter))
+
+	// New requests are rejected while draining.
+	w = serve(func(c *request.Context) {
+		t.Fatal("handler should not be called while draining")
+	})
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "5", w.Header().Get(headers.RetryAfter))
+	assert.Equal(t, `{"error":"server is shutting down: server is draining"}`+"\n", w.Body.String())
+}
@@ -19,15 +19,47 @@ package middleware
 
 import (
 	"errors"
+	"sync/atomic"
 
 	"github.com/elastic/apm-server/internal/beater/request"
 )
 
+// KillSwitch holds whether a set of endpoints is enabled, and may be
+// toggled at runtime.
+//
+// KillSwitch is safe for concurrent use.
+type KillSwitch struct {
+	enabled atomic.Bool
+}
+
+// NewKillSwitch returns a new KillSwitch, initially enabled or disabled.
+func NewKillSwitch(enabled bool) *KillSwitch {
+	var s KillSwitch
+	s.enabled.Store(enabled)
+	return &s
+}
+
+// Enabled reports whether the endpoints are enabled.
+func (s *KillSwitch) Enabled() bool {
+	return s.enabled.Load()
+}
+
+// SetEnabled enables or disables the endpoints.
+func (s *KillSwitch) SetEnabled(enabled bool) {
+	s.enabled.Store(enabled)
+}
+
 // KillSwitchMiddleware returns a Middleware checking whether the path for the request is enabled
 func KillSwitchMiddleware(enabled bool, errorMessage string) Middleware {
+	return RuntimeKillSwitchMiddleware(NewKillSwitch(enabled), errorMessage)
+}
+
+// RuntimeKillSwitchMiddleware returns a Middleware checking whether the
+// path for the request is enabled by s at the time of the request.
+func RuntimeKillSwitchMiddleware(s *KillSwitch, errorMessage string) Middleware {
 	return func(h request.Handler) (request.Handler, error) {
 		return func(c *request.Context) {
-			if enabled {
+			if s.Enabled() {
 				h(c)
 			} else {
 				c.Result.SetWithError(request.IDResponseErrorsForbidden, errors.New(errorMessage))
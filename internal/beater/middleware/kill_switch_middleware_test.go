@@ -36,3 +36,17 @@ func TestKillSwitchMiddleware(t *testing.T) {
 		assert.Equal(t, http.StatusForbidden, rec.Code)
 	})
 }
+
+func TestRuntimeKillSwitchMiddleware(t *testing.T) {
+	s := NewKillSwitch(false)
+	h := Apply(RuntimeKillSwitchMiddleware(s, "endpoint is disabled"), Handler202)
+
+	c, rec := DefaultContextWithResponseRecorder()
+	h(c)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	s.SetEnabled(true)
+	c, rec = DefaultContextWithResponseRecorder()
+	h(c)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+}
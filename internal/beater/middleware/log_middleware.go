@@ -31,8 +31,11 @@ import (
 )
 
 // LogMiddleware returns a middleware taking care of logging processing a request in the middleware and the request handler
+//
+// Debug messages of the request logger are filtered by the runtime
+// debug selectors, regardless of how logger was created.
 func LogMiddleware(logger *logp.Logger) Middleware {
-	logger = logger.Named(logs.Request)
+	logger = logger.Named(logs.Request).WithOptions(logs.WithRuntimeSelectors())
 	return func(h request.Handler) (request.Handler, error) {
 		return func(c *request.Context) {
 			c.Logger = loggerWithRequestContext(logger, c)
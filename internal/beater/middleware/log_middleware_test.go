@@ -138,6 +138,32 @@ func TestLogMiddleware(t *testing.T) {
 	}
 }
 
+func TestLogMiddlewareRuntimeSelectors(t *testing.T) {
+	t.Cleanup(func() { logs.SetRuntimeSelectors(nil) })
+	core, observedLogs := observer.New(zapcore.DebugLevel)
+	logger := logptest.NewTestingLogger(t, "", zap.WrapCore(func(in zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(in, core)
+	}))
+	handler := Apply(LogMiddleware(logger), func(c *request.Context) {
+		c.Logger.Debug("debug")
+		Handler202(c)
+	})
+
+	logs.SetRuntimeSelectors([]string{"other"})
+	c, _ := DefaultContextWithResponseRecorder()
+	handler(c)
+	entries := observedLogs.TakeAll()
+	require.Len(t, entries, 1)
+	assert.Equal(t, zapcore.InfoLevel, entries[0].Level)
+
+	logs.SetRuntimeSelectors([]string{logs.Request})
+	c, _ = DefaultContextWithResponseRecorder()
+	handler(c)
+	entries = observedLogs.TakeAll()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "debug", entries[0].Message)
+}
+
 func TestLogMiddlewareRequestBodyBytes(t *testing.T) {
 	core, observedLogs := observer.New(zapcore.DebugLevel)
 	logger := logptest.NewTestingLogger(t, "", zap.WrapCore(func(in zapcore.Core) zapcore.Core {
@@ -40,6 +40,10 @@ var (
 )
 
 // RegisterGRPCServices registers OTLP consumer services with the given gRPC server.
+//
+// The OTel-Arrow streaming services are not registered. Collectors using
+// the otelarrow exporter receive Unimplemented for the Arrow streams, and
+// fall back to sending standard OTLP to these services.
 func RegisterGRPCServices(
 	grpcServer *grpc.Server,
 	logger *zap.Logger,
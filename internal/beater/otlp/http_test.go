@@ -180,6 +180,10 @@ func newHTTPServer(t *testing.T, batchProcessor modelpb.BatchProcessor) (string,
 		ratelimitStore,
 		nil,
 		func() bool { return true },
+		nil,
+		nil,
+		nil,
+		nil,
 		semaphore.NewWeighted(1),
 		mp,
 		noop.NewTracerProvider(),
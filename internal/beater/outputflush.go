@@ -0,0 +1,93 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package beater
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+)
+
+// outputFlushWaiter tracks requests in flight to Elasticsearch, for
+// waiting until documents buffered by docappenders have been flushed.
+//
+// docappender does not support flushing without closing the appender,
+// which would prevent events from being indexed after draining, such
+// as those reported by tail-sampling. Instead, buffered documents are
+// assumed to have been flushed after the flush interval has elapsed and
+// there are no requests in flight. This is best-effort: a flush may
+// start just after the interval elapses, and bulk requests may fail or
+// be retried after waiting returns.
+type outputFlushWaiter struct {
+	mu            sync.Mutex
+	flushInterval time.Duration
+	inflight      atomic.Int64
+}
+
+// wrap returns an elastictransport.Interface which tracks requests in
+// flight through next, for a docappender with the given flush interval.
+func (w *outputFlushWaiter) wrap(next elastictransport.Interface, flushInterval time.Duration) elastictransport.Interface {
+	w.mu.Lock()
+	w.flushInterval = max(w.flushInterval, flushInterval)
+	w.mu.Unlock()
+	return &outputFlushTransport{next: next, waiter: w}
+}
+
+// wait waits, on a best-effort basis, for documents buffered at the
+// time of calling to be flushed, or for ctx to be cancelled.
+func (w *outputFlushWaiter) wait(ctx context.Context) error {
+	w.mu.Lock()
+	flushInterval := w.flushInterval
+	w.mu.Unlock()
+	if flushInterval == 0 {
+		// No docappenders have been created.
+		return nil
+	}
+	timer := time.NewTimer(flushInterval)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for w.inflight.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+type outputFlushTransport struct {
+	next   elastictransport.Interface
+	waiter *outputFlushWaiter
+}
+
+func (t *outputFlushTransport) Perform(req *http.Request) (*http.Response, error) {
+	t.waiter.inflight.Add(1)
+	defer t.waiter.inflight.Add(-1)
+	return t.next.Perform(req)
+}
@@ -0,0 +1,56 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package beater
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputFlushWaiter(t *testing.T) {
+	var w outputFlushWaiter
+	require.NoError(t, w.wait(context.Background()))
+
+	unblock := make(chan struct{})
+	transport := w.wrap(performFunc(func(*http.Request) (*http.Response, error) {
+		<-unblock
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}), 10*time.Millisecond)
+	go transport.Perform(&http.Request{})
+
+	// The waiter waits for the flush interval to elapse
+	// and for in-flight requests to complete.
+	assert.Eventually(t, func() bool { return w.inflight.Load() == 1 }, 10*time.Second, time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, w.wait(ctx), context.DeadlineExceeded)
+
+	close(unblock)
+	assert.NoError(t, w.wait(context.Background()))
+}
+
+type performFunc func(*http.Request) (*http.Response, error)
+
+func (f performFunc) Perform(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
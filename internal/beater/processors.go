@@ -19,8 +19,10 @@ package beater
 
 import (
 	"context"
+	"errors"
 	"io"
 	"os"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -31,6 +33,9 @@ import (
 	"github.com/elastic/apm-data/model/modelpb"
 	"github.com/elastic/apm-server/internal/beater/auth"
 	"github.com/elastic/apm-server/internal/beater/ratelimit"
+	srvmodelprocessor "github.com/elastic/apm-server/internal/model/modelprocessor"
+	"github.com/elastic/apm-server/internal/publish"
+	"github.com/elastic/apm-server/internal/spool"
 	"github.com/elastic/apm-server/internal/version"
 	"github.com/elastic/go-docappender/v2"
 )
@@ -114,6 +119,61 @@ func newDocappenderBatchProcessor(a *docappender.Appender) modelpb.ProcessBatchF
 	}
 }
 
+// newSpoolBatchProcessor returns a model.BatchProcessor that writes batches
+// to the spool, translating spool errors to their publisher equivalents.
+func newSpoolBatchProcessor(s *spool.Spool) modelpb.ProcessBatchFunc {
+	return func(ctx context.Context, b *modelpb.Batch) error {
+		err := s.ProcessBatch(ctx, b)
+		switch {
+		case errors.Is(err, spool.ErrFull):
+			return publish.ErrFull
+		case errors.Is(err, spool.ErrClosed):
+			return publish.ErrChannelClosed
+		}
+		return err
+	}
+}
+
+// outputRoute holds the conditions of an output routing rule, and the
+// processor for the output to which events matching the rule are sent.
+type outputRoute struct {
+	matcher   srvmodelprocessor.EventMatcher
+	processor modelpb.BatchProcessor
+}
+
+// newOutputRoutingBatchProcessor returns a model.BatchProcessor that sends
+// each event to the processor of the first route it matches, or to
+// defaultProcessor if it matches no route.
+func newOutputRoutingBatchProcessor(routes []outputRoute, defaultProcessor modelpb.BatchProcessor) modelpb.ProcessBatchFunc {
+	return func(ctx context.Context, b *modelpb.Batch) error {
+		// The last batch holds events for defaultProcessor.
+		batches := make([]modelpb.Batch, len(routes)+1)
+		for _, event := range *b {
+			i := slices.IndexFunc(routes, func(r outputRoute) bool {
+				return r.matcher.Matches(event)
+			})
+			if i < 0 {
+				i = len(routes)
+			}
+			batches[i] = append(batches[i], event)
+		}
+		var errs []error
+		for i, batch := range batches {
+			if len(batch) == 0 {
+				continue
+			}
+			processor := defaultProcessor
+			if i < len(routes) {
+				processor = routes[i].processor
+			}
+			if err := processor.ProcessBatch(ctx, &batch); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
 type pooledReader struct {
 	pool         *sync.Pool
 	jsonw        fastjson.Writer
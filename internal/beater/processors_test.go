@@ -27,6 +27,9 @@ import (
 
 	"github.com/elastic/apm-data/model/modelpb"
 	"github.com/elastic/apm-server/internal/beater/ratelimit"
+	srvmodelprocessor "github.com/elastic/apm-server/internal/model/modelprocessor"
+	"github.com/elastic/apm-server/internal/publish"
+	"github.com/elastic/apm-server/internal/spool"
 )
 
 func TestRateLimitBatchProcessor(t *testing.T) {
@@ -47,3 +50,67 @@ func TestRateLimitBatchProcessor(t *testing.T) {
 	err := rateLimitBatchProcessor(ctx, &batch)
 	assert.Equal(t, ratelimit.ErrRateLimitExceeded, err)
 }
+
+func TestSpoolBatchProcessor(t *testing.T) {
+	sp, err := spool.New(context.Background(), spool.Config{
+		Dir:       t.TempDir(),
+		MaxSize:   1024,
+		Processor: modelpb.ProcessBatchFunc(func(context.Context, *modelpb.Batch) error { return nil }),
+	})
+	require.NoError(t, err)
+	processor := newSpoolBatchProcessor(sp)
+
+	batch := modelpb.Batch{{Message: "hello"}}
+	require.NoError(t, processor(context.Background(), &batch))
+
+	large := modelpb.Batch{{Message: string(make([]byte, 1024))}}
+	assert.ErrorIs(t, processor(context.Background(), &large), publish.ErrFull)
+
+	require.NoError(t, sp.Close())
+	assert.ErrorIs(t, processor(context.Background(), &batch), publish.ErrChannelClosed)
+}
+
+func TestOutputRoutingBatchProcessor(t *testing.T) {
+	var production, loadtest, fallback []string
+	recordTo := func(messages *[]string) modelpb.ProcessBatchFunc {
+		return func(ctx context.Context, b *modelpb.Batch) error {
+			for _, event := range *b {
+				*messages = append(*messages, event.Message)
+			}
+			return nil
+		}
+	}
+	processor := newOutputRoutingBatchProcessor([]outputRoute{{
+		matcher: srvmodelprocessor.EventMatcher{
+			ServiceEnvironment: []string{"production"},
+			DataStreamType:     []string{"traces"},
+		},
+		processor: recordTo(&production),
+	}, {
+		matcher: srvmodelprocessor.EventMatcher{
+			Labels: map[string]string{"scenario": "loadtest"},
+		},
+		processor: recordTo(&loadtest),
+	}}, recordTo(&fallback))
+
+	batch := modelpb.Batch{{
+		Message:    "production-traces",
+		Service:    &modelpb.Service{Environment: "production"},
+		DataStream: &modelpb.DataStream{Type: "traces"},
+	}, {
+		Message:    "production-logs",
+		Service:    &modelpb.Service{Environment: "production"},
+		DataStream: &modelpb.DataStream{Type: "logs"},
+	}, {
+		Message:    "loadtest",
+		Service:    &modelpb.Service{Environment: "production"},
+		DataStream: &modelpb.DataStream{Type: "logs"},
+		Labels:     modelpb.Labels{"scenario": {Value: "loadtest"}},
+	}, {
+		Message: "unmatched",
+	}}
+	require.NoError(t, processor(context.Background(), &batch))
+	assert.Equal(t, []string{"production-traces"}, production)
+	assert.Equal(t, []string{"loadtest"}, loadtest)
+	assert.Equal(t, []string{"production-logs", "unmatched"}, fallback)
+}
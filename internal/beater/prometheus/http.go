@@ -0,0 +1,189 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package prometheus implements a Prometheus remote-write receiver.
+package prometheus
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/golang/snappy"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
+
+	"github.com/elastic/apm-data/input"
+	"github.com/elastic/apm-data/input/otlp"
+	"github.com/elastic/apm-data/model/modelpb"
+	"github.com/elastic/apm-data/model/modelprocessor"
+	"github.com/elastic/apm-server/internal/beater/auth"
+	"github.com/elastic/apm-server/internal/beater/prometheus/prompb"
+	"github.com/elastic/apm-server/internal/beater/prometheus/prompb/writev2"
+	"github.com/elastic/apm-server/internal/beater/ratelimit"
+)
+
+const (
+	// protoMessageV1 and protoMessageV2 are the values of the Content-Type
+	// "proto" parameter identifying remote-write 1.0 and 2.0 requests.
+	protoMessageV1 = "prometheus.WriteRequest"
+	protoMessageV2 = "io.prometheus.write.v2.Request"
+
+	headerSamplesWritten    = "X-Prometheus-Remote-Write-Samples-Written"
+	headerHistogramsWritten = "X-Prometheus-Remote-Write-Histograms-Written"
+	headerExemplarsWritten  = "X-Prometheus-Remote-Write-Exemplars-Written"
+
+	// maxDecodedSize limits the size of a decompressed request body.
+	maxDecodedSize = 32 * 1024 * 1024
+)
+
+// NewHTTPHandler returns an http.HandlerFunc that receives Prometheus
+// remote-write 1.0 and 2.0 requests, and processes their time series
+// as metrics with an OTLP consumer.
+func NewHTTPHandler(logger *zap.Logger, processor modelpb.BatchProcessor, semaphore input.Semaphore, tp trace.TracerProvider) http.HandlerFunc {
+	h := httpHandler{consumer: otlp.NewConsumer(otlp.ConsumerConfig{
+		Processor:     modelprocessor.NewTracer("prometheus.ProcessBatch", processor, modelprocessor.WithTracerProvider(tp)),
+		Logger:        logger,
+		Semaphore:     semaphore,
+		TraceProvider: tp,
+	})}
+	return h.handle
+}
+
+type httpHandler struct {
+	consumer *otlp.Consumer
+}
+
+func (h httpHandler) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, fmt.Sprintf("method %s not supported", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	protoMessage, err := requestProtoMessage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	if encoding := r.Header.Get("Content-Encoding"); encoding != "snappy" {
+		http.Error(w, fmt.Sprintf("unsupported content encoding %q", encoding), http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := readSnappyBody(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var in []series
+	switch protoMessage {
+	case protoMessageV1:
+		var req prompb.WriteRequest
+		if err := proto.Unmarshal(body, protoadapt.MessageV2Of(&req)); err != nil {
+			http.Error(w, fmt.Sprintf("failed to decode write request: %s", err), http.StatusBadRequest)
+			return
+		}
+		in = writeRequestSeries(&req)
+	case protoMessageV2:
+		var req writev2.Request
+		if err := proto.Unmarshal(body, protoadapt.MessageV2Of(&req)); err != nil {
+			http.Error(w, fmt.Sprintf("failed to decode write request: %s", err), http.StatusBadRequest)
+			return
+		}
+		if in, err = writeV2RequestSeries(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	metrics, droppedSeries := seriesToMetrics(in)
+	result, err := h.consumer.ConsumeMetricsWithResult(r.Context(), metrics)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, auth.ErrUnauthorized):
+			statusCode = http.StatusForbidden
+		case errors.Is(err, ratelimit.ErrRateLimitExceeded):
+			statusCode = http.StatusTooManyRequests
+		}
+		http.Error(w, err.Error(), statusCode)
+		return
+	}
+	if protoMessage == protoMessageV2 {
+		written := int64(metrics.DataPointCount()) - result.RejectedDataPoints
+		w.Header().Set(headerSamplesWritten, strconv.FormatInt(written, 10))
+		w.Header().Set(headerHistogramsWritten, "0")
+		w.Header().Set(headerExemplarsWritten, "0")
+	}
+	switch {
+	case droppedSeries > 0:
+		http.Error(w, fmt.Sprintf("dropped %d time series without a metric name", droppedSeries), http.StatusBadRequest)
+	case result.RejectedDataPoints > 0:
+		http.Error(w, result.ErrorMessage, http.StatusBadRequest)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// requestProtoMessage returns the protobuf message type of the request
+// body, as identified by the Content-Type "proto" parameter. Requests
+// without the parameter are remote-write 1.0 requests.
+func requestProtoMessage(r *http.Request) (string, error) {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return protoMessageV1, nil
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("invalid content type: %w", err)
+	}
+	if mediaType != "application/x-protobuf" {
+		return "", fmt.Errorf("unsupported content type %q", mediaType)
+	}
+	switch msg := params["proto"]; msg {
+	case "", protoMessageV1:
+		return protoMessageV1, nil
+	case protoMessageV2:
+		return protoMessageV2, nil
+	default:
+		return "", fmt.Errorf("unsupported proto message %q", msg)
+	}
+}
+
+// readSnappyBody reads and decodes a snappy block-compressed request body.
+func readSnappyBody(r io.Reader) ([]byte, error) {
+	compressed, err := io.ReadAll(io.LimitReader(r, maxDecodedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	n, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode snappy body: %w", err)
+	}
+	if len(compressed) > maxDecodedSize || n > maxDecodedSize {
+		return nil, fmt.Errorf("request body exceeds %d bytes", maxDecodedSize)
+	}
+	body, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode snappy body: %w", err)
+	}
+	return body, nil
+}
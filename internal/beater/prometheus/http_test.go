@@ -0,0 +1,163 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package prometheus_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/trace/noop"
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
+
+	"github.com/elastic/apm-data/model/modelpb"
+	"github.com/elastic/apm-server/internal/agentcfg"
+	"github.com/elastic/apm-server/internal/beater/api"
+	"github.com/elastic/apm-server/internal/beater/auth"
+	"github.com/elastic/apm-server/internal/beater/config"
+	"github.com/elastic/apm-server/internal/beater/monitoringtest"
+	"github.com/elastic/apm-server/internal/beater/prometheus/prompb"
+	"github.com/elastic/apm-server/internal/beater/prometheus/prompb/writev2"
+	"github.com/elastic/apm-server/internal/beater/ratelimit"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func TestRemoteWriteHTTP(t *testing.T) {
+	var batches []modelpb.Batch
+	var batchProcessor modelpb.ProcessBatchFunc = func(ctx context.Context, batch *modelpb.Batch) error {
+		batches = append(batches, *batch)
+		return nil
+	}
+	addr, reader := newHTTPServer(t, batchProcessor)
+
+	v1 := encodeRequest(t, &prompb.WriteRequest{
+		Timeseries: []*prompb.TimeSeries{{
+			Labels: []*prompb.Label{
+				{Name: "__name__", Value: "requests_total"},
+				{Name: "job", Value: "service_name"},
+				{Name: "instance", Value: "host:9090"},
+			},
+			Samples: []*prompb.Sample{{Value: 5, Timestamp: 1700000000000}},
+		}},
+		Metadata: []*prompb.MetricMetadata{{Type: prompb.MetricType_COUNTER, MetricFamilyName: "requests_total"}},
+	})
+	rsp := post(t, addr, "application/x-protobuf", v1)
+	assert.Equal(t, http.StatusNoContent, rsp.StatusCode)
+	require.Len(t, batches, 1)
+	require.Len(t, batches[0], 1)
+	event := batches[0][0]
+	assert.Equal(t, "service_name", event.GetService().GetName())
+	assert.Equal(t, "host:9090", event.GetService().GetNode().GetName())
+	assert.Equal(t, "prometheus", event.GetAgent().GetName())
+	assert.Equal(t, "app", event.GetMetricset().GetName())
+	require.Len(t, event.GetMetricset().GetSamples(), 1)
+	assert.Equal(t, "requests_total", event.Metricset.Samples[0].Name)
+	assert.Equal(t, modelpb.MetricType_METRIC_TYPE_COUNTER, event.Metricset.Samples[0].Type)
+	assert.Equal(t, 5.0, event.Metricset.Samples[0].Value)
+
+	v2 := encodeRequest(t, &writev2.Request{
+		Symbols: []string{"", "__name__", "temperature", "job", "service_name"},
+		Timeseries: []*writev2.TimeSeries{{
+			LabelsRefs: []uint32{1, 2, 3, 4},
+			Samples:    []*writev2.Sample{{Value: 20, Timestamp: 1700000000000}, {Value: 21, Timestamp: 1700000001000}},
+		}},
+	})
+	rsp = post(t, addr, "application/x-protobuf;proto=io.prometheus.write.v2.Request", v2)
+	assert.Equal(t, http.StatusNoContent, rsp.StatusCode)
+	assert.Equal(t, "2", rsp.Header.Get("X-Prometheus-Remote-Write-Samples-Written"))
+	require.Len(t, batches, 2)
+	assert.Len(t, batches[1], 2)
+
+	rsp = post(t, addr, "application/x-protobuf;proto=unknown", v2)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rsp.StatusCode)
+	rsp = post(t, addr, "application/x-protobuf", []byte("not snappy"))
+	assert.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+	require.Len(t, batches, 2)
+
+	monitoringtest.ExpectContainOtelMetrics(t, reader, map[string]any{
+		"apm-server.prometheus.http.remote_write.request.count":  4,
+		"apm-server.prometheus.http.remote_write.response.count": 4,
+	})
+}
+
+func encodeRequest(t testing.TB, m protoadapt.MessageV1) []byte {
+	data, err := proto.Marshal(protoadapt.MessageV2Of(m))
+	require.NoError(t, err)
+	return snappy.Encode(nil, data)
+}
+
+func post(t testing.TB, addr, contentType string, body []byte) *http.Response {
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%s/api/v1/write", addr), bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Content-Encoding", "snappy")
+	rsp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	assert.NoError(t, rsp.Body.Close())
+	return rsp
+}
+
+func newHTTPServer(t *testing.T, batchProcessor modelpb.BatchProcessor) (string, sdkmetric.Reader) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	reader := sdkmetric.NewManualReader(sdkmetric.WithTemporalitySelector(
+		func(ik sdkmetric.InstrumentKind) metricdata.Temporality {
+			return metricdata.DeltaTemporality
+		},
+	))
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	cfg := &config.Config{}
+	auth, _ := auth.NewAuthenticator(cfg.AgentAuth, logptest.NewTestingLogger(t, ""))
+	ratelimitStore, _ := ratelimit.NewStore(1000, 1000, 1000)
+	router, err := api.NewMux(
+		cfg,
+		batchProcessor,
+		auth,
+		agentcfg.NewEmptyFetcher(),
+		ratelimitStore,
+		nil,
+		func() bool { return true },
+		nil,
+		nil,
+		nil,
+		nil,
+		semaphore.NewWeighted(1),
+		mp,
+		noop.NewTracerProvider(),
+		logptest.NewTestingLogger(t, ""),
+		monitoring.NewRegistry(),
+	)
+	require.NoError(t, err)
+	srv := http.Server{Handler: router}
+	t.Cleanup(func() {
+		require.NoError(t, srv.Close())
+	})
+	go srv.Serve(lis)
+	return lis.Addr().String(), reader
+}
@@ -0,0 +1,94 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package prompb holds Go types for the Prometheus remote-write 1.0
+// protocol messages that are served by APM Server.
+//
+// The types are wire-compatible with the messages defined in Prometheus'
+// prompb/remote.proto and prompb/types.proto, and are encoded using the
+// struct tags understood by google.golang.org/protobuf. Exemplars and
+// native histograms are not decoded.
+package prompb
+
+import "fmt"
+
+// MetricType identifies the type of a metric family.
+type MetricType int32
+
+const (
+	MetricType_UNKNOWN        MetricType = 0
+	MetricType_COUNTER        MetricType = 1
+	MetricType_GAUGE          MetricType = 2
+	MetricType_HISTOGRAM      MetricType = 3
+	MetricType_GAUGEHISTOGRAM MetricType = 4
+	MetricType_SUMMARY        MetricType = 5
+	MetricType_INFO           MetricType = 6
+	MetricType_STATESET       MetricType = 7
+)
+
+// WriteRequest is the body of a remote-write 1.0 request.
+type WriteRequest struct {
+	Timeseries []*TimeSeries     `protobuf:"bytes,1,rep,name=timeseries,proto3" json:"timeseries,omitempty"`
+	Metadata   []*MetricMetadata `protobuf:"bytes,3,rep,name=metadata,proto3" json:"metadata,omitempty"`
+}
+
+func (m *WriteRequest) Reset()         { *m = WriteRequest{} }
+func (m *WriteRequest) String() string { return fmt.Sprintf("%+v", *m) }
+func (*WriteRequest) ProtoMessage()    {}
+
+// MetricMetadata describes a metric family.
+type MetricMetadata struct {
+	Type             MetricType `protobuf:"varint,1,opt,name=type,proto3,enum=prometheus.MetricMetadata_MetricType" json:"type,omitempty"`
+	MetricFamilyName string     `protobuf:"bytes,2,opt,name=metric_family_name,json=metricFamilyName,proto3" json:"metric_family_name,omitempty"`
+	Help             string     `protobuf:"bytes,4,opt,name=help,proto3" json:"help,omitempty"`
+	Unit             string     `protobuf:"bytes,5,opt,name=unit,proto3" json:"unit,omitempty"`
+}
+
+func (m *MetricMetadata) Reset()         { *m = MetricMetadata{} }
+func (m *MetricMetadata) String() string { return fmt.Sprintf("%+v", *m) }
+func (*MetricMetadata) ProtoMessage()    {}
+
+// TimeSeries is a set of samples identified by a unique set of labels.
+type TimeSeries struct {
+	Labels  []*Label  `protobuf:"bytes,1,rep,name=labels,proto3" json:"labels,omitempty"`
+	Samples []*Sample `protobuf:"bytes,2,rep,name=samples,proto3" json:"samples,omitempty"`
+}
+
+func (m *TimeSeries) Reset()         { *m = TimeSeries{} }
+func (m *TimeSeries) String() string { return fmt.Sprintf("%+v", *m) }
+func (*TimeSeries) ProtoMessage()    {}
+
+// Label is a name/value pair identifying a time series.
+type Label struct {
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+}
+
+func (m *Label) Reset()         { *m = Label{} }
+func (m *Label) String() string { return fmt.Sprintf("%+v", *m) }
+func (*Label) ProtoMessage()    {}
+
+// Sample is a single sample of a time series. Timestamp is in
+// milliseconds since the Unix epoch.
+type Sample struct {
+	Value     float64 `protobuf:"fixed64,1,opt,name=value,proto3" json:"value,omitempty"`
+	Timestamp int64   `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+}
+
+func (m *Sample) Reset()         { *m = Sample{} }
+func (m *Sample) String() string { return fmt.Sprintf("%+v", *m) }
+func (*Sample) ProtoMessage()    {}
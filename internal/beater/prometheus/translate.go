@@ -0,0 +1,229 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package prometheus
+
+import (
+	"fmt"
+	"math"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/elastic/apm-server/internal/beater/prometheus/prompb"
+	"github.com/elastic/apm-server/internal/beater/prometheus/prompb/writev2"
+)
+
+const (
+	labelMetricName = "__name__"
+	labelJob        = "job"
+	labelInstance   = "instance"
+
+	attributeServiceName       = "service.name"
+	attributeServiceInstanceID = "service.instance.id"
+	attributeSDKName           = "telemetry.sdk.name"
+	sdkName                    = "prometheus"
+)
+
+// metricKind describes how samples of a time series are recorded.
+type metricKind int
+
+const (
+	metricKindGauge metricKind = iota
+	metricKindCounter
+)
+
+// series is a protocol-independent representation of a
+// remote-write time series.
+type series struct {
+	labels  []label
+	samples []sample
+	kind    metricKind
+}
+
+type label struct {
+	name, value string
+}
+
+// maxTimestampMillis is the largest sample timestamp, in milliseconds
+// since the Unix epoch, which may be converted to nanoseconds without
+// overflowing.
+const maxTimestampMillis = math.MaxInt64 / 1_000_000
+
+type sample struct {
+	value     float64
+	timestamp int64
+}
+
+// writeRequestSeries returns the series of a remote-write 1.0 request.
+//
+// Metric metadata in 1.0 is sent per metric family, so series are matched
+// to their metadata by metric name. Classic histogram and summary series,
+// whose names have suffixes such as _bucket, will not match and are
+// recorded as gauges.
+func writeRequestSeries(req *prompb.WriteRequest) []series {
+	counters := make(map[string]bool)
+	for _, md := range req.Metadata {
+		if md.Type == prompb.MetricType_COUNTER {
+			counters[md.MetricFamilyName] = true
+		}
+	}
+	out := make([]series, 0, len(req.Timeseries))
+	for _, ts := range req.Timeseries {
+		s := series{
+			labels:  make([]label, 0, len(ts.Labels)),
+			samples: make([]sample, 0, len(ts.Samples)),
+		}
+		for _, l := range ts.Labels {
+			s.labels = append(s.labels, label{name: l.Name, value: l.Value})
+			if l.Name == labelMetricName && counters[l.Value] {
+				s.kind = metricKindCounter
+			}
+		}
+		for _, smp := range ts.Samples {
+			s.samples = append(s.samples, sample{value: smp.Value, timestamp: smp.Timestamp})
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// writeV2RequestSeries returns the series of a remote-write 2.0 request,
+// resolving label references against the request's symbols table.
+func writeV2RequestSeries(req *writev2.Request) ([]series, error) {
+	symbol := func(ref uint32) (string, error) {
+		if int(ref) >= len(req.Symbols) {
+			return "", fmt.Errorf("symbol reference %d out of range", ref)
+		}
+		return req.Symbols[ref], nil
+	}
+	out := make([]series, 0, len(req.Timeseries))
+	for i, ts := range req.Timeseries {
+		if len(ts.LabelsRefs)%2 != 0 {
+			return nil, fmt.Errorf("invalid time series at index %d: odd number of label references", i)
+		}
+		s := series{
+			labels:  make([]label, 0, len(ts.LabelsRefs)/2),
+			samples: make([]sample, 0, len(ts.Samples)),
+		}
+		for j := 0; j < len(ts.LabelsRefs); j += 2 {
+			name, err := symbol(ts.LabelsRefs[j])
+			if err != nil {
+				return nil, fmt.Errorf("invalid time series at index %d: %w", i, err)
+			}
+			value, err := symbol(ts.LabelsRefs[j+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid time series at index %d: %w", i, err)
+			}
+			s.labels = append(s.labels, label{name: name, value: value})
+		}
+		if ts.Metadata != nil && ts.Metadata.Type == writev2.Metadata_METRIC_TYPE_COUNTER {
+			s.kind = metricKindCounter
+		}
+		for _, smp := range ts.Samples {
+			s.samples = append(s.samples, sample{value: smp.Value, timestamp: smp.Timestamp})
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// seriesToMetrics translates time series into OpenTelemetry metrics, so
+// that they may be processed by the same consumer as OTLP metrics.
+//
+// Series are grouped into a resource per distinct job and instance label,
+// which identify the service name and service instance respectively, in
+// line with the OpenTelemetry Collector's Prometheus receiver. The remaining
+// labels, other than the metric name, are recorded as data point attributes.
+//
+// Series without a metric name are skipped and counted in the returned
+// number of dropped series. Samples with a non-finite value, including
+// Prometheus staleness markers, are dropped, as are samples whose
+// timestamp is negative or too large to be represented in nanoseconds.
+func seriesToMetrics(in []series) (pmetric.Metrics, int) {
+	type resourceKey struct {
+		job, instance string
+	}
+	metrics := pmetric.NewMetrics()
+	scopes := make(map[resourceKey]pmetric.MetricSlice)
+	var dropped int
+	for _, s := range in {
+		var name string
+		var key resourceKey
+		for _, l := range s.labels {
+			switch l.name {
+			case labelMetricName:
+				name = l.value
+			case labelJob:
+				key.job = l.value
+			case labelInstance:
+				key.instance = l.value
+			}
+		}
+		if name == "" {
+			dropped++
+			continue
+		}
+		metricSlice, ok := scopes[key]
+		if !ok {
+			rm := metrics.ResourceMetrics().AppendEmpty()
+			attrs := rm.Resource().Attributes()
+			attrs.PutStr(attributeSDKName, sdkName)
+			if key.job != "" {
+				attrs.PutStr(attributeServiceName, key.job)
+			}
+			if key.instance != "" {
+				attrs.PutStr(attributeServiceInstanceID, key.instance)
+			}
+			metricSlice = rm.ScopeMetrics().AppendEmpty().Metrics()
+			scopes[key] = metricSlice
+		}
+
+		metric := metricSlice.AppendEmpty()
+		metric.SetName(name)
+		var dps pmetric.NumberDataPointSlice
+		switch s.kind {
+		case metricKindCounter:
+			sum := metric.SetEmptySum()
+			sum.SetIsMonotonic(true)
+			sum.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+			dps = sum.DataPoints()
+		default:
+			dps = metric.SetEmptyGauge().DataPoints()
+		}
+		for _, smp := range s.samples {
+			if math.IsNaN(smp.value) || math.IsInf(smp.value, 0) {
+				continue
+			}
+			if smp.timestamp < 0 || smp.timestamp > maxTimestampMillis {
+				continue
+			}
+			dp := dps.AppendEmpty()
+			dp.SetDoubleValue(smp.value)
+			dp.SetTimestamp(pcommon.Timestamp(smp.timestamp * 1e6))
+			attrs := dp.Attributes()
+			for _, l := range s.labels {
+				switch l.name {
+				case labelMetricName, labelJob, labelInstance:
+				default:
+					attrs.PutStr(l.name, l.value)
+				}
+			}
+		}
+	}
+	return metrics, dropped
+}
@@ -0,0 +1,138 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package prometheus
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+
+	"github.com/elastic/apm-server/internal/beater/prometheus/prompb"
+	"github.com/elastic/apm-server/internal/beater/prometheus/prompb/writev2"
+)
+
+func TestWriteRequestSeries(t *testing.T) {
+	in := writeRequestSeries(&prompb.WriteRequest{
+		Timeseries: []*prompb.TimeSeries{{
+			Labels:  []*prompb.Label{{Name: "__name__", Value: "requests_total"}, {Name: "job", Value: "api"}},
+			Samples: []*prompb.Sample{{Value: 1, Timestamp: 1000}},
+		}, {
+			Labels:  []*prompb.Label{{Name: "__name__", Value: "temperature"}},
+			Samples: []*prompb.Sample{{Value: 2, Timestamp: 2000}},
+		}},
+		Metadata: []*prompb.MetricMetadata{
+			{Type: prompb.MetricType_COUNTER, MetricFamilyName: "requests_total"},
+			{Type: prompb.MetricType_GAUGE, MetricFamilyName: "temperature"},
+		},
+	})
+	assert.Equal(t, []series{{
+		labels:  []label{{"__name__", "requests_total"}, {"job", "api"}},
+		samples: []sample{{1, 1000}},
+		kind:    metricKindCounter,
+	}, {
+		labels:  []label{{"__name__", "temperature"}},
+		samples: []sample{{2, 2000}},
+		kind:    metricKindGauge,
+	}}, in)
+}
+
+func TestWriteV2RequestSeries(t *testing.T) {
+	in, err := writeV2RequestSeries(&writev2.Request{
+		Symbols: []string{"", "__name__", "requests_total", "job", "api"},
+		Timeseries: []*writev2.TimeSeries{{
+			LabelsRefs: []uint32{1, 2, 3, 4},
+			Samples:    []*writev2.Sample{{Value: 1, Timestamp: 1000}},
+			Metadata:   &writev2.Metadata{Type: writev2.Metadata_METRIC_TYPE_COUNTER},
+		}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []series{{
+		labels:  []label{{"__name__", "requests_total"}, {"job", "api"}},
+		samples: []sample{{1, 1000}},
+		kind:    metricKindCounter,
+	}}, in)
+
+	_, err = writeV2RequestSeries(&writev2.Request{
+		Symbols:    []string{"", "__name__"},
+		Timeseries: []*writev2.TimeSeries{{LabelsRefs: []uint32{1, 2}}},
+	})
+	assert.EqualError(t, err, "invalid time series at index 0: symbol reference 2 out of range")
+
+	_, err = writeV2RequestSeries(&writev2.Request{
+		Symbols:    []string{"", "__name__"},
+		Timeseries: []*writev2.TimeSeries{{LabelsRefs: []uint32{1}}},
+	})
+	assert.EqualError(t, err, "invalid time series at index 0: odd number of label references")
+}
+
+func TestSeriesToMetrics(t *testing.T) {
+	metrics, dropped := seriesToMetrics([]series{{
+		labels: []label{
+			{"__name__", "requests_total"},
+			{"job", "api"},
+			{"instance", "host:9090"},
+			{"method", "GET"},
+		},
+		samples: []sample{{1, 1000}, {math.NaN(), 2000}, {2, -1}, {2, math.MaxInt64}, {3, 3000}},
+		kind:    metricKindCounter,
+	}, {
+		labels:  []label{{"__name__", "temperature"}, {"job", "api"}, {"instance", "host:9090"}},
+		samples: []sample{{20.5, 1000}},
+	}, {
+		labels:  []label{{"__name__", "up"}},
+		samples: []sample{{1, 1000}},
+	}, {
+		labels:  []label{{"job", "api"}},
+		samples: []sample{{1, 1000}},
+	}})
+	assert.Equal(t, 1, dropped)
+	require.Equal(t, 2, metrics.ResourceMetrics().Len())
+
+	rm := metrics.ResourceMetrics().At(0)
+	assert.Equal(t, map[string]any{
+		"service.name":        "api",
+		"service.instance.id": "host:9090",
+		"telemetry.sdk.name":  "prometheus",
+	}, rm.Resource().Attributes().AsRaw())
+	ms := rm.ScopeMetrics().At(0).Metrics()
+	require.Equal(t, 2, ms.Len())
+
+	counter := ms.At(0)
+	assert.Equal(t, "requests_total", counter.Name())
+	require.Equal(t, pmetric.MetricTypeSum, counter.Type())
+	assert.True(t, counter.Sum().IsMonotonic())
+	assert.Equal(t, pmetric.AggregationTemporalityCumulative, counter.Sum().AggregationTemporality())
+	dps := counter.Sum().DataPoints()
+	require.Equal(t, 2, dps.Len()) // NaN and out of range samples dropped
+	assert.Equal(t, 1.0, dps.At(0).DoubleValue())
+	assert.Equal(t, int64(1000), dps.At(0).Timestamp().AsTime().UnixMilli())
+	assert.Equal(t, map[string]any{"method": "GET"}, dps.At(0).Attributes().AsRaw())
+	assert.Equal(t, 3.0, dps.At(1).DoubleValue())
+
+	gauge := ms.At(1)
+	assert.Equal(t, "temperature", gauge.Name())
+	require.Equal(t, pmetric.MetricTypeGauge, gauge.Type())
+	assert.Equal(t, 20.5, gauge.Gauge().DataPoints().At(0).DoubleValue())
+
+	rm = metrics.ResourceMetrics().At(1)
+	assert.Equal(t, map[string]any{"telemetry.sdk.name": "prometheus"}, rm.Resource().Attributes().AsRaw())
+	assert.Equal(t, "up", rm.ScopeMetrics().At(0).Metrics().At(0).Name())
+}
@@ -58,6 +58,7 @@ type Context struct {
 	// with a non-zero ContentLength and empty Content-Encoding.
 	compressedRequestReadCloser compressedRequestReadCloser
 	countingReadCloser          countingReadCloser
+	trustedProxies              netutil.TrustedProxies
 	gzipReader                  *gzip.Reader
 	zlibReader                  zlibReadCloseResetter
 
@@ -115,6 +116,12 @@ func NewContext() *Context {
 // the request, and information such as the user agent and source IP will be
 // extracted for handlers.
 func (c *Context) Reset(w http.ResponseWriter, r *http.Request) {
+	c.reset(w, r, true)
+}
+
+// reset is Reset, additionally controlling whether the request body
+// is decoded according to its content encoding.
+func (c *Context) reset(w http.ResponseWriter, r *http.Request, decodeBody bool) {
 	if c.Request != nil {
 		if c.Request.MultipartForm != nil {
 			err := c.Request.MultipartForm.RemoveAll()
@@ -139,15 +146,17 @@ func (c *Context) Reset(w http.ResponseWriter, r *http.Request) {
 		// Reuse gzip and zlib reader buffers.
 		gzipReader: c.gzipReader,
 		zlibReader: c.zlibReader,
+
+		trustedProxies: c.trustedProxies,
 	}
 	c.Result.Reset()
 
 	if r != nil {
-		c.setRequest(r)
+		c.setRequest(r, decodeBody)
 	}
 }
 
-func (c *Context) setRequest(r *http.Request) {
+func (c *Context) setRequest(r *http.Request, decodeBody bool) {
 	c.Timestamp = time.Now()
 	c.Request = r
 	c.UserAgent = strings.Join(r.Header["User-Agent"], ", ")
@@ -155,7 +164,7 @@ func (c *Context) setRequest(r *http.Request) {
 	ip, port := netutil.SplitAddrPort(r.RemoteAddr)
 	c.SourceIP, c.ClientIP = ip, ip
 	c.SourcePort, c.ClientPort = int(port), int(port)
-	if ip, port := netutil.ClientAddrFromHeaders(r.Header); ip.IsValid() {
+	if ip, port := c.trustedProxies.ClientAddr(ip, r.Header); ip.IsValid() {
 		c.SourceNATIP = c.ClientIP
 		c.SourceIP, c.ClientIP = ip, ip
 		c.SourcePort, c.ClientPort = int(port), int(port)
@@ -168,6 +177,9 @@ func (c *Context) setRequest(r *http.Request) {
 		c.Request.Body = &c.countingReadCloser
 	}
 
+	if !decodeBody {
+		return
+	}
 	if err := c.decodeRequestBody(); err != nil {
 		if c.Logger != nil {
 			c.Logger.Errorw("failed to decode request body", "error", err)
@@ -259,7 +271,7 @@ func (c *Context) writePlain(body interface{}) error {
 
 func (c *Context) errOnWrite(err error) {
 	if c.Logger == nil {
-		c.Logger = logp.NewLogger(logs.Response)
+		c.Logger = logp.NewLogger(logs.Response, logs.WithRuntimeSelectors())
 	}
 	c.Logger.Errorw("write response", "error", err)
 }
@@ -20,6 +20,8 @@ package request
 import (
 	"net/http"
 	"sync"
+
+	"github.com/elastic/apm-server/internal/netutil"
 )
 
 // ContextPool provides a pool of Context objects, and a
@@ -29,10 +31,15 @@ type ContextPool struct {
 }
 
 // NewContextPool returns a new ContextPool.
-func NewContextPool() *ContextPool {
+//
+// Contexts acquired from the pool derive the client address from request
+// headers according to trustedProxies; see netutil.TrustedProxies.ClientAddr.
+func NewContextPool(trustedProxies netutil.TrustedProxies) *ContextPool {
 	pool := ContextPool{}
 	pool.p.New = func() interface{} {
-		return NewContext()
+		c := NewContext()
+		c.trustedProxies = trustedProxies
+		return c
 	}
 	return &pool
 }
@@ -47,3 +54,18 @@ func (pool *ContextPool) HTTPHandler(h Handler) http.Handler {
 		h(c)
 	})
 }
+
+// RawBodyHTTPHandler returns an http.Handler that calls h with a new
+// context, like HTTPHandler, but leaves the request body undecoded.
+// This is for handlers which decode their own request bodies, such as
+// snappy-compressed Prometheus remote-write requests, whose leading
+// bytes could otherwise be mistaken for a zlib header.
+func (pool *ContextPool) RawBodyHTTPHandler(h Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := pool.p.Get().(*Context)
+		defer pool.p.Put(c)
+		defer c.Reset(nil, nil)
+		c.reset(w, r, false)
+		h(c)
+	})
+}
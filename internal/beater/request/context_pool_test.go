@@ -18,8 +18,10 @@
 package request
 
 import (
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 
@@ -31,7 +33,7 @@ func TestContextPool(t *testing.T) {
 	// Request stored inside a context is always set fresh.
 	// The test is important to avoid mixing up separate requests in a reused context.
 
-	p := NewContextPool()
+	p := NewContextPool(nil)
 
 	// mockhHandler adds the context and its request to dedicated slices
 	var contexts, requests []interface{}
@@ -78,3 +80,27 @@ func TestContextPool(t *testing.T) {
 	assert.Equal(t, totalRequests, countUnique(requests))
 	assert.True(t, countUnique(contexts) < totalRequests) // contexts get reused, but not deterministic how many exactly
 }
+
+func TestContextPoolRawBody(t *testing.T) {
+	// "\x18" would be sniffed as a zlib header.
+	const body = "\x18contents"
+	var decoded, raw string
+	p := NewContextPool(nil)
+	for _, test := range []struct {
+		handler func(Handler) http.Handler
+		body    *string
+	}{
+		{p.HTTPHandler, &decoded},
+		{p.RawBodyHTTPHandler, &raw},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set("Content-Encoding", "snappy")
+		test.handler(func(c *Context) {
+			b, _ := io.ReadAll(c.Request.Body)
+			*test.body = string(b)
+		}).ServeHTTP(w, r)
+	}
+	assert.NotEqual(t, body, decoded)
+	assert.Equal(t, body, raw)
+}
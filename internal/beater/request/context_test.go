@@ -40,6 +40,7 @@ import (
 
 	"github.com/elastic/apm-server/internal/beater/auth"
 	"github.com/elastic/apm-server/internal/beater/headers"
+	"github.com/elastic/apm-server/internal/netutil"
 )
 
 func TestContext_Reset(t *testing.T) {
@@ -129,12 +130,35 @@ func TestContext_Reset(t *testing.T) {
 			assert.Nil(t, c.zlibReader)
 		case "gzipReader":
 			assert.Nil(t, c.gzipReader)
+		case "trustedProxies":
+			assert.Nil(t, c.trustedProxies)
 		default:
 			assert.Empty(t, cVal.Field(i).Interface(), cType.Field(i).Name)
 		}
 	}
 }
 
+func TestContextResetTrustedProxies(t *testing.T) {
+	trustedProxies, err := netutil.ParseTrustedProxies([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	c := NewContextPool(trustedProxies).p.Get().(*Context)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.1.2.3:4321"
+	r.Header.Set("X-Forwarded-For", "1.1.1.1, 192.168.0.1, 10.0.0.1")
+	c.Reset(httptest.NewRecorder(), r)
+	assert.Equal(t, netip.MustParseAddr("192.168.0.1"), c.ClientIP)
+	assert.Equal(t, netip.MustParseAddr("10.1.2.3"), c.SourceNATIP)
+
+	// Headers sent by untrusted peers are ignored.
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "192.168.0.1:4321"
+	r.Header.Set("X-Forwarded-For", "1.1.1.1")
+	c.Reset(httptest.NewRecorder(), r)
+	assert.Equal(t, netip.MustParseAddr("192.168.0.1"), c.ClientIP)
+	assert.False(t, c.SourceNATIP.IsValid())
+}
+
 func BenchmarkContextReset(b *testing.B) {
 	testCases := map[string]struct {
 		header     http.Header
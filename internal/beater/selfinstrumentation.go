@@ -0,0 +1,121 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package beater
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+
+	"github.com/elastic/apm-server/internal/beater/config"
+	"github.com/elastic/apm-server/internal/otlpexport"
+	"github.com/elastic/apm-server/internal/version"
+)
+
+// selfInstrumentation exports the server's own traces and metrics via
+// OTLP, independent of the output. This ensures the server remains
+// observable when the output is unavailable.
+type selfInstrumentation struct {
+	cfg            config.SelfInstrumentationConfig
+	logger         *logp.Logger
+	resource       *resource.Resource
+	exporter       *otlpexport.Exporter
+	metricReader   sdkmetric.Reader
+	tracerProvider *sdktrace.TracerProvider
+}
+
+// newSelfInstrumentation returns a new selfInstrumentation which exports
+// traces recorded through its tracer provider, and metrics collected from
+// metricReader. If metricReader is nil, no metrics will be exported.
+func newSelfInstrumentation(
+	cfg config.SelfInstrumentationConfig,
+	metricReader sdkmetric.Reader,
+	logger *logp.Logger,
+) (*selfInstrumentation, error) {
+	logger = logger.Named("self_instrumentation")
+	// The exporter's own metrics are not recorded, as they would
+	// otherwise be exported through itself.
+	exporter, err := otlpexport.New(cfg.OTLP, logger, metricnoop.NewMeterProvider())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create self-instrumentation exporter: %w", err)
+	}
+	res := resource.NewSchemaless(
+		attribute.String("service.name", "apm-server"),
+		attribute.String("service.version", version.VersionWithQualifier()),
+	)
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SamplingRate))),
+		sdktrace.WithBatcher(exporter),
+	)
+	return &selfInstrumentation{
+		cfg:            cfg,
+		logger:         logger,
+		resource:       res,
+		exporter:       exporter,
+		metricReader:   metricReader,
+		tracerProvider: tracerProvider,
+	}, nil
+}
+
+// runMetrics periodically collects and exports metrics until ctx is
+// cancelled, exporting metrics a final time before returning.
+func (s *selfInstrumentation) runMetrics(ctx context.Context) error {
+	if s.metricReader == nil {
+		return nil
+	}
+	ticker := time.NewTicker(s.cfg.MetricsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.exportMetrics(context.WithoutCancel(ctx))
+			return nil
+		case <-ticker.C:
+			s.exportMetrics(ctx)
+		}
+	}
+}
+
+func (s *selfInstrumentation) exportMetrics(ctx context.Context) {
+	var rm metricdata.ResourceMetrics
+	if err := s.metricReader.Collect(ctx, &rm); err != nil {
+		s.logger.With(logp.Error(err)).Warn("failed to collect metrics")
+		return
+	}
+	rm.Resource = s.resource
+	if err := s.exporter.ExportMetrics(ctx, &rm); err != nil {
+		s.logger.With(logp.Error(err)).Warn("failed to export metrics")
+	}
+}
+
+// shutdown flushes any buffered spans and closes the exporter,
+// waiting for queued requests to be exported.
+func (s *selfInstrumentation) shutdown(ctx context.Context) error {
+	// Shutting down the tracer provider shuts down the exporter.
+	return s.tracerProvider.Shutdown(ctx)
+}
@@ -0,0 +1,68 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package beater
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+
+	"github.com/elastic/apm-server/internal/beater/config"
+	"github.com/elastic/apm-server/internal/otlpexport"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestSelfInstrumentation(t *testing.T) {
+	cfg := config.DefaultConfig().SelfInstrumentation
+	cfg.Enabled = true
+	cfg.MetricsInterval = time.Hour
+	cfg.OTLP.Protocol = otlpexport.ProtocolFile
+	cfg.OTLP.Path = t.TempDir()
+
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	counter, err := mp.Meter("test").Int64Counter("requests")
+	require.NoError(t, err)
+	counter.Add(context.Background(), 1)
+
+	selfInstrumentation, err := newSelfInstrumentation(cfg, reader, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	_, span := selfInstrumentation.tracerProvider.Tracer("test").Start(context.Background(), "name")
+	span.End()
+
+	// Metrics are exported a final time when the context is cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, selfInstrumentation.runMetrics(ctx))
+	require.NoError(t, selfInstrumentation.shutdown(context.Background()))
+
+	for _, signal := range []string{"traces", "metrics"} {
+		paths, err := filepath.Glob(filepath.Join(cfg.OTLP.Path, signal+"*.ndjson"))
+		require.NoError(t, err)
+		require.Len(t, paths, 1)
+		data, err := os.ReadFile(paths[0])
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"stringValue":"apm-server"`, signal)
+	}
+}
@@ -19,8 +19,8 @@ package beater
 
 import (
 	"context"
-	"net"
 	"net/http"
+	"sync"
 
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
@@ -36,11 +36,17 @@ import (
 	"github.com/elastic/apm-data/model/modelpb"
 	"github.com/elastic/apm-data/model/modelprocessor"
 	"github.com/elastic/apm-server/internal/agentcfg"
+	"github.com/elastic/apm-server/internal/beater/admin"
 	"github.com/elastic/apm-server/internal/beater/api"
 	"github.com/elastic/apm-server/internal/beater/auth"
 	"github.com/elastic/apm-server/internal/beater/config"
+	"github.com/elastic/apm-server/internal/beater/drain"
+	"github.com/elastic/apm-server/internal/beater/health"
+	"github.com/elastic/apm-server/internal/beater/jaeger"
+	"github.com/elastic/apm-server/internal/beater/middleware"
 	"github.com/elastic/apm-server/internal/beater/otlp"
 	"github.com/elastic/apm-server/internal/beater/ratelimit"
+	"github.com/elastic/apm-server/internal/capture"
 	"github.com/elastic/apm-server/internal/elasticsearch"
 	"github.com/elastic/apm-server/internal/kibana"
 	"github.com/elastic/apm-server/internal/sourcemap"
@@ -134,6 +140,36 @@ type ServerParams struct {
 	// See package internal/beater/interceptors for details.
 	GRPCServer *grpc.Server
 
+	// HealthChecker holds a health.Checker for reporting readiness.
+	//
+	// WrapServerFunc may register additional checks, for example for
+	// the health of storage used by processors.
+	HealthChecker *health.Checker
+
+	// Drainer holds a drain.Drainer for tracking in-flight intake
+	// requests, and rejecting new ones, while the server is draining.
+	//
+	// Draining is started on shutdown if a drain timeout is configured,
+	// and may also be started explicitly by calling Drainer.Drain.
+	// WrapServerFunc may add flushers for buffered events, which are
+	// flushed once in-flight requests have been drained on shutdown.
+	Drainer *drain.Drainer
+
+	// RUMKillSwitch holds a middleware.KillSwitch for enabling or
+	// disabling the RUM endpoints at runtime.
+	RUMKillSwitch *middleware.KillSwitch
+
+	// Capturer holds a capture.Capturer for capturing intake requests
+	// for debugging, started through the admin API.
+	Capturer *capture.Capturer
+
+	// AdminRegistry holds an admin.Registry for registering operations
+	// which may be invoked through the admin API.
+	//
+	// WrapServerFunc may register additional operations, for example
+	// for managing storage used by processors.
+	AdminRegistry *admin.Registry
+
 	// Semaphore holds a shared semaphore used to limit the number of
 	// concurrently running requests
 	Semaphore input.Semaphore
@@ -143,9 +179,9 @@ type ServerParams struct {
 }
 
 // newBaseRunServer returns the base RunServerFunc.
-func newBaseRunServer(listener net.Listener) RunServerFunc {
+func newBaseRunServer(listeners []serverListener) RunServerFunc {
 	return func(ctx context.Context, args ServerParams) error {
-		srv, err := newServer(args, listener)
+		srv, err := newServer(args, listeners)
 		if err != nil {
 			return err
 		}
@@ -157,11 +193,12 @@ type server struct {
 	logger *logp.Logger
 	cfg    *config.Config
 
-	httpServer *httpServer
-	grpcServer *grpc.Server
+	httpServers []*httpServer
+	grpcServer  *grpc.Server
+	drainer     *drain.Drainer
 }
 
-func newServer(args ServerParams, listener net.Listener) (server, error) {
+func newServer(args ServerParams, listeners []serverListener) (server, error) {
 	publishReady := func() bool {
 		select {
 		case <-args.PublishReady:
@@ -180,6 +217,10 @@ func newServer(args ServerParams, listener net.Listener) (server, error) {
 		args.RateLimitStore,
 		args.SourcemapFetcher,
 		publishReady,
+		args.HealthChecker,
+		args.Drainer,
+		args.RUMKillSwitch,
+		args.Capturer,
 		args.Semaphore,
 		args.MeterProvider,
 		args.TracerProvider,
@@ -189,9 +230,17 @@ func newServer(args ServerParams, listener net.Listener) (server, error) {
 	if err != nil {
 		return server{}, err
 	}
-	httpServer, err := newHTTPServer(args.Logger, args.Config, router, listener)
-	if err != nil {
-		return server{}, err
+	httpServers := make([]*httpServer, len(listeners))
+	for i, listener := range listeners {
+		var handler http.Handler = router
+		if len(listener.routes) < len(config.RouteGroups) {
+			handler = api.FilterRouteGroups(router, args.Config, listener.routes)
+		}
+		httpServer, err := newHTTPServer(args.Logger, args.Config, handler, listener)
+		if err != nil {
+			return server{}, err
+		}
+		httpServers[i] = httpServer
 	}
 
 	otlpBatchProcessor := args.BatchProcessor
@@ -204,12 +253,14 @@ func newServer(args ServerParams, listener net.Listener) (server, error) {
 	}
 	zapLogger := zap.New(args.Logger.Core(), zap.WithCaller(true))
 	otlp.RegisterGRPCServices(args.GRPCServer, zapLogger, otlpBatchProcessor, args.Semaphore, args.MeterProvider, args.TracerProvider)
+	jaeger.RegisterGRPCServices(args.GRPCServer, zapLogger, otlpBatchProcessor, args.Semaphore, args.AgentConfig, args.TracerProvider)
 
 	return server{
-		logger:     args.Logger,
-		cfg:        args.Config,
-		httpServer: httpServer,
-		grpcServer: args.GRPCServer,
+		logger:      args.Logger,
+		cfg:         args.Config,
+		httpServers: httpServers,
+		grpcServer:  args.GRPCServer,
+		drainer:     args.Drainer,
 	}, nil
 }
 
@@ -217,17 +268,56 @@ func (s server) run(ctx context.Context) error {
 	s.logger.Infof("Starting apm-server [%s built %s]. Hit CTRL-C to stop it.", version.Commit(), version.BuildTime())
 	defer s.logger.Infof("Server stopped")
 
+	if s.cfg.RumConfig.Enabled {
+		s.logger.Info("RUM endpoints enabled!")
+		for _, origin := range s.cfg.RumConfig.AllowOrigins {
+			if origin == "*" {
+				s.logger.Warn("CORS related setting `apm-server.rum.allow_origins` allows all origins. Consider more restrictive setting for production use.")
+				break
+			}
+		}
+	} else {
+		s.logger.Info("RUM endpoints disabled.")
+	}
+
 	g, ctx := errgroup.WithContext(ctx)
-	g.Go(s.httpServer.start)
-	g.Go(func() error {
-		return s.grpcServer.Serve(s.httpServer.grpcListener)
-	})
+	for _, httpServer := range s.httpServers {
+		g.Go(httpServer.start)
+		if httpServer.http3Server != nil {
+			g.Go(httpServer.startHTTP3)
+		}
+		if httpServer.grpcListener != nil {
+			g.Go(func() error {
+				return s.grpcServer.Serve(httpServer.grpcListener)
+			})
+		}
+	}
 	g.Go(func() error {
 		<-ctx.Done()
+		if s.drainer != nil && s.cfg.Drain.Timeout > 0 {
+			s.logger.Infof(
+				"draining in-flight requests... waiting maximum of %s",
+				s.cfg.Drain.Timeout,
+			)
+			s.drainer.Drain()
+			drainctx, cancel := context.WithTimeout(context.Background(), s.cfg.Drain.Timeout)
+			// Complete logs the outcome; remaining requests are
+			// cut off by stopping the servers below.
+			_ = s.drainer.Complete(drainctx, s.logger)
+			cancel()
+		}
 		s.grpcServer.GracefulStop()
 		stopctx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
 		defer cancel()
-		s.httpServer.stop(stopctx)
+		var wg sync.WaitGroup
+		for _, httpServer := range s.httpServers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				httpServer.stop(stopctx)
+			}()
+		}
+		wg.Wait()
 		return nil
 	})
 	if err := g.Wait(); err != http.ErrServerClosed {
@@ -244,7 +334,7 @@ func newAgentConfigFetcher(
 	tp trace.TracerProvider,
 	mp metric.MeterProvider,
 	logger *logp.Logger,
-) (agentcfg.Fetcher, func(context.Context) error, error) {
+) (agentcfg.Fetcher, *agentcfg.ElasticsearchFetcher, error) {
 	// Always use ElasticsearchFetcher, and as a fallback, use:
 	// 1. no fallback if Elasticsearch is explicitly configured
 	// 2. kibana fetcher
@@ -269,5 +359,5 @@ func newAgentConfigFetcher(
 		return nil, nil, err
 	}
 	esFetcher := agentcfg.NewElasticsearchFetcher(esClient, cfg.AgentConfig.Cache.Expiration, fallbackFetcher, tp, mp, logger)
-	return agentcfg.SanitizingFetcher{Fetcher: esFetcher}, esFetcher.Run, nil
+	return agentcfg.SanitizingFetcher{Fetcher: esFetcher}, esFetcher, nil
 }
@@ -522,6 +522,52 @@ func TestServerPProf(t *testing.T) {
 	}
 }
 
+func TestServerListeners(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping test on windows")
+	}
+
+	addr := filepath.Join(t.TempDir(), "debug.sock")
+	srv := beatertest.NewServer(t, beatertest.WithConfig(agentconfig.MustNewConfigFrom(map[string]interface{}{
+		"apm-server.pprof.enabled": true,
+		"apm-server.listeners": []map[string]interface{}{{
+			"name":   "debug",
+			"host":   "unix:" + addr,
+			"routes": []string{"debug"},
+		}},
+	})))
+	debugClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", addr)
+		},
+	}}
+
+	// Debug routes are served only by the debug listener,
+	// while all other routes are served by apm-server.host.
+	for _, test := range []struct {
+		client   *http.Client
+		baseURL  string
+		path     string
+		notFound bool
+	}{
+		{srv.Client, srv.URL, "/debug/pprof/cmdline", true},
+		{srv.Client, srv.URL, api.AgentConfigPath, false},
+		{debugClient, "http://debug", "/debug/pprof/cmdline", false},
+		{debugClient, "http://debug", api.AgentConfigPath, true},
+		{debugClient, "http://debug", api.RootPath, false},
+	} {
+		resp, err := test.client.Get(test.baseURL + test.path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		if test.notFound {
+			assert.Equal(t, http.StatusNotFound, resp.StatusCode, test.path)
+		} else {
+			assert.NotEqual(t, http.StatusNotFound, resp.StatusCode, test.path)
+		}
+	}
+}
+
 func TestWrapServer(t *testing.T) {
 	escfg, docs := beatertest.ElasticsearchOutputConfig(t)
 	srv := beatertest.NewServer(t, beatertest.WithConfig(escfg), beatertest.WithWrapServer(
@@ -0,0 +1,219 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package beater
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.elastic.co/fastjson"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/elastic/apm-data/model/modeljson"
+	"github.com/elastic/apm-data/model/modelpb"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/go-docappender/v2"
+)
+
+const (
+	minSyncIndexerRetryBackoff = 100 * time.Millisecond
+	maxSyncIndexerRetryBackoff = 10 * time.Second
+)
+
+// syncIndexer is a model.BatchProcessor which indexes events into
+// Elasticsearch with the bulk API, returning only once Elasticsearch
+// has responded for every event in the batch.
+//
+// syncIndexer is used in place of docappender for delivering spooled
+// events, so that a spooled batch is only consumed once its events have
+// been indexed. Documents rejected with 429 Too Many Requests are retried
+// until they are indexed or ctx is cancelled; documents rejected for any
+// other reason are not retried, and are reported to the dead-letter store
+// by the client's transport, if enabled. If a bulk request fails, the
+// error is returned so that the batch may be retried.
+//
+// syncIndexer records the same metrics as docappender, so that output
+// statistics are reported regardless of whether events are spooled.
+type syncIndexer struct {
+	logger     *logp.Logger
+	flushBytes int
+
+	mu      sync.Mutex
+	cfg     docappender.BulkIndexerConfig
+	indexer *docappender.BulkIndexer
+	jsonw   fastjson.Writer
+
+	eventsAdded     metric.Int64Counter
+	eventsProcessed metric.Int64Counter
+	bulkRequests    metric.Int64Counter
+	bytesFlushed    metric.Int64Counter
+}
+
+// newSyncIndexer returns a new syncIndexer which indexes events using
+// cfg.Client, issuing a bulk request whenever flushBytes have been
+// buffered, and at the end of each batch.
+func newSyncIndexer(
+	cfg docappender.BulkIndexerConfig,
+	flushBytes int,
+	logger *logp.Logger,
+	mp metric.MeterProvider,
+) (*syncIndexer, error) {
+	// Retry documents rejected with 429 indefinitely, backing off
+	// between attempts; the spool must not advance past them.
+	cfg.RetryOnDocumentStatus = []int{429}
+	cfg.MaxDocumentRetries = int(^uint(0) >> 1)
+	indexer, err := docappender.NewBulkIndexer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	i := &syncIndexer{
+		logger:     logger,
+		flushBytes: flushBytes,
+		cfg:        cfg,
+		indexer:    indexer,
+	}
+	meter := mp.Meter("github.com/elastic/go-docappender")
+	if i.eventsAdded, err = meter.Int64Counter("elasticsearch.events.count"); err != nil {
+		return nil, err
+	}
+	if i.eventsProcessed, err = meter.Int64Counter("elasticsearch.events.processed"); err != nil {
+		return nil, err
+	}
+	if i.bulkRequests, err = meter.Int64Counter("elasticsearch.bulk_requests.count"); err != nil {
+		return nil, err
+	}
+	if i.bytesFlushed, err = meter.Int64Counter("elasticsearch.flushed.bytes", metric.WithUnit("By")); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// ProcessBatch indexes the events in b, returning once they have all been
+// indexed or permanently rejected by Elasticsearch.
+func (i *syncIndexer) ProcessBatch(ctx context.Context, b *modelpb.Batch) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.eventsAdded.Add(ctx, int64(len(*b)))
+	for _, event := range *b {
+		i.jsonw.Reset()
+		if err := modeljson.MarshalAPMEvent(event, &i.jsonw); err != nil {
+			return err
+		}
+		ds := event.GetDataStream()
+		if err := i.indexer.Add(docappender.BulkIndexerItem{
+			Index: ds.GetType() + "-" + ds.GetDataset() + "-" + ds.GetNamespace(),
+			Body:  bytes.NewReader(i.jsonw.Bytes()),
+		}); err != nil {
+			i.reset()
+			return err
+		}
+		if i.indexer.Len() >= i.flushBytes {
+			if err := i.flush(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return i.flush(ctx)
+}
+
+// flush issues bulk requests until all buffered documents have been
+// indexed or permanently rejected.
+func (i *syncIndexer) flush(ctx context.Context) error {
+	backoff := minSyncIndexerRetryBackoff
+	for i.indexer.Items() > 0 {
+		n := i.indexer.Items()
+		resp, err := i.indexer.Flush(ctx)
+		i.bulkRequests.Add(ctx, 1)
+		if flushed := i.indexer.BytesFlushed(); flushed > 0 {
+			i.bytesFlushed.Add(ctx, int64(flushed))
+		}
+		if err != nil {
+			i.reset()
+			i.recordProcessed(ctx, int64(n), flushErrorStatus(ctx, err))
+			return fmt.Errorf("bulk indexing request failed: %w", err)
+		}
+		i.recordProcessed(ctx, resp.Indexed, "Success")
+		for _, item := range resp.FailedDocs {
+			status := "FailedClient"
+			if item.Status >= 500 {
+				status = "FailedServer"
+			}
+			i.recordProcessed(ctx, 1, status)
+		}
+		if len(resp.FailedDocs) > 0 {
+			item := resp.FailedDocs[0]
+			i.logger.With(
+				logp.String("error.type", item.Error.Type),
+				logp.Int("status", item.Status),
+			).Errorf("failed to index %d spooled documents", len(resp.FailedDocs))
+		}
+		if i.indexer.Items() == 0 {
+			break
+		}
+		// Documents rejected with 429 have been buffered again;
+		// back off before retrying them.
+		select {
+		case <-ctx.Done():
+			i.reset()
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxSyncIndexerRetryBackoff)
+	}
+	return nil
+}
+
+// reset discards any buffered documents. docappender.BulkIndexer retains
+// documents to be retried after a failed flush, so a new one is created.
+func (i *syncIndexer) reset() {
+	indexer, err := docappender.NewBulkIndexer(i.cfg)
+	if err != nil {
+		// The config was validated by newSyncIndexer.
+		panic(err)
+	}
+	i.indexer = indexer
+}
+
+func (i *syncIndexer) recordProcessed(ctx context.Context, n int64, status string) {
+	if n > 0 {
+		i.eventsProcessed.Add(ctx, n, metric.WithAttributes(attribute.String("status", status)))
+	}
+}
+
+// flushErrorStatus returns the docappender status for documents in a
+// bulk request which failed with err.
+func flushErrorStatus(ctx context.Context, err error) string {
+	if ctx.Err() != nil || errors.Is(err, context.DeadlineExceeded) {
+		return "Timeout"
+	}
+	var flushErr docappender.ErrorFlushFailed
+	if errors.As(err, &flushErr) {
+		switch code := flushErr.StatusCode(); {
+		case code == 429:
+			return "TooMany"
+		case code >= 500:
+			return "FailedServer"
+		}
+	}
+	return "FailedClient"
+}
@@ -0,0 +1,141 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package beater
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+
+	"github.com/elastic/apm-data/model/modelpb"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/go-docappender/v2"
+	"github.com/elastic/go-docappender/v2/docappendertest"
+)
+
+func TestSyncIndexer(t *testing.T) {
+	batch := modelpb.Batch{
+		{DataStream: &modelpb.DataStream{Type: "traces", Dataset: "apm", Namespace: "default"}, Message: "a"},
+		{DataStream: &modelpb.DataStream{Type: "logs", Dataset: "apm.app", Namespace: "default"}, Message: "b"},
+		{DataStream: &modelpb.DataStream{Type: "logs", Dataset: "apm.app", Namespace: "default"}, Message: "c"},
+	}
+
+	type request struct {
+		docs    []string
+		indices []string
+	}
+	newIndexer := func(t *testing.T, respond func(i int, result *docappendertest.BulkIndexerResponse) int) (*syncIndexer, *[]request) {
+		var requests []request
+		client := docappendertest.NewMockElasticsearchClient(t, func(w http.ResponseWriter, r *http.Request) {
+			docs, meta, result, _ := docappendertest.DecodeBulkRequestWithStatsAndMeta(r)
+			var req request
+			for i, doc := range docs {
+				var fields struct {
+					Message string `json:"message"`
+				}
+				require.NoError(t, json.Unmarshal(doc, &fields))
+				req.docs = append(req.docs, fields.Message)
+				req.indices = append(req.indices, meta[i].Index)
+			}
+			status := respond(len(requests), &result)
+			requests = append(requests, req)
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(result)
+		})
+		indexer, err := newSyncIndexer(
+			docappender.BulkIndexerConfig{Client: client},
+			1024*1024, logptest.NewTestingLogger(t, ""), metricnoop.NewMeterProvider(),
+		)
+		require.NoError(t, err)
+		return indexer, &requests
+	}
+	setStatus := func(result *docappendertest.BulkIndexerResponse, i, status int) {
+		result.HasErrors = true
+		for action, item := range result.Items[i] {
+			item.Status = status
+			item.Error.Type = "error"
+			result.Items[i][action] = item
+		}
+	}
+
+	t.Run("indexed", func(t *testing.T) {
+		indexer, requests := newIndexer(t, func(int, *docappendertest.BulkIndexerResponse) int {
+			return http.StatusOK
+		})
+		require.NoError(t, indexer.ProcessBatch(context.Background(), &batch))
+		assert.Equal(t, []request{{
+			docs:    []string{"a", "b", "c"},
+			indices: []string{"traces-apm-default", "logs-apm.app-default", "logs-apm.app-default"},
+		}}, *requests)
+	})
+
+	t.Run("retry_too_many_requests", func(t *testing.T) {
+		indexer, requests := newIndexer(t, func(i int, result *docappendertest.BulkIndexerResponse) int {
+			if i < 2 {
+				setStatus(result, len(result.Items)-1, http.StatusTooManyRequests)
+			}
+			return http.StatusOK
+		})
+		require.NoError(t, indexer.ProcessBatch(context.Background(), &batch))
+		require.Len(t, *requests, 3)
+		assert.Equal(t, []string{"a", "b", "c"}, (*requests)[0].docs)
+		assert.Equal(t, []string{"c"}, (*requests)[1].docs)
+		assert.Equal(t, []string{"c"}, (*requests)[2].docs)
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		indexer, requests := newIndexer(t, func(i int, result *docappendertest.BulkIndexerResponse) int {
+			setStatus(result, 0, http.StatusBadRequest)
+			return http.StatusOK
+		})
+		// Documents rejected for reasons other than 429 are not retried.
+		require.NoError(t, indexer.ProcessBatch(context.Background(), &batch))
+		assert.Len(t, *requests, 1)
+	})
+
+	t.Run("request_failed", func(t *testing.T) {
+		indexer, requests := newIndexer(t, func(i int, result *docappendertest.BulkIndexerResponse) int {
+			if i == 0 {
+				return http.StatusServiceUnavailable
+			}
+			return http.StatusOK
+		})
+		err := indexer.ProcessBatch(context.Background(), &batch)
+		assert.ErrorContains(t, err, "bulk indexing request failed")
+
+		// Failed documents are discarded, so that the batch may be retried.
+		require.NoError(t, indexer.ProcessBatch(context.Background(), &batch))
+		require.Len(t, *requests, 2)
+		assert.Equal(t, []string{"a", "b", "c"}, (*requests)[1].docs)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		indexer, _ := newIndexer(t, func(i int, result *docappendertest.BulkIndexerResponse) int {
+			cancel()
+			setStatus(result, 0, http.StatusTooManyRequests)
+			return http.StatusOK
+		})
+		assert.ErrorIs(t, indexer.ProcessBatch(ctx, &batch), context.Canceled)
+	})
+}
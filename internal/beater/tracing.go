@@ -54,6 +54,10 @@ func newTracerServer(cfg *config.Config, listener net.Listener, logger *logp.Log
 		ratelimitStore,
 		nil,                         // no sourcemap store
 		func() bool { return true }, // ready for publishing
+		nil,                         // no health checks
+		nil,                         // never drains
+		nil,                         // RUM enabled according to cfg
+		nil,                         // no debug capture
 		semaphore,
 		noopmetric.NewMeterProvider(),
 		nooptrace.NewTracerProvider(),
@@ -0,0 +1,83 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package zipkin
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/elastic/apm-data/input"
+	"github.com/elastic/apm-data/input/otlp"
+	"github.com/elastic/apm-data/model/modelpb"
+	"github.com/elastic/apm-data/model/modelprocessor"
+)
+
+// NewHTTPHandler returns an http.HandlerFunc that receives JSON-encoded
+// Zipkin v2 spans, as sent to Zipkin's /api/v2/spans endpoint, and
+// processes them with an OTLP consumer.
+func NewHTTPHandler(logger *zap.Logger, processor modelpb.BatchProcessor, semaphore input.Semaphore, tp trace.TracerProvider) http.HandlerFunc {
+	h := httpHandler{consumer: otlp.NewConsumer(otlp.ConsumerConfig{
+		Processor:     modelprocessor.NewTracer("zipkin.ProcessBatch", processor, modelprocessor.WithTracerProvider(tp)),
+		Logger:        logger,
+		Semaphore:     semaphore,
+		TraceProvider: tp,
+	})}
+	return h.handle
+}
+
+type httpHandler struct {
+	consumer *otlp.Consumer
+}
+
+func (h httpHandler) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, fmt.Sprintf("method %s not supported", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid content type: %s", err), http.StatusBadRequest)
+			return
+		}
+		if mediaType != "application/json" {
+			// Only the JSON encoding of Zipkin v2 spans is supported.
+			http.Error(w, fmt.Sprintf("unsupported content type %q", mediaType), http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+	traces, err := decodeSpans(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result, err := h.consumer.ConsumeTracesWithResult(r.Context(), traces)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.RejectedSpans > 0 {
+		http.Error(w, result.ErrorMessage, http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
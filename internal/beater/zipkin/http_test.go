@@ -0,0 +1,123 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package zipkin_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/trace/noop"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/elastic/apm-data/model/modelpb"
+	"github.com/elastic/apm-server/internal/agentcfg"
+	"github.com/elastic/apm-server/internal/beater/api"
+	"github.com/elastic/apm-server/internal/beater/auth"
+	"github.com/elastic/apm-server/internal/beater/config"
+	"github.com/elastic/apm-server/internal/beater/monitoringtest"
+	"github.com/elastic/apm-server/internal/beater/ratelimit"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func TestConsumeSpansHTTP(t *testing.T) {
+	var batches []modelpb.Batch
+	var batchProcessor modelpb.ProcessBatchFunc = func(ctx context.Context, batch *modelpb.Batch) error {
+		batches = append(batches, *batch)
+		return nil
+	}
+
+	addr, reader := newHTTPServer(t, batchProcessor)
+
+	// Send a minimal span to verify that everything is connected properly.
+	//
+	// We intentionally do not check the published event contents; those are
+	// tested in processor/otel.
+	post := func(contentType, body string) int {
+		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%s/api/v2/spans", addr), strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", contentType)
+		rsp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		assert.NoError(t, rsp.Body.Close())
+		return rsp.StatusCode
+	}
+	assert.Equal(t, http.StatusAccepted, post("application/json", `[{
+		"traceId": "1", "id": "2", "name": "operation_name",
+		"localEndpoint": {"serviceName": "service_name"}
+	}]`))
+	require.Len(t, batches, 1)
+	require.Len(t, batches[0], 1)
+	assert.Equal(t, "service_name", batches[0][0].GetService().GetName())
+
+	assert.Equal(t, http.StatusBadRequest, post("application/json", `[{"id": "2"}]`))
+	assert.Equal(t, http.StatusUnsupportedMediaType, post("application/x-protobuf", ""))
+	require.Len(t, batches, 1)
+
+	monitoringtest.ExpectContainOtelMetrics(t, reader, map[string]any{
+		"apm-server.zipkin.http.request.count":  3,
+		"apm-server.zipkin.http.response.count": 3,
+	})
+}
+
+func newHTTPServer(t *testing.T, batchProcessor modelpb.BatchProcessor) (string, sdkmetric.Reader) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	reader := sdkmetric.NewManualReader(sdkmetric.WithTemporalitySelector(
+		func(ik sdkmetric.InstrumentKind) metricdata.Temporality {
+			return metricdata.DeltaTemporality
+		},
+	))
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	cfg := &config.Config{}
+	auth, _ := auth.NewAuthenticator(cfg.AgentAuth, logptest.NewTestingLogger(t, ""))
+	ratelimitStore, _ := ratelimit.NewStore(1000, 1000, 1000)
+	router, err := api.NewMux(
+		cfg,
+		batchProcessor,
+		auth,
+		agentcfg.NewEmptyFetcher(),
+		ratelimitStore,
+		nil,
+		func() bool { return true },
+		nil,
+		nil,
+		nil,
+		nil,
+		semaphore.NewWeighted(1),
+		mp,
+		noop.NewTracerProvider(),
+		logptest.NewTestingLogger(t, ""),
+		monitoring.NewRegistry(),
+	)
+	require.NoError(t, err)
+	srv := http.Server{Handler: router}
+	t.Cleanup(func() {
+		require.NoError(t, srv.Close())
+	})
+	go srv.Serve(lis)
+	return lis.Addr().String(), reader
+}
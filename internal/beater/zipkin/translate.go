@@ -0,0 +1,288 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package zipkin
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+const (
+	attributeServiceName  = "service.name"
+	attributeSDKName      = "telemetry.sdk.name"
+	attributePeerService  = "peer.service"
+	attributeNetPeerIP    = "net.peer.ip"
+	attributeNetPeerPort  = "net.peer.port"
+	attributeNetHostIP    = "net.host.ip"
+	attributeNetHostPort  = "net.host.port"
+	tagError              = "error"
+	tagStatusCode         = "otel.status_code"
+	tagStatusDescription  = "otel.status_description"
+	tagScopeName          = "otel.scope.name"
+	tagScopeVersion       = "otel.scope.version"
+	tagLibraryName        = "otel.library.name"
+	tagLibraryVersion     = "otel.library.version"
+	statusCodeError       = "ERROR"
+	statusCodeOK          = "OK"
+	sdkName               = "zipkin"
+	maxTraceIDHexLength   = 32
+	maxSpanIDHexLength    = 16
+	microsecondsPerSecond = int64(time.Second / time.Microsecond)
+)
+
+// span is a Zipkin v2 span, as defined by
+// https://zipkin.io/zipkin-api/#/default/post_spans
+type span struct {
+	TraceID        string            `json:"traceId"`
+	ID             string            `json:"id"`
+	ParentID       string            `json:"parentId"`
+	Name           string            `json:"name"`
+	Kind           string            `json:"kind"`
+	Timestamp      int64             `json:"timestamp"`
+	Duration       int64             `json:"duration"`
+	LocalEndpoint  *endpoint         `json:"localEndpoint"`
+	RemoteEndpoint *endpoint         `json:"remoteEndpoint"`
+	Annotations    []annotation      `json:"annotations"`
+	Tags           map[string]string `json:"tags"`
+}
+
+type endpoint struct {
+	ServiceName string `json:"serviceName"`
+	IPv4        string `json:"ipv4"`
+	IPv6        string `json:"ipv6"`
+	Port        int64  `json:"port"`
+}
+
+type annotation struct {
+	Timestamp int64  `json:"timestamp"`
+	Value     string `json:"value"`
+}
+
+// decodeSpans decodes a JSON array of Zipkin v2 spans from r, and
+// translates them to OpenTelemetry traces.
+func decodeSpans(r io.Reader) (ptrace.Traces, error) {
+	var spans []span
+	if err := json.NewDecoder(r).Decode(&spans); err != nil {
+		return ptrace.Traces{}, fmt.Errorf("failed to decode zipkin spans: %w", err)
+	}
+	return spansToTraces(spans)
+}
+
+// spansToTraces translates Zipkin spans into OpenTelemetry traces, with
+// a resource for each distinct local endpoint service name.
+func spansToTraces(spans []span) (ptrace.Traces, error) {
+	traces := ptrace.NewTraces()
+	type scopeKey struct {
+		service string
+		name    string
+		version string
+	}
+	resources := make(map[string]ptrace.ResourceSpans)
+	scopes := make(map[scopeKey]ptrace.SpanSlice)
+	for i, span := range spans {
+		var service string
+		if span.LocalEndpoint != nil {
+			service = span.LocalEndpoint.ServiceName
+		}
+		key := scopeKey{service: service}
+		for k, v := range span.Tags {
+			switch k {
+			case tagScopeName, tagLibraryName:
+				key.name = v
+			case tagScopeVersion, tagLibraryVersion:
+				key.version = v
+			}
+		}
+		spanSlice, ok := scopes[key]
+		if !ok {
+			rs, ok := resources[service]
+			if !ok {
+				rs = traces.ResourceSpans().AppendEmpty()
+				attrs := rs.Resource().Attributes()
+				attrs.PutStr(attributeSDKName, sdkName)
+				if service != "" {
+					attrs.PutStr(attributeServiceName, service)
+				}
+				resources[service] = rs
+			}
+			ss := rs.ScopeSpans().AppendEmpty()
+			ss.Scope().SetName(key.name)
+			ss.Scope().SetVersion(key.version)
+			spanSlice = ss.Spans()
+			scopes[key] = spanSlice
+		}
+		if err := translateSpan(span, spanSlice.AppendEmpty()); err != nil {
+			return ptrace.Traces{}, fmt.Errorf("invalid span at index %d: %w", i, err)
+		}
+	}
+	return traces, nil
+}
+
+func translateSpan(in span, out ptrace.Span) error {
+	traceID, err := decodeTraceID(in.TraceID)
+	if err != nil {
+		return err
+	}
+	spanID, err := decodeSpanID(in.ID, "id")
+	if err != nil {
+		return err
+	}
+	out.SetTraceID(traceID)
+	out.SetSpanID(spanID)
+	if in.ParentID != "" {
+		parentID, err := decodeSpanID(in.ParentID, "parentId")
+		if err != nil {
+			return err
+		}
+		out.SetParentSpanID(parentID)
+	}
+	out.SetName(in.Name)
+	out.SetKind(spanKind(in.Kind))
+
+	start := microsToTime(in.Timestamp)
+	out.SetStartTimestamp(pcommon.NewTimestampFromTime(start))
+	out.SetEndTimestamp(pcommon.NewTimestampFromTime(start.Add(time.Duration(in.Duration) * time.Microsecond)))
+
+	attrs := out.Attributes()
+	if e := in.LocalEndpoint; e != nil {
+		if ip := endpointIP(e); ip != "" {
+			attrs.PutStr(attributeNetHostIP, ip)
+		}
+		if e.Port != 0 {
+			attrs.PutInt(attributeNetHostPort, e.Port)
+		}
+	}
+	if e := in.RemoteEndpoint; e != nil {
+		if e.ServiceName != "" {
+			attrs.PutStr(attributePeerService, e.ServiceName)
+		}
+		if ip := endpointIP(e); ip != "" {
+			attrs.PutStr(attributeNetPeerIP, ip)
+		}
+		if e.Port != 0 {
+			attrs.PutInt(attributeNetPeerPort, e.Port)
+		}
+	}
+
+	var statusCode, statusDescription, errorTag string
+	var hasError bool
+	for k, v := range in.Tags {
+		switch k {
+		case tagStatusCode:
+			statusCode = strings.ToUpper(v)
+		case tagStatusDescription:
+			statusDescription = v
+		case tagError:
+			// Zipkin records errors with an "error" tag, whose value
+			// is the error message, or empty if there is none.
+			hasError = true
+			errorTag = v
+		case tagScopeName, tagScopeVersion, tagLibraryName, tagLibraryVersion:
+			// Recorded as the span's instrumentation scope.
+		default:
+			attrs.PutStr(k, v)
+		}
+	}
+	switch {
+	case statusCode == statusCodeError:
+		out.Status().SetCode(ptrace.StatusCodeError)
+		out.Status().SetMessage(statusDescription)
+	case statusCode == statusCodeOK:
+		out.Status().SetCode(ptrace.StatusCodeOk)
+	case hasError && errorTag != "false":
+		out.Status().SetCode(ptrace.StatusCodeError)
+		if errorTag != "true" {
+			out.Status().SetMessage(errorTag)
+		}
+	}
+
+	for _, a := range in.Annotations {
+		event := out.Events().AppendEmpty()
+		event.SetTimestamp(pcommon.NewTimestampFromTime(microsToTime(a.Timestamp)))
+		event.SetName(a.Value)
+	}
+	return nil
+}
+
+func spanKind(kind string) ptrace.SpanKind {
+	switch strings.ToUpper(kind) {
+	case "CLIENT":
+		return ptrace.SpanKindClient
+	case "SERVER":
+		return ptrace.SpanKindServer
+	case "PRODUCER":
+		return ptrace.SpanKindProducer
+	case "CONSUMER":
+		return ptrace.SpanKindConsumer
+	}
+	return ptrace.SpanKindInternal
+}
+
+func endpointIP(e *endpoint) string {
+	if e.IPv4 != "" {
+		return e.IPv4
+	}
+	return e.IPv6
+}
+
+func microsToTime(us int64) time.Time {
+	return time.Unix(us/microsecondsPerSecond, (us%microsecondsPerSecond)*int64(time.Microsecond))
+}
+
+// decodeTraceID decodes a 64 or 128-bit lower-hex trace ID.
+func decodeTraceID(s string) (pcommon.TraceID, error) {
+	var id pcommon.TraceID
+	if s == "" || len(s) > maxTraceIDHexLength {
+		return id, fmt.Errorf("invalid traceId %q", s)
+	}
+	b, err := decodeHexID(s)
+	if err != nil {
+		return id, fmt.Errorf("invalid traceId %q: %w", s, err)
+	}
+	copy(id[len(id)-len(b):], b)
+	return id, nil
+}
+
+// decodeSpanID decodes a 64-bit lower-hex span ID.
+func decodeSpanID(s, field string) (pcommon.SpanID, error) {
+	var id pcommon.SpanID
+	if s == "" || len(s) > maxSpanIDHexLength {
+		return id, fmt.Errorf("invalid %s %q", field, s)
+	}
+	b, err := decodeHexID(s)
+	if err != nil {
+		return id, fmt.Errorf("invalid %s %q: %w", field, s, err)
+	}
+	copy(id[len(id)-len(b):], b)
+	return id, nil
+}
+
+func decodeHexID(s string) ([]byte, error) {
+	if len(s)%2 != 0 {
+		// IDs may omit leading zeroes.
+		s = "0" + s
+	}
+	return hex.DecodeString(s)
+}
@@ -0,0 +1,106 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package zipkin
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func TestDecodeSpans(t *testing.T) {
+	traces, err := decodeSpans(strings.NewReader(`[{
+		"traceId": "1",
+		"id": "2",
+		"parentId": "3",
+		"name": "get /api",
+		"kind": "CLIENT",
+		"timestamp": 1700000000000001,
+		"duration": 1500,
+		"localEndpoint": {"serviceName": "frontend", "ipv4": "10.0.0.1", "port": 8080},
+		"remoteEndpoint": {"serviceName": "backend", "ipv6": "::1", "port": 9000},
+		"annotations": [{"timestamp": 1700000000000500, "value": "retry"}],
+		"tags": {"http.method": "GET", "error": "connection refused", "otel.library.name": "lib"}
+	}, {
+		"traceId": "00000000000000010000000000000002",
+		"id": "0000000000000004",
+		"name": "unknown service"
+	}]`))
+	require.NoError(t, err)
+	require.Equal(t, 2, traces.ResourceSpans().Len())
+
+	rs := traces.ResourceSpans().At(0)
+	assert.Equal(t, map[string]any{
+		"service.name":       "frontend",
+		"telemetry.sdk.name": "zipkin",
+	}, rs.Resource().Attributes().AsRaw())
+	require.Equal(t, 1, rs.ScopeSpans().Len())
+	assert.Equal(t, "lib", rs.ScopeSpans().At(0).Scope().Name())
+	require.Equal(t, 1, rs.ScopeSpans().At(0).Spans().Len())
+
+	span := rs.ScopeSpans().At(0).Spans().At(0)
+	assert.Equal(t, pcommon.TraceID{15: 1}, span.TraceID())
+	assert.Equal(t, pcommon.SpanID{7: 2}, span.SpanID())
+	assert.Equal(t, pcommon.SpanID{7: 3}, span.ParentSpanID())
+	assert.Equal(t, "get /api", span.Name())
+	assert.Equal(t, ptrace.SpanKindClient, span.Kind())
+	start := time.UnixMicro(1700000000000001)
+	assert.Equal(t, start, span.StartTimestamp().AsTime().Local())
+	assert.Equal(t, start.Add(1500*time.Microsecond), span.EndTimestamp().AsTime().Local())
+	assert.Equal(t, ptrace.StatusCodeError, span.Status().Code())
+	assert.Equal(t, "connection refused", span.Status().Message())
+	assert.Equal(t, map[string]any{
+		"http.method":   "GET",
+		"net.host.ip":   "10.0.0.1",
+		"net.host.port": int64(8080),
+		"peer.service":  "backend",
+		"net.peer.ip":   "::1",
+		"net.peer.port": int64(9000),
+	}, span.Attributes().AsRaw())
+	require.Equal(t, 1, span.Events().Len())
+	assert.Equal(t, "retry", span.Events().At(0).Name())
+
+	rs = traces.ResourceSpans().At(1)
+	assert.Equal(t, map[string]any{"telemetry.sdk.name": "zipkin"}, rs.Resource().Attributes().AsRaw())
+	span = rs.ScopeSpans().At(0).Spans().At(0)
+	assert.Equal(t, pcommon.TraceID{7: 1, 15: 2}, span.TraceID())
+	assert.Equal(t, ptrace.SpanKindInternal, span.Kind())
+	assert.Equal(t, ptrace.StatusCodeUnset, span.Status().Code())
+}
+
+func TestDecodeSpansInvalid(t *testing.T) {
+	for name, test := range map[string]struct {
+		input string
+		err   string
+	}{
+		"not_json":         {input: "{", err: "failed to decode zipkin spans: unexpected EOF"},
+		"missing_trace_id": {input: `[{"id": "1"}]`, err: `invalid span at index 0: invalid traceId ""`},
+		"long_span_id":     {input: `[{"traceId": "1", "id": "00000000000000001"}]`, err: `invalid span at index 0: invalid id "00000000000000001"`},
+		"invalid_hex":      {input: `[{"traceId": "1", "id": "1", "parentId": "xyz"}]`, err: `invalid span at index 0: invalid parentId "xyz": encoding/hex: invalid byte: U+0078 'x'`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := decodeSpans(strings.NewReader(test.input))
+			assert.EqualError(t, err, test.err)
+		})
+	}
+}
@@ -0,0 +1,429 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package capture provides a facility for capturing the intake requests
+// of specific agents, for debugging agents which send malformed data.
+//
+// Capture is started at runtime with a filter and a duration. Requests
+// matching the filter are written as newline-delimited JSON records to
+// size-rotated files, along with the errors that resulted from them.
+package capture
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/file"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const (
+	// DirName is the name of the directory under path.logs in which
+	// capture files are written, unless configured otherwise.
+	DirName = "capture"
+
+	// FilePrefix is the prefix of capture file names.
+	FilePrefix = "capture"
+
+	// DefaultDuration is the default duration for which capture runs.
+	DefaultDuration = 5 * time.Minute
+
+	fileExtension = "ndjson"
+)
+
+// ErrEmptyFilter is returned by Capturer.Start if the filter has no criteria.
+var ErrEmptyFilter = errors.New("capture filter must have at least one criterion")
+
+// Filter holds the criteria for capturing requests. Requests are captured
+// if they match all non-empty criteria.
+type Filter struct {
+	ServiceName string     `json:"service.name,omitempty"`
+	AgentName   string     `json:"agent.name,omitempty"`
+	ClientIP    netip.Addr `json:"client.ip,omitzero"`
+	APIKeyID    string     `json:"api_key.id,omitempty"`
+}
+
+// IsZero reports whether f has no criteria.
+func (f Filter) IsZero() bool {
+	return f == Filter{}
+}
+
+// Record is a captured request.
+type Record struct {
+	// Timestamp holds the time at which the request was received.
+	Timestamp time.Time `json:"@timestamp"`
+
+	URLPath     string     `json:"url.path"`
+	ClientIP    netip.Addr `json:"client.ip,omitzero"`
+	APIKeyID    string     `json:"api_key.id,omitempty"`
+	ServiceName string     `json:"service.name,omitempty"`
+	AgentName   string     `json:"agent.name,omitempty"`
+
+	// StatusCode holds the HTTP status code of the response.
+	StatusCode int `json:"http.response.status_code"`
+
+	// Accepted holds the number of events accepted.
+	Accepted int `json:"accepted"`
+
+	// Errors holds the errors that resulted from the request.
+	Errors []Error `json:"errors,omitempty"`
+
+	// Body holds the decompressed request body, truncated to the
+	// configured maximum size if BodyTruncated is true.
+	Body          string `json:"body"`
+	BodyTruncated bool   `json:"body_truncated,omitempty"`
+}
+
+// Error holds an error that resulted from a captured request.
+type Error struct {
+	Message  string `json:"message"`
+	Document string `json:"document,omitempty"`
+}
+
+// Config holds configuration for New.
+type Config struct {
+	// Dir holds the directory in which capture files are written.
+	Dir string
+
+	// MaxFileSize holds the size in bytes at which files are rotated.
+	MaxFileSize uint
+
+	// MaxFiles holds the maximum number of files to retain, including
+	// the file currently being written.
+	MaxFiles uint
+
+	// MaxBodySize holds the maximum number of bytes of each request
+	// body to capture.
+	MaxBodySize int
+
+	// MaxDuration holds the maximum duration for which capture may run.
+	MaxDuration time.Duration
+
+	// Logger holds a logger for the capturer.
+	Logger *logp.Logger
+}
+
+// Status describes the state of a Capturer.
+type Status struct {
+	Active   bool       `json:"active"`
+	Filter   *Filter    `json:"filter,omitempty"`
+	Until    *time.Time `json:"until,omitempty"`
+	Captured int        `json:"captured"`
+	Dir      string     `json:"dir"`
+}
+
+// Capturer captures intake requests matching a filter, for a limited time.
+type Capturer struct {
+	cfg    Config
+	active atomic.Bool
+
+	mu      sync.Mutex
+	session *session
+}
+
+type session struct {
+	filter   Filter
+	until    time.Time
+	timer    *time.Timer
+	rotator  *file.Rotator
+	captured int
+}
+
+// New returns a new Capturer, which captures nothing until started.
+func New(cfg Config) (*Capturer, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("capture directory unspecified")
+	}
+	if cfg.MaxFiles == 0 {
+		return nil, errors.New("capture max files must be greater than zero")
+	}
+	if cfg.MaxBodySize <= 0 {
+		return nil, errors.New("capture max body size must be greater than zero")
+	}
+	if cfg.MaxDuration <= 0 {
+		return nil, errors.New("capture max duration must be greater than zero")
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = logp.NewNopLogger()
+	}
+	return &Capturer{cfg: cfg}, nil
+}
+
+// Start starts capturing requests matching filter for duration d,
+// replacing any capture already in progress.
+func (c *Capturer) Start(filter Filter, d time.Duration) (Status, error) {
+	if filter.IsZero() {
+		return Status{}, ErrEmptyFilter
+	}
+	if d <= 0 || d > c.cfg.MaxDuration {
+		return Status{}, fmt.Errorf("capture duration must be greater than 0 and at most %s", c.cfg.MaxDuration)
+	}
+	filter.ClientIP = filter.ClientIP.Unmap()
+	rotator, err := file.NewFileRotator(
+		filepath.Join(c.cfg.Dir, FilePrefix),
+		file.Extension(fileExtension),
+		file.MaxSizeBytes(c.cfg.MaxFileSize),
+		file.MaxBackups(c.cfg.MaxFiles-1),
+		file.Permissions(0600),
+		file.RotateOnStartup(false),
+	)
+	if err != nil {
+		return Status{}, fmt.Errorf("failed to create capture file: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopLocked()
+	s := &session{filter: filter, until: time.Now().Add(d), rotator: rotator}
+	s.timer = time.AfterFunc(d, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.session == s {
+			c.stopLocked()
+		}
+	})
+	c.session = s
+	c.active.Store(true)
+	c.cfg.Logger.With(
+		logp.Any("filter", filter),
+		logp.Time("until", s.until),
+	).Infof("started capturing intake requests to %s", c.cfg.Dir)
+	return c.statusLocked(), nil
+}
+
+// Stop stops any capture in progress, returning the final status.
+func (c *Capturer) Stop() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := c.statusLocked()
+	c.stopLocked()
+	status.Active = false
+	return status
+}
+
+// Status returns the status of the capturer.
+func (c *Capturer) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.statusLocked()
+}
+
+func (c *Capturer) stopLocked() {
+	s := c.session
+	if s == nil {
+		return
+	}
+	c.session = nil
+	c.active.Store(false)
+	s.timer.Stop()
+	if err := s.rotator.Close(); err != nil {
+		c.cfg.Logger.With(logp.Error(err)).Warn("failed to close capture file")
+	}
+	c.cfg.Logger.Infof("stopped capturing intake requests, captured %d", s.captured)
+}
+
+func (c *Capturer) statusLocked() Status {
+	status := Status{Dir: c.cfg.Dir}
+	if s := c.session; s != nil {
+		filter, until := s.filter, s.until
+		status.Active = true
+		status.Filter = &filter
+		status.Until = &until
+		status.Captured = s.captured
+	}
+	return status
+}
+
+// Begin begins capturing a request if capture is in progress and the
+// request matches the filter's client IP and API key ID criteria. The
+// service and agent name criteria are matched against the request's
+// metadata as soon as it has been read; the body of a request whose
+// metadata does not match is discarded rather than buffered.
+//
+// Begin returns a Request and a reader which must be read in place of
+// body, or nil and body if the request is not being captured. Begin
+// may be called on a nil Capturer.
+func (c *Capturer) Begin(urlPath string, clientIP netip.Addr, apiKeyID string, body io.Reader) (*Request, io.Reader) {
+	if c == nil || !c.active.Load() {
+		return nil, body
+	}
+	c.mu.Lock()
+	s := c.session
+	c.mu.Unlock()
+	if s == nil ||
+		(s.filter.ClientIP.IsValid() && s.filter.ClientIP != clientIP.Unmap()) ||
+		(s.filter.APIKeyID != "" && s.filter.APIKeyID != apiKeyID) {
+		return nil, body
+	}
+	r := &Request{
+		capturer: c,
+		session:  s,
+		body: requestBody{
+			limitedBuffer: limitedBuffer{limit: c.cfg.MaxBodySize},
+			filter:        s.filter,
+		},
+		record: Record{
+			Timestamp: time.Now(),
+			URLPath:   urlPath,
+			ClientIP:  clientIP,
+			APIKeyID:  apiKeyID,
+		},
+	}
+	return r, io.TeeReader(body, &r.body)
+}
+
+// Request is an intake request being captured.
+type Request struct {
+	capturer *Capturer
+	session  *session
+	body     requestBody
+	record   Record
+}
+
+// End ends capturing the request, writing a record with the response
+// status code, number of accepted events, and errors if the request's
+// metadata matches the filter. Requests ending after the capture in
+// which they began has stopped are discarded.
+func (r *Request) End(statusCode, accepted int, errs []Error) {
+	if !r.body.checked {
+		// The body ended without a newline after the metadata.
+		r.body.checkMetadata()
+	}
+	if r.body.discarded {
+		return
+	}
+	r.record.ServiceName, r.record.AgentName = r.body.serviceName, r.body.agentName
+	r.record.StatusCode = statusCode
+	r.record.Accepted = accepted
+	r.record.Errors = errs
+	r.record.Body = r.body.buf.String()
+	r.record.BodyTruncated = r.body.truncated
+	line, err := json.Marshal(r.record)
+	if err != nil {
+		r.capturer.cfg.Logger.With(logp.Error(err)).Warn("failed to encode captured request")
+		return
+	}
+	line = append(line, '\n')
+
+	c := r.capturer
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.session != r.session {
+		return
+	}
+	if _, err := r.session.rotator.Write(line); err != nil {
+		c.cfg.Logger.With(logp.Error(err)).Warn("failed to write captured request")
+		return
+	}
+	r.session.captured++
+}
+
+// parseMetadata returns the service and agent names from the metadata
+// in the first line of an intake v2 or RUM v3 request body.
+func parseMetadata(body []byte) (serviceName, agentName string) {
+	line, _, _ := bytes.Cut(body, []byte("\n"))
+	var metadata struct {
+		V2 *struct {
+			Service struct {
+				Name  string `json:"name"`
+				Agent struct {
+					Name string `json:"name"`
+				} `json:"agent"`
+			} `json:"service"`
+		} `json:"metadata"`
+		V3 *struct {
+			Service struct {
+				Name  string `json:"n"`
+				Agent struct {
+					Name string `json:"n"`
+				} `json:"a"`
+			} `json:"se"`
+		} `json:"m"`
+	}
+	if err := json.Unmarshal(line, &metadata); err != nil {
+		return "", ""
+	}
+	switch {
+	case metadata.V2 != nil:
+		return metadata.V2.Service.Name, metadata.V2.Service.Agent.Name
+	case metadata.V3 != nil:
+		return metadata.V3.Service.Name, metadata.V3.Service.Agent.Name
+	}
+	return "", ""
+}
+
+// requestBody is an io.Writer which buffers a captured request body.
+//
+// Once the metadata line has been buffered, or the buffer is full, its
+// service and agent names are matched against the filter. If they do not
+// match, the buffered body is released and the remainder is discarded,
+// so requests that will not be captured are not held in memory.
+type requestBody struct {
+	limitedBuffer
+	filter Filter
+
+	checked                bool
+	discarded              bool
+	serviceName, agentName string
+}
+
+func (b *requestBody) Write(p []byte) (int, error) {
+	if b.discarded {
+		return len(p), nil
+	}
+	n, err := b.limitedBuffer.Write(p)
+	if !b.checked && (bytes.IndexByte(p, '\n') >= 0 || b.truncated) {
+		b.checkMetadata()
+	}
+	return n, err
+}
+
+func (b *requestBody) checkMetadata() {
+	b.checked = true
+	b.serviceName, b.agentName = parseMetadata(b.buf.Bytes())
+	if (b.filter.ServiceName != "" && b.filter.ServiceName != b.serviceName) ||
+		(b.filter.AgentName != "" && b.filter.AgentName != b.agentName) {
+		b.discarded = true
+		b.buf = bytes.Buffer{}
+	}
+}
+
+// limitedBuffer is an io.Writer which buffers up to limit bytes,
+// silently discarding the remainder.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if remaining := b.limit - b.buf.Len(); n > remaining {
+		p = p[:remaining]
+		b.truncated = true
+	}
+	b.buf.Write(p)
+	return n, nil
+}
@@ -0,0 +1,166 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+const (
+	v2Body = `{"metadata":{"service":{"name":"svc","agent":{"name":"python"}}}}` + "\n" + `{"transaction":{}}` + "\n"
+	v3Body = `{"m":{"se":{"n":"svc","a":{"n":"rum-js"}}}}` + "\n"
+)
+
+func TestCapturer(t *testing.T) {
+	dir := t.TempDir()
+	c := newCapturer(t, Config{Dir: dir, MaxFileSize: 1 << 20, MaxFiles: 2, MaxBodySize: 80, MaxDuration: time.Hour})
+
+	// Nothing is captured before capture is started.
+	r, body := c.Begin("/intake/v2/events", netip.Addr{}, "", strings.NewReader(v2Body))
+	assert.Nil(t, r)
+	assert.Equal(t, strings.NewReader(v2Body), body)
+
+	_, err := c.Start(Filter{}, time.Minute)
+	assert.ErrorIs(t, err, ErrEmptyFilter)
+	_, err = c.Start(Filter{AgentName: "python"}, 2*time.Hour)
+	assert.Error(t, err)
+
+	status, err := c.Start(Filter{AgentName: "python", APIKeyID: "key"}, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, status.Active)
+	assert.Equal(t, &Filter{AgentName: "python", APIKeyID: "key"}, status.Filter)
+
+	capture := func(apiKeyID, requestBody string) {
+		r, body := c.Begin("/intake/v2/events", netip.MustParseAddr("10.1.2.3"), apiKeyID, strings.NewReader(requestBody))
+		_, err := io.ReadAll(body)
+		require.NoError(t, err)
+		if r != nil {
+			r.End(400, 1, []Error{{Message: "invalid", Document: "{}"}})
+		}
+	}
+	capture("other", v2Body) // API key ID does not match
+	capture("key", v3Body)   // agent name does not match
+	capture("key", v2Body)
+
+	status = c.Stop()
+	assert.False(t, status.Active)
+	assert.Equal(t, 1, status.Captured)
+	capture("key", v2Body) // stopped
+
+	records := readRecords(t, dir)
+	require.Len(t, records, 1)
+	assert.NotZero(t, records[0].Timestamp)
+	records[0].Timestamp = time.Time{}
+	assert.Equal(t, Record{
+		URLPath:       "/intake/v2/events",
+		ClientIP:      netip.MustParseAddr("10.1.2.3"),
+		APIKeyID:      "key",
+		ServiceName:   "svc",
+		AgentName:     "python",
+		StatusCode:    400,
+		Accepted:      1,
+		Errors:        []Error{{Message: "invalid", Document: "{}"}},
+		Body:          v2Body[:80],
+		BodyTruncated: true,
+	}, records[0])
+}
+
+func TestCapturerDiscardsNonMatchingBody(t *testing.T) {
+	c := newCapturer(t, Config{Dir: t.TempDir(), MaxFileSize: 1 << 20, MaxFiles: 1, MaxBodySize: 1 << 20, MaxDuration: time.Hour})
+	_, err := c.Start(Filter{ServiceName: "other"}, time.Minute)
+	require.NoError(t, err)
+
+	events := strings.Repeat(`{"transaction":{}}`+"\n", 1000)
+	r, body := c.Begin("/intake/v2/events", netip.Addr{}, "", strings.NewReader(v2Body+events))
+	require.NotNil(t, r)
+
+	// The body is no longer buffered once the metadata has been read
+	// and found not to match the filter.
+	metadata, _, _ := strings.Cut(v2Body, "\n")
+	_, err = io.ReadFull(body, make([]byte, len(metadata)+1))
+	require.NoError(t, err)
+	assert.True(t, r.body.discarded)
+	assert.Zero(t, r.body.buf.Cap())
+
+	_, err = io.Copy(io.Discard, body)
+	require.NoError(t, err)
+	assert.Zero(t, r.body.buf.Len())
+	r.End(202, 1001, nil)
+	assert.Equal(t, 0, c.Status().Captured)
+}
+
+func TestCapturerTimeout(t *testing.T) {
+	c := newCapturer(t, Config{Dir: t.TempDir(), MaxFileSize: 1 << 20, MaxFiles: 1, MaxBodySize: 1, MaxDuration: time.Hour})
+	_, err := c.Start(Filter{ServiceName: "svc"}, time.Millisecond)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return !c.Status().Active
+	}, 10*time.Second, time.Millisecond)
+}
+
+func TestParseMetadata(t *testing.T) {
+	for body, expected := range map[string][2]string{
+		v2Body:        {"svc", "python"},
+		v3Body:        {"svc", "rum-js"},
+		`{"metadata"`: {"", ""},
+		``:            {"", ""},
+	} {
+		serviceName, agentName := parseMetadata([]byte(body))
+		assert.Equal(t, expected, [2]string{serviceName, agentName}, body)
+	}
+}
+
+func newCapturer(t testing.TB, cfg Config) *Capturer {
+	cfg.Logger = logptest.NewTestingLogger(t, "")
+	c, err := New(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Stop() })
+	return c
+}
+
+func readRecords(t testing.TB, dir string) []Record {
+	files, err := filepath.Glob(filepath.Join(dir, FilePrefix+"-*."+fileExtension))
+	require.NoError(t, err)
+	var records []Record
+	for _, name := range files {
+		f, err := os.Open(name)
+		require.NoError(t, err)
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var record Record
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+			records = append(records, record)
+		}
+		require.NoError(t, scanner.Err())
+	}
+	return records
+}
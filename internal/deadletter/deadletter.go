@@ -0,0 +1,203 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package deadletter provides a local store for documents rejected by
+// Elasticsearch, and support for replaying them.
+//
+// Rejected documents are written as newline-delimited JSON entries to
+// size-rotated files, along with the index they were destined for and
+// the reason they were rejected.
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+
+	"github.com/elastic/elastic-agent-libs/file"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const (
+	// DirName is the name of the directory under path.data in which
+	// dead-letter files are written, unless configured otherwise.
+	DirName = "deadletter"
+
+	// FilePrefix is the prefix of dead-letter file names.
+	FilePrefix = "deadletter"
+
+	fileExtension = "ndjson"
+)
+
+// Entry is a dead-lettered document.
+type Entry struct {
+	// Timestamp holds the time at which the document was rejected.
+	Timestamp time.Time `json:"@timestamp"`
+
+	// Index holds the name of the index or data stream to which
+	// the document was sent.
+	Index string `json:"index"`
+
+	// Status holds the HTTP status code for the rejected document.
+	Status int `json:"status"`
+
+	// Error holds the error reported by Elasticsearch.
+	Error Error `json:"error"`
+
+	// Document holds the original JSON document.
+	Document json.RawMessage `json:"document"`
+}
+
+// Error holds the error reported by Elasticsearch for a rejected document.
+type Error struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Config holds configuration for NewWriter.
+type Config struct {
+	// Dir holds the directory in which dead-letter files are written.
+	Dir string
+
+	// MaxFileSize holds the size in bytes at which files are rotated.
+	MaxFileSize uint
+
+	// MaxFiles holds the maximum number of files to retain, including
+	// the file currently being written. The oldest files are removed
+	// when this is exceeded.
+	MaxFiles uint
+
+	// Logger holds a logger for the writer.
+	Logger *logp.Logger
+
+	// MeterProvider holds the metric.MeterProvider for recording
+	// dead-letter metrics. If nil, no metrics are recorded.
+	MeterProvider metric.MeterProvider
+}
+
+// Writer writes dead-lettered documents to rotated files.
+type Writer struct {
+	rotator *file.Rotator
+	logger  *logp.Logger
+
+	written metric.Int64Counter
+	dropped metric.Int64Counter
+}
+
+// NewWriter returns a new Writer.
+func NewWriter(cfg Config) (*Writer, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("dead-letter directory unspecified")
+	}
+	if cfg.MaxFiles == 0 {
+		return nil, errors.New("dead-letter max files must be greater than zero")
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = logp.NewNopLogger()
+	}
+	if cfg.MeterProvider == nil {
+		cfg.MeterProvider = noop.NewMeterProvider()
+	}
+	rotator, err := file.NewFileRotator(
+		filepath.Join(cfg.Dir, FilePrefix),
+		file.Extension(fileExtension),
+		file.MaxSizeBytes(cfg.MaxFileSize),
+		file.MaxBackups(cfg.MaxFiles-1),
+		file.Permissions(0600),
+		file.RotateOnStartup(false),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dead-letter file: %w", err)
+	}
+
+	meter := cfg.MeterProvider.Meter("github.com/elastic/apm-server/internal/deadletter")
+	written, err := meter.Int64Counter("apm-server.dead_letter.written")
+	if err != nil {
+		return nil, err
+	}
+	dropped, err := meter.Int64Counter("apm-server.dead_letter.dropped")
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{
+		rotator: rotator,
+		logger:  cfg.Logger,
+		written: written,
+		dropped: dropped,
+	}, nil
+}
+
+// Write writes entries to the current dead-letter file. Each entry is
+// written in a single write, so entries are never split across files.
+func (w *Writer) Write(ctx context.Context, entries []Entry) error {
+	for i, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err == nil {
+			line = append(line, '\n')
+			_, err = w.rotator.Write(line)
+		}
+		if err != nil {
+			w.written.Add(ctx, int64(i))
+			w.dropped.Add(ctx, int64(len(entries)-i))
+			return fmt.Errorf("failed to write dead-letter entry: %w", err)
+		}
+	}
+	w.written.Add(ctx, int64(len(entries)))
+	return nil
+}
+
+// Close closes the writer.
+func (w *Writer) Close() error {
+	return w.rotator.Close()
+}
+
+// Files returns the dead-letter files in dir, ordered from oldest to newest.
+func Files(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, FilePrefix+"-*."+fileExtension))
+	if err != nil {
+		return nil, err
+	}
+	// File names have the form deadletter-<date>[-<n>].ndjson,
+	// where n is the sequence number for files rotated on the
+	// same date. Sort by date, then sequence.
+	sort.Slice(files, func(i, j int) bool {
+		di, ni := parseFileName(files[i])
+		dj, nj := parseFileName(files[j])
+		if di != dj {
+			return di < dj
+		}
+		return ni < nj
+	})
+	return files, nil
+}
+
+func parseFileName(path string) (date string, n int) {
+	name := strings.TrimPrefix(filepath.Base(path), FilePrefix+"-")
+	name = strings.TrimSuffix(name, "."+fileExtension)
+	date, seq, _ := strings.Cut(name, "-")
+	n, _ = strconv.Atoi(seq)
+	return date, n
+}
@@ -0,0 +1,280 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deadletter
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestWriter(t *testing.T) {
+	dir := t.TempDir()
+	w := newWriter(t, Config{Dir: dir, MaxFileSize: 200, MaxFiles: 3})
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, w.Write(context.Background(), []Entry{{
+			Index:    "logs-apm.app.foo-default",
+			Status:   400,
+			Error:    Error{Type: "document_parsing_exception"},
+			Document: json.RawMessage(`{"i":` + strings.Repeat("1", i+1) + `}`),
+		}}))
+	}
+	require.NoError(t, w.Close())
+
+	files, err := Files(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+
+	// The oldest files should have been removed, and the remaining
+	// entries should be in order.
+	var docs []string
+	for _, file := range files {
+		for _, entry := range readEntries(t, file) {
+			docs = append(docs, string(entry.Document))
+		}
+	}
+	require.NotEmpty(t, docs)
+	assert.Equal(t, `{"i":1111111111}`, docs[len(docs)-1])
+	for i := 1; i < len(docs); i++ {
+		assert.Less(t, len(docs[i-1]), len(docs[i]))
+	}
+}
+
+func TestFilesOrder(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"deadletter-20250102-2.ndjson",
+		"deadletter-20250102.ndjson",
+		"deadletter-20250101-10.ndjson",
+		"deadletter-20250102-1.ndjson",
+		"deadletter-20250101-9.ndjson",
+		"other.ndjson",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0600))
+	}
+	files, err := Files(dir)
+	require.NoError(t, err)
+	for i, file := range files {
+		files[i] = filepath.Base(file)
+	}
+	assert.Equal(t, []string{
+		"deadletter-20250101-9.ndjson",
+		"deadletter-20250101-10.ndjson",
+		"deadletter-20250102.ndjson",
+		"deadletter-20250102-1.ndjson",
+		"deadletter-20250102-2.ndjson",
+	}, files)
+}
+
+func TestTransport(t *testing.T) {
+	for _, compressed := range []bool{false, true} {
+		t.Run(map[bool]string{false: "uncompressed", true: "gzip"}[compressed], func(t *testing.T) {
+			dir := t.TempDir()
+			w := newWriter(t, Config{Dir: dir, MaxFileSize: 1024 * 1024, MaxFiles: 1})
+			client := newFakeElasticsearch(func(doc string) (int, string) {
+				switch {
+				case strings.Contains(doc, "bad"):
+					return 400, "document_parsing_exception"
+				case strings.Contains(doc, "busy"):
+					return 429, "es_rejected_execution_exception"
+				}
+				return 201, ""
+			})
+			transport := NewTransport(client, w, logptest.NewTestingLogger(t, ""))
+
+			body := bulkBody(t, compressed, map[string]string{
+				"logs-apm.app.a-default": `{"message":"good"}`,
+				"logs-apm.app.b-default": `{"message":"bad"}`,
+				"logs-apm.app.c-default": `{"message":"busy"}`,
+			})
+			req, err := http.NewRequest(http.MethodPost, "/_bulk", bytes.NewReader(body))
+			require.NoError(t, err)
+			if compressed {
+				req.Header.Set("Content-Encoding", "gzip")
+			}
+			res, err := transport.Perform(req)
+			require.NoError(t, err)
+
+			// The response body should be readable by the caller.
+			var resBody bulkResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&resBody))
+			assert.Len(t, resBody.Items, 3)
+			require.NoError(t, w.Close())
+
+			files, err := Files(dir)
+			require.NoError(t, err)
+			require.Len(t, files, 1)
+			entries := readEntries(t, files[0])
+			require.Len(t, entries, 1)
+			assert.Equal(t, "logs-apm.app.b-default", entries[0].Index)
+			assert.Equal(t, 400, entries[0].Status)
+			assert.Equal(t, Error{Type: "document_parsing_exception", Reason: "rejected"}, entries[0].Error)
+			assert.JSONEq(t, `{"message":"bad"}`, string(entries[0].Document))
+			assert.WithinDuration(t, time.Now(), entries[0].Timestamp, time.Minute)
+		})
+	}
+}
+
+func TestReplayFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "deadletter-20250101.ndjson")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, writeEntries(f, []Entry{
+		{Index: "logs-apm.app.a-default", Status: 400, Document: json.RawMessage(`{"message":"fixed"}`)},
+		{Index: "logs-apm.app.b-default", Status: 400, Document: json.RawMessage(`{"message":"still bad"}`)},
+		{Index: "logs-apm.app.c-default", Status: 400, Document: json.RawMessage(`{"message":"also fixed"}`)},
+	}))
+	require.NoError(t, f.Close())
+
+	var indexed []string
+	client := newFakeElasticsearch(func(doc string) (int, string) {
+		if strings.Contains(doc, "bad") {
+			return 400, "mapper_parsing_exception"
+		}
+		indexed = append(indexed, doc)
+		return 201, ""
+	})
+	stats, err := ReplayFile(context.Background(), client, path)
+	require.NoError(t, err)
+	assert.Equal(t, ReplayStats{Replayed: 2, Failed: 1}, stats)
+	assert.Equal(t, []string{`{"message":"fixed"}`, `{"message":"also fixed"}`}, indexed)
+
+	// The file should now contain only the document that was rejected again.
+	entries := readEntries(t, path)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "logs-apm.app.b-default", entries[0].Index)
+	assert.Equal(t, "mapper_parsing_exception", entries[0].Error.Type)
+
+	// Once all documents are replayed, the file is removed.
+	client = newFakeElasticsearch(func(doc string) (int, string) { return 201, "" })
+	stats, err = ReplayFile(context.Background(), client, path)
+	require.NoError(t, err)
+	assert.Equal(t, ReplayStats{Replayed: 1}, stats)
+	assert.NoFileExists(t, path)
+}
+
+func newWriter(t testing.TB, cfg Config) *Writer {
+	cfg.Logger = logptest.NewTestingLogger(t, "")
+	w, err := NewWriter(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { w.Close() })
+	return w
+}
+
+func readEntries(t testing.TB, path string) []Entry {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry Entry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.NoError(t, scanner.Err())
+	return entries
+}
+
+func bulkBody(t testing.TB, compressed bool, docs map[string]string) []byte {
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var gw *gzip.Writer
+	if compressed {
+		gw = gzip.NewWriter(&buf)
+		w = gw
+	}
+	for _, index := range []string{"logs-apm.app.a-default", "logs-apm.app.b-default", "logs-apm.app.c-default"} {
+		io.WriteString(w, `{"create":{"_index":"`+index+`"}}`+"\n")
+		io.WriteString(w, docs[index]+"\n")
+	}
+	if gw != nil {
+		require.NoError(t, gw.Close())
+	}
+	return buf.Bytes()
+}
+
+// fakeElasticsearch is an elastictransport.Interface that handles bulk
+// requests, calling a function to determine the status of each document.
+type fakeElasticsearch func(*http.Request) (*http.Response, error)
+
+func (f fakeElasticsearch) Perform(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func newFakeElasticsearch(status func(doc string) (int, string)) fakeElasticsearch {
+	return func(req *http.Request) (*http.Response, error) {
+		var r io.Reader = req.Body
+		if req.Header.Get("Content-Encoding") == "gzip" {
+			gr, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			r = gr
+		}
+		type item struct {
+			Index  string `json:"_index"`
+			Status int    `json:"status"`
+			Error  *Error `json:"error,omitempty"`
+		}
+		var result struct {
+			Items []map[string]item `json:"items"`
+		}
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			var action map[string]struct {
+				Index string `json:"_index"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+				return nil, err
+			}
+			scanner.Scan()
+			code, errorType := status(scanner.Text())
+			it := item{Index: action["create"].Index, Status: code}
+			if errorType != "" {
+				it.Error = &Error{Type: errorType, Reason: "rejected"}
+			}
+			result.Items = append(result.Items, map[string]item{"create": it})
+		}
+		body, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(bytes.NewReader(body)),
+		}, nil
+	}
+}
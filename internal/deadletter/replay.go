@@ -0,0 +1,168 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deadletter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+	"github.com/elastic/go-docappender/v2"
+)
+
+// replayBatchSize is the maximum number of documents sent in each bulk
+// request when replaying.
+const replayBatchSize = 500
+
+// ReplayStats holds statistics for a replay.
+type ReplayStats struct {
+	// Replayed holds the number of documents indexed successfully.
+	Replayed int
+
+	// Failed holds the number of documents that were rejected again.
+	Failed int
+}
+
+// ReplayFile re-indexes the documents in a dead-letter file using the
+// bulk API, with client.
+//
+// Once all documents in the file have been indexed the file is removed.
+// If any documents are rejected again, the file is rewritten to contain
+// only those documents, with their new errors, so that replay may be
+// retried after addressing the cause.
+func ReplayFile(ctx context.Context, client elastictransport.Interface, path string) (ReplayStats, error) {
+	indexer, err := docappender.NewBulkIndexer(docappender.BulkIndexerConfig{Client: client})
+	if err != nil {
+		return ReplayStats{}, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return ReplayStats{}, err
+	}
+	defer f.Close()
+
+	var stats ReplayStats
+	var failed []Entry
+	batch := make([]Entry, 0, replayBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		rejected, err := replayBatch(ctx, indexer, batch)
+		if err != nil {
+			return err
+		}
+		stats.Replayed += len(batch) - len(rejected)
+		stats.Failed += len(rejected)
+		failed = append(failed, rejected...)
+		batch = batch[:0]
+		return nil
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return stats, fmt.Errorf("failed to decode dead-letter entry: %w", err)
+		}
+		batch = append(batch, entry)
+		if len(batch) == replayBatchSize {
+			if err := flush(); err != nil {
+				return stats, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return stats, fmt.Errorf("failed to read dead-letter file: %w", err)
+	}
+	if err := flush(); err != nil {
+		return stats, err
+	}
+	f.Close()
+
+	if len(failed) == 0 {
+		return stats, os.Remove(path)
+	}
+	return stats, rewriteFile(path, failed)
+}
+
+// replayBatch indexes batch, returning entries for the documents
+// that were rejected.
+func replayBatch(ctx context.Context, indexer *docappender.BulkIndexer, batch []Entry) ([]Entry, error) {
+	indexer.Reset()
+	for _, entry := range batch {
+		if err := indexer.Add(docappender.BulkIndexerItem{
+			Index: entry.Index,
+			Body:  bytes.NewReader(entry.Document),
+		}); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := indexer.Flush(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay documents: %w", err)
+	}
+	var rejected []Entry
+	for _, item := range resp.FailedDocs {
+		entry := batch[item.Position]
+		entry.Status = item.Status
+		entry.Error = Error{Type: item.Error.Type, Reason: item.Error.Reason}
+		rejected = append(rejected, entry)
+	}
+	return rejected, nil
+}
+
+// rewriteFile atomically replaces the file at path with entries.
+func rewriteFile(path string, entries []Entry) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if err := writeEntries(f, entries); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func writeEntries(w io.Writer, entries []Entry) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,176 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deadletter
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-transport-go/v8/elastictransport"
+)
+
+// Transport is an elastictransport.Interface which inspects the responses
+// to bulk requests, and writes documents rejected by Elasticsearch to a
+// Writer before returning the response to the caller.
+//
+// Documents rejected with status 429 (Too Many Requests) are expected to
+// be retried by the caller, and are not dead-lettered.
+type Transport struct {
+	next   elastictransport.Interface
+	writer *Writer
+	logger *logp.Logger
+}
+
+// NewTransport returns a new Transport which sends requests to next and
+// writes rejected documents to writer.
+func NewTransport(next elastictransport.Interface, writer *Writer, logger *logp.Logger) *Transport {
+	return &Transport{next: next, writer: writer, logger: logger}
+}
+
+// Perform performs the request using the wrapped transport. If the request
+// is a bulk request, rejected documents in the response are dead-lettered.
+func (t *Transport) Perform(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodPost || !strings.HasSuffix(req.URL.Path, "/_bulk") || req.Body == nil {
+		return t.next.Perform(req)
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+
+	res, err := t.next.Perform(req)
+	if err != nil || res.StatusCode > 299 {
+		return res, err
+	}
+	resBody, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(resBody))
+	if err != nil {
+		return res, nil
+	}
+	entries, err := rejectedDocuments(req.Header.Get("Content-Encoding"), body, resBody)
+	if err != nil {
+		t.logger.With(logp.Error(err)).Warn("failed to extract rejected documents from bulk request")
+		return res, nil
+	}
+	if len(entries) > 0 {
+		if err := t.writer.Write(req.Context(), entries); err != nil {
+			t.logger.With(logp.Error(err)).Errorf(
+				"failed to dead-letter %d rejected documents", len(entries),
+			)
+		}
+	}
+	return res, nil
+}
+
+type bulkResponse struct {
+	Items []map[string]bulkResponseItem `json:"items"`
+}
+
+type bulkResponseItem struct {
+	Index  string `json:"_index"`
+	Status int    `json:"status"`
+	Error  Error  `json:"error"`
+}
+
+// rejectedDocuments returns entries for the documents in the bulk request
+// body which were rejected according to the bulk response.
+func rejectedDocuments(contentEncoding string, reqBody, resBody []byte) ([]Entry, error) {
+	var res bulkResponse
+	if err := json.Unmarshal(resBody, &res); err != nil {
+		return nil, fmt.Errorf("failed to decode bulk response: %w", err)
+	}
+	rejected := make(map[int]bulkResponseItem)
+	for i, item := range res.Items {
+		for _, result := range item {
+			if result.Status > 299 && result.Status != http.StatusTooManyRequests {
+				rejected[i] = result
+			}
+		}
+	}
+	if len(rejected) == 0 {
+		return nil, nil
+	}
+
+	var r io.Reader = bytes.NewReader(reqBody)
+	if contentEncoding == "gzip" {
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress bulk request: %w", err)
+		}
+		defer gr.Close()
+		r = gr
+	}
+
+	// Each document in the request is represented by an action line,
+	// followed by the document line.
+	now := time.Now()
+	entries := make([]Entry, 0, len(rejected))
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+	for i := 0; len(entries) < len(rejected) && scanner.Scan(); i++ {
+		item, ok := rejected[i]
+		if ok && item.Index == "" {
+			item.Index = actionIndex(scanner.Bytes())
+		}
+		if !scanner.Scan() {
+			break
+		}
+		if !ok {
+			continue
+		}
+		entries = append(entries, Entry{
+			Timestamp: now,
+			Index:     item.Index,
+			Status:    item.Status,
+			Error:     item.Error,
+			Document:  bytes.Clone(scanner.Bytes()),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read bulk request: %w", err)
+	}
+	return entries, nil
+}
+
+// actionIndex returns the index named in a bulk action line.
+func actionIndex(action []byte) string {
+	var meta map[string]struct {
+		Index string `json:"_index"`
+	}
+	if err := json.Unmarshal(action, &meta); err != nil {
+		return ""
+	}
+	for _, m := range meta {
+		return m.Index
+	}
+	return ""
+}
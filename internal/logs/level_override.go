@@ -0,0 +1,160 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logs
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const (
+	// DefaultRevertAfter is the default duration after which a log
+	// level override is reverted.
+	DefaultRevertAfter = 15 * time.Minute
+
+	// MaxRevertAfter is the maximum duration for which a log level
+	// override may be left in place.
+	MaxRevertAfter = 24 * time.Hour
+)
+
+// LevelState describes the current log level and debug selectors.
+type LevelState struct {
+	// Level holds the current log level.
+	Level string `json:"level"`
+
+	// Selectors holds the debug selectors set at runtime, or
+	// nil if debug messages are logged for all selectors.
+	Selectors []string `json:"selectors"`
+
+	// RevertAt holds the time at which the override will be
+	// reverted, or nil if there is no override in place.
+	RevertAt *time.Time `json:"revert_at,omitempty"`
+}
+
+var runtimeLevel = &levelOverrider{
+	getLevel: logp.GetLevel,
+	setLevel: logp.SetLevel,
+	logger:   func() *logp.Logger { return logp.NewLogger(Config) },
+}
+
+// SetLevelOverride overrides the log level and the debug selectors for
+// loggers created with WithRuntimeSelectors, reverting them to their
+// previous values after revertAfter so that verbose logging cannot be
+// left enabled indefinitely.
+//
+// Setting an override while another is in place replaces it, and
+// restarts the revert timer; the values reverted to are unchanged.
+func SetLevelOverride(level zapcore.Level, selectors []string, revertAfter time.Duration) (LevelState, error) {
+	return runtimeLevel.set(level, selectors, revertAfter)
+}
+
+// RevertLevelOverride reverts any log level override immediately.
+func RevertLevelOverride() LevelState {
+	return runtimeLevel.revert()
+}
+
+// CurrentLevel returns the current log level and debug selectors.
+func CurrentLevel() LevelState {
+	return runtimeLevel.state()
+}
+
+type levelOverrider struct {
+	getLevel func() zapcore.Level
+	setLevel func(zapcore.Level)
+	logger   func() *logp.Logger
+
+	mu        sync.Mutex
+	timer     *time.Timer
+	revertAt  time.Time
+	baseLevel zapcore.Level
+
+	// generation is incremented for each override, so a revert timer
+	// which fires after its override is replaced has no effect.
+	generation uint64
+}
+
+func (o *levelOverrider) set(level zapcore.Level, selectors []string, revertAfter time.Duration) (LevelState, error) {
+	if revertAfter <= 0 || revertAfter > MaxRevertAfter {
+		return LevelState{}, fmt.Errorf("revert duration must be greater than 0 and at most %s", MaxRevertAfter)
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.timer == nil {
+		o.baseLevel = o.getLevel()
+	} else {
+		o.timer.Stop()
+	}
+	o.setLevel(level)
+	SetRuntimeSelectors(selectors)
+	o.revertAt = time.Now().Add(revertAfter)
+	o.generation++
+	generation := o.generation
+	o.timer = time.AfterFunc(revertAfter, func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		if o.generation == generation {
+			o.revertLocked()
+		}
+	})
+	state := o.stateLocked()
+	o.logger().Infof(
+		"log level set to %s with selectors %v, reverting to %s at %s",
+		state.Level, selectors, o.baseLevel, o.revertAt.Format(time.RFC3339),
+	)
+	return state, nil
+}
+
+func (o *levelOverrider) revert() LevelState {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.revertLocked()
+	return o.stateLocked()
+}
+
+func (o *levelOverrider) revertLocked() {
+	if o.timer != nil {
+		o.timer.Stop()
+		o.timer = nil
+		o.setLevel(o.baseLevel)
+		SetRuntimeSelectors(nil)
+		o.logger().Infof("log level reverted to %s", o.baseLevel)
+	}
+}
+
+func (o *levelOverrider) state() LevelState {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.stateLocked()
+}
+
+func (o *levelOverrider) stateLocked() LevelState {
+	state := LevelState{
+		Level:     o.getLevel().String(),
+		Selectors: RuntimeSelectors(),
+	}
+	if o.timer != nil {
+		revertAt := o.revertAt
+		state.RevertAt = &revertAt
+	}
+	return state
+}
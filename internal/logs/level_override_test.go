@@ -0,0 +1,68 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestLevelOverrider(t *testing.T) {
+	t.Cleanup(func() { SetRuntimeSelectors(nil) })
+
+	// getLevel and setLevel are only called with o.mu held.
+	level := zapcore.InfoLevel
+	o := &levelOverrider{
+		getLevel: func() zapcore.Level { return level },
+		setLevel: func(l zapcore.Level) { level = l },
+		logger:   func() *logp.Logger { return logptest.NewTestingLogger(t, "") },
+	}
+	assert.Equal(t, LevelState{Level: "info"}, o.state())
+
+	_, err := o.set(zapcore.DebugLevel, nil, 0)
+	assert.Error(t, err)
+	_, err = o.set(zapcore.DebugLevel, nil, MaxRevertAfter+time.Second)
+	assert.Error(t, err)
+
+	state, err := o.set(zapcore.DebugLevel, []string{"a"}, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "debug", state.Level)
+	assert.Equal(t, []string{"a"}, state.Selectors)
+	require.NotNil(t, state.RevertAt)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *state.RevertAt, time.Minute)
+
+	// Replacing the override does not change the level reverted to.
+	_, err = o.set(zapcore.WarnLevel, nil, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, LevelState{Level: "info"}, o.revert())
+
+	// Overrides are reverted automatically.
+	_, err = o.set(zapcore.DebugLevel, []string{"b"}, time.Millisecond)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return o.state().RevertAt == nil
+	}, 10*time.Second, time.Millisecond)
+	assert.Equal(t, LevelState{Level: "info"}, o.state())
+}
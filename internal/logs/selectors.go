@@ -19,6 +19,8 @@ package logs
 
 // logging selectors
 const (
+	Admin                     = "admin"
+	Audit                     = "audit"
 	Beater                    = "beater"
 	Config                    = "config"
 	Handler                   = "handler"
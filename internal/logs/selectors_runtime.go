@@ -0,0 +1,104 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logs
+
+import (
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// runtimeSelectors holds the debug selectors set with SetRuntimeSelectors,
+// or nil if all selectors are enabled.
+var runtimeSelectors atomic.Pointer[selectorSet]
+
+type selectorSet struct {
+	all       bool
+	selectors map[string]struct{}
+}
+
+// SetRuntimeSelectors sets the debug selectors enabled for loggers created
+// with WithRuntimeSelectors, replacing any previously set. If selectors is
+// empty, or contains "*", debug messages are logged for all selectors.
+//
+// Runtime selectors can only further restrict the selectors configured at
+// startup, and debug messages are only logged if the log level is debug.
+func SetRuntimeSelectors(selectors []string) {
+	set := &selectorSet{selectors: make(map[string]struct{})}
+	for _, selector := range selectors {
+		selector = strings.TrimSpace(selector)
+		switch selector {
+		case "":
+			continue
+		case "*":
+			set.all = true
+		}
+		set.selectors[selector] = struct{}{}
+	}
+	if len(set.selectors) == 0 || set.all {
+		set = nil
+	}
+	runtimeSelectors.Store(set)
+}
+
+// RuntimeSelectors returns the debug selectors set with SetRuntimeSelectors,
+// sorted, or nil if all selectors are enabled.
+func RuntimeSelectors() []string {
+	set := runtimeSelectors.Load()
+	if set == nil {
+		return nil
+	}
+	selectors := make([]string, 0, len(set.selectors))
+	for selector := range set.selectors {
+		selectors = append(selectors, selector)
+	}
+	slices.Sort(selectors)
+	return selectors
+}
+
+// WithRuntimeSelectors returns a logp.LogOption which filters debug messages
+// by the selectors set with SetRuntimeSelectors.
+func WithRuntimeSelectors() logp.LogOption {
+	return zap.WrapCore(func(in zapcore.Core) zapcore.Core {
+		return runtimeSelectorCore{in}
+	})
+}
+
+type runtimeSelectorCore struct {
+	zapcore.Core
+}
+
+func (c runtimeSelectorCore) With(fields []zapcore.Field) zapcore.Core {
+	return runtimeSelectorCore{c.Core.With(fields)}
+}
+
+func (c runtimeSelectorCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.Level == zapcore.DebugLevel {
+		if set := runtimeSelectors.Load(); set != nil {
+			if _, ok := set.selectors[ent.LoggerName]; !ok {
+				return ce
+			}
+		}
+	}
+	return c.Core.Check(ent, ce)
+}
@@ -0,0 +1,60 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logs_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/elastic/apm-server/internal/logs"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestWithRuntimeSelectors(t *testing.T) {
+	t.Cleanup(func() { logs.SetRuntimeSelectors(nil) })
+
+	core, observed := observer.New(zapcore.DebugLevel)
+	logger := logptest.NewTestingLogger(t, "", zap.WrapCore(func(in zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(in, core)
+	})).WithOptions(logs.WithRuntimeSelectors())
+
+	logger.Named("a").Debug("hello")
+	logger.Named("b").Debug("hello")
+	assert.Len(t, observed.TakeAll(), 2)
+
+	logs.SetRuntimeSelectors([]string{"a", " "})
+	assert.Equal(t, []string{"a"}, logs.RuntimeSelectors())
+	logger.Named("a").Debug("hello")
+	logger.Named("b").Debug("hello")
+	logger.Named("b").With(zap.String("k", "v")).Debug("hello")
+	logger.Named("b").Info("hello")
+	entries := observed.TakeAll()
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, "a", entries[0].LoggerName)
+		assert.Equal(t, zapcore.InfoLevel, entries[1].Level)
+	}
+
+	logs.SetRuntimeSelectors([]string{"a", "*"})
+	assert.Nil(t, logs.RuntimeSelectors())
+	logger.Named("b").Debug("hello")
+	assert.Equal(t, 1, observed.Len())
+}
@@ -0,0 +1,73 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package modelprocessor
+
+import (
+	"context"
+
+	"github.com/elastic/apm-data/model/modelpb"
+)
+
+// DataStreamRoutingRule holds a rule for overriding the data stream
+// namespace and dataset of matching events.
+//
+// An event matches a rule if it matches the rule's EventMatcher.
+type DataStreamRoutingRule struct {
+	EventMatcher
+
+	// Namespace holds the namespace for matching events, if non-empty.
+	Namespace string
+
+	// Dataset holds the dataset for matching events, if non-empty.
+	Dataset string
+}
+
+// DataStreamRouter is a model.BatchProcessor that overrides the data stream
+// namespace and dataset of events, according to the first rule they match.
+// Events matching no rule are left unmodified.
+//
+// DataStreamRouter must run after modelprocessor.SetDataStream, so that
+// the rules take precedence over the server's default namespace and any
+// namespace or dataset specified by agents.
+type DataStreamRouter struct {
+	Rules []DataStreamRoutingRule
+}
+
+// ProcessBatch sets the data stream namespace and dataset of events in b
+// which match one of the routing rules.
+func (r *DataStreamRouter) ProcessBatch(ctx context.Context, b *modelpb.Batch) error {
+	for _, event := range *b {
+		for i := range r.Rules {
+			rule := &r.Rules[i]
+			if !rule.Matches(event) {
+				continue
+			}
+			if event.DataStream == nil {
+				event.DataStream = &modelpb.DataStream{}
+			}
+			if rule.Namespace != "" {
+				event.DataStream.Namespace = rule.Namespace
+			}
+			if rule.Dataset != "" {
+				event.DataStream.Dataset = rule.Dataset
+			}
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package modelprocessor_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-data/model/modelpb"
+	"github.com/elastic/apm-server/internal/model/modelprocessor"
+)
+
+func TestDataStreamRouter(t *testing.T) {
+	router := &modelprocessor.DataStreamRouter{Rules: []modelprocessor.DataStreamRoutingRule{{
+		EventMatcher: modelprocessor.EventMatcher{
+			ServiceName: []string{"checkout", "cart"},
+		},
+		Namespace: "teama",
+	}, {
+		EventMatcher: modelprocessor.EventMatcher{
+			ServiceEnvironment: []string{"staging"},
+			AgentName:          []string{"java"},
+		},
+		Namespace: "staging",
+	}, {
+		EventMatcher: modelprocessor.EventMatcher{
+			DataStreamType: []string{"logs"},
+			Labels:         map[string]string{"audit": "true"},
+		},
+		Dataset: "apm.audit",
+	}}}
+
+	newEvent := func(serviceName, environment, agentName, dataStreamType string) *modelpb.APMEvent {
+		return &modelpb.APMEvent{
+			Service:    &modelpb.Service{Name: serviceName, Environment: environment},
+			Agent:      &modelpb.Agent{Name: agentName},
+			DataStream: &modelpb.DataStream{Type: dataStreamType, Dataset: "apm", Namespace: "default"},
+		}
+	}
+	audit := newEvent("backend", "production", "go", "logs")
+	audit.Labels = modelpb.Labels{"audit": {Value: "true"}}
+
+	batch := modelpb.Batch{
+		newEvent("checkout", "staging", "java", "traces"),
+		newEvent("backend", "staging", "java", "traces"),
+		newEvent("backend", "staging", "nodejs", "traces"),
+		audit,
+		{},
+	}
+	require.NoError(t, router.ProcessBatch(context.Background(), &batch))
+
+	var dataStreams []*modelpb.DataStream
+	for _, event := range batch {
+		dataStreams = append(dataStreams, event.DataStream)
+	}
+	assert.Equal(t, []*modelpb.DataStream{
+		{Type: "traces", Dataset: "apm", Namespace: "teama"},
+		{Type: "traces", Dataset: "apm", Namespace: "staging"},
+		{Type: "traces", Dataset: "apm", Namespace: "default"},
+		{Type: "logs", Dataset: "apm.audit", Namespace: "default"},
+		nil,
+	}, dataStreams)
+}
@@ -0,0 +1,87 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package modelprocessor
+
+import (
+	"slices"
+	"strconv"
+
+	"github.com/elastic/apm-data/model/modelpb"
+)
+
+// EventMatcher holds conditions on event fields, shared by the rules
+// of processors which treat events differently depending on their
+// service, agent, data stream type or labels.
+//
+// An event matches if it matches all of the non-empty conditions.
+// Conditions with multiple values match if any of the values match.
+//
+// Labels conditions match string labels with the given value, or with
+// the value among their values, and numeric labels whose value, or one
+// of whose values, equals the condition parsed as a number.
+type EventMatcher struct {
+	ServiceName        []string
+	ServiceEnvironment []string
+	AgentName          []string
+	DataStreamType     []string
+	Labels             map[string]string
+}
+
+// Matches reports whether event matches all of m's conditions.
+func (m *EventMatcher) Matches(event *modelpb.APMEvent) bool {
+	if len(m.ServiceName) > 0 && !slices.Contains(m.ServiceName, event.GetService().GetName()) {
+		return false
+	}
+	if len(m.ServiceEnvironment) > 0 && !slices.Contains(m.ServiceEnvironment, event.GetService().GetEnvironment()) {
+		return false
+	}
+	if len(m.AgentName) > 0 && !slices.Contains(m.AgentName, event.GetAgent().GetName()) {
+		return false
+	}
+	if len(m.DataStreamType) > 0 && !slices.Contains(m.DataStreamType, event.GetDataStream().GetType()) {
+		return false
+	}
+	for k, v := range m.Labels {
+		if !labelMatches(event, k, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// labelMatches reports whether event has a string or numeric label
+// with the key k and the value v.
+func labelMatches(event *modelpb.APMEvent, k, v string) bool {
+	if label, ok := event.Labels[k]; ok {
+		if len(label.Values) > 0 {
+			return slices.Contains(label.Values, v)
+		}
+		return label.Value == v
+	}
+	if label, ok := event.NumericLabels[k]; ok {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return false
+		}
+		if len(label.Values) > 0 {
+			return slices.Contains(label.Values, f)
+		}
+		return label.Value == f
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package modelprocessor_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/apm-data/model/modelpb"
+	"github.com/elastic/apm-server/internal/model/modelprocessor"
+)
+
+func TestEventMatcher(t *testing.T) {
+	event := &modelpb.APMEvent{
+		Service:    &modelpb.Service{Name: "checkout", Environment: "production"},
+		Agent:      &modelpb.Agent{Name: "java"},
+		DataStream: &modelpb.DataStream{Type: "traces"},
+		Labels: modelpb.Labels{
+			"team": {Value: "payments"},
+			"tags": {Values: []string{"a", "b"}},
+		},
+		NumericLabels: modelpb.NumericLabels{
+			"shard":  {Value: 3},
+			"shards": {Values: []float64{1, 2.5}},
+		},
+	}
+	for name, test := range map[string]struct {
+		matcher modelprocessor.EventMatcher
+		matches bool
+	}{
+		"empty":                   {matches: true},
+		"service_name":            {matcher: modelprocessor.EventMatcher{ServiceName: []string{"cart", "checkout"}}, matches: true},
+		"service_name_mismatch":   {matcher: modelprocessor.EventMatcher{ServiceName: []string{"cart"}}},
+		"service_environment":     {matcher: modelprocessor.EventMatcher{ServiceEnvironment: []string{"staging"}}},
+		"agent_name":              {matcher: modelprocessor.EventMatcher{AgentName: []string{"java"}}, matches: true},
+		"data_stream_type":        {matcher: modelprocessor.EventMatcher{DataStreamType: []string{"logs"}}},
+		"labels":                  {matcher: modelprocessor.EventMatcher{Labels: map[string]string{"team": "payments"}}, matches: true},
+		"labels_mismatch":         {matcher: modelprocessor.EventMatcher{Labels: map[string]string{"team": "search"}}},
+		"labels_missing":          {matcher: modelprocessor.EventMatcher{Labels: map[string]string{"tier": ""}}},
+		"labels_values":           {matcher: modelprocessor.EventMatcher{Labels: map[string]string{"tags": "b"}}, matches: true},
+		"labels_values_mismatch":  {matcher: modelprocessor.EventMatcher{Labels: map[string]string{"tags": "a,b"}}},
+		"numeric_labels":          {matcher: modelprocessor.EventMatcher{Labels: map[string]string{"shard": "3.0"}}, matches: true},
+		"numeric_labels_mismatch": {matcher: modelprocessor.EventMatcher{Labels: map[string]string{"shard": "three"}}},
+		"numeric_labels_values":   {matcher: modelprocessor.EventMatcher{Labels: map[string]string{"shards": "2.5"}}, matches: true},
+		"all": {
+			matcher: modelprocessor.EventMatcher{
+				ServiceName:        []string{"checkout"},
+				ServiceEnvironment: []string{"production"},
+				AgentName:          []string{"java"},
+				DataStreamType:     []string{"traces"},
+				Labels:             map[string]string{"team": "payments"},
+			},
+			matches: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.matches, test.matcher.Matches(event))
+		})
+	}
+	assert.True(t, (&modelprocessor.EventMatcher{}).Matches(&modelpb.APMEvent{}))
+}
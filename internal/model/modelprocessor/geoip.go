@@ -0,0 +1,236 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package modelprocessor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/oschwald/maxminddb-golang"
+
+	"github.com/elastic/apm-data/model/modelpb"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// geoIPReloadDelay is the time to wait after the last change to the
+// directory holding the GeoIP database before reloading it, so that
+// a database which is still being written is not loaded.
+const geoIPReloadDelay = 500 * time.Millisecond
+
+// GeoIP is a model.BatchProcessor that enriches events with the geo
+// location of their client.ip and source.ip addresses, looked up in a
+// MaxMind-format (GeoIP2 or GeoLite2 City or Country) database.
+//
+// The model has no geo fields, so locations are recorded as labels
+// prefixed with "client_geo_" or "source_geo_": country_iso_code,
+// country_name, continent_name, region_iso_code, region_name and
+// city_name, and the numeric labels location_lat and location_lon.
+// Names are recorded in English.
+//
+// The database is reloaded when it changes, while Run is running.
+type GeoIP struct {
+	path   string
+	logger *logp.Logger
+	db     atomic.Pointer[geoIPDatabase]
+}
+
+type geoIPDatabase struct {
+	reader *maxminddb.Reader
+	info   os.FileInfo
+}
+
+// geoIPRecord holds the fields of a GeoIP2 City or Country database
+// record which are recorded in events.
+type geoIPRecord struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Continent struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"continent"`
+	Country struct {
+		IsoCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		IsoCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	Location struct {
+		Latitude  *float64 `maxminddb:"latitude"`
+		Longitude *float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+}
+
+// NewGeoIP returns a new GeoIP which looks up addresses in the
+// database at path, returning an error if it cannot be loaded.
+func NewGeoIP(path string, logger *logp.Logger) (*GeoIP, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	g := &GeoIP{path: path, logger: logger}
+	db, err := g.load()
+	if err != nil {
+		return nil, err
+	}
+	g.db.Store(db)
+	return g, nil
+}
+
+// load reads and verifies the database.
+//
+// The database is read into memory rather than memory-mapped, as the
+// file may be modified in place while it is in use.
+func (g *GeoIP) load() (*geoIPDatabase, error) {
+	info, err := os.Stat(g.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load GeoIP database: %w", err)
+	}
+	data, err := os.ReadFile(g.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load GeoIP database: %w", err)
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load GeoIP database %q: %w", g.path, err)
+	}
+	if err := reader.Verify(); err != nil {
+		return nil, fmt.Errorf("failed to load GeoIP database %q: %w", g.path, err)
+	}
+	return &geoIPDatabase{reader: reader, info: info}, nil
+}
+
+// Run watches the directory holding the database, reloading the
+// database when it is modified or replaced, until ctx is cancelled.
+//
+// The directory is watched rather than the file, so that the database
+// may be replaced by renaming a file over it, or by updating symlinks
+// as is done for Kubernetes volumes. If the new database cannot be
+// loaded, an error is logged and the previous database is kept.
+func (g *GeoIP) Run(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch GeoIP database: %w", err)
+	}
+	defer watcher.Close()
+	if err := watcher.Add(filepath.Dir(g.path)); err != nil {
+		return fmt.Errorf("failed to watch GeoIP database: %w", err)
+	}
+
+	timer := time.NewTimer(0)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watcher.Errors:
+			g.logger.With(logp.Error(err)).Warn("error watching GeoIP database")
+		case <-watcher.Events:
+			timer.Reset(geoIPReloadDelay)
+		case <-timer.C:
+			g.reload()
+		}
+	}
+}
+
+// reload reloads the database if the file has changed since it was
+// last loaded.
+func (g *GeoIP) reload() {
+	info, err := os.Stat(g.path)
+	if err != nil {
+		g.logger.With(logp.Error(err)).Warn("failed to reload GeoIP database")
+		return
+	}
+	if old := g.db.Load().info; os.SameFile(info, old) &&
+		info.ModTime().Equal(old.ModTime()) && info.Size() == old.Size() {
+		return
+	}
+	db, err := g.load()
+	if err != nil {
+		g.logger.With(logp.Error(err)).Warn("failed to reload GeoIP database")
+		return
+	}
+	g.db.Store(db)
+	g.logger.Infof("reloaded GeoIP database %q", g.path)
+}
+
+// ProcessBatch records the geo location of the client.ip and source.ip
+// of events in b as labels, for addresses found in the database.
+func (g *GeoIP) ProcessBatch(ctx context.Context, b *modelpb.Batch) error {
+	reader := g.db.Load().reader
+	for _, event := range *b {
+		if ip := event.GetClient().GetIp(); ip != nil {
+			g.enrich(reader, event, "client_geo_", ip)
+		}
+		if ip := event.GetSource().GetIp(); ip != nil {
+			g.enrich(reader, event, "source_geo_", ip)
+		}
+	}
+	return nil
+}
+
+func (g *GeoIP) enrich(reader *maxminddb.Reader, event *modelpb.APMEvent, prefix string, ip *modelpb.IP) {
+	addr := modelpb.IP2Addr(ip).Unmap()
+	if !addr.IsValid() || !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return
+	}
+	var record geoIPRecord
+	if err := reader.Lookup(net.IP(addr.AsSlice()), &record); err != nil {
+		g.logger.With(logp.Error(err)).Debugf("failed to look up %s in GeoIP database", addr)
+		return
+	}
+	setLabel := func(key, value string) {
+		if value == "" {
+			return
+		}
+		if event.Labels == nil {
+			event.Labels = make(modelpb.Labels)
+		}
+		event.Labels[prefix+key] = &modelpb.LabelValue{Value: value}
+	}
+	setNumericLabel := func(key string, value *float64) {
+		if value == nil {
+			return
+		}
+		if event.NumericLabels == nil {
+			event.NumericLabels = make(modelpb.NumericLabels)
+		}
+		event.NumericLabels[prefix+key] = &modelpb.NumericLabelValue{Value: *value}
+	}
+	setLabel("country_iso_code", record.Country.IsoCode)
+	setLabel("country_name", record.Country.Names["en"])
+	setLabel("continent_name", record.Continent.Names["en"])
+	setLabel("city_name", record.City.Names["en"])
+	if len(record.Subdivisions) > 0 {
+		if code := record.Subdivisions[0].IsoCode; code != "" && record.Country.IsoCode != "" {
+			setLabel("region_iso_code", record.Country.IsoCode+"-"+code)
+		}
+		setLabel("region_name", record.Subdivisions[0].Names["en"])
+	}
+	setNumericLabel("location_lat", record.Location.Latitude)
+	setNumericLabel("location_lon", record.Location.Longitude)
+}
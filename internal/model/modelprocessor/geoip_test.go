@@ -0,0 +1,213 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package modelprocessor_test
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-data/model/modelpb"
+	"github.com/elastic/apm-server/internal/model/modelprocessor"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+var londonRecord = map[string]any{
+	"city":         map[string]any{"names": map[string]any{"en": "London"}},
+	"continent":    map[string]any{"names": map[string]any{"en": "Europe"}},
+	"country":      map[string]any{"iso_code": "GB", "names": map[string]any{"en": "United Kingdom"}},
+	"subdivisions": []any{map[string]any{"iso_code": "ENG", "names": map[string]any{"en": "England"}}},
+	"location":     map[string]any{"latitude": 51.5142, "longitude": -0.0931},
+}
+
+func TestGeoIP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "GeoIP2-City.mmdb")
+	writeGeoIPDatabase(t, path, netip.MustParsePrefix("81.2.69.0/24"), londonRecord)
+	geoIP, err := modelprocessor.NewGeoIP(path, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+
+	batch := modelpb.Batch{{
+		Client: &modelpb.Client{Ip: modelpb.MustParseIP("81.2.69.142")},
+		Source: &modelpb.Source{Ip: modelpb.MustParseIP("81.2.69.160")},
+	}, {
+		// Addresses not in the database, and private addresses, are ignored.
+		Client: &modelpb.Client{Ip: modelpb.MustParseIP("81.2.70.1")},
+		Source: &modelpb.Source{Ip: modelpb.MustParseIP("10.0.0.1")},
+		Labels: modelpb.Labels{"a": {Value: "b"}},
+	}, {}}
+	require.NoError(t, geoIP.ProcessBatch(context.Background(), &batch))
+
+	expected := map[string]*modelpb.LabelValue{}
+	expectedNumeric := map[string]*modelpb.NumericLabelValue{}
+	for _, prefix := range []string{"client_geo_", "source_geo_"} {
+		expected[prefix+"city_name"] = &modelpb.LabelValue{Value: "London"}
+		expected[prefix+"continent_name"] = &modelpb.LabelValue{Value: "Europe"}
+		expected[prefix+"country_iso_code"] = &modelpb.LabelValue{Value: "GB"}
+		expected[prefix+"country_name"] = &modelpb.LabelValue{Value: "United Kingdom"}
+		expected[prefix+"region_iso_code"] = &modelpb.LabelValue{Value: "GB-ENG"}
+		expected[prefix+"region_name"] = &modelpb.LabelValue{Value: "England"}
+		expectedNumeric[prefix+"location_lat"] = &modelpb.NumericLabelValue{Value: 51.5142}
+		expectedNumeric[prefix+"location_lon"] = &modelpb.NumericLabelValue{Value: -0.0931}
+	}
+	assert.Equal(t, expected, map[string]*modelpb.LabelValue(batch[0].Labels))
+	assert.Equal(t, expectedNumeric, map[string]*modelpb.NumericLabelValue(batch[0].NumericLabels))
+	assert.Equal(t, map[string]*modelpb.LabelValue{"a": {Value: "b"}}, map[string]*modelpb.LabelValue(batch[1].Labels))
+	assert.Nil(t, batch[1].NumericLabels)
+	assert.Nil(t, batch[2].Labels)
+}
+
+func TestGeoIPReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "GeoIP2-Country.mmdb")
+	prefix := netip.MustParsePrefix("81.2.69.0/24")
+	writeGeoIPDatabase(t, path, prefix, map[string]any{"country": map[string]any{"iso_code": "GB"}})
+	logger, logs := logptest.NewTestingLoggerWithObserver(t, "")
+	geoIP, err := modelprocessor.NewGeoIP(path, logger)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- geoIP.Run(ctx) }()
+	defer func() {
+		cancel()
+		assert.NoError(t, <-done)
+	}()
+
+	countryISOCode := func() string {
+		batch := modelpb.Batch{{Client: &modelpb.Client{Ip: modelpb.MustParseIP("81.2.69.142")}}}
+		require.NoError(t, geoIP.ProcessBatch(context.Background(), &batch))
+		return batch[0].Labels["client_geo_country_iso_code"].GetValue()
+	}
+	assert.Equal(t, "GB", countryISOCode())
+
+	// Invalid databases are not loaded. The database is rewritten until
+	// the watcher has started, and the failure to reload it is logged.
+	assert.Eventually(t, func() bool {
+		require.NoError(t, os.WriteFile(path, []byte("invalid"), 0644))
+		return logs.FilterMessage("failed to reload GeoIP database").Len() > 0
+	}, 10*time.Second, time.Second)
+	assert.Equal(t, "GB", countryISOCode())
+
+	// Databases replaced by renaming are loaded.
+	tmp := filepath.Join(dir, "GeoIP2-Country.mmdb.tmp")
+	writeGeoIPDatabase(t, tmp, prefix, map[string]any{"country": map[string]any{"iso_code": "IE"}})
+	require.NoError(t, os.Rename(tmp, path))
+	assert.Eventually(t, func() bool {
+		return countryISOCode() == "IE"
+	}, 10*time.Second, 50*time.Millisecond)
+}
+
+func TestNewGeoIPInvalidDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "GeoIP2-City.mmdb")
+	_, err := modelprocessor.NewGeoIP(path, logptest.NewTestingLogger(t, ""))
+	assert.ErrorContains(t, err, "failed to load GeoIP database")
+
+	require.NoError(t, os.WriteFile(path, []byte("invalid"), 0644))
+	_, err = modelprocessor.NewGeoIP(path, logptest.NewTestingLogger(t, ""))
+	assert.ErrorContains(t, err, "failed to load GeoIP database")
+}
+
+// writeGeoIPDatabase writes an IPv4 MaxMind DB file to path, holding
+// record for the addresses in prefix.
+func writeGeoIPDatabase(t testing.TB, path string, prefix netip.Prefix, record map[string]any) {
+	// The search tree holds a node for each bit of the prefix, with
+	// 24-bit records. Each node's record for the prefix's next bit
+	// refers to the next node, or to the data section for the last
+	// bit; the other record refers to nodeCount, meaning no data.
+	nodeCount := prefix.Bits()
+	addr := prefix.Addr().As4()
+	var buf []byte
+	for i := 0; i < nodeCount; i++ {
+		next := i + 1
+		if next == nodeCount {
+			const dataSectionSeparatorSize = 16
+			next = nodeCount + dataSectionSeparatorSize // offset 0 in the data section
+		}
+		records := [2]int{nodeCount, nodeCount}
+		records[addr[i/8]>>(7-i%8)&1] = next
+		for _, r := range records {
+			buf = append(buf, byte(r>>16), byte(r>>8), byte(r))
+		}
+	}
+	buf = append(buf, make([]byte, 16)...)
+	buf = appendMMDBValue(buf, record)
+	buf = append(buf, "\xab\xcd\xefMaxMind.com"...)
+	buf = appendMMDBValue(buf, map[string]any{
+		"binary_format_major_version": uint32(2),
+		"binary_format_minor_version": uint32(0),
+		"build_epoch":                 uint32(0),
+		"database_type":               "GeoIP2-City",
+		"description":                 map[string]any{"en": "test"},
+		"ip_version":                  uint32(4),
+		"languages":                   []any{"en"},
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint32(24),
+	})
+	require.NoError(t, os.WriteFile(path, buf, 0644))
+}
+
+// appendMMDBValue appends v to b in the MaxMind DB data section format.
+// Only values with a size of less than 29 are supported.
+func appendMMDBValue(b []byte, v any) []byte {
+	control := func(typ, size int) {
+		if typ > 7 {
+			b = append(b, byte(size), byte(typ-7))
+		} else {
+			b = append(b, byte(typ<<5|size))
+		}
+	}
+	switch v := v.(type) {
+	case string:
+		control(2, len(v))
+		b = append(b, v...)
+	case float64:
+		control(3, 8)
+		b = binary.BigEndian.AppendUint64(b, math.Float64bits(v))
+	case uint32:
+		control(6, 4)
+		b = binary.BigEndian.AppendUint32(b, v)
+	case map[string]any:
+		control(7, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			b = appendMMDBValue(b, k)
+			b = appendMMDBValue(b, v[k])
+		}
+	case []any:
+		control(11, len(v))
+		for _, v := range v {
+			b = appendMMDBValue(b, v)
+		}
+	default:
+		panic("unsupported type")
+	}
+	return b
+}
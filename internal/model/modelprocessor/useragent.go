@@ -0,0 +1,49 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package modelprocessor
+
+import (
+	"context"
+
+	"github.com/mssola/useragent"
+
+	"github.com/elastic/apm-data/model/modelpb"
+)
+
+// SetUserAgentName is a model.BatchProcessor that parses user_agent.original,
+// setting user_agent.name to the name of the browser or bot, if it is not
+// already set.
+//
+// This removes the need for parsing user agents at ingest time, and allows
+// user agents to be parsed for outputs other than Elasticsearch.
+type SetUserAgentName struct{}
+
+// ProcessBatch sets user_agent.name for events in b with a non-empty
+// user_agent.original and an empty user_agent.name.
+func (SetUserAgentName) ProcessBatch(ctx context.Context, b *modelpb.Batch) error {
+	for _, event := range *b {
+		ua := event.GetUserAgent()
+		if ua.GetOriginal() == "" || ua.Name != "" {
+			continue
+		}
+		if name, _ := useragent.New(ua.Original).Browser(); name != "" {
+			ua.Name = name
+		}
+	}
+	return nil
+}
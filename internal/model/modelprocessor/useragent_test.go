@@ -0,0 +1,52 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package modelprocessor_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/apm-data/model/modelpb"
+	"github.com/elastic/apm-server/internal/model/modelprocessor"
+)
+
+func TestSetUserAgentName(t *testing.T) {
+	batch := modelpb.Batch{{
+		UserAgent: &modelpb.UserAgent{
+			Original: "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		},
+	}, {
+		UserAgent: &modelpb.UserAgent{
+			Original: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:121.0) Gecko/20100101 Firefox/121.0",
+		},
+	}, {
+		UserAgent: &modelpb.UserAgent{Original: "curl/8.4.0", Name: "curl"},
+	}, {
+		UserAgent: &modelpb.UserAgent{Name: "agent"},
+	}, {}}
+	require.NoError(t, modelprocessor.SetUserAgentName{}.ProcessBatch(context.Background(), &batch))
+
+	var names []string
+	for _, event := range batch {
+		names = append(names, event.GetUserAgent().GetName())
+	}
+	assert.Equal(t, []string{"Chrome", "Firefox", "curl", "agent", ""}, names)
+}
@@ -0,0 +1,214 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package processors
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/elastic/apm-data/model/modelpb"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// condition reports whether an event matches.
+type condition func(*modelpb.APMEvent) bool
+
+// conditionConfig holds the configuration of a condition. Exactly one
+// of the fields must be set.
+type conditionConfig struct {
+	Equals    map[string]interface{} `config:"equals"`
+	Contains  map[string]interface{} `config:"contains"`
+	Regexp    map[string]interface{} `config:"regexp"`
+	HasFields []string               `config:"has_fields"`
+	And       []*config.C            `config:"and"`
+	Or        []*config.C            `config:"or"`
+	Not       *config.C              `config:"not"`
+}
+
+func newCondition(cfg *config.C) (condition, error) {
+	var c conditionConfig
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, err
+	}
+	var conditions []condition
+	if c.Equals != nil {
+		cond, err := newFieldCondition(c.Equals, func(value string) (func(string) bool, error) {
+			return func(s string) bool { return s == value }, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("equals: %w", err)
+		}
+		conditions = append(conditions, cond)
+	}
+	if c.Contains != nil {
+		cond, err := newFieldCondition(c.Contains, func(value string) (func(string) bool, error) {
+			return func(s string) bool { return strings.Contains(s, value) }, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("contains: %w", err)
+		}
+		conditions = append(conditions, cond)
+	}
+	if c.Regexp != nil {
+		cond, err := newFieldCondition(c.Regexp, func(value string) (func(string) bool, error) {
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, err
+			}
+			return re.MatchString, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("regexp: %w", err)
+		}
+		conditions = append(conditions, cond)
+	}
+	if c.HasFields != nil {
+		fields := make([]*field, len(c.HasFields))
+		for i, path := range c.HasFields {
+			f, err := parseField(path)
+			if err != nil {
+				return nil, fmt.Errorf("has_fields: %w", err)
+			}
+			fields[i] = f
+		}
+		conditions = append(conditions, func(event *modelpb.APMEvent) bool {
+			for _, f := range fields {
+				if !f.exists(event) {
+					return false
+				}
+			}
+			return true
+		})
+	}
+	if c.And != nil {
+		and, err := newConditions(c.And)
+		if err != nil {
+			return nil, fmt.Errorf("and: %w", err)
+		}
+		conditions = append(conditions, func(event *modelpb.APMEvent) bool {
+			for _, cond := range and {
+				if !cond(event) {
+					return false
+				}
+			}
+			return true
+		})
+	}
+	if c.Or != nil {
+		or, err := newConditions(c.Or)
+		if err != nil {
+			return nil, fmt.Errorf("or: %w", err)
+		}
+		conditions = append(conditions, func(event *modelpb.APMEvent) bool {
+			for _, cond := range or {
+				if cond(event) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	if c.Not != nil {
+		not, err := newCondition(c.Not)
+		if err != nil {
+			return nil, fmt.Errorf("not: %w", err)
+		}
+		conditions = append(conditions, func(event *modelpb.APMEvent) bool {
+			return !not(event)
+		})
+	}
+	switch len(conditions) {
+	case 0:
+		return nil, errors.New("condition must be specified")
+	case 1:
+		return conditions[0], nil
+	}
+	return nil, errors.New("only one condition may be specified; use and/or to combine conditions")
+}
+
+func newConditions(cfgs []*config.C) ([]condition, error) {
+	conditions := make([]condition, len(cfgs))
+	for i, cfg := range cfgs {
+		cond, err := newCondition(cfg)
+		if err != nil {
+			return nil, err
+		}
+		conditions[i] = cond
+	}
+	return conditions, nil
+}
+
+// newFieldCondition returns a condition that matches events for which
+// all fields in m are set, and their values match. The values of m are
+// passed to newMatcher to create a matcher for the field values.
+func newFieldCondition(m map[string]interface{}, newMatcher func(string) (func(string) bool, error)) (condition, error) {
+	type fieldMatcher struct {
+		field *field
+		match func(string) bool
+	}
+	flat := make(map[string]string)
+	flatten("", m, flat)
+	if len(flat) == 0 {
+		return nil, errors.New("no fields specified")
+	}
+	paths := make([]string, 0, len(flat))
+	for path := range flat {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	matchers := make([]fieldMatcher, len(paths))
+	for i, path := range paths {
+		f, err := parseField(path)
+		if err != nil {
+			return nil, err
+		}
+		match, err := newMatcher(flat[path])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		matchers[i] = fieldMatcher{field: f, match: match}
+	}
+	return func(event *modelpb.APMEvent) bool {
+		for _, m := range matchers {
+			v, ok := m.field.stringValue(event)
+			if !ok || !m.match(v) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// flatten flattens nested maps into dotted keys. Configuration keys
+// containing dots are unpacked as nested objects, so field names such
+// as "service.name" must be reassembled.
+func flatten(prefix string, m map[string]interface{}, out map[string]string) {
+	for k, v := range m {
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+		if nested, ok := v.(map[string]interface{}); ok {
+			flatten(k, nested, out)
+			continue
+		}
+		out[k] = fmt.Sprint(v)
+	}
+}
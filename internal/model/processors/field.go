@@ -0,0 +1,226 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package processors
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/elastic/apm-data/model/modelpb"
+)
+
+const (
+	labelsPrefix        = "labels."
+	numericLabelsPrefix = "numeric_labels."
+)
+
+var eventDescriptor = (&modelpb.APMEvent{}).ProtoReflect().Descriptor()
+
+// field identifies a field of modelpb.APMEvent by its dotted path,
+// using the protobuf field names, e.g. "transaction.name". Labels
+// are identified by "labels.<key>" and "numeric_labels.<key>".
+type field struct {
+	path string
+
+	// label holds the key of a string label, if the field is a label.
+	label string
+
+	// numericLabel holds the key of a numeric label, if the field is
+	// a numeric label.
+	numericLabel string
+
+	// fields holds the descriptors of the fields leading to, and
+	// including, the identified field, starting from APMEvent.
+	fields []protoreflect.FieldDescriptor
+}
+
+func parseField(path string) (*field, error) {
+	if key, ok := strings.CutPrefix(path, labelsPrefix); ok && key != "" {
+		return &field{path: path, label: key}, nil
+	}
+	if key, ok := strings.CutPrefix(path, numericLabelsPrefix); ok && key != "" {
+		return &field{path: path, numericLabel: key}, nil
+	}
+	f := &field{path: path}
+	md := eventDescriptor
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		fd := md.Fields().ByName(protoreflect.Name(part))
+		if fd == nil {
+			return nil, fmt.Errorf("unknown field %q", path)
+		}
+		f.fields = append(f.fields, fd)
+		if i == len(parts)-1 {
+			break
+		}
+		if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+			return nil, fmt.Errorf("unknown field %q: %q is not an object", path, strings.Join(parts[:i+1], "."))
+		}
+		md = fd.Message()
+	}
+	return f, nil
+}
+
+// isString reports whether the field holds a single string value.
+func (f *field) isString() bool {
+	if f.label != "" {
+		return true
+	}
+	last := f.fields[len(f.fields)-1]
+	return last.Kind() == protoreflect.StringKind && !last.IsList()
+}
+
+// compatible reports whether the value of f may be moved to other.
+func (f *field) compatible(other *field) bool {
+	switch {
+	case f.label != "" || other.label != "":
+		return f.isString() && other.isString()
+	case f.numericLabel != "" || other.numericLabel != "":
+		return f.numericLabel != "" && other.numericLabel != ""
+	}
+	a, b := f.fields[len(f.fields)-1], other.fields[len(other.fields)-1]
+	if a.Kind() != b.Kind() || a.Cardinality() != b.Cardinality() || a.IsMap() != b.IsMap() {
+		return false
+	}
+	if a.Kind() == protoreflect.MessageKind {
+		return a.Message().FullName() == b.Message().FullName()
+	}
+	return true
+}
+
+// parent returns the message holding the field's value, or false if
+// the message does not exist and create is false.
+func (f *field) parent(event *modelpb.APMEvent, create bool) (protoreflect.Message, bool) {
+	m := event.ProtoReflect()
+	for _, fd := range f.fields[:len(f.fields)-1] {
+		if !create && !m.Has(fd) {
+			return nil, false
+		}
+		m = m.Mutable(fd).Message()
+	}
+	return m, true
+}
+
+// exists reports whether the field is set in event.
+func (f *field) exists(event *modelpb.APMEvent) bool {
+	switch {
+	case f.label != "":
+		_, ok := event.Labels[f.label]
+		return ok
+	case f.numericLabel != "":
+		_, ok := event.NumericLabels[f.numericLabel]
+		return ok
+	}
+	m, ok := f.parent(event, false)
+	return ok && m.Has(f.fields[len(f.fields)-1])
+}
+
+// stringValue returns the value of the field formatted as a string,
+// or false if the field is not set.
+func (f *field) stringValue(event *modelpb.APMEvent) (string, bool) {
+	switch {
+	case f.label != "":
+		v, ok := event.Labels[f.label]
+		if !ok {
+			return "", false
+		}
+		if len(v.Values) > 0 {
+			return strings.Join(v.Values, ","), true
+		}
+		return v.Value, true
+	case f.numericLabel != "":
+		v, ok := event.NumericLabels[f.numericLabel]
+		if !ok {
+			return "", false
+		}
+		return strconv.FormatFloat(v.Value, 'f', -1, 64), true
+	}
+	m, ok := f.parent(event, false)
+	if !ok {
+		return "", false
+	}
+	last := f.fields[len(f.fields)-1]
+	if !m.Has(last) {
+		return "", false
+	}
+	return m.Get(last).String(), true
+}
+
+// setString sets the field to s. The field must be a string field.
+func (f *field) setString(event *modelpb.APMEvent, s string) {
+	if f.label != "" {
+		if event.Labels == nil {
+			event.Labels = make(modelpb.Labels)
+		}
+		event.Labels[f.label] = &modelpb.LabelValue{Value: s}
+		return
+	}
+	m, _ := f.parent(event, true)
+	m.Set(f.fields[len(f.fields)-1], protoreflect.ValueOfString(s))
+}
+
+// clear unsets the field.
+func (f *field) clear(event *modelpb.APMEvent) {
+	switch {
+	case f.label != "":
+		delete(event.Labels, f.label)
+		return
+	case f.numericLabel != "":
+		delete(event.NumericLabels, f.numericLabel)
+		return
+	}
+	if m, ok := f.parent(event, false); ok {
+		m.Clear(f.fields[len(f.fields)-1])
+	}
+}
+
+// moveTo moves the value of the field to other, which must be
+// compatible. moveTo does nothing if the field is not set, or if
+// other is the same field.
+func (f *field) moveTo(event *modelpb.APMEvent, other *field) {
+	if f.path == other.path || !f.exists(event) {
+		return
+	}
+	switch {
+	case f.label != "" && other.label != "":
+		v := event.Labels[f.label]
+		delete(event.Labels, f.label)
+		event.Labels[other.label] = v
+		return
+	case f.numericLabel != "":
+		v := event.NumericLabels[f.numericLabel]
+		delete(event.NumericLabels, f.numericLabel)
+		event.NumericLabels[other.numericLabel] = v
+		return
+	case f.label != "" || other.label != "":
+		s, _ := f.stringValue(event)
+		f.clear(event)
+		other.setString(event, s)
+		return
+	}
+	// Clear the field before creating the destination's parents,
+	// which may include the field itself.
+	from, _ := f.parent(event, false)
+	v := from.Get(f.fields[len(f.fields)-1])
+	from.Clear(f.fields[len(f.fields)-1])
+	to, _ := other.parent(event, true)
+	to.Set(other.fields[len(other.fields)-1], v)
+}
@@ -0,0 +1,333 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package processors provides a declaratively configured pipeline of
+// processors for filtering and transforming events before they are
+// processed further and indexed.
+//
+// Processors are configured as a list, each entry having a single key
+// naming the processor type, and are applied to each event in order:
+//
+//   - drop_event: drops events.
+//   - drop_fields: unsets the fields listed in "fields".
+//   - rename: moves the value of each "from" field to the "to" field.
+//   - add_labels: sets the string labels in "labels".
+//   - truncate_fields: truncates the string fields listed in "fields"
+//     to "max_characters" characters.
+//
+// Each processor may have a "when" condition, in which case it is only
+// applied to events matching the condition. Conditions are one of:
+// "equals", "contains" and "regexp", mapping field names to values;
+// "has_fields", listing field names; and "and", "or" and "not" for
+// combining conditions.
+//
+// Fields are identified by their dotted protobuf field names, e.g.
+// "transaction.name" or "http.request.method". String and numeric
+// labels are identified by "labels.<key>" and "numeric_labels.<key>".
+package processors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+
+	"github.com/elastic/apm-data/model/modelpb"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// Pipeline is a modelpb.BatchProcessor which applies a sequence of
+// declaratively configured processors to each event, removing events
+// that are dropped from the batch.
+type Pipeline struct {
+	processors []*processor
+}
+
+type processor struct {
+	when  condition
+	apply func(*modelpb.APMEvent) bool // returns false if the event should be dropped
+	attrs metric.MeasurementOption
+
+	applied metric.Int64Counter
+	dropped metric.Int64Counter
+}
+
+type newProcessorFunc func(*config.C) (func(*modelpb.APMEvent) bool, error)
+
+var processorTypes = map[string]newProcessorFunc{
+	"drop_event":      newDropEvent,
+	"drop_fields":     newDropFields,
+	"rename":          newRename,
+	"add_labels":      newAddLabels,
+	"truncate_fields": newTruncateFields,
+}
+
+// New returns a new Pipeline for the given processor configurations.
+//
+// The number of events to which each processor was applied, and the
+// number of events each processor dropped, are recorded as metrics
+// with the processor's index and type as attributes.
+func New(cfgs []*config.C, mp metric.MeterProvider) (*Pipeline, error) {
+	if mp == nil {
+		mp = noop.NewMeterProvider()
+	}
+	meter := mp.Meter("github.com/elastic/apm-server/internal/model/processors")
+	applied, err := meter.Int64Counter("apm-server.processors.events.applied")
+	if err != nil {
+		return nil, err
+	}
+	dropped, err := meter.Int64Counter("apm-server.processors.events.dropped")
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Pipeline{processors: make([]*processor, len(cfgs))}
+	for i, cfg := range cfgs {
+		fields := cfg.GetFields()
+		if len(fields) != 1 {
+			return nil, fmt.Errorf("processor %d: expected exactly one processor type, got %d", i, len(fields))
+		}
+		typ := fields[0]
+		newProcessor, ok := processorTypes[typ]
+		if !ok {
+			return nil, fmt.Errorf("processor %d: unknown processor type %q", i, typ)
+		}
+		processorConfig, err := cfg.Child(typ, -1)
+		if err != nil {
+			return nil, fmt.Errorf("processor %d (%s): %w", i, typ, err)
+		}
+		var when struct {
+			When *config.C `config:"when"`
+		}
+		if err := processorConfig.Unpack(&when); err != nil {
+			return nil, fmt.Errorf("processor %d (%s): %w", i, typ, err)
+		}
+		proc := &processor{
+			attrs: metric.WithAttributeSet(attribute.NewSet(
+				attribute.Int("processor.index", i),
+				attribute.String("processor.type", typ),
+			)),
+			applied: applied,
+			dropped: dropped,
+		}
+		if when.When != nil {
+			if proc.when, err = newCondition(when.When); err != nil {
+				return nil, fmt.Errorf("processor %d (%s): invalid condition: %w", i, typ, err)
+			}
+		}
+		if proc.apply, err = newProcessor(processorConfig); err != nil {
+			return nil, fmt.Errorf("processor %d (%s): %w", i, typ, err)
+		}
+		p.processors[i] = proc
+	}
+	return p, nil
+}
+
+// ProcessBatch applies the processors to each event in b, in order,
+// removing dropped events from b.
+func (p *Pipeline) ProcessBatch(ctx context.Context, b *modelpb.Batch) error {
+	if len(p.processors) == 0 {
+		return nil
+	}
+	events := (*b)[:0]
+	for _, event := range *b {
+		if p.process(ctx, event) {
+			events = append(events, event)
+		}
+	}
+	clear((*b)[len(events):])
+	*b = events
+	return nil
+}
+
+// process applies the processors to event, returning false if
+// the event was dropped.
+func (p *Pipeline) process(ctx context.Context, event *modelpb.APMEvent) bool {
+	for _, proc := range p.processors {
+		if proc.when != nil && !proc.when(event) {
+			continue
+		}
+		proc.applied.Add(ctx, 1, proc.attrs)
+		if !proc.apply(event) {
+			proc.dropped.Add(ctx, 1, proc.attrs)
+			return false
+		}
+	}
+	return true
+}
+
+func newDropEvent(cfg *config.C) (func(*modelpb.APMEvent) bool, error) {
+	var c struct {
+		When *config.C `config:"when"`
+	}
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, err
+	}
+	if c.When == nil {
+		return nil, errors.New("when must be specified")
+	}
+	return func(*modelpb.APMEvent) bool { return false }, nil
+}
+
+func newDropFields(cfg *config.C) (func(*modelpb.APMEvent) bool, error) {
+	var c struct {
+		Fields []string `config:"fields" validate:"required"`
+	}
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, err
+	}
+	fields, err := parseFields(c.Fields)
+	if err != nil {
+		return nil, err
+	}
+	return func(event *modelpb.APMEvent) bool {
+		for _, f := range fields {
+			f.clear(event)
+		}
+		return true
+	}, nil
+}
+
+func newRename(cfg *config.C) (func(*modelpb.APMEvent) bool, error) {
+	var c struct {
+		Fields []struct {
+			From string `config:"from" validate:"required"`
+			To   string `config:"to" validate:"required"`
+		} `config:"fields" validate:"required"`
+	}
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, err
+	}
+	type rename struct{ from, to *field }
+	renames := make([]rename, len(c.Fields))
+	for i, r := range c.Fields {
+		from, err := parseField(r.From)
+		if err != nil {
+			return nil, err
+		}
+		to, err := parseField(r.To)
+		if err != nil {
+			return nil, err
+		}
+		if !from.compatible(to) {
+			return nil, fmt.Errorf("cannot rename %q to %q: incompatible types", r.From, r.To)
+		}
+		renames[i] = rename{from: from, to: to}
+	}
+	return func(event *modelpb.APMEvent) bool {
+		for _, r := range renames {
+			r.from.moveTo(event, r.to)
+		}
+		return true
+	}, nil
+}
+
+func newAddLabels(cfg *config.C) (func(*modelpb.APMEvent) bool, error) {
+	var c struct {
+		Labels map[string]interface{} `config:"labels" validate:"required"`
+	}
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, err
+	}
+	labels := make(map[string]string)
+	flatten("", c.Labels, labels)
+	return func(event *modelpb.APMEvent) bool {
+		if event.Labels == nil {
+			event.Labels = make(modelpb.Labels, len(labels))
+		}
+		for k, v := range labels {
+			event.Labels[k] = &modelpb.LabelValue{Value: v}
+		}
+		return true
+	}, nil
+}
+
+func newTruncateFields(cfg *config.C) (func(*modelpb.APMEvent) bool, error) {
+	var c struct {
+		Fields        []string `config:"fields" validate:"required"`
+		MaxCharacters int      `config:"max_characters" validate:"required,min=1"`
+	}
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, err
+	}
+	fields, err := parseFields(c.Fields)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		if !f.isString() {
+			return nil, fmt.Errorf("cannot truncate %q: not a string field", f.path)
+		}
+	}
+	return func(event *modelpb.APMEvent) bool {
+		for _, f := range fields {
+			if f.label != "" {
+				// Truncate each value of multi-value labels,
+				// rather than their joined string value.
+				if v, ok := event.Labels[f.label]; ok {
+					truncateLabel(v, c.MaxCharacters)
+				}
+				continue
+			}
+			s, ok := f.stringValue(event)
+			if !ok {
+				continue
+			}
+			if truncated, ok := truncate(s, c.MaxCharacters); ok {
+				f.setString(event, truncated)
+			}
+		}
+		return true
+	}, nil
+}
+
+// truncateLabel truncates the value, or each of the values,
+// of a string label to n characters.
+func truncateLabel(v *modelpb.LabelValue, n int) {
+	v.Value, _ = truncate(v.Value, n)
+	for i, s := range v.Values {
+		v.Values[i], _ = truncate(s, n)
+	}
+}
+
+// truncate truncates s to n characters, returning false
+// if s is not longer than n characters.
+func truncate(s string, n int) (string, bool) {
+	var i int
+	for pos := range s {
+		if i == n {
+			return s[:pos], true
+		}
+		i++
+	}
+	return s, false
+}
+
+func parseFields(paths []string) ([]*field, error) {
+	fields := make([]*field, len(paths))
+	for i, path := range paths {
+		f, err := parseField(path)
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = f
+	}
+	return fields, nil
+}
@@ -0,0 +1,296 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package processors_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata/metricdatatest"
+
+	"github.com/elastic/apm-data/model/modelpb"
+	"github.com/elastic/apm-server/internal/model/processors"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+func TestDropEvent(t *testing.T) {
+	p := newPipeline(t, nil, `
+- drop_event:
+    when:
+      or:
+        - equals:
+            transaction.name: "GET /healthz"
+        - regexp:
+            url.path: "^/internal/"
+`)
+	batch := modelpb.Batch{
+		{Message: "healthz", Transaction: &modelpb.Transaction{Name: "GET /healthz"}},
+		{Message: "orders", Transaction: &modelpb.Transaction{Name: "GET /orders"}},
+		{Message: "internal", Url: &modelpb.URL{Path: "/internal/status"}},
+		{Message: "other"},
+	}
+	require.NoError(t, p.ProcessBatch(context.Background(), &batch))
+	assert.Equal(t, []string{"orders", "other"}, messages(batch))
+}
+
+func TestDropFields(t *testing.T) {
+	p := newPipeline(t, nil, `
+- drop_fields:
+    fields: [labels.noisy, http.request.headers, user]
+`)
+	batch := modelpb.Batch{{
+		Labels: modelpb.Labels{"noisy": {Value: "x"}, "keep": {Value: "y"}},
+		Http: &modelpb.HTTP{Request: &modelpb.HTTPRequest{
+			Method:  "GET",
+			Headers: []*modelpb.HTTPHeader{{Key: "Cookie", Value: []string{"secret"}}},
+		}},
+		User: &modelpb.User{Name: "alice"},
+	}, {}}
+	require.NoError(t, p.ProcessBatch(context.Background(), &batch))
+	require.Len(t, batch, 2)
+	assert.Equal(t, map[string]*modelpb.LabelValue{"keep": {Value: "y"}}, batch[0].Labels)
+	assert.Empty(t, batch[0].Http.Request.Headers)
+	assert.Equal(t, "GET", batch[0].Http.Request.Method)
+	assert.Nil(t, batch[0].User)
+}
+
+func TestRename(t *testing.T) {
+	p := newPipeline(t, nil, `
+- rename:
+    fields:
+      - from: labels.old
+        to: labels.new
+      - from: numeric_labels.old
+        to: numeric_labels.new
+      - from: labels.tenant
+        to: service.environment
+`)
+	batch := modelpb.Batch{{
+		Labels:        modelpb.Labels{"old": {Values: []string{"a", "b"}}, "tenant": {Value: "acme"}},
+		NumericLabels: modelpb.NumericLabels{"old": {Value: 1}},
+	}}
+	require.NoError(t, p.ProcessBatch(context.Background(), &batch))
+	assert.Equal(t, map[string]*modelpb.LabelValue{"new": {Values: []string{"a", "b"}}}, batch[0].Labels)
+	assert.Equal(t, map[string]*modelpb.NumericLabelValue{"new": {Value: 1}}, batch[0].NumericLabels)
+	assert.Equal(t, "acme", batch[0].Service.Environment)
+}
+
+func TestRenameSameField(t *testing.T) {
+	p := newPipeline(t, nil, `
+- rename:
+    fields:
+      - from: labels.same
+        to: labels.same
+      - from: message
+        to: message
+      - from: service.target.name
+        to: service.target.type
+`)
+	batch := modelpb.Batch{{
+		Message: "hello",
+		Labels:  modelpb.Labels{"same": {Value: "x"}},
+		Service: &modelpb.Service{Target: &modelpb.ServiceTarget{Name: "db"}},
+	}}
+	require.NoError(t, p.ProcessBatch(context.Background(), &batch))
+	assert.Equal(t, "hello", batch[0].Message)
+	assert.Equal(t, map[string]*modelpb.LabelValue{"same": {Value: "x"}}, batch[0].Labels)
+	assert.Empty(t, batch[0].Service.Target.Name)
+	assert.Equal(t, "db", batch[0].Service.Target.Type)
+}
+
+func TestAddLabels(t *testing.T) {
+	p := newPipeline(t, nil, `
+- add_labels:
+    labels:
+      team: checkout
+    when:
+      equals:
+        service.name: cart
+`)
+	batch := modelpb.Batch{
+		{Service: &modelpb.Service{Name: "cart"}},
+		{Service: &modelpb.Service{Name: "search"}},
+	}
+	require.NoError(t, p.ProcessBatch(context.Background(), &batch))
+	assert.Equal(t, map[string]*modelpb.LabelValue{"team": {Value: "checkout"}}, batch[0].Labels)
+	assert.Nil(t, batch[1].Labels)
+}
+
+func TestTruncateFields(t *testing.T) {
+	p := newPipeline(t, nil, `
+- truncate_fields:
+    fields: [message, labels.long]
+    max_characters: 3
+`)
+	batch := modelpb.Batch{{
+		Message: "héllo",
+		Labels:  modelpb.Labels{"long": {Value: "abcdef"}},
+	}, {
+		Message: "ok",
+		Labels:  modelpb.Labels{"long": {Values: []string{"abcdef", "gh"}}},
+	}}
+	require.NoError(t, p.ProcessBatch(context.Background(), &batch))
+	assert.Equal(t, "hél", batch[0].Message)
+	assert.Equal(t, "abc", batch[0].Labels["long"].Value)
+	assert.Equal(t, "ok", batch[1].Message)
+	assert.Equal(t, []string{"abc", "gh"}, batch[1].Labels["long"].Values)
+}
+
+func TestConditions(t *testing.T) {
+	event := &modelpb.APMEvent{
+		Service: &modelpb.Service{Name: "cart", Environment: "production"},
+		Http:    &modelpb.HTTP{Response: &modelpb.HTTPResponse{StatusCode: 200}},
+		Labels:  modelpb.Labels{"tier": {Value: "gold"}},
+	}
+	for name, test := range map[string]struct {
+		when  string
+		match bool
+	}{
+		"equals":             {`equals: {service.name: cart}`, true},
+		"equals_numeric":     {`equals: {http.response.status_code: 200}`, true},
+		"equals_mismatch":    {`equals: {service.name: search}`, false},
+		"equals_unset":       {`equals: {transaction.name: foo}`, false},
+		"contains":           {`contains: {service.environment: prod}`, true},
+		"regexp":             {`regexp: {labels.tier: "^g"}`, true},
+		"has_fields":         {`has_fields: [service.name, labels.tier]`, true},
+		"has_fields_missing": {`has_fields: [service.version]`, false},
+		"not":                {`not: {equals: {service.name: cart}}`, false},
+		"and":                {`and: [{equals: {service.name: cart}}, {equals: {labels.tier: silver}}]`, false},
+		"or":                 {`or: [{equals: {service.name: search}}, {equals: {labels.tier: gold}}]`, true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			p := newPipeline(t, nil, "- drop_event:\n    when: {"+test.when+"}\n")
+			batch := modelpb.Batch{event}
+			require.NoError(t, p.ProcessBatch(context.Background(), &batch))
+			assert.Equal(t, test.match, len(batch) == 0)
+		})
+	}
+}
+
+func TestPipelineMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	p := newPipeline(t, mp, `
+- add_labels:
+    labels: {a: b}
+- drop_event:
+    when:
+      equals:
+        message: drop
+`)
+	batch := modelpb.Batch{{Message: "drop"}, {Message: "keep"}}
+	require.NoError(t, p.ProcessBatch(context.Background(), &batch))
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	addLabels := attribute.NewSet(attribute.Int("processor.index", 0), attribute.String("processor.type", "add_labels"))
+	dropEvent := attribute.NewSet(attribute.Int("processor.index", 1), attribute.String("processor.type", "drop_event"))
+	metricdatatest.AssertEqual(t, metricdata.Metrics{
+		Name: "apm-server.processors.events.applied",
+		Data: metricdata.Sum[int64]{
+			Temporality: metricdata.CumulativeTemporality,
+			IsMonotonic: true,
+			DataPoints: []metricdata.DataPoint[int64]{
+				{Attributes: addLabels, Value: 2},
+				{Attributes: dropEvent, Value: 1},
+			},
+		},
+	}, rm.ScopeMetrics[0].Metrics[0], metricdatatest.IgnoreTimestamp())
+	metricdatatest.AssertEqual(t, metricdata.Metrics{
+		Name: "apm-server.processors.events.dropped",
+		Data: metricdata.Sum[int64]{
+			Temporality: metricdata.CumulativeTemporality,
+			IsMonotonic: true,
+			DataPoints: []metricdata.DataPoint[int64]{
+				{Attributes: dropEvent, Value: 1},
+			},
+		},
+	}, rm.ScopeMetrics[0].Metrics[1], metricdatatest.IgnoreTimestamp())
+}
+
+func TestNewErrors(t *testing.T) {
+	for name, test := range map[string]struct {
+		config string
+		expect string
+	}{
+		"unknown_type": {
+			config: "- uppercase: {}",
+			expect: `processor 0: unknown processor type "uppercase"`,
+		},
+		"unknown_field": {
+			config: "- drop_fields: {fields: [service.nme]}",
+			expect: `processor 0 (drop_fields): unknown field "service.nme"`,
+		},
+		"drop_event_no_condition": {
+			config: "- drop_event: {}",
+			expect: "processor 0 (drop_event): when must be specified",
+		},
+		"multiple_conditions": {
+			config: "- drop_event: {when: {equals: {message: a}, contains: {message: b}}}",
+			expect: "processor 0 (drop_event): invalid condition: only one condition may be specified; use and/or to combine conditions",
+		},
+		"invalid_regexp": {
+			config: "- drop_event: {when: {regexp: {message: '('}}}",
+			expect: "processor 0 (drop_event): invalid condition: regexp: message: error parsing regexp: missing closing ): `(`",
+		},
+		"rename_incompatible": {
+			config: "- rename: {fields: [{from: numeric_labels.a, to: message}]}",
+			expect: `processor 0 (rename): cannot rename "numeric_labels.a" to "message": incompatible types`,
+		},
+		"truncate_non_string": {
+			config: "- truncate_fields: {fields: [http.response.status_code], max_characters: 1}",
+			expect: `processor 0 (truncate_fields): cannot truncate "http.response.status_code": not a string field`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := processors.New(parseConfig(t, test.config), nil)
+			assert.EqualError(t, err, test.expect)
+		})
+	}
+}
+
+func newPipeline(t testing.TB, mp metric.MeterProvider, yaml string) *processors.Pipeline {
+	p, err := processors.New(parseConfig(t, yaml), mp)
+	require.NoError(t, err)
+	return p
+}
+
+func parseConfig(t testing.TB, yaml string) []*config.C {
+	var cfg struct {
+		Processors []*config.C `config:"processors"`
+	}
+	c, err := config.NewConfigWithYAML([]byte("processors:\n"+yaml), "")
+	require.NoError(t, err)
+	require.NoError(t, c.Unpack(&cfg))
+	return cfg.Processors
+}
+
+func messages(batch modelpb.Batch) []string {
+	var out []string
+	for _, event := range batch {
+		out = append(out, event.Message)
+	}
+	return out
+}
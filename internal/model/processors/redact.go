@@ -0,0 +1,387 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package processors
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/elastic/apm-data/model/modelpb"
+)
+
+const defaultRedactionReplacement = "[REDACTED]"
+
+// RedactionRule holds a rule for redacting the values of fields.
+type RedactionRule struct {
+	// Fields holds the fields whose values should be redacted.
+	//
+	// In addition to string fields, e.g. "url.query" or "span.db.statement",
+	// the following fields are supported: "http.request.headers",
+	// "http.response.headers", "http.request.cookies", "http.request.env",
+	// "labels", and "error.exception.message", which covers all exceptions
+	// and their causes. Redacting "url.query" or "url.path" also redacts
+	// the same component of "url.full" and "url.original".
+	Fields []string
+
+	// Keys optionally restricts redaction of headers, cookies, env and
+	// labels to those with the given keys, matched case-insensitively.
+	Keys []string
+
+	// Pattern optionally restricts redaction to the parts of values that
+	// match. If Pattern is nil, whole values are redacted.
+	Pattern *regexp.Regexp
+
+	// Hash controls whether values are replaced by their hex-encoded
+	// SHA-256 hash, rather than by Replacement.
+	Hash bool
+
+	// HashKey holds an optional key for hashing values with HMAC-SHA256.
+	HashKey []byte
+
+	// Replacement holds the replacement for masked values. If Replacement
+	// is empty, "[REDACTED]" is used.
+	Replacement string
+}
+
+// Redactor is a modelpb.BatchProcessor which redacts personal data from
+// events according to a list of rules.
+type Redactor struct {
+	rules    []*redactionRule
+	redacted metric.Int64Counter
+}
+
+type redactionRule struct {
+	targets []redactionTarget
+	keys    map[string]struct{}
+	pattern *regexp.Regexp
+	redact  func(string) string
+}
+
+// redactionTarget calls redact for each value of a field in event,
+// replacing the value with the result. Values of key/value fields are
+// only redacted if match returns true for the key. redactionTarget
+// returns the number of values changed.
+type redactionTarget func(event *modelpb.APMEvent, match func(key string) bool, redact func(string) string) int
+
+// NewRedactor returns a new Redactor for the given rules.
+//
+// The number of redacted values is recorded in the metric
+// "apm-server.redaction.values.redacted".
+func NewRedactor(rules []RedactionRule, mp metric.MeterProvider) (*Redactor, error) {
+	if mp == nil {
+		mp = noop.NewMeterProvider()
+	}
+	meter := mp.Meter("github.com/elastic/apm-server/internal/model/processors")
+	redacted, err := meter.Int64Counter("apm-server.redaction.values.redacted")
+	if err != nil {
+		return nil, err
+	}
+	r := &Redactor{rules: make([]*redactionRule, len(rules)), redacted: redacted}
+	for i, rule := range rules {
+		rr := &redactionRule{pattern: rule.Pattern}
+		for _, path := range rule.Fields {
+			target, err := newRedactionTarget(path)
+			if err != nil {
+				return nil, fmt.Errorf("redaction rule %d: %w", i, err)
+			}
+			rr.targets = append(rr.targets, target)
+		}
+		if len(rule.Keys) > 0 {
+			rr.keys = make(map[string]struct{}, len(rule.Keys))
+			for _, key := range rule.Keys {
+				rr.keys[strings.ToLower(key)] = struct{}{}
+			}
+		}
+		if rule.Hash {
+			rr.redact = hashValue(rule.HashKey)
+		} else {
+			replacement := rule.Replacement
+			if replacement == "" {
+				replacement = defaultRedactionReplacement
+			}
+			rr.redact = func(string) string { return replacement }
+		}
+		r.rules[i] = rr
+	}
+	return r, nil
+}
+
+// ProcessBatch redacts values from each event in the batch.
+func (r *Redactor) ProcessBatch(ctx context.Context, batch *modelpb.Batch) error {
+	var n int
+	for _, event := range *batch {
+		for _, rule := range r.rules {
+			n += rule.apply(event)
+		}
+	}
+	if n > 0 {
+		r.redacted.Add(ctx, int64(n))
+	}
+	return nil
+}
+
+func (r *redactionRule) apply(event *modelpb.APMEvent) int {
+	var n int
+	for _, target := range r.targets {
+		n += target(event, r.matchKey, r.redactValue)
+	}
+	return n
+}
+
+func (r *redactionRule) matchKey(key string) bool {
+	if r.keys == nil {
+		return true
+	}
+	_, ok := r.keys[strings.ToLower(key)]
+	return ok
+}
+
+func (r *redactionRule) redactValue(s string) string {
+	if r.pattern == nil {
+		return r.redact(s)
+	}
+	return r.pattern.ReplaceAllStringFunc(s, r.redact)
+}
+
+func hashValue(key []byte) func(string) string {
+	return func(s string) string {
+		var h hash.Hash
+		if len(key) > 0 {
+			h = hmac.New(sha256.New, key)
+		} else {
+			h = sha256.New()
+		}
+		h.Write([]byte(s))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+}
+
+func newRedactionTarget(path string) (redactionTarget, error) {
+	switch path {
+	case "http.request.headers":
+		return func(event *modelpb.APMEvent, match func(string) bool, redact func(string) string) int {
+			return redactHeaders(event.GetHttp().GetRequest().GetHeaders(), match, redact)
+		}, nil
+	case "http.response.headers":
+		return func(event *modelpb.APMEvent, match func(string) bool, redact func(string) string) int {
+			return redactHeaders(event.GetHttp().GetResponse().GetHeaders(), match, redact)
+		}, nil
+	case "http.request.cookies":
+		return func(event *modelpb.APMEvent, match func(string) bool, redact func(string) string) int {
+			return redactKeyValues(event.GetHttp().GetRequest().GetCookies(), match, redact)
+		}, nil
+	case "http.request.env":
+		return func(event *modelpb.APMEvent, match func(string) bool, redact func(string) string) int {
+			return redactKeyValues(event.GetHttp().GetRequest().GetEnv(), match, redact)
+		}, nil
+	case "labels":
+		return redactLabels, nil
+	case "error.exception.message":
+		return func(event *modelpb.APMEvent, _ func(string) bool, redact func(string) string) int {
+			if exception := event.GetError().GetException(); exception != nil {
+				return redactExceptionMessage(exception, redact)
+			}
+			return 0
+		}, nil
+	}
+	if key, ok := strings.CutPrefix(path, labelsPrefix); ok && key != "" {
+		return func(event *modelpb.APMEvent, _ func(string) bool, redact func(string) string) int {
+			return redactLabels(event, func(k string) bool { return k == key }, redact)
+		}, nil
+	}
+	f, err := parseField(path)
+	if err != nil {
+		return nil, err
+	}
+	if !f.isString() {
+		return nil, fmt.Errorf("field %q is not a string field", path)
+	}
+	target := func(event *modelpb.APMEvent, _ func(string) bool, redact func(string) string) int {
+		s, ok := f.stringValue(event)
+		if !ok {
+			return 0
+		}
+		if redacted := redact(s); redacted != s {
+			f.setString(event, redacted)
+			return 1
+		}
+		return 0
+	}
+	switch path {
+	case "url.query":
+		return redactURLComponent(target, urlQuery), nil
+	case "url.path":
+		return redactURLComponent(target, urlPath), nil
+	}
+	return target, nil
+}
+
+// redactURLComponent returns a redactionTarget which calls target, and
+// then redacts the component of url.full and url.original identified by
+// component, so the redacted value is not left in the full URL fields.
+func redactURLComponent(target redactionTarget, component func(u string) (start, end int)) redactionTarget {
+	return func(event *modelpb.APMEvent, match func(string) bool, redact func(string) string) int {
+		n := target(event, match, redact)
+		u := event.GetUrl()
+		if u == nil {
+			return n
+		}
+		for _, s := range []*string{&u.Full, &u.Original} {
+			start, end := component(*s)
+			if start == end {
+				continue
+			}
+			value := (*s)[start:end]
+			if redacted := redact(value); redacted != value {
+				*s = (*s)[:start] + redacted + (*s)[end:]
+				n++
+			}
+		}
+		return n
+	}
+}
+
+// urlQuery returns the offsets of the query string in u, excluding
+// the leading "?", or (0, 0) if u has no query string.
+func urlQuery(u string) (start, end int) {
+	i := strings.IndexByte(u, '?')
+	if i < 0 {
+		return 0, 0
+	}
+	start, end = i+1, len(u)
+	if i := strings.IndexByte(u[start:], '#'); i >= 0 {
+		end = start + i
+	}
+	return start, end
+}
+
+// urlPath returns the offsets of the path in u, which may be an absolute
+// URL or a relative URL such as an HTTP request target, or (0, 0) if u
+// has no path.
+func urlPath(u string) (start, end int) {
+	if i := strings.Index(u, "://"); i >= 0 && !strings.ContainsAny(u[:i], "/?#") {
+		authority := u[i+len("://"):]
+		j := strings.IndexAny(authority, "/?#")
+		if j < 0 || authority[j] != '/' {
+			return 0, 0
+		}
+		start = i + len("://") + j
+	}
+	end = len(u)
+	if i := strings.IndexAny(u[start:], "?#"); i >= 0 {
+		end = start + i
+	}
+	return start, end
+}
+
+func redactHeaders(headers []*modelpb.HTTPHeader, match func(string) bool, redact func(string) string) int {
+	var n int
+	for _, header := range headers {
+		if !match(header.Key) {
+			continue
+		}
+		for i, v := range header.Value {
+			if redacted := redact(v); redacted != v {
+				header.Value[i] = redacted
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func redactKeyValues(kvs []*modelpb.KeyValue, match func(string) bool, redact func(string) string) int {
+	var n int
+	for _, kv := range kvs {
+		if match(kv.Key) {
+			n += redactStructValue(kv.Value, redact)
+		}
+	}
+	return n
+}
+
+// redactStructValue redacts the string values within v, recursing
+// into lists and structs.
+func redactStructValue(v *structpb.Value, redact func(string) string) int {
+	switch kind := v.GetKind().(type) {
+	case *structpb.Value_StringValue:
+		if redacted := redact(kind.StringValue); redacted != kind.StringValue {
+			kind.StringValue = redacted
+			return 1
+		}
+	case *structpb.Value_ListValue:
+		var n int
+		for _, v := range kind.ListValue.GetValues() {
+			n += redactStructValue(v, redact)
+		}
+		return n
+	case *structpb.Value_StructValue:
+		var n int
+		for _, v := range kind.StructValue.GetFields() {
+			n += redactStructValue(v, redact)
+		}
+		return n
+	}
+	return 0
+}
+
+func redactLabels(event *modelpb.APMEvent, match func(string) bool, redact func(string) string) int {
+	var n int
+	for key, label := range event.Labels {
+		if label == nil || !match(key) {
+			continue
+		}
+		if label.Value != "" {
+			if redacted := redact(label.Value); redacted != label.Value {
+				label.Value = redacted
+				n++
+			}
+		}
+		for i, v := range label.Values {
+			if redacted := redact(v); redacted != v {
+				label.Values[i] = redacted
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func redactExceptionMessage(exception *modelpb.Exception, redact func(string) string) int {
+	var n int
+	if exception.Message != "" {
+		if redacted := redact(exception.Message); redacted != exception.Message {
+			exception.Message = redacted
+			n++
+		}
+	}
+	for _, cause := range exception.Cause {
+		n += redactExceptionMessage(cause, redact)
+	}
+	return n
+}
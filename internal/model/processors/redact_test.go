@@ -0,0 +1,189 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package processors_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata/metricdatatest"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/elastic/apm-data/model/modelpb"
+	"github.com/elastic/apm-server/internal/model/processors"
+)
+
+func TestRedactorMask(t *testing.T) {
+	r, err := processors.NewRedactor([]processors.RedactionRule{{
+		Fields: []string{"http.request.headers", "http.request.cookies", "labels"},
+		Keys:   []string{"authorization", "session_id", "email"},
+	}, {
+		Fields:      []string{"url.query", "url.full", "error.exception.message"},
+		Pattern:     regexp.MustCompile(`[\w.+-]+@[\w-]+\.[\w.]+`),
+		Replacement: "<email>",
+	}}, nil)
+	require.NoError(t, err)
+
+	batch := modelpb.Batch{{
+		Http: &modelpb.HTTP{Request: &modelpb.HTTPRequest{
+			Headers: []*modelpb.HTTPHeader{
+				{Key: "Authorization", Value: []string{"Bearer abc"}},
+				{Key: "Accept", Value: []string{"*/*"}},
+			},
+			Cookies: []*modelpb.KeyValue{
+				{Key: "session_id", Value: structpb.NewStringValue("123")},
+				{Key: "theme", Value: structpb.NewStringValue("dark")},
+			},
+		}},
+		Url: &modelpb.URL{
+			Full:  "https://example.com/?to=alice@example.com",
+			Query: "to=alice@example.com",
+		},
+		Labels: modelpb.Labels{
+			"email": {Value: "alice@example.com"},
+			"team":  {Value: "a"},
+		},
+		Error: &modelpb.Error{Exception: &modelpb.Exception{
+			Message: "no user bob@example.com",
+			Cause:   []*modelpb.Exception{{Message: "lookup alice@example.com failed"}},
+		}},
+	}, {}}
+	require.NoError(t, r.ProcessBatch(context.Background(), &batch))
+
+	event := batch[0]
+	assert.Equal(t, []string{"[REDACTED]"}, event.Http.Request.Headers[0].Value)
+	assert.Equal(t, []string{"*/*"}, event.Http.Request.Headers[1].Value)
+	assert.Equal(t, "[REDACTED]", event.Http.Request.Cookies[0].Value.GetStringValue())
+	assert.Equal(t, "dark", event.Http.Request.Cookies[1].Value.GetStringValue())
+	assert.Equal(t, "https://example.com/?to=<email>", event.Url.Full)
+	assert.Equal(t, "to=<email>", event.Url.Query)
+	assert.Equal(t, map[string]*modelpb.LabelValue{
+		"email": {Value: "[REDACTED]"},
+		"team":  {Value: "a"},
+	}, map[string]*modelpb.LabelValue(event.Labels))
+	assert.Equal(t, "no user <email>", event.Error.Exception.Message)
+	assert.Equal(t, "lookup <email> failed", event.Error.Exception.Cause[0].Message)
+}
+
+func TestRedactorHash(t *testing.T) {
+	r, err := processors.NewRedactor([]processors.RedactionRule{{
+		Fields:  []string{"span.db.statement", "labels.user"},
+		Pattern: regexp.MustCompile(`'[^']*'`),
+		Hash:    true,
+	}}, nil)
+	require.NoError(t, err)
+
+	batch := modelpb.Batch{{
+		Span: &modelpb.Span{Db: &modelpb.DB{
+			Statement: "SELECT * FROM users WHERE name = 'alice'",
+		}},
+		Labels: modelpb.Labels{"user": {Value: "'alice'"}},
+	}}
+	require.NoError(t, r.ProcessBatch(context.Background(), &batch))
+
+	sum := sha256.Sum256([]byte("'alice'"))
+	hash := hex.EncodeToString(sum[:])
+	assert.Equal(t, "SELECT * FROM users WHERE name = "+hash, batch[0].Span.Db.Statement)
+	assert.Equal(t, hash, batch[0].Labels["user"].Value)
+}
+
+func TestRedactorMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader(sdkmetric.WithTemporalitySelector(
+		func(ik sdkmetric.InstrumentKind) metricdata.Temporality {
+			return metricdata.DeltaTemporality
+		},
+	))
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	r, err := processors.NewRedactor([]processors.RedactionRule{{
+		Fields: []string{"url.path", "url.query"},
+	}}, mp)
+	require.NoError(t, err)
+
+	batch := modelpb.Batch{
+		{Url: &modelpb.URL{Path: "/a", Query: "b=c"}},
+		{Url: &modelpb.URL{Path: "/d"}},
+		{},
+	}
+	require.NoError(t, r.ProcessBatch(context.Background(), &batch))
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	require.Len(t, rm.ScopeMetrics[0].Metrics, 1)
+	metricdatatest.AssertEqual(t, metricdata.Metrics{
+		Name: "apm-server.redaction.values.redacted",
+		Data: metricdata.Sum[int64]{
+			Temporality: metricdata.DeltaTemporality,
+			IsMonotonic: true,
+			DataPoints:  []metricdata.DataPoint[int64]{{Value: 3}},
+		},
+	}, rm.ScopeMetrics[0].Metrics[0], metricdatatest.IgnoreTimestamp())
+}
+
+func TestRedactorURLComponents(t *testing.T) {
+	r, err := processors.NewRedactor([]processors.RedactionRule{{
+		Fields:  []string{"url.query"},
+		Pattern: regexp.MustCompile(`token=[^&]*`),
+	}, {
+		Fields:  []string{"url.path"},
+		Pattern: regexp.MustCompile(`users/[^/]+`),
+	}}, nil)
+	require.NoError(t, err)
+
+	batch := modelpb.Batch{{
+		Url: &modelpb.URL{
+			Original: "/users/alice/orders?token=abc&page=2",
+			Full:     "https://example.com/users/alice/orders?token=abc&page=2#top",
+			Path:     "/users/alice/orders",
+			Query:    "token=abc&page=2",
+		},
+	}, {
+		Url: &modelpb.URL{
+			Original: "/search?next=https://example.com/users/bob",
+			Full:     "https://example.com?next=/users/bob",
+		},
+	}, {}}
+	require.NoError(t, r.ProcessBatch(context.Background(), &batch))
+
+	url := batch[0].Url
+	assert.Equal(t, "/[REDACTED]/orders?[REDACTED]&page=2", url.Original)
+	assert.Equal(t, "https://example.com/[REDACTED]/orders?[REDACTED]&page=2#top", url.Full)
+	assert.Equal(t, "/[REDACTED]/orders", url.Path)
+	assert.Equal(t, "[REDACTED]&page=2", url.Query)
+
+	// Path rules do not apply to values in the query string.
+	url = batch[1].Url
+	assert.Equal(t, "/search?next=https://example.com/users/bob", url.Original)
+	assert.Equal(t, "https://example.com?next=/users/bob", url.Full)
+}
+
+func TestNewRedactorInvalidField(t *testing.T) {
+	_, err := processors.NewRedactor([]processors.RedactionRule{{Fields: []string{"url.nope"}}}, nil)
+	assert.EqualError(t, err, `redaction rule 0: unknown field "url.nope"`)
+
+	_, err = processors.NewRedactor([]processors.RedactionRule{{Fields: []string{"url.port"}}}, nil)
+	assert.EqualError(t, err, `redaction rule 0: field "url.port" is not a string field`)
+}
@@ -0,0 +1,48 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package netutil
+
+import (
+	"net"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// ProxyProtocolListener returns a net.Listener which accepts PROXY protocol
+// v1 and v2 headers on connections accepted by l, such that the connections'
+// RemoteAddr reports the client address sent by the proxy.
+//
+// If trusted is non-empty, only connections from trusted proxies may send
+// PROXY protocol headers; connections from other peers that send a header
+// are rejected. Connections without a header are accepted regardless.
+func ProxyProtocolListener(l net.Listener, trusted TrustedProxies, readHeaderTimeout time.Duration) net.Listener {
+	return &proxyproto.Listener{
+		Listener:          l,
+		ReadHeaderTimeout: readHeaderTimeout,
+		Policy: func(upstream net.Addr) (proxyproto.Policy, error) {
+			if len(trusted) == 0 {
+				return proxyproto.USE, nil
+			}
+			if ip, _ := SplitAddrPort(upstream.String()); ip.IsValid() && trusted.Contains(ip) {
+				return proxyproto.USE, nil
+			}
+			return proxyproto.REJECT, nil
+		},
+	}
+}
@@ -0,0 +1,93 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package netutil
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyProtocolListener(t *testing.T) {
+	for name, tc := range map[string]struct {
+		trusted    []string
+		header     string
+		remoteAddr string
+		rejected   bool
+	}{
+		"v1": {
+			header:     "PROXY TCP4 192.168.0.1 10.0.0.1 56324 8200\r\n",
+			remoteAddr: "192.168.0.1:56324",
+		},
+		"v2": {
+			header: "\r\n\r\n\x00\r\nQUIT\n" + "\x21\x11\x00\x0c" +
+				"\xc0\xa8\x00\x01" + "\x0a\x00\x00\x01" + "\xdc\x04" + "\x20\x08",
+			remoteAddr: "192.168.0.1:56324",
+		},
+		"no header": {
+			remoteAddr: "127.0.0.1",
+		},
+		"trusted peer": {
+			trusted:    []string{"127.0.0.0/8"},
+			header:     "PROXY TCP4 192.168.0.1 10.0.0.1 56324 8200\r\n",
+			remoteAddr: "192.168.0.1:56324",
+		},
+		"untrusted peer": {
+			trusted:  []string{"10.0.0.0/8"},
+			header:   "PROXY TCP4 192.168.0.1 10.0.0.1 56324 8200\r\n",
+			rejected: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			trusted, err := ParseTrustedProxies(tc.trusted)
+			require.NoError(t, err)
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			l = ProxyProtocolListener(l, trusted, time.Second)
+			defer l.Close()
+
+			client, err := net.Dial("tcp", l.Addr().String())
+			require.NoError(t, err)
+			defer client.Close()
+			_, err = client.Write([]byte(tc.header + "hello"))
+			require.NoError(t, err)
+
+			conn, err := l.Accept()
+			require.NoError(t, err)
+			defer conn.Close()
+			buf := make([]byte, 5)
+			_, err = io.ReadFull(conn, buf)
+			if tc.rejected {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "hello", string(buf))
+			if tc.header == "" {
+				ip, _ := SplitAddrPort(conn.RemoteAddr().String())
+				assert.Equal(t, tc.remoteAddr, ip.String())
+			} else {
+				assert.Equal(t, tc.remoteAddr, conn.RemoteAddr().String())
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package netutil
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// TrustedProxies holds the network prefixes of proxies trusted to report
+// the address of the client in request headers.
+//
+// An empty TrustedProxies trusts all peers, and honours only the first
+// address reported in request headers; see ClientAddrFromHeaders.
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies parses a list of IP addresses and CIDR ranges.
+func ParseTrustedProxies(in []string) (TrustedProxies, error) {
+	out := make(TrustedProxies, 0, len(in))
+	for _, s := range in {
+		if strings.Contains(s, "/") {
+			prefix, err := netip.ParsePrefix(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy CIDR %q: %w", s, err)
+			}
+			out = append(out, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy IP %q: %w", s, err)
+		}
+		addr = addr.Unmap()
+		out = append(out, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return out, nil
+}
+
+// Contains reports whether ip is the address of a trusted proxy.
+func (t TrustedProxies) Contains(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	for _, prefix := range t {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientAddr returns the IP address, and optionally port, of the client that
+// originated a request received from the network peer with the given headers.
+//
+// If t is empty, ClientAddr is equivalent to ClientAddrFromHeaders. Otherwise
+// headers are only honoured if peer is a trusted proxy, and the addresses in
+// the Forwarded and X-Forwarded-For headers are walked from right to left,
+// returning the first address which is not a trusted proxy, so clients
+// cannot spoof their address by sending these headers.
+//
+// If no client address can be determined, ClientAddr returns a zero
+// netip.Addr.
+func (t TrustedProxies) ClientAddr(peer netip.Addr, header http.Header) (netip.Addr, uint16) {
+	if len(t) == 0 {
+		return ClientAddrFromHeaders(header)
+	}
+	if !t.Contains(peer) {
+		return netip.Addr{}, 0
+	}
+	if forwarded := getHeaderValues(header, "Forwarded", "forwarded"); len(forwarded) > 0 {
+		var addrs []string
+		for _, element := range splitList(forwarded) {
+			addrs = append(addrs, parseForwarded(element).For)
+		}
+		return t.rightmostUntrusted(addrs)
+	}
+	if ip, port := parseXRealIP(header); ip.IsValid() {
+		return ip, port
+	}
+	if xff := getHeaderValues(header, "X-Forwarded-For", "x-forwarded-for"); len(xff) > 0 {
+		return t.rightmostUntrusted(splitList(xff))
+	}
+	return netip.Addr{}, 0
+}
+
+// rightmostUntrusted returns the rightmost address in addrs which is not
+// a trusted proxy, or the leftmost address if all are trusted. If an
+// invalid address is encountered, a zero netip.Addr is returned.
+func (t TrustedProxies) rightmostUntrusted(addrs []string) (netip.Addr, uint16) {
+	for i := len(addrs) - 1; i >= 0; i-- {
+		ip, port := SplitAddrPort(addrs[i])
+		if !ip.IsValid() {
+			break
+		}
+		if i == 0 || !t.Contains(ip) {
+			return ip, port
+		}
+	}
+	return netip.Addr{}, 0
+}
+
+// getHeaderValues returns all values of the header, looking them up by
+// both their canonical and lowercase key as in getHeader.
+func getHeaderValues(header http.Header, key, keyLower string) []string {
+	if v := header.Values(key); len(v) > 0 {
+		return v
+	}
+	return header[keyLower]
+}
+
+// splitList splits comma-separated header values into their elements.
+func splitList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, element := range strings.Split(v, ",") {
+			out = append(out, strings.TrimSpace(element))
+		}
+	}
+	return out
+}
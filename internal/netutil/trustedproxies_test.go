@@ -0,0 +1,112 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package netutil
+
+import (
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.1.2.3/8", "192.168.0.1", "2001:db8::/32"})
+	require.NoError(t, err)
+	assert.Equal(t, TrustedProxies{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.168.0.1/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}, trusted)
+
+	_, err = ParseTrustedProxies([]string{"10.0.0.0/40"})
+	assert.ErrorContains(t, err, `invalid trusted proxy CIDR "10.0.0.0/40"`)
+	_, err = ParseTrustedProxies([]string{"proxy.local"})
+	assert.ErrorContains(t, err, `invalid trusted proxy IP "proxy.local"`)
+}
+
+func TestTrustedProxiesClientAddr(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "::ffff:172.16.0.1"})
+	require.NoError(t, err)
+
+	for name, tc := range map[string]struct {
+		trusted TrustedProxies
+		peer    string
+		header  http.Header
+		ip      string
+		port    uint16
+	}{
+		"no trusted proxies": {
+			peer:   "192.168.0.1",
+			header: http.Header{headerXForwardedFor: []string{"1.1.1.1, 10.0.0.1"}},
+			ip:     "1.1.1.1",
+		},
+		"untrusted peer": {
+			trusted: trusted,
+			peer:    "192.168.0.1",
+			header:  http.Header{headerXForwardedFor: []string{"1.1.1.1"}},
+		},
+		"X-Forwarded-For rightmost untrusted": {
+			trusted: trusted,
+			peer:    "10.0.0.1",
+			header:  http.Header{headerXForwardedFor: []string{"1.1.1.1, 2.2.2.2", "10.0.0.2"}},
+			ip:      "2.2.2.2",
+		},
+		"X-Forwarded-For all trusted": {
+			trusted: trusted,
+			peer:    "10.0.0.1",
+			header:  http.Header{headerXForwardedFor: []string{"10.0.0.3, 10.0.0.2"}},
+			ip:      "10.0.0.3",
+		},
+		"X-Forwarded-For invalid": {
+			trusted: trusted,
+			peer:    "10.0.0.1",
+			header:  http.Header{headerXForwardedFor: []string{"1.1.1.1, unknown, 10.0.0.2"}},
+		},
+		"X-Forwarded-For lowercase": {
+			trusted: trusted,
+			peer:    "172.16.0.1",
+			header:  http.Header{"x-forwarded-for": []string{"1.1.1.1"}},
+			ip:      "1.1.1.1",
+		},
+		"Forwarded rightmost untrusted": {
+			trusted: trusted,
+			peer:    "10.0.0.1",
+			header:  http.Header{headerForwarded: []string{`for=1.1.1.1, for="[2001:db8:cafe::17]:4711";proto=http, for=10.0.0.2`}},
+			ip:      "2001:db8:cafe::17",
+			port:    4711,
+		},
+		"X-Real-Ip": {
+			trusted: trusted,
+			peer:    "10.0.0.1",
+			header:  http.Header{headerXRealIP: []string{"1.1.1.1"}},
+			ip:      "1.1.1.1",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ip, port := tc.trusted.ClientAddr(netip.MustParseAddr(tc.peer), tc.header)
+			if tc.ip == "" {
+				assert.False(t, ip.IsValid())
+			} else {
+				assert.Equal(t, netip.MustParseAddr(tc.ip), ip)
+			}
+			assert.Equal(t, tc.port, port)
+		})
+	}
+}
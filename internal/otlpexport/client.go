@@ -0,0 +1,268 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlpexport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	grpcgzip "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+// client sends OTLP export requests to a receiver.
+type client interface {
+	exportTraces(context.Context, ptraceotlp.ExportRequest) error
+	exportMetrics(context.Context, pmetricotlp.ExportRequest) error
+	exportLogs(context.Context, plogotlp.ExportRequest) error
+	close() error
+}
+
+// retryableError is returned by clients for failures that may
+// succeed if retried.
+type retryableError struct {
+	err error
+
+	// throttle holds the delay requested by the receiver before
+	// retrying, or zero if none was requested.
+	throttle time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+func newClient(cfg Config, logger *logp.Logger) (client, error) {
+	var tlsConfig *tlscommon.TLSConfig
+	if cfg.TLS.IsEnabled() {
+		var err error
+		if tlsConfig, err = tlscommon.LoadTLSConfig(cfg.TLS, logger); err != nil {
+			return nil, err
+		}
+	}
+	switch cfg.Protocol {
+	case ProtocolGRPC:
+		return newGRPCClient(cfg, tlsConfig)
+	case ProtocolHTTP:
+		return newHTTPClient(cfg, tlsConfig), nil
+	case ProtocolFile:
+		return newFileClient(cfg)
+	}
+	return nil, fmt.Errorf("unsupported protocol %q", cfg.Protocol)
+}
+
+type grpcClient struct {
+	conn     *grpc.ClientConn
+	traces   ptraceotlp.GRPCClient
+	metrics  pmetricotlp.GRPCClient
+	logs     plogotlp.GRPCClient
+	md       metadata.MD
+	callOpts []grpc.CallOption
+}
+
+func newGRPCClient(cfg Config, tlsConfig *tlscommon.TLSConfig) (*grpcClient, error) {
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		host := cfg.Endpoint
+		if i := strings.LastIndexByte(host, ':'); i >= 0 {
+			host = host[:i]
+		}
+		creds = credentials.NewTLS(tlsConfig.BuildModuleClientConfig(host))
+	}
+	conn, err := grpc.NewClient(cfg.Endpoint, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC client: %w", err)
+	}
+	var callOpts []grpc.CallOption
+	if cfg.Compression == compressionGzip {
+		callOpts = append(callOpts, grpc.UseCompressor(grpcgzip.Name))
+	}
+	return &grpcClient{
+		conn:     conn,
+		traces:   ptraceotlp.NewGRPCClient(conn),
+		metrics:  pmetricotlp.NewGRPCClient(conn),
+		logs:     plogotlp.NewGRPCClient(conn),
+		md:       metadata.New(cfg.Headers),
+		callOpts: callOpts,
+	}, nil
+}
+
+func (c *grpcClient) exportTraces(ctx context.Context, req ptraceotlp.ExportRequest) error {
+	_, err := c.traces.Export(metadata.NewOutgoingContext(ctx, c.md), req, c.callOpts...)
+	return grpcError(err)
+}
+
+func (c *grpcClient) exportMetrics(ctx context.Context, req pmetricotlp.ExportRequest) error {
+	_, err := c.metrics.Export(metadata.NewOutgoingContext(ctx, c.md), req, c.callOpts...)
+	return grpcError(err)
+}
+
+func (c *grpcClient) exportLogs(ctx context.Context, req plogotlp.ExportRequest) error {
+	_, err := c.logs.Export(metadata.NewOutgoingContext(ctx, c.md), req, c.callOpts...)
+	return grpcError(err)
+}
+
+func (c *grpcClient) close() error {
+	return c.conn.Close()
+}
+
+// grpcError wraps err in a retryableError if its status code
+// is defined as retryable by the OTLP specification.
+func grpcError(err error) error {
+	if err == nil {
+		return nil
+	}
+	st := status.Convert(err)
+	switch st.Code() {
+	case codes.Canceled,
+		codes.DeadlineExceeded,
+		codes.Aborted,
+		codes.OutOfRange,
+		codes.Unavailable,
+		codes.DataLoss:
+		return &retryableError{err: err}
+	case codes.ResourceExhausted:
+		// Resource exhaustion is only retryable if the
+		// receiver indicates that it may recover.
+		for _, detail := range st.Details() {
+			if info, ok := detail.(*errdetails.RetryInfo); ok {
+				return &retryableError{err: err, throttle: info.GetRetryDelay().AsDuration()}
+			}
+		}
+	}
+	return err
+}
+
+type httpClient struct {
+	client   *http.Client
+	endpoint string
+	headers  map[string]string
+	gzip     bool
+}
+
+func newHTTPClient(cfg Config, tlsConfig *tlscommon.TLSConfig) *httpClient {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig.ToConfig()
+	}
+	return &httpClient{
+		client:   &http.Client{Transport: transport},
+		endpoint: strings.TrimSuffix(cfg.Endpoint, "/"),
+		headers:  cfg.Headers,
+		gzip:     cfg.Compression == compressionGzip,
+	}
+}
+
+func (c *httpClient) exportTraces(ctx context.Context, req ptraceotlp.ExportRequest) error {
+	body, err := req.MarshalProto()
+	if err != nil {
+		return err
+	}
+	return c.export(ctx, "/v1/traces", body)
+}
+
+func (c *httpClient) exportMetrics(ctx context.Context, req pmetricotlp.ExportRequest) error {
+	body, err := req.MarshalProto()
+	if err != nil {
+		return err
+	}
+	return c.export(ctx, "/v1/metrics", body)
+}
+
+func (c *httpClient) exportLogs(ctx context.Context, req plogotlp.ExportRequest) error {
+	body, err := req.MarshalProto()
+	if err != nil {
+		return err
+	}
+	return c.export(ctx, "/v1/logs", body)
+}
+
+func (c *httpClient) export(ctx context.Context, path string, body []byte) error {
+	if c.gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	if c.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return &retryableError{err: err}
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("export to %s failed with status %d: %s", req.URL, resp.StatusCode, bytes.TrimSpace(respBody))
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		var throttle time.Duration
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			throttle = time.Duration(secs) * time.Second
+		}
+		return &retryableError{err: err, throttle: throttle}
+	}
+	return err
+}
+
+func (c *httpClient) close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,146 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlpexport
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+const (
+	// ProtocolGRPC exports using OTLP/gRPC.
+	ProtocolGRPC = "grpc"
+
+	// ProtocolHTTP exports using OTLP/HTTP with binary protobuf encoding.
+	ProtocolHTTP = "http"
+
+	// ProtocolFile writes export requests as newline-delimited OTLP/JSON
+	// to size-rotated files, one set of files per signal, in Path.
+	ProtocolFile = "file"
+
+	compressionGzip = "gzip"
+	compressionNone = "none"
+)
+
+// Config holds configuration for the OTLP exporter.
+type Config struct {
+	// Endpoint holds the address of the OTLP receiver. For gRPC this is
+	// a host:port pair; for HTTP it is the base URL, to which the signal
+	// paths (e.g. "/v1/traces") are appended.
+	Endpoint string `config:"endpoint"`
+
+	// Protocol holds the OTLP transport protocol: "grpc", "http", or "file".
+	Protocol string `config:"protocol"`
+
+	// Path holds the directory in which files are written, if Protocol
+	// is "file". Endpoint is ignored in this case.
+	Path string `config:"path"`
+
+	// Headers holds additional headers (or gRPC metadata) to send
+	// with each export request.
+	Headers map[string]string `config:"headers"`
+
+	// Compression holds the compression to use for export requests:
+	// "gzip" or "none".
+	Compression string `config:"compression"`
+
+	// Timeout holds the timeout for each export request attempt.
+	Timeout time.Duration `config:"timeout"`
+
+	// TLS holds the client TLS configuration. If TLS is not enabled,
+	// gRPC connections are made without transport security.
+	TLS *tlscommon.Config `config:"ssl"`
+
+	// QueueSize holds the maximum number of export requests that may be
+	// queued. Event processing blocks while the queue is full.
+	QueueSize int `config:"queue_size"`
+
+	// NumWorkers holds the number of export requests that may be sent
+	// concurrently.
+	NumWorkers int `config:"num_workers"`
+
+	// Retry holds configuration for retrying failed export requests.
+	Retry RetryConfig `config:"retry"`
+}
+
+// RetryConfig holds configuration for retrying failed export requests.
+//
+// Only failures which the OTLP specification defines as retryable,
+// such as the receiver being unavailable or throttling, are retried.
+type RetryConfig struct {
+	Enabled bool `config:"enabled"`
+
+	// InitialInterval holds the backoff duration after the first failure.
+	InitialInterval time.Duration `config:"initial_interval"`
+
+	// MaxInterval holds the maximum backoff duration between attempts.
+	MaxInterval time.Duration `config:"max_interval"`
+
+	// MaxElapsedTime holds the maximum amount of time spent retrying a
+	// request, after which it is dropped.
+	MaxElapsedTime time.Duration `config:"max_elapsed_time"`
+}
+
+// DefaultConfig returns a default config.
+func DefaultConfig() Config {
+	return Config{
+		Endpoint:    "localhost:4317",
+		Protocol:    ProtocolGRPC,
+		Compression: compressionGzip,
+		Timeout:     10 * time.Second,
+		QueueSize:   1000,
+		NumWorkers:  10,
+		Retry: RetryConfig{
+			Enabled:         true,
+			InitialInterval: 5 * time.Second,
+			MaxInterval:     30 * time.Second,
+			MaxElapsedTime:  5 * time.Minute,
+		},
+	}
+}
+
+// Validate validates the config.
+func (c *Config) Validate() error {
+	switch c.Protocol {
+	case ProtocolGRPC, ProtocolHTTP:
+		if c.Endpoint == "" {
+			return errors.New("endpoint must be specified")
+		}
+	case ProtocolFile:
+		if c.Path == "" {
+			return errors.New("path must be specified for the file protocol")
+		}
+	default:
+		return fmt.Errorf("invalid protocol %q, expected %q, %q or %q", c.Protocol, ProtocolGRPC, ProtocolHTTP, ProtocolFile)
+	}
+	switch c.Compression {
+	case compressionGzip, compressionNone, "":
+	default:
+		return fmt.Errorf("invalid compression %q, expected %q or %q", c.Compression, compressionGzip, compressionNone)
+	}
+	if c.QueueSize <= 0 {
+		return errors.New("queue_size must be greater than zero")
+	}
+	if c.NumWorkers <= 0 {
+		return errors.New("num_workers must be greater than zero")
+	}
+	return nil
+}
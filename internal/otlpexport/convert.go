@@ -0,0 +1,497 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlpexport
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/elastic/apm-data/model/modelpb"
+)
+
+// converted holds the OTLP signals converted from a batch of events,
+// and the number of events contributing to each.
+type converted struct {
+	traces  ptrace.Traces
+	metrics pmetric.Metrics
+	logs    plog.Logs
+
+	spanEvents   int
+	metricEvents int
+	logEvents    int
+}
+
+// resource holds the event fields which are mapped to OTLP resource
+// attributes. Events with equal resources are grouped together.
+type resource struct {
+	serviceName        string
+	serviceVersion     string
+	serviceEnvironment string
+	serviceNodeName    string
+	languageName       string
+	agentName          string
+	agentVersion       string
+	hostName           string
+	hostID             string
+	hostArchitecture   string
+	osType             string
+	containerID        string
+	kubernetesPodName  string
+	kubernetesPodUID   string
+	kubernetesNS       string
+	cloudProvider      string
+	cloudRegion        string
+	cloudAccountID     string
+	processPid         uint32
+}
+
+func newResource(event *modelpb.APMEvent) resource {
+	var r resource
+	if s := event.Service; s != nil {
+		r.serviceName = s.Name
+		r.serviceVersion = s.Version
+		r.serviceEnvironment = s.Environment
+		if s.Node != nil {
+			r.serviceNodeName = s.Node.Name
+		}
+		if s.Language != nil {
+			r.languageName = s.Language.Name
+		}
+	}
+	if a := event.Agent; a != nil {
+		r.agentName = a.Name
+		r.agentVersion = a.Version
+	}
+	if h := event.Host; h != nil {
+		r.hostName = h.Hostname
+		if r.hostName == "" {
+			r.hostName = h.Name
+		}
+		r.hostID = h.Id
+		r.hostArchitecture = h.Architecture
+		if h.Os != nil {
+			r.osType = h.Os.Type
+		}
+	}
+	if c := event.Container; c != nil {
+		r.containerID = c.Id
+	}
+	if k := event.Kubernetes; k != nil {
+		r.kubernetesPodName = k.PodName
+		r.kubernetesPodUID = k.PodUid
+		r.kubernetesNS = k.Namespace
+	}
+	if c := event.Cloud; c != nil {
+		r.cloudProvider = c.Provider
+		r.cloudRegion = c.Region
+		r.cloudAccountID = c.AccountId
+	}
+	if p := event.Process; p != nil {
+		r.processPid = p.Pid
+	}
+	return r
+}
+
+func (r resource) copyTo(m pcommon.Map) {
+	putStr(m, "service.name", r.serviceName)
+	putStr(m, "service.version", r.serviceVersion)
+	putStr(m, "deployment.environment.name", r.serviceEnvironment)
+	putStr(m, "service.instance.id", r.serviceNodeName)
+	putStr(m, "telemetry.sdk.language", r.languageName)
+	putStr(m, "agent.name", r.agentName)
+	putStr(m, "agent.version", r.agentVersion)
+	putStr(m, "host.name", r.hostName)
+	putStr(m, "host.id", r.hostID)
+	putStr(m, "host.arch", r.hostArchitecture)
+	putStr(m, "os.type", r.osType)
+	putStr(m, "container.id", r.containerID)
+	putStr(m, "k8s.pod.name", r.kubernetesPodName)
+	putStr(m, "k8s.pod.uid", r.kubernetesPodUID)
+	putStr(m, "k8s.namespace.name", r.kubernetesNS)
+	putStr(m, "cloud.provider", r.cloudProvider)
+	putStr(m, "cloud.region", r.cloudRegion)
+	putStr(m, "cloud.account.id", r.cloudAccountID)
+	if r.processPid != 0 {
+		m.PutInt("process.pid", int64(r.processPid))
+	}
+}
+
+// convert converts a batch of events to OTLP traces, metrics and logs.
+//
+// Transactions and spans are converted to spans, errors and logs are
+// converted to log records, and metricsets are converted to metrics.
+// Events of any other type are ignored.
+func convert(batch modelpb.Batch) converted {
+	out := converted{
+		traces:  ptrace.NewTraces(),
+		metrics: pmetric.NewMetrics(),
+		logs:    plog.NewLogs(),
+	}
+	scopeSpans := make(map[resource]ptrace.SpanSlice)
+	scopeMetrics := make(map[resource]pmetric.MetricSlice)
+	scopeLogs := make(map[resource]plog.LogRecordSlice)
+	for _, event := range batch {
+		switch event.Type() {
+		case modelpb.TransactionEventType, modelpb.SpanEventType:
+			r := newResource(event)
+			spans, ok := scopeSpans[r]
+			if !ok {
+				rs := out.traces.ResourceSpans().AppendEmpty()
+				r.copyTo(rs.Resource().Attributes())
+				spans = rs.ScopeSpans().AppendEmpty().Spans()
+				scopeSpans[r] = spans
+			}
+			convertSpan(event, spans.AppendEmpty())
+			out.spanEvents++
+		case modelpb.MetricEventType:
+			r := newResource(event)
+			metrics, ok := scopeMetrics[r]
+			if !ok {
+				rm := out.metrics.ResourceMetrics().AppendEmpty()
+				r.copyTo(rm.Resource().Attributes())
+				metrics = rm.ScopeMetrics().AppendEmpty().Metrics()
+				scopeMetrics[r] = metrics
+			}
+			convertMetricset(event, metrics)
+			out.metricEvents++
+		case modelpb.ErrorEventType, modelpb.LogEventType:
+			r := newResource(event)
+			records, ok := scopeLogs[r]
+			if !ok {
+				rl := out.logs.ResourceLogs().AppendEmpty()
+				r.copyTo(rl.Resource().Attributes())
+				records = rl.ScopeLogs().AppendEmpty().LogRecords()
+				scopeLogs[r] = records
+			}
+			convertLog(event, records.AppendEmpty())
+			out.logEvents++
+		}
+	}
+	return out
+}
+
+func convertSpan(event *modelpb.APMEvent, span ptrace.Span) {
+	attrs := span.Attributes()
+	span.SetTraceID(traceID(event.GetTrace().GetId()))
+	span.SetParentSpanID(spanID(event.ParentId))
+	span.SetStartTimestamp(pcommon.Timestamp(event.Timestamp))
+	span.SetEndTimestamp(pcommon.Timestamp(event.Timestamp + event.GetEvent().GetDuration()))
+	if event.GetEvent().GetOutcome() == "failure" {
+		span.Status().SetCode(ptrace.StatusCodeError)
+	}
+
+	var kind string
+	if event.Span != nil {
+		kind = event.Span.Kind
+	}
+	if tx := event.Transaction; tx != nil {
+		span.SetSpanID(spanID(tx.Id))
+		span.SetName(tx.Name)
+		span.SetKind(spanKind(kind, ptrace.SpanKindServer))
+		if tx.Type == "messaging" && kind == "" {
+			span.SetKind(ptrace.SpanKindConsumer)
+		}
+		putStr(attrs, "transaction.type", tx.Type)
+		putStr(attrs, "transaction.result", tx.Result)
+	} else if s := event.Span; s != nil {
+		span.SetSpanID(spanID(s.Id))
+		span.SetName(s.Name)
+		defaultKind := ptrace.SpanKindInternal
+		if s.DestinationService != nil || event.GetService().GetTarget() != nil {
+			defaultKind = ptrace.SpanKindClient
+		}
+		span.SetKind(spanKind(kind, defaultKind))
+		putStr(attrs, "span.type", s.Type)
+		putStr(attrs, "span.subtype", s.Subtype)
+		putStr(attrs, "span.action", s.Action)
+		if db := s.Db; db != nil {
+			putStr(attrs, "db.system", db.Type)
+			putStr(attrs, "db.namespace", db.Instance)
+			putStr(attrs, "db.query.text", db.Statement)
+		}
+		if t := event.GetService().GetTarget(); t != nil {
+			putStr(attrs, "service.target.type", t.Type)
+			putStr(attrs, "service.target.name", t.Name)
+		}
+		for _, link := range s.Links {
+			l := span.Links().AppendEmpty()
+			l.SetTraceID(traceID(link.TraceId))
+			l.SetSpanID(spanID(link.SpanId))
+		}
+	}
+	if d := event.Destination; d != nil {
+		putStr(attrs, "server.address", d.Address)
+		if d.Port != 0 {
+			attrs.PutInt("server.port", int64(d.Port))
+		}
+	}
+	if h := event.Http; h != nil {
+		if h.Request != nil {
+			putStr(attrs, "http.request.method", h.Request.Method)
+		}
+		if h.Response != nil && h.Response.StatusCode != 0 {
+			attrs.PutInt("http.response.status_code", int64(h.Response.StatusCode))
+		}
+	}
+	if u := event.Url; u != nil {
+		putStr(attrs, "url.full", u.Full)
+		putStr(attrs, "url.path", u.Path)
+		putStr(attrs, "url.scheme", u.Scheme)
+	}
+	putStr(attrs, "event.outcome", event.GetEvent().GetOutcome())
+	putLabels(attrs, event)
+}
+
+func convertLog(event *modelpb.APMEvent, record plog.LogRecord) {
+	attrs := record.Attributes()
+	record.SetTimestamp(pcommon.Timestamp(event.Timestamp))
+	record.SetObservedTimestamp(pcommon.Timestamp(event.GetEvent().GetReceived()))
+	record.SetTraceID(traceID(event.GetTrace().GetId()))
+
+	if e := event.Error; e != nil {
+		// Errors are recorded as exception events, as described by
+		// the OpenTelemetry semantic conventions for exceptions.
+		record.SetEventName("exception")
+		record.SetSeverityNumber(plog.SeverityNumberError)
+		record.SetSeverityText("ERROR")
+		record.SetSpanID(spanID(event.ParentId))
+		putStr(attrs, "error.id", e.Id)
+		putStr(attrs, "error.grouping_key", e.GroupingKey)
+		message, typ := e.Message, e.Type
+		if ex := e.Exception; ex != nil {
+			if message == "" {
+				message = ex.Message
+			}
+			if typ == "" {
+				typ = ex.Type
+			}
+		} else if l := e.Log; l != nil && message == "" {
+			message = l.Message
+		}
+		putStr(attrs, "exception.type", typ)
+		putStr(attrs, "exception.message", message)
+		putStr(attrs, "exception.stacktrace", e.StackTrace)
+		record.Body().SetStr(message)
+	} else {
+		record.SetSpanID(spanID(event.GetSpan().GetId()))
+		record.Body().SetStr(event.Message)
+		if l := event.Log; l != nil {
+			record.SetSeverityText(l.Level)
+			record.SetSeverityNumber(severityNumber(l.Level))
+			putStr(attrs, "log.logger", l.Logger)
+		}
+	}
+	putStr(attrs, "event.dataset", event.GetEvent().GetDataset())
+	putLabels(attrs, event)
+}
+
+func convertMetricset(event *modelpb.APMEvent, metrics pmetric.MetricSlice) {
+	ts := pcommon.Timestamp(event.Timestamp)
+	newDataPointAttributes := func(m pcommon.Map) {
+		putStr(m, "metricset.name", event.GetMetricset().GetName())
+		if tx := event.Transaction; tx != nil {
+			putStr(m, "transaction.type", tx.Type)
+			putStr(m, "transaction.name", tx.Name)
+		}
+		putLabels(m, event)
+	}
+
+	for _, sample := range event.GetMetricset().GetSamples() {
+		m := metrics.AppendEmpty()
+		m.SetName(sample.Name)
+		m.SetUnit(sample.Unit)
+		switch sample.Type {
+		case modelpb.MetricType_METRIC_TYPE_COUNTER:
+			sum := m.SetEmptySum()
+			sum.SetIsMonotonic(true)
+			sum.SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+			dp := sum.DataPoints().AppendEmpty()
+			dp.SetTimestamp(ts)
+			dp.SetDoubleValue(sample.Value)
+			newDataPointAttributes(dp.Attributes())
+		case modelpb.MetricType_METRIC_TYPE_HISTOGRAM:
+			convertHistogram(m, ts, sample.Histogram, newDataPointAttributes)
+		case modelpb.MetricType_METRIC_TYPE_SUMMARY:
+			convertSummary(m, ts, sample.Summary.GetCount(), sample.Summary.GetSum(), newDataPointAttributes)
+		default:
+			dp := m.SetEmptyGauge().DataPoints().AppendEmpty()
+			dp.SetTimestamp(ts)
+			dp.SetDoubleValue(sample.Value)
+			newDataPointAttributes(dp.Attributes())
+		}
+	}
+
+	// Aggregated transaction and span metrics carry their
+	// values outside of the metricset samples.
+	if tx := event.Transaction; tx != nil {
+		if tx.DurationHistogram != nil {
+			m := metrics.AppendEmpty()
+			m.SetName("transaction.duration.histogram")
+			m.SetUnit("us")
+			convertHistogram(m, ts, tx.DurationHistogram, newDataPointAttributes)
+		}
+		if tx.DurationSummary != nil {
+			m := metrics.AppendEmpty()
+			m.SetName("transaction.duration.summary")
+			m.SetUnit("us")
+			convertSummary(m, ts, tx.DurationSummary.Count, tx.DurationSummary.Sum, newDataPointAttributes)
+		}
+	}
+	if rt := event.GetSpan().GetDestinationService().GetResponseTime(); rt != nil {
+		m := metrics.AppendEmpty()
+		m.SetName("span.destination.service.response_time")
+		m.SetUnit("ns")
+		convertSummary(m, ts, rt.Count, float64(rt.Sum), func(attrs pcommon.Map) {
+			newDataPointAttributes(attrs)
+			putStr(attrs, "span.destination.service.resource", event.Span.DestinationService.Resource)
+		})
+	}
+}
+
+// convertHistogram converts h to an OTLP explicit bucket histogram.
+// Histogram values are bucket midpoints, so bucket boundaries are
+// placed halfway between consecutive values.
+func convertHistogram(m pmetric.Metric, ts pcommon.Timestamp, h *modelpb.Histogram, attrs func(pcommon.Map)) {
+	dp := m.SetEmptyHistogram().DataPoints().AppendEmpty()
+	m.Histogram().SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+	dp.SetTimestamp(ts)
+	attrs(dp.Attributes())
+
+	values, counts := h.GetValues(), h.GetCounts()
+	if len(values) == 0 || len(values) != len(counts) {
+		return
+	}
+	var count uint64
+	var sum float64
+	for i, v := range values {
+		if i > 0 {
+			dp.ExplicitBounds().Append(values[i-1] + (v-values[i-1])/2)
+		}
+		count += counts[i]
+		sum += v * float64(counts[i])
+	}
+	dp.BucketCounts().FromRaw(counts)
+	dp.SetCount(count)
+	dp.SetSum(sum)
+}
+
+func convertSummary(m pmetric.Metric, ts pcommon.Timestamp, count uint64, sum float64, attrs func(pcommon.Map)) {
+	dp := m.SetEmptySummary().DataPoints().AppendEmpty()
+	dp.SetTimestamp(ts)
+	dp.SetCount(count)
+	dp.SetSum(sum)
+	attrs(dp.Attributes())
+}
+
+func putLabels(m pcommon.Map, event *modelpb.APMEvent) {
+	for k, v := range event.Labels {
+		if len(v.Values) > 0 {
+			s := m.PutEmptySlice("labels." + k)
+			for _, v := range v.Values {
+				s.AppendEmpty().SetStr(v)
+			}
+			continue
+		}
+		m.PutStr("labels."+k, v.Value)
+	}
+	for k, v := range event.NumericLabels {
+		if len(v.Values) > 0 {
+			s := m.PutEmptySlice("numeric_labels." + k)
+			for _, v := range v.Values {
+				s.AppendEmpty().SetDouble(v)
+			}
+			continue
+		}
+		m.PutDouble("numeric_labels."+k, v.Value)
+	}
+	if ds := event.DataStream; ds != nil {
+		putStr(m, "data_stream.dataset", ds.Dataset)
+		putStr(m, "data_stream.namespace", ds.Namespace)
+	}
+}
+
+func putStr(m pcommon.Map, k, v string) {
+	if v != "" {
+		m.PutStr(k, v)
+	}
+}
+
+func spanKind(kind string, defaultKind ptrace.SpanKind) ptrace.SpanKind {
+	switch strings.ToUpper(kind) {
+	case "INTERNAL":
+		return ptrace.SpanKindInternal
+	case "SERVER":
+		return ptrace.SpanKindServer
+	case "CLIENT":
+		return ptrace.SpanKindClient
+	case "PRODUCER":
+		return ptrace.SpanKindProducer
+	case "CONSUMER":
+		return ptrace.SpanKindConsumer
+	}
+	return defaultKind
+}
+
+func severityNumber(level string) plog.SeverityNumber {
+	switch strings.ToLower(level) {
+	case "trace":
+		return plog.SeverityNumberTrace
+	case "debug":
+		return plog.SeverityNumberDebug
+	case "info", "information":
+		return plog.SeverityNumberInfo
+	case "warn", "warning":
+		return plog.SeverityNumberWarn
+	case "error", "err":
+		return plog.SeverityNumberError
+	case "fatal", "critical", "crit":
+		return plog.SeverityNumberFatal
+	}
+	return plog.SeverityNumberUnspecified
+}
+
+// traceID decodes a hex-encoded trace ID, returning an empty
+// trace ID if s is not a valid 16-byte hex string.
+func traceID(s string) pcommon.TraceID {
+	var id pcommon.TraceID
+	if len(s) != hex.EncodedLen(len(id)) {
+		return pcommon.NewTraceIDEmpty()
+	}
+	if _, err := hex.Decode(id[:], []byte(s)); err != nil {
+		return pcommon.NewTraceIDEmpty()
+	}
+	return id
+}
+
+// spanID decodes a hex-encoded span ID, returning an empty
+// span ID if s is not a valid 8-byte hex string.
+func spanID(s string) pcommon.SpanID {
+	var id pcommon.SpanID
+	if len(s) != hex.EncodedLen(len(id)) {
+		return pcommon.NewSpanIDEmpty()
+	}
+	if _, err := hex.Decode(id[:], []byte(s)); err != nil {
+		return pcommon.NewSpanIDEmpty()
+	}
+	return id
+}
@@ -0,0 +1,212 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlpexport
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+
+	"github.com/elastic/apm-data/model/modelpb"
+)
+
+const (
+	testTraceID = "0102030405060708090a0b0c0d0e0f10"
+	testTxID    = "0102030405060708"
+	testSpanID  = "1112131415161718"
+)
+
+func TestConvertTraces(t *testing.T) {
+	service := &modelpb.Service{Name: "svc", Version: "1.0", Environment: "prod"}
+	batch := modelpb.Batch{{
+		Timestamp:   1000,
+		Service:     service,
+		Trace:       &modelpb.Trace{Id: testTraceID},
+		Event:       &modelpb.Event{Duration: 500, Outcome: "success"},
+		Transaction: &modelpb.Transaction{Id: testTxID, Name: "GET /", Type: "request", Result: "HTTP 2xx"},
+		Http: &modelpb.HTTP{
+			Request:  &modelpb.HTTPRequest{Method: "GET"},
+			Response: &modelpb.HTTPResponse{StatusCode: 200},
+		},
+		Labels: modelpb.Labels{"key": {Value: "value"}},
+	}, {
+		Timestamp: 1100,
+		Service:   &modelpb.Service{Name: "svc", Version: "1.0", Environment: "prod", Target: &modelpb.ServiceTarget{Type: "postgresql"}},
+		Trace:     &modelpb.Trace{Id: testTraceID},
+		ParentId:  testTxID,
+		Event:     &modelpb.Event{Duration: 200, Outcome: "failure"},
+		Span: &modelpb.Span{
+			Id: testSpanID, Name: "SELECT", Type: "db", Subtype: "postgresql",
+			Db: &modelpb.DB{Type: "sql", Statement: "SELECT 1"},
+		},
+	}}
+
+	out := convert(batch)
+	assert.Equal(t, 2, out.spanEvents)
+	assert.Zero(t, out.metricEvents)
+	assert.Zero(t, out.logEvents)
+
+	// Both events share a resource, so they are grouped together.
+	require.Equal(t, 1, out.traces.ResourceSpans().Len())
+	rs := out.traces.ResourceSpans().At(0)
+	assert.Equal(t, map[string]any{
+		"service.name":                "svc",
+		"service.version":             "1.0",
+		"deployment.environment.name": "prod",
+	}, rs.Resource().Attributes().AsRaw())
+
+	spans := rs.ScopeSpans().At(0).Spans()
+	require.Equal(t, 2, spans.Len())
+
+	tx := spans.At(0)
+	assert.Equal(t, testTraceID, tx.TraceID().String())
+	assert.Equal(t, testTxID, tx.SpanID().String())
+	assert.True(t, tx.ParentSpanID().IsEmpty())
+	assert.Equal(t, "GET /", tx.Name())
+	assert.Equal(t, ptrace.SpanKindServer, tx.Kind())
+	assert.Equal(t, ptrace.StatusCodeUnset, tx.Status().Code())
+	assert.Equal(t, uint64(1000), uint64(tx.StartTimestamp()))
+	assert.Equal(t, uint64(1500), uint64(tx.EndTimestamp()))
+	assert.Equal(t, map[string]any{
+		"transaction.type":          "request",
+		"transaction.result":        "HTTP 2xx",
+		"http.request.method":       "GET",
+		"http.response.status_code": int64(200),
+		"event.outcome":             "success",
+		"labels.key":                "value",
+	}, tx.Attributes().AsRaw())
+
+	span := spans.At(1)
+	assert.Equal(t, testSpanID, span.SpanID().String())
+	assert.Equal(t, testTxID, span.ParentSpanID().String())
+	assert.Equal(t, ptrace.SpanKindClient, span.Kind())
+	assert.Equal(t, ptrace.StatusCodeError, span.Status().Code())
+	assert.Equal(t, map[string]any{
+		"span.type":           "db",
+		"span.subtype":        "postgresql",
+		"db.system":           "sql",
+		"db.query.text":       "SELECT 1",
+		"service.target.type": "postgresql",
+		"event.outcome":       "failure",
+	}, span.Attributes().AsRaw())
+}
+
+func TestConvertLogs(t *testing.T) {
+	batch := modelpb.Batch{{
+		Timestamp: 1000,
+		Service:   &modelpb.Service{Name: "svc"},
+		Trace:     &modelpb.Trace{Id: testTraceID},
+		ParentId:  testSpanID,
+		Error: &modelpb.Error{
+			Id:         "err",
+			Exception:  &modelpb.Exception{Type: "java.lang.NullPointerException", Message: "boom"},
+			StackTrace: "at Foo.bar()",
+		},
+	}, {
+		Timestamp: 2000,
+		Service:   &modelpb.Service{Name: "other"},
+		Message:   "hello",
+		Log:       &modelpb.Log{Level: "warn", Logger: "main"},
+	}}
+
+	out := convert(batch)
+	assert.Equal(t, 2, out.logEvents)
+	require.Equal(t, 2, out.logs.ResourceLogs().Len())
+
+	errorRecord := out.logs.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0)
+	assert.Equal(t, "exception", errorRecord.EventName())
+	assert.Equal(t, plog.SeverityNumberError, errorRecord.SeverityNumber())
+	assert.Equal(t, testTraceID, errorRecord.TraceID().String())
+	assert.Equal(t, testSpanID, errorRecord.SpanID().String())
+	assert.Equal(t, "boom", errorRecord.Body().Str())
+	assert.Equal(t, map[string]any{
+		"error.id":             "err",
+		"exception.type":       "java.lang.NullPointerException",
+		"exception.message":    "boom",
+		"exception.stacktrace": "at Foo.bar()",
+	}, errorRecord.Attributes().AsRaw())
+
+	logRecord := out.logs.ResourceLogs().At(1).ScopeLogs().At(0).LogRecords().At(0)
+	assert.Equal(t, "hello", logRecord.Body().Str())
+	assert.Equal(t, "warn", logRecord.SeverityText())
+	assert.Equal(t, plog.SeverityNumberWarn, logRecord.SeverityNumber())
+	assert.True(t, logRecord.TraceID().IsEmpty())
+	assert.Equal(t, map[string]any{"log.logger": "main"}, logRecord.Attributes().AsRaw())
+}
+
+func TestConvertMetrics(t *testing.T) {
+	batch := modelpb.Batch{{
+		Timestamp: 1000,
+		Service:   &modelpb.Service{Name: "svc"},
+		Metricset: &modelpb.Metricset{
+			Name: "app",
+			Samples: []*modelpb.MetricsetSample{
+				{Name: "gauge", Value: 1.5},
+				{Name: "counter", Type: modelpb.MetricType_METRIC_TYPE_COUNTER, Value: 3},
+				{
+					Name: "histogram", Type: modelpb.MetricType_METRIC_TYPE_HISTOGRAM,
+					Histogram: &modelpb.Histogram{Values: []float64{1, 3, 7}, Counts: []uint64{1, 2, 3}},
+				},
+			},
+		},
+	}, {
+		Timestamp:   1000,
+		Service:     &modelpb.Service{Name: "svc"},
+		Metricset:   &modelpb.Metricset{Name: "transaction"},
+		Transaction: &modelpb.Transaction{Type: "request", DurationSummary: &modelpb.SummaryMetric{Count: 2, Sum: 10}},
+	}}
+
+	out := convert(batch)
+	assert.Equal(t, 2, out.metricEvents)
+	require.Equal(t, 1, out.metrics.ResourceMetrics().Len())
+	metrics := out.metrics.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics()
+	require.Equal(t, 4, metrics.Len())
+
+	gauge := metrics.At(0)
+	assert.Equal(t, "gauge", gauge.Name())
+	assert.Equal(t, pmetric.MetricTypeGauge, gauge.Type())
+	assert.Equal(t, 1.5, gauge.Gauge().DataPoints().At(0).DoubleValue())
+	assert.Equal(t, map[string]any{"metricset.name": "app"}, gauge.Gauge().DataPoints().At(0).Attributes().AsRaw())
+
+	counter := metrics.At(1)
+	assert.Equal(t, pmetric.MetricTypeSum, counter.Type())
+	assert.True(t, counter.Sum().IsMonotonic())
+	assert.Equal(t, 3.0, counter.Sum().DataPoints().At(0).DoubleValue())
+
+	histogram := metrics.At(2)
+	require.Equal(t, pmetric.MetricTypeHistogram, histogram.Type())
+	dp := histogram.Histogram().DataPoints().At(0)
+	assert.Equal(t, []float64{2, 5}, dp.ExplicitBounds().AsRaw())
+	assert.Equal(t, []uint64{1, 2, 3}, dp.BucketCounts().AsRaw())
+	assert.Equal(t, uint64(6), dp.Count())
+	assert.Equal(t, 28.0, dp.Sum())
+
+	summary := metrics.At(3)
+	assert.Equal(t, "transaction.duration.summary", summary.Name())
+	require.Equal(t, pmetric.MetricTypeSummary, summary.Type())
+	assert.Equal(t, uint64(2), summary.Summary().DataPoints().At(0).Count())
+	assert.Equal(t, 10.0, summary.Summary().DataPoints().At(0).Sum())
+	assert.Equal(t, map[string]any{
+		"metricset.name":   "transaction",
+		"transaction.type": "request",
+	}, summary.Summary().DataPoints().At(0).Attributes().AsRaw())
+}
@@ -0,0 +1,263 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package otlpexport provides an output which converts events back into
+// OTLP traces, metrics and logs, and exports them to an OTLP receiver
+// such as an OpenTelemetry Collector.
+package otlpexport
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+
+	"github.com/elastic/apm-data/model/modelpb"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// ErrClosed is returned by Exporter.ProcessBatch after the
+// exporter has been closed.
+var ErrClosed = errors.New("otlp exporter is closed")
+
+// Exporter is a modelpb.BatchProcessor which converts events to OTLP
+// and exports them asynchronously to an OTLP receiver.
+//
+// Converted batches are placed in a bounded queue, from which a fixed
+// number of workers send export requests, retrying failed requests
+// according to the retry configuration.
+type Exporter struct {
+	cfg    Config
+	logger *logp.Logger
+	client client
+	queue  chan request
+
+	// stopping is closed when Close is called, to unblock
+	// calls to ProcessBatch waiting for space in the queue.
+	stopping chan struct{}
+	stopOnce sync.Once
+	mu       sync.RWMutex
+	closed   bool
+
+	// workersCtx is cancelled if Close times out, to abort
+	// in-flight export requests.
+	workersCtx    context.Context
+	cancelWorkers context.CancelFunc
+	workers       sync.WaitGroup
+
+	eventsAccepted metric.Int64Counter
+	eventsExported metric.Int64Counter
+	eventsFailed   metric.Int64Counter
+}
+
+type request struct {
+	signal string
+	events int
+	export func(context.Context, client) error
+}
+
+// New returns a new Exporter with the given configuration.
+func New(cfg Config, logger *logp.Logger, mp metric.MeterProvider) (*Exporter, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if logger == nil {
+		logger = logp.NewNopLogger()
+	}
+	if mp == nil {
+		mp = noop.NewMeterProvider()
+	}
+	client, err := newClient(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	meter := mp.Meter("github.com/elastic/apm-server/internal/otlpexport")
+	eventsAccepted, err := meter.Int64Counter("apm-server.otlp.exporter.events.accepted")
+	if err != nil {
+		return nil, err
+	}
+	eventsExported, err := meter.Int64Counter("apm-server.otlp.exporter.events.exported")
+	if err != nil {
+		return nil, err
+	}
+	eventsFailed, err := meter.Int64Counter("apm-server.otlp.exporter.events.failed")
+	if err != nil {
+		return nil, err
+	}
+
+	workersCtx, cancelWorkers := context.WithCancel(context.Background())
+	e := &Exporter{
+		cfg:            cfg,
+		logger:         logger,
+		client:         client,
+		queue:          make(chan request, cfg.QueueSize),
+		stopping:       make(chan struct{}),
+		workersCtx:     workersCtx,
+		cancelWorkers:  cancelWorkers,
+		eventsAccepted: eventsAccepted,
+		eventsExported: eventsExported,
+		eventsFailed:   eventsFailed,
+	}
+	for i := 0; i < cfg.NumWorkers; i++ {
+		e.workers.Add(1)
+		go func() {
+			defer e.workers.Done()
+			for req := range e.queue {
+				e.send(req)
+			}
+		}()
+	}
+	return e, nil
+}
+
+// ProcessBatch converts the batch to OTLP and enqueues it for export,
+// blocking while the queue is full.
+func (e *Exporter) ProcessBatch(ctx context.Context, batch *modelpb.Batch) error {
+	out := convert(*batch)
+	var requests []request
+	if out.spanEvents > 0 {
+		r := ptraceotlp.NewExportRequestFromTraces(out.traces)
+		requests = append(requests, request{
+			signal: "traces",
+			events: out.spanEvents,
+			export: func(ctx context.Context, c client) error { return c.exportTraces(ctx, r) },
+		})
+	}
+	if out.metricEvents > 0 {
+		r := pmetricotlp.NewExportRequestFromMetrics(out.metrics)
+		requests = append(requests, request{
+			signal: "metrics",
+			events: out.metricEvents,
+			export: func(ctx context.Context, c client) error { return c.exportMetrics(ctx, r) },
+		})
+	}
+	if out.logEvents > 0 {
+		r := plogotlp.NewExportRequestFromLogs(out.logs)
+		requests = append(requests, request{
+			signal: "logs",
+			events: out.logEvents,
+			export: func(ctx context.Context, c client) error { return c.exportLogs(ctx, r) },
+		})
+	}
+
+	return e.enqueue(ctx, requests...)
+}
+
+// enqueue enqueues requests for export, blocking while the queue is full.
+func (e *Exporter) enqueue(ctx context.Context, requests ...request) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return ErrClosed
+	}
+	for _, req := range requests {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-e.stopping:
+			return ErrClosed
+		case e.queue <- req:
+			e.eventsAccepted.Add(ctx, int64(req.events))
+		}
+	}
+	return nil
+}
+
+// send sends req, retrying retryable failures until the request
+// succeeds, the retry budget is exhausted, or the exporter is closed.
+func (e *Exporter) send(req request) {
+	ctx := e.workersCtx
+	backoff := e.cfg.Retry.InitialInterval
+	start := time.Now()
+	for {
+		attemptCtx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
+		err := req.export(attemptCtx, e.client)
+		cancel()
+		if err == nil {
+			e.eventsExported.Add(ctx, int64(req.events))
+			return
+		}
+
+		var retryable *retryableError
+		if !errors.As(err, &retryable) || !e.cfg.Retry.Enabled || ctx.Err() != nil {
+			e.fail(req, err)
+			return
+		}
+		delay := max(backoff, retryable.throttle)
+		if time.Since(start)+delay > e.cfg.Retry.MaxElapsedTime {
+			e.fail(req, err)
+			return
+		}
+		e.logger.With(logp.Error(err)).Warnf(
+			"failed to export %s, retrying in %s", req.signal, delay,
+		)
+		select {
+		case <-ctx.Done():
+			e.fail(req, ctx.Err())
+			return
+		case <-time.After(delay):
+		}
+		backoff = min(backoff*2, e.cfg.Retry.MaxInterval)
+	}
+}
+
+func (e *Exporter) fail(req request, err error) {
+	e.eventsFailed.Add(context.Background(), int64(req.events))
+	e.logger.With(logp.Error(err)).Errorf(
+		"failed to export %s, dropping %d events", req.signal, req.events,
+	)
+}
+
+// Close stops accepting new events and waits for queued events to be
+// exported. If ctx is cancelled before the queue has been drained, any
+// in-flight requests are aborted and ctx.Err() is returned.
+func (e *Exporter) Close(ctx context.Context) error {
+	e.stopOnce.Do(func() { close(e.stopping) })
+
+	// Wait for any ProcessBatch calls to return before
+	// closing the queue, so they cannot send on it.
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return nil
+	}
+	e.closed = true
+	close(e.queue)
+	e.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.workers.Wait()
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		e.cancelWorkers()
+		<-done
+	}
+	e.cancelWorkers()
+	return errors.Join(err, e.client.close())
+}
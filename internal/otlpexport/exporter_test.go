@@ -0,0 +1,193 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlpexport_test
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/elastic/apm-data/model/modelpb"
+	"github.com/elastic/apm-server/internal/otlpexport"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestExporterHTTP(t *testing.T) {
+	var mu sync.Mutex
+	var attempts int
+	received := make(chan ptraceotlp.ExportRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		attempt := attempts
+		mu.Unlock()
+		if attempt == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "secret", r.Header.Get("Authorization"))
+		zr, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		req := ptraceotlp.NewExportRequest()
+		require.NoError(t, req.UnmarshalProto(body))
+		received <- req
+	}))
+	defer srv.Close()
+
+	cfg := otlpexport.DefaultConfig()
+	cfg.Protocol = otlpexport.ProtocolHTTP
+	cfg.Endpoint = srv.URL
+	cfg.Headers = map[string]string{"Authorization": "secret"}
+	cfg.Retry.InitialInterval = time.Millisecond
+	exporter := newExporter(t, cfg)
+
+	require.NoError(t, exporter.ProcessBatch(context.Background(), makeBatch()))
+	select {
+	case req := <-received:
+		assert.Equal(t, 1, req.Traces().SpanCount())
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for export request")
+	}
+	require.NoError(t, exporter.Close(context.Background()))
+	assert.Equal(t, 2, attempts)
+}
+
+func TestExporterHTTPNonRetryable(t *testing.T) {
+	var mu sync.Mutex
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	cfg := otlpexport.DefaultConfig()
+	cfg.Protocol = otlpexport.ProtocolHTTP
+	cfg.Endpoint = srv.URL
+	cfg.Retry.InitialInterval = time.Millisecond
+	exporter := newExporter(t, cfg)
+
+	require.NoError(t, exporter.ProcessBatch(context.Background(), makeBatch()))
+	require.NoError(t, exporter.Close(context.Background()))
+	assert.Equal(t, 1, attempts)
+}
+
+func TestExporterGRPC(t *testing.T) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	receiver := &traceReceiver{received: make(chan ptraceotlp.ExportRequest, 1)}
+	srv := grpc.NewServer()
+	ptraceotlp.RegisterGRPCServer(srv, receiver)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	cfg := otlpexport.DefaultConfig()
+	cfg.Endpoint = lis.Addr().String()
+	cfg.Headers = map[string]string{"authorization": "secret"}
+	exporter := newExporter(t, cfg)
+
+	require.NoError(t, exporter.ProcessBatch(context.Background(), makeBatch()))
+	select {
+	case req := <-receiver.received:
+		assert.Equal(t, 1, req.Traces().SpanCount())
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for export request")
+	}
+	require.NoError(t, exporter.Close(context.Background()))
+	assert.Equal(t, []string{"secret"}, receiver.md.Get("authorization"))
+}
+
+func TestExporterClosed(t *testing.T) {
+	cfg := otlpexport.DefaultConfig()
+	exporter := newExporter(t, cfg)
+	require.NoError(t, exporter.Close(context.Background()))
+	err := exporter.ProcessBatch(context.Background(), makeBatch())
+	assert.ErrorIs(t, err, otlpexport.ErrClosed)
+}
+
+func TestConfigValidate(t *testing.T) {
+	cfg := otlpexport.DefaultConfig()
+	require.NoError(t, cfg.Validate())
+
+	cfg.Protocol = "udp"
+	assert.EqualError(t, cfg.Validate(), `invalid protocol "udp", expected "grpc", "http" or "file"`)
+
+	cfg = otlpexport.DefaultConfig()
+	cfg.Compression = "zstd"
+	assert.EqualError(t, cfg.Validate(), `invalid compression "zstd", expected "gzip" or "none"`)
+
+	cfg = otlpexport.DefaultConfig()
+	cfg.Endpoint = ""
+	assert.EqualError(t, cfg.Validate(), "endpoint must be specified")
+
+	cfg.Protocol = otlpexport.ProtocolFile
+	assert.EqualError(t, cfg.Validate(), "path must be specified for the file protocol")
+	cfg.Path = t.TempDir()
+	require.NoError(t, cfg.Validate())
+}
+
+type traceReceiver struct {
+	ptraceotlp.UnimplementedGRPCServer
+	md       metadata.MD
+	received chan ptraceotlp.ExportRequest
+}
+
+func (r *traceReceiver) Export(ctx context.Context, req ptraceotlp.ExportRequest) (ptraceotlp.ExportResponse, error) {
+	r.md, _ = metadata.FromIncomingContext(ctx)
+	r.received <- req
+	return ptraceotlp.NewExportResponse(), nil
+}
+
+func newExporter(t testing.TB, cfg otlpexport.Config) *otlpexport.Exporter {
+	exporter, err := otlpexport.New(cfg, logptest.NewTestingLogger(t, ""), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		exporter.Close(ctx)
+	})
+	return exporter
+}
+
+func makeBatch() *modelpb.Batch {
+	return &modelpb.Batch{{
+		Timestamp:   1000,
+		Service:     &modelpb.Service{Name: "svc"},
+		Trace:       &modelpb.Trace{Id: "0102030405060708090a0b0c0d0e0f10"},
+		Transaction: &modelpb.Transaction{Id: "0102030405060708", Name: "tx", Type: "request"},
+	}}
+}
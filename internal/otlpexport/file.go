@@ -0,0 +1,106 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlpexport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+
+	"github.com/elastic/elastic-agent-libs/file"
+)
+
+const (
+	fileExtension   = "ndjson"
+	fileMaxSize     = 10 * 1024 * 1024 // 10MiB
+	fileMaxBackups  = 4
+	filePermissions = 0600
+)
+
+// fileClient writes export requests as newline-delimited OTLP/JSON,
+// in the format read by the OpenTelemetry Collector's otlpjsonfile
+// receiver, to size-rotated files named after each signal.
+type fileClient struct {
+	mu       sync.Mutex
+	rotators map[string]*file.Rotator
+}
+
+func newFileClient(cfg Config) (*fileClient, error) {
+	c := &fileClient{rotators: make(map[string]*file.Rotator)}
+	for _, signal := range []string{"traces", "metrics", "logs"} {
+		rotator, err := file.NewFileRotator(
+			filepath.Join(cfg.Path, signal),
+			file.Extension(fileExtension),
+			file.MaxSizeBytes(fileMaxSize),
+			file.MaxBackups(fileMaxBackups),
+			file.Permissions(filePermissions),
+			file.RotateOnStartup(false),
+		)
+		if err != nil {
+			c.close()
+			return nil, fmt.Errorf("failed to create %s file: %w", signal, err)
+		}
+		c.rotators[signal] = rotator
+	}
+	return c, nil
+}
+
+func (c *fileClient) exportTraces(_ context.Context, req ptraceotlp.ExportRequest) error {
+	return c.write("traces", req)
+}
+
+func (c *fileClient) exportMetrics(_ context.Context, req pmetricotlp.ExportRequest) error {
+	return c.write("metrics", req)
+}
+
+func (c *fileClient) exportLogs(_ context.Context, req plogotlp.ExportRequest) error {
+	return c.write("logs", req)
+}
+
+func (c *fileClient) write(signal string, req json.Marshaler) error {
+	line, err := req.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.rotators[signal].Write(line); err != nil {
+		return fmt.Errorf("failed to write %s: %w", signal, err)
+	}
+	return nil
+}
+
+func (c *fileClient) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errs []error
+	for _, rotator := range c.rotators {
+		if err := rotator.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
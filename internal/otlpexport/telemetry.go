@@ -0,0 +1,296 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlpexport
+
+import (
+	"context"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// ExportSpans implements sdktrace.SpanExporter, converting spans
+// recorded by the OpenTelemetry SDK to OTLP and enqueuing them for
+// export. This is used for exporting the server's own traces.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	r := ptraceotlp.NewExportRequestFromTraces(convertSpans(spans))
+	return e.enqueue(ctx, request{
+		signal: "traces",
+		events: len(spans),
+		export: func(ctx context.Context, c client) error { return c.exportTraces(ctx, r) },
+	})
+}
+
+// Shutdown implements sdktrace.SpanExporter, closing the exporter.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	return e.Close(ctx)
+}
+
+// ExportMetrics converts metrics collected by the OpenTelemetry SDK
+// to OTLP and enqueues them for export. This is used for exporting
+// the server's own metrics.
+func (e *Exporter) ExportMetrics(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	metrics := convertResourceMetrics(rm)
+	n := metrics.DataPointCount()
+	if n == 0 {
+		return nil
+	}
+	r := pmetricotlp.NewExportRequestFromMetrics(metrics)
+	return e.enqueue(ctx, request{
+		signal: "metrics",
+		events: n,
+		export: func(ctx context.Context, c client) error { return c.exportMetrics(ctx, r) },
+	})
+}
+
+func convertSpans(spans []sdktrace.ReadOnlySpan) ptrace.Traces {
+	type scopeKey struct {
+		resource *sdkresource.Resource
+		scope    string
+	}
+	traces := ptrace.NewTraces()
+	resourceSpans := make(map[*sdkresource.Resource]ptrace.ResourceSpans)
+	scopeSpans := make(map[scopeKey]ptrace.ScopeSpans)
+	for _, span := range spans {
+		res := span.Resource()
+		rs, ok := resourceSpans[res]
+		if !ok {
+			rs = traces.ResourceSpans().AppendEmpty()
+			convertResource(res, rs.Resource())
+			rs.SetSchemaUrl(res.SchemaURL())
+			resourceSpans[res] = rs
+		}
+		scope := span.InstrumentationScope()
+		key := scopeKey{resource: res, scope: scope.Name + "\x00" + scope.Version + "\x00" + scope.SchemaURL}
+		ss, ok := scopeSpans[key]
+		if !ok {
+			ss = rs.ScopeSpans().AppendEmpty()
+			convertScope(scope, ss.Scope())
+			ss.SetSchemaUrl(scope.SchemaURL)
+			scopeSpans[key] = ss
+		}
+		convertSDKSpan(span, ss.Spans().AppendEmpty())
+	}
+	return traces
+}
+
+func convertSDKSpan(in sdktrace.ReadOnlySpan, out ptrace.Span) {
+	sc := in.SpanContext()
+	out.SetTraceID(pcommon.TraceID(sc.TraceID()))
+	out.SetSpanID(pcommon.SpanID(sc.SpanID()))
+	out.TraceState().FromRaw(sc.TraceState().String())
+	if parent := in.Parent(); parent.IsValid() {
+		out.SetParentSpanID(pcommon.SpanID(parent.SpanID()))
+	}
+	out.SetName(in.Name())
+	// OpenTelemetry API and OTLP span kinds have the same values.
+	out.SetKind(ptrace.SpanKind(in.SpanKind()))
+	out.SetStartTimestamp(pcommon.NewTimestampFromTime(in.StartTime()))
+	out.SetEndTimestamp(pcommon.NewTimestampFromTime(in.EndTime()))
+	putAttributes(out.Attributes(), in.Attributes())
+	out.SetDroppedAttributesCount(uint32(in.DroppedAttributes()))
+
+	for _, event := range in.Events() {
+		e := out.Events().AppendEmpty()
+		e.SetName(event.Name)
+		e.SetTimestamp(pcommon.NewTimestampFromTime(event.Time))
+		putAttributes(e.Attributes(), event.Attributes)
+		e.SetDroppedAttributesCount(uint32(event.DroppedAttributeCount))
+	}
+	out.SetDroppedEventsCount(uint32(in.DroppedEvents()))
+
+	for _, link := range in.Links() {
+		l := out.Links().AppendEmpty()
+		l.SetTraceID(pcommon.TraceID(link.SpanContext.TraceID()))
+		l.SetSpanID(pcommon.SpanID(link.SpanContext.SpanID()))
+		l.TraceState().FromRaw(link.SpanContext.TraceState().String())
+		putAttributes(l.Attributes(), link.Attributes)
+		l.SetDroppedAttributesCount(uint32(link.DroppedAttributeCount))
+	}
+	out.SetDroppedLinksCount(uint32(in.DroppedLinks()))
+
+	status := in.Status()
+	switch status.Code {
+	case codes.Ok:
+		out.Status().SetCode(ptrace.StatusCodeOk)
+	case codes.Error:
+		out.Status().SetCode(ptrace.StatusCodeError)
+		out.Status().SetMessage(status.Description)
+	}
+}
+
+func convertResourceMetrics(in *metricdata.ResourceMetrics) pmetric.Metrics {
+	metrics := pmetric.NewMetrics()
+	rm := metrics.ResourceMetrics().AppendEmpty()
+	if in.Resource != nil {
+		convertResource(in.Resource, rm.Resource())
+		rm.SetSchemaUrl(in.Resource.SchemaURL())
+	}
+	for _, scopeMetrics := range in.ScopeMetrics {
+		sm := rm.ScopeMetrics().AppendEmpty()
+		convertScope(scopeMetrics.Scope, sm.Scope())
+		sm.SetSchemaUrl(scopeMetrics.Scope.SchemaURL)
+		for _, m := range scopeMetrics.Metrics {
+			convertSDKMetric(m, sm.Metrics())
+		}
+	}
+	return metrics
+}
+
+// convertSDKMetric converts m, appending it to out. Exponential
+// histograms and summaries are not supported, and are skipped.
+func convertSDKMetric(in metricdata.Metrics, out pmetric.MetricSlice) {
+	var m pmetric.Metric
+	newMetric := func() pmetric.Metric {
+		m = out.AppendEmpty()
+		m.SetName(in.Name)
+		m.SetDescription(in.Description)
+		m.SetUnit(in.Unit)
+		return m
+	}
+	switch data := in.Data.(type) {
+	case metricdata.Gauge[int64]:
+		convertNumberDataPoints(data.DataPoints, newMetric().SetEmptyGauge().DataPoints())
+	case metricdata.Gauge[float64]:
+		convertNumberDataPoints(data.DataPoints, newMetric().SetEmptyGauge().DataPoints())
+	case metricdata.Sum[int64]:
+		sum := newMetric().SetEmptySum()
+		sum.SetIsMonotonic(data.IsMonotonic)
+		sum.SetAggregationTemporality(convertTemporality(data.Temporality))
+		convertNumberDataPoints(data.DataPoints, sum.DataPoints())
+	case metricdata.Sum[float64]:
+		sum := newMetric().SetEmptySum()
+		sum.SetIsMonotonic(data.IsMonotonic)
+		sum.SetAggregationTemporality(convertTemporality(data.Temporality))
+		convertNumberDataPoints(data.DataPoints, sum.DataPoints())
+	case metricdata.Histogram[int64]:
+		hist := newMetric().SetEmptyHistogram()
+		hist.SetAggregationTemporality(convertTemporality(data.Temporality))
+		convertHistogramDataPoints(data.DataPoints, hist.DataPoints())
+	case metricdata.Histogram[float64]:
+		hist := newMetric().SetEmptyHistogram()
+		hist.SetAggregationTemporality(convertTemporality(data.Temporality))
+		convertHistogramDataPoints(data.DataPoints, hist.DataPoints())
+	}
+}
+
+func convertNumberDataPoints[N int64 | float64](in []metricdata.DataPoint[N], out pmetric.NumberDataPointSlice) {
+	for _, dp := range in {
+		p := out.AppendEmpty()
+		putAttributes(p.Attributes(), dp.Attributes.ToSlice())
+		p.SetStartTimestamp(pcommon.NewTimestampFromTime(dp.StartTime))
+		p.SetTimestamp(pcommon.NewTimestampFromTime(dp.Time))
+		switch v := any(dp.Value).(type) {
+		case int64:
+			p.SetIntValue(v)
+		case float64:
+			p.SetDoubleValue(v)
+		}
+	}
+}
+
+func convertHistogramDataPoints[N int64 | float64](in []metricdata.HistogramDataPoint[N], out pmetric.HistogramDataPointSlice) {
+	for _, dp := range in {
+		p := out.AppendEmpty()
+		putAttributes(p.Attributes(), dp.Attributes.ToSlice())
+		p.SetStartTimestamp(pcommon.NewTimestampFromTime(dp.StartTime))
+		p.SetTimestamp(pcommon.NewTimestampFromTime(dp.Time))
+		p.SetCount(dp.Count)
+		p.SetSum(float64(dp.Sum))
+		p.ExplicitBounds().FromRaw(dp.Bounds)
+		p.BucketCounts().FromRaw(dp.BucketCounts)
+		if v, ok := dp.Min.Value(); ok {
+			p.SetMin(float64(v))
+		}
+		if v, ok := dp.Max.Value(); ok {
+			p.SetMax(float64(v))
+		}
+	}
+}
+
+func convertTemporality(t metricdata.Temporality) pmetric.AggregationTemporality {
+	switch t {
+	case metricdata.CumulativeTemporality:
+		return pmetric.AggregationTemporalityCumulative
+	case metricdata.DeltaTemporality:
+		return pmetric.AggregationTemporalityDelta
+	}
+	return pmetric.AggregationTemporalityUnspecified
+}
+
+func convertResource(in *sdkresource.Resource, out pcommon.Resource) {
+	putAttributes(out.Attributes(), in.Attributes())
+}
+
+func convertScope(in instrumentation.Scope, out pcommon.InstrumentationScope) {
+	out.SetName(in.Name)
+	out.SetVersion(in.Version)
+	putAttributes(out.Attributes(), in.Attributes.ToSlice())
+}
+
+// putAttributes puts OpenTelemetry API attributes in m.
+func putAttributes(m pcommon.Map, attrs []attribute.KeyValue) {
+	m.EnsureCapacity(m.Len() + len(attrs))
+	for _, kv := range attrs {
+		key := string(kv.Key)
+		switch kv.Value.Type() {
+		case attribute.BOOL:
+			m.PutBool(key, kv.Value.AsBool())
+		case attribute.INT64:
+			m.PutInt(key, kv.Value.AsInt64())
+		case attribute.FLOAT64:
+			m.PutDouble(key, kv.Value.AsFloat64())
+		case attribute.STRING:
+			m.PutStr(key, kv.Value.AsString())
+		case attribute.BOOLSLICE:
+			s := m.PutEmptySlice(key)
+			for _, v := range kv.Value.AsBoolSlice() {
+				s.AppendEmpty().SetBool(v)
+			}
+		case attribute.INT64SLICE:
+			s := m.PutEmptySlice(key)
+			for _, v := range kv.Value.AsInt64Slice() {
+				s.AppendEmpty().SetInt(v)
+			}
+		case attribute.FLOAT64SLICE:
+			s := m.PutEmptySlice(key)
+			for _, v := range kv.Value.AsFloat64Slice() {
+				s.AppendEmpty().SetDouble(v)
+			}
+		case attribute.STRINGSLICE:
+			s := m.PutEmptySlice(key)
+			for _, v := range kv.Value.AsStringSlice() {
+				s.AppendEmpty().SetStr(v)
+			}
+		default:
+			m.PutStr(key, kv.Value.Emit())
+		}
+	}
+}
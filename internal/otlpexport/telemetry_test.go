@@ -0,0 +1,163 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlpexport_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/elastic/apm-server/internal/otlpexport"
+)
+
+func TestExporterExportSpans(t *testing.T) {
+	cfg := otlpexport.DefaultConfig()
+	cfg.Protocol = otlpexport.ProtocolFile
+	cfg.Path = t.TempDir()
+	exporter := newExporter(t, cfg)
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := tp.Tracer("test", trace.WithInstrumentationVersion("1.0"))
+	ctx, parent := tracer.Start(context.Background(), "parent", trace.WithSpanKind(trace.SpanKindServer))
+	_, child := tracer.Start(ctx, "child", trace.WithAttributes(
+		attribute.String("string", "value"),
+		attribute.Int64Slice("ints", []int64{1, 2}),
+	))
+	child.AddEvent("event")
+	child.RecordError(errors.New("boom"))
+	child.SetStatus(codes.Error, "failed")
+	child.End()
+	parent.SetStatus(codes.Ok, "")
+	parent.End()
+	require.NoError(t, tp.Shutdown(context.Background()))
+
+	lines := readLines(t, cfg.Path, "traces")
+	require.Len(t, lines, 2)
+	spans := make(map[string]ptrace.Span)
+	for _, line := range lines {
+		req := ptraceotlp.NewExportRequest()
+		require.NoError(t, req.UnmarshalJSON(line))
+		rs := req.Traces().ResourceSpans().At(0)
+		ss := rs.ScopeSpans().At(0)
+		assert.Equal(t, "test", ss.Scope().Name())
+		assert.Equal(t, "1.0", ss.Scope().Version())
+		span := ss.Spans().At(0)
+		spans[span.Name()] = span
+	}
+
+	parentSpan, childSpan := spans["parent"], spans["child"]
+	assert.Equal(t, ptrace.SpanKindServer, parentSpan.Kind())
+	assert.Equal(t, ptrace.StatusCodeOk, parentSpan.Status().Code())
+	assert.True(t, parentSpan.ParentSpanID().IsEmpty())
+
+	assert.Equal(t, ptrace.SpanKindInternal, childSpan.Kind())
+	assert.Equal(t, parentSpan.TraceID(), childSpan.TraceID())
+	assert.Equal(t, parentSpan.SpanID(), childSpan.ParentSpanID())
+	assert.Equal(t, ptrace.StatusCodeError, childSpan.Status().Code())
+	assert.Equal(t, "failed", childSpan.Status().Message())
+	assert.Equal(t, map[string]any{
+		"string": "value",
+		"ints":   []any{int64(1), int64(2)},
+	}, childSpan.Attributes().AsRaw())
+	require.Equal(t, 2, childSpan.Events().Len())
+	assert.Equal(t, "event", childSpan.Events().At(0).Name())
+	assert.Equal(t, "exception", childSpan.Events().At(1).Name())
+}
+
+func TestExporterExportMetrics(t *testing.T) {
+	cfg := otlpexport.DefaultConfig()
+	cfg.Protocol = otlpexport.ProtocolFile
+	cfg.Path = t.TempDir()
+	exporter := newExporter(t, cfg)
+
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	meter := mp.Meter("test")
+	counter, err := meter.Int64Counter("requests")
+	require.NoError(t, err)
+	counter.Add(context.Background(), 3, metric.WithAttributes(attribute.String("outcome", "success")))
+	histogram, err := meter.Float64Histogram("duration", metric.WithUnit("s"))
+	require.NoError(t, err)
+	histogram.Record(context.Background(), 0.5)
+	histogram.Record(context.Background(), 1.5)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.NoError(t, exporter.ExportMetrics(context.Background(), &rm))
+	require.NoError(t, exporter.Close(context.Background()))
+
+	lines := readLines(t, cfg.Path, "metrics")
+	require.Len(t, lines, 1)
+	req := pmetricotlp.NewExportRequest()
+	require.NoError(t, req.UnmarshalJSON(lines[0]))
+	metrics := req.Metrics().ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics()
+	byName := make(map[string]pmetric.Metric)
+	for i := 0; i < metrics.Len(); i++ {
+		byName[metrics.At(i).Name()] = metrics.At(i)
+	}
+
+	sum := byName["requests"].Sum()
+	assert.True(t, sum.IsMonotonic())
+	assert.Equal(t, pmetric.AggregationTemporalityCumulative, sum.AggregationTemporality())
+	require.Equal(t, 1, sum.DataPoints().Len())
+	assert.Equal(t, int64(3), sum.DataPoints().At(0).IntValue())
+	assert.Equal(t, map[string]any{"outcome": "success"}, sum.DataPoints().At(0).Attributes().AsRaw())
+
+	assert.Equal(t, "s", byName["duration"].Unit())
+	hist := byName["duration"].Histogram()
+	require.Equal(t, 1, hist.DataPoints().Len())
+	assert.Equal(t, uint64(2), hist.DataPoints().At(0).Count())
+	assert.Equal(t, 2.0, hist.DataPoints().At(0).Sum())
+	assert.Equal(t, 0.5, hist.DataPoints().At(0).Min())
+	assert.Equal(t, 1.5, hist.DataPoints().At(0).Max())
+}
+
+// readLines reads the lines of the file written for signal in dir.
+func readLines(t testing.TB, dir, signal string) [][]byte {
+	paths, err := filepath.Glob(filepath.Join(dir, signal+"*.ndjson"))
+	require.NoError(t, err)
+	require.Len(t, paths, 1)
+	f, err := os.Open(paths[0])
+	require.NoError(t, err)
+	defer f.Close()
+	var lines [][]byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, append([]byte(nil), scanner.Bytes()...))
+	}
+	require.NoError(t, scanner.Err())
+	return lines
+}
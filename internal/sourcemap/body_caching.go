@@ -101,6 +101,15 @@ func (s *BodyCachingFetcher) Fetch(ctx context.Context, name, version, path stri
 	return consumer, nil
 }
 
+// Purge removes all source maps from the cache, returning the number of
+// entries removed. Subsequent fetches will be served by the wrapped backend.
+func (s *BodyCachingFetcher) Purge() int {
+	n := s.cache.Len()
+	s.cache.Purge()
+	s.logger.Infof("Purged %d entries from the cache", n)
+	return n
+}
+
 func (s *BodyCachingFetcher) add(key identifier, consumer *sourcemap.Consumer) {
 	s.cache.Add(key, consumer)
 	s.logger.Debugf("Added id %v. Cache now has %v entries.", key, s.cache.Len())
@@ -54,6 +54,17 @@ func Test_NewCachingFetcher(t *testing.T) {
 	assert.NotNil(t, f.cache)
 }
 
+func TestBodyCachingFetcherPurge(t *testing.T) {
+	key := identifier{name: "foo", version: "1.0.1", path: "/tmp"}
+	store := testCachingFetcher(t, newUnavailableElasticsearchClient(t))
+	store.add(key, &sourcemap.Consumer{})
+
+	assert.Equal(t, 1, store.Purge())
+	_, found := store.cache.Get(key)
+	assert.False(t, found)
+	assert.Equal(t, 0, store.Purge())
+}
+
 func TestStore_Fetch(t *testing.T) {
 	serviceName, serviceVersion, path := "foo", "1.0.1", "/tmp"
 	key := identifier{
@@ -0,0 +1,206 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package spool
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/elastic/apm-data/model/modelpb"
+)
+
+// Each record holds one batch, and is laid out as follows:
+//
+//	payload length (4 bytes)
+//	CRC-32C checksum of the remainder of the record (4 bytes)
+//	write time in Unix nanoseconds (8 bytes)
+//	number of events (4 bytes)
+//	payload: for each event, its uvarint-encoded length and protobuf encoding
+//
+// All integers are little-endian.
+const recordHeaderSize = 20
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var errCorruptRecord = errors.New("corrupt spool record")
+
+type record struct {
+	batch     modelpb.Batch
+	timestamp time.Time
+	size      int64
+}
+
+func encodeRecord(batch modelpb.Batch, now time.Time) ([]byte, error) {
+	size := recordHeaderSize
+	for _, event := range batch {
+		n := event.SizeVT()
+		size += uvarintSize(uint64(n)) + n
+	}
+	buf := make([]byte, recordHeaderSize, size)
+	binary.LittleEndian.PutUint64(buf[8:], uint64(now.UnixNano()))
+	binary.LittleEndian.PutUint32(buf[16:], uint32(len(batch)))
+	for _, event := range batch {
+		n := event.SizeVT()
+		buf = binary.AppendUvarint(buf, uint64(n))
+		buf = buf[:len(buf)+n]
+		if _, err := event.MarshalToSizedBufferVT(buf[len(buf)-n:]); err != nil {
+			return nil, err
+		}
+	}
+	binary.LittleEndian.PutUint32(buf[0:], uint32(len(buf)-recordHeaderSize))
+	binary.LittleEndian.PutUint32(buf[4:], crc32.Checksum(buf[8:], crcTable))
+	return buf, nil
+}
+
+// readRecord reads and decodes the record at offset in f, which must
+// end at or before limit.
+func readRecord(f *os.File, offset, limit int64) (record, error) {
+	var header [recordHeaderSize]byte
+	if offset+recordHeaderSize > limit {
+		return record{}, errCorruptRecord
+	}
+	if _, err := f.ReadAt(header[:], offset); err != nil {
+		return record{}, err
+	}
+	size := recordHeaderSize + int64(binary.LittleEndian.Uint32(header[0:]))
+	if offset+size > limit {
+		return record{}, errCorruptRecord
+	}
+	buf := make([]byte, size)
+	if _, err := f.ReadAt(buf, offset); err != nil {
+		return record{}, err
+	}
+	if crc32.Checksum(buf[8:], crcTable) != binary.LittleEndian.Uint32(buf[4:]) {
+		return record{}, errCorruptRecord
+	}
+	r := record{
+		timestamp: time.Unix(0, int64(binary.LittleEndian.Uint64(buf[8:]))),
+		batch:     make(modelpb.Batch, binary.LittleEndian.Uint32(buf[16:])),
+		size:      size,
+	}
+	payload := buf[recordHeaderSize:]
+	for i := range r.batch {
+		n, k := binary.Uvarint(payload)
+		if k <= 0 || uint64(len(payload)-k) < n {
+			return record{}, errCorruptRecord
+		}
+		payload = payload[k:]
+		event := &modelpb.APMEvent{}
+		if err := event.UnmarshalVT(payload[:n]); err != nil {
+			return record{}, fmt.Errorf("%w: %w", errCorruptRecord, err)
+		}
+		r.batch[i] = event
+		payload = payload[n:]
+	}
+	return r, nil
+}
+
+// scanSegment walks the records of the segment file at path from the
+// record boundary start, returning the size of the segment and the number
+// of events from start. If the segment ends with an incomplete record,
+// e.g. due to a crash while writing, the segment is truncated to exclude
+// it. If validate is true, record checksums are also verified.
+func scanSegment(path string, start int64, validate bool) (size, events int64, err error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	limit := info.Size()
+	if start > limit {
+		return limit, 0, nil
+	}
+	offset := start
+	for offset < limit {
+		var header [recordHeaderSize]byte
+		if offset+recordHeaderSize > limit {
+			break
+		}
+		if _, err := f.ReadAt(header[:], offset); err != nil {
+			return 0, 0, err
+		}
+		n := recordHeaderSize + int64(binary.LittleEndian.Uint32(header[0:]))
+		if offset+n > limit {
+			break
+		}
+		if validate {
+			if _, err := readRecord(f, offset, limit); err != nil {
+				if errors.Is(err, errCorruptRecord) {
+					break
+				}
+				return 0, 0, err
+			}
+		}
+		events += int64(binary.LittleEndian.Uint32(header[16:]))
+		offset += n
+	}
+	if offset < limit {
+		if err := f.Truncate(offset); err != nil {
+			return 0, 0, err
+		}
+	}
+	return offset, events, nil
+}
+
+// readCursor returns the position of the next record to be consumed.
+func (s *Spool) readCursor() (segment uint64, offset int64, err error) {
+	data, err := os.ReadFile(filepath.Join(s.cfg.Dir, cursorFileName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, 0, nil
+		}
+		return 0, 0, fmt.Errorf("failed to read spool cursor: %w", err)
+	}
+	if len(data) != 16 {
+		s.logger.Warn("ignoring invalid spool cursor, spooled events may be replayed")
+		return 0, 0, nil
+	}
+	return binary.LittleEndian.Uint64(data), int64(binary.LittleEndian.Uint64(data[8:])), nil
+}
+
+// writeCursor records the position of the next record to be consumed.
+// The cursor is written to a temporary file and renamed, so a crash
+// leaves either the old or the new cursor in place.
+func (s *Spool) writeCursor() error {
+	var data [16]byte
+	binary.LittleEndian.PutUint64(data[:], s.readSegment)
+	binary.LittleEndian.PutUint64(data[8:], uint64(s.readOffset))
+	path := filepath.Join(s.cfg.Dir, cursorFileName)
+	if err := os.WriteFile(path+".tmp", data[:], 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func uvarintSize(x uint64) int {
+	n := 1
+	for x >= 0x80 {
+		x >>= 7
+		n++
+	}
+	return n
+}
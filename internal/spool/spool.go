@@ -0,0 +1,586 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package spool provides a durable, size-bounded, on-disk queue of event
+// batches, used to decouple event intake from the output.
+//
+// Batches are appended to segment files and synced to disk before being
+// acknowledged. A single consumer reads batches back in the order they
+// were written and passes them to a downstream processor, recording its
+// position so that unconsumed batches are replayed after a restart.
+package spool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofrs/flock"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+
+	"github.com/elastic/apm-data/model/modelpb"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const (
+	defaultSegmentSize = 64 * 1024 * 1024
+
+	segmentFileSuffix = ".segment"
+	cursorFileName    = "cursor"
+	lockFileName      = "spool.lock"
+	lockRetryDelay    = 100 * time.Millisecond
+
+	minRetryBackoff = 100 * time.Millisecond
+	maxRetryBackoff = 30 * time.Second
+)
+
+var (
+	// ErrFull is returned by Spool.ProcessBatch when accepting the
+	// batch would exceed the configured maximum size of the spool.
+	ErrFull = errors.New("spool is full")
+
+	// ErrClosed is returned by Spool.ProcessBatch after the spool
+	// has been closed.
+	ErrClosed = errors.New("spool is closed")
+)
+
+// Config holds configuration for New.
+type Config struct {
+	// Dir holds the directory in which spooled batches are stored.
+	// The directory will be created if it does not exist.
+	Dir string
+
+	// MaxSize holds the maximum size of unconsumed spooled batches on
+	// disk, in bytes. Consumed batches remain on disk until their segment
+	// is deleted, so disk usage may exceed MaxSize by up to SegmentSize.
+	MaxSize uint64
+
+	// SegmentSize holds the size, in bytes, at which segment files are
+	// rotated. Segments are deleted once all of their batches have been
+	// consumed. If SegmentSize is zero, a quarter of MaxSize is used, up
+	// to a maximum of 64MiB.
+	SegmentSize int64
+
+	// Processor holds the modelpb.BatchProcessor to which spooled
+	// batches are passed, in order, by Run. A batch is consumed once
+	// ProcessBatch returns nil, so Processor should not return until
+	// the batch has been durably delivered.
+	Processor modelpb.BatchProcessor
+
+	// Logger holds the logger for the spool.
+	Logger *logp.Logger
+
+	// MeterProvider holds the metric.MeterProvider for recording
+	// spool metrics. If nil, no metrics are recorded.
+	MeterProvider metric.MeterProvider
+}
+
+// Spool is a modelpb.BatchProcessor which durably stores batches on disk,
+// and a consumer which delivers stored batches to a downstream processor.
+//
+// ProcessBatch may be called concurrently. Run must be called at most once,
+// and Close must be called only after Run has returned.
+type Spool struct {
+	cfg    Config
+	logger *logp.Logger
+	lock   *flock.Flock
+	notify chan struct{}
+
+	mu       sync.Mutex
+	closed   bool
+	segments []*segment // ordered by id; the last is being written to
+	file     *os.File   // write handle for the last segment
+	size     int64      // total size of unconsumed records on disk
+	events   int64      // number of unconsumed events
+	written  uint64     // number of records written
+
+	syncMu sync.Mutex
+	synced uint64 // number of records known to be synced to disk
+
+	// oldest holds the write time of the record currently being
+	// delivered, in Unix nanoseconds, or zero if there is none.
+	oldest atomic.Int64
+
+	// The following fields are only accessed by Run.
+	readFile    *os.File
+	readSegment uint64
+	readOffset  int64
+
+	eventsAccepted  metric.Int64Counter
+	eventsRejected  metric.Int64Counter
+	eventsDelivered metric.Int64Counter
+}
+
+type segment struct {
+	id       uint64
+	size     int64
+	consumed int64 // number of bytes consumed
+	events   int64 // number of unconsumed events
+}
+
+// New returns a new Spool, opening or creating the spool directory
+// and recovering any batches that were spooled but not yet consumed.
+//
+// Only one Spool may use a directory at a time. If the directory is in
+// use, New blocks until it is released or ctx is cancelled; this allows
+// a new Spool to be created while the Spool it replaces is being closed.
+func New(ctx context.Context, cfg Config) (*Spool, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("spool directory unspecified")
+	}
+	if cfg.MaxSize == 0 {
+		return nil, errors.New("spool max size must be greater than zero")
+	}
+	if cfg.Processor == nil {
+		return nil, errors.New("spool processor unspecified")
+	}
+	if cfg.SegmentSize <= 0 {
+		cfg.SegmentSize = int64(min(cfg.MaxSize/4, defaultSegmentSize))
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = logp.NewNopLogger()
+	}
+	if cfg.MeterProvider == nil {
+		cfg.MeterProvider = noop.NewMeterProvider()
+	}
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	lock := flock.New(filepath.Join(cfg.Dir, lockFileName))
+	if _, err := lock.TryLockContext(ctx, lockRetryDelay); err != nil {
+		return nil, fmt.Errorf("failed to lock spool directory: %w", err)
+	}
+	s := &Spool{
+		cfg:    cfg,
+		logger: cfg.Logger,
+		lock:   lock,
+		notify: make(chan struct{}, 1),
+	}
+	if err := s.recover(); err != nil {
+		lock.Unlock()
+		return nil, err
+	}
+	if err := s.registerMetrics(cfg.MeterProvider); err != nil {
+		s.file.Close()
+		lock.Unlock()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Spool) registerMetrics(mp metric.MeterProvider) error {
+	meter := mp.Meter("github.com/elastic/apm-server/internal/spool")
+	var err error
+	if s.eventsAccepted, err = meter.Int64Counter("apm-server.spool.events.accepted"); err != nil {
+		return err
+	}
+	if s.eventsRejected, err = meter.Int64Counter("apm-server.spool.events.rejected"); err != nil {
+		return err
+	}
+	if s.eventsDelivered, err = meter.Int64Counter("apm-server.spool.events.delivered"); err != nil {
+		return err
+	}
+	queueBytes, err := meter.Int64ObservableGauge("apm-server.spool.queue.bytes", metric.WithUnit("By"))
+	if err != nil {
+		return err
+	}
+	queueEvents, err := meter.Int64ObservableGauge("apm-server.spool.queue.events")
+	if err != nil {
+		return err
+	}
+	queueAge, err := meter.Int64ObservableGauge("apm-server.spool.queue.age", metric.WithUnit("ms"))
+	if err != nil {
+		return err
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		s.mu.Lock()
+		size, events := s.size, s.events
+		s.mu.Unlock()
+		var age int64
+		if oldest := s.oldest.Load(); oldest != 0 {
+			age = time.Since(time.Unix(0, oldest)).Milliseconds()
+		}
+		o.ObserveInt64(queueBytes, size)
+		o.ObserveInt64(queueEvents, events)
+		o.ObserveInt64(queueAge, age)
+		return nil
+	}, queueBytes, queueEvents, queueAge)
+	return err
+}
+
+// recover opens existing segments, discarding those already consumed
+// and truncating any partially written record at the end of the last
+// segment, and then creates a new segment for writing.
+func (s *Spool) recover() error {
+	ids, err := s.listSegments()
+	if err != nil {
+		return err
+	}
+	cursorSegment, cursorOffset, err := s.readCursor()
+	if err != nil {
+		return err
+	}
+	for i, id := range ids {
+		path := s.segmentPath(id)
+		if id < cursorSegment {
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("failed to remove consumed spool segment: %w", err)
+			}
+			continue
+		}
+		var start int64
+		if id == cursorSegment {
+			start = cursorOffset
+		}
+		last := i == len(ids)-1
+		size, events, err := scanSegment(path, start, last)
+		if err != nil {
+			return fmt.Errorf("failed to recover spool segment %q: %w", path, err)
+		}
+		var consumed int64
+		if id == cursorSegment {
+			if size < cursorOffset {
+				// The segment was truncated before the cursor;
+				// nothing remains to be consumed.
+				cursorOffset = size
+			}
+			consumed = cursorOffset
+		}
+		s.segments = append(s.segments, &segment{id: id, size: size, consumed: consumed, events: events})
+		s.size += size - consumed
+		s.events += events
+	}
+
+	if len(s.segments) > 0 && s.segments[0].id == cursorSegment {
+		s.readSegment, s.readOffset = cursorSegment, cursorOffset
+	} else if len(s.segments) > 0 {
+		s.readSegment = s.segments[0].id
+	}
+	var nextID uint64 = 1
+	if len(s.segments) > 0 {
+		nextID = s.segments[len(s.segments)-1].id + 1
+	}
+	if len(s.segments) == 0 {
+		s.readSegment = nextID
+	}
+	if s.events > 0 {
+		s.logger.Infof("recovered %d spooled events (%d bytes)", s.events, s.size)
+	}
+	return s.createSegment(nextID)
+}
+
+func (s *Spool) listSegments() ([]uint64, error) {
+	entries, err := os.ReadDir(s.cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool directory: %w", err)
+	}
+	var ids []uint64
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), segmentFileSuffix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		id, err := strconv.ParseUint(name, 16, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+func (s *Spool) segmentPath(id uint64) string {
+	return filepath.Join(s.cfg.Dir, fmt.Sprintf("%016x%s", id, segmentFileSuffix))
+}
+
+// createSegment creates a new segment file for writing. This must be
+// called with s.mu held, or before the spool is in use.
+func (s *Spool) createSegment(id uint64) error {
+	f, err := os.OpenFile(s.segmentPath(id), os.O_CREATE|os.O_EXCL|os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create spool segment: %w", err)
+	}
+	// Sync the directory so that the segment is not lost on a crash
+	// after records written to it have been acknowledged.
+	if err := syncDir(s.cfg.Dir); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync spool directory: %w", err)
+	}
+	s.segments = append(s.segments, &segment{id: id})
+	s.file = f
+	return nil
+}
+
+// ProcessBatch encodes and appends the batch to the spool, returning
+// once the batch has been synced to disk. ProcessBatch returns ErrFull
+// if the batch does not fit within the configured maximum size.
+func (s *Spool) ProcessBatch(ctx context.Context, batch *modelpb.Batch) error {
+	if len(*batch) == 0 {
+		return nil
+	}
+	record, err := encodeRecord(*batch, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to encode batch: %w", err)
+	}
+	n := int64(len(*batch))
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	if uint64(s.size+int64(len(record))) > s.cfg.MaxSize {
+		s.mu.Unlock()
+		s.eventsRejected.Add(ctx, n)
+		return ErrFull
+	}
+	active := s.segments[len(s.segments)-1]
+	if active.size > 0 && active.size+int64(len(record)) > s.cfg.SegmentSize {
+		if err := s.rotate(); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		active = s.segments[len(s.segments)-1]
+	}
+	// Write at the segment's known size, so that a partial write
+	// following an error is overwritten by the next record.
+	if _, err := s.file.WriteAt(record, active.size); err != nil {
+		s.mu.Unlock()
+		return fmt.Errorf("failed to write to spool: %w", err)
+	}
+	active.size += int64(len(record))
+	active.events += n
+	s.size += int64(len(record))
+	s.events += n
+	s.written++
+	written := s.written
+	s.mu.Unlock()
+
+	if err := s.sync(written); err != nil {
+		return fmt.Errorf("failed to sync spool: %w", err)
+	}
+	s.eventsAccepted.Add(ctx, n)
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// rotate syncs and closes the current segment and creates a new one.
+// This must be called with s.mu held.
+func (s *Spool) rotate() error {
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync spool segment: %w", err)
+	}
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("failed to close spool segment: %w", err)
+	}
+	return s.createSegment(s.segments[len(s.segments)-1].id + 1)
+}
+
+// sync ensures that at least the first n records written have been synced
+// to disk. Concurrent callers share the cost of a single sync.
+func (s *Spool) sync(n uint64) error {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+	if s.synced >= n {
+		return nil
+	}
+	s.mu.Lock()
+	f, written := s.file, s.written
+	s.mu.Unlock()
+	// If the file has been closed then it was rotated, in which
+	// case it was synced prior to being closed.
+	if err := f.Sync(); err != nil && !errors.Is(err, os.ErrClosed) {
+		return err
+	}
+	s.synced = written
+	return nil
+}
+
+// Run reads spooled batches in order and passes them to the configured
+// processor, until the context is cancelled. Batches for which the
+// processor returns an error are retried with backoff, so that they are
+// never skipped.
+//
+// A batch is considered consumed once the processor has returned without
+// error; batches that have been handed to the processor may be lost if
+// the process crashes before the processor has completed delivery.
+func (s *Spool) Run(ctx context.Context) error {
+	defer func() {
+		if s.readFile != nil {
+			s.readFile.Close()
+			s.readFile = nil
+		}
+	}()
+	for {
+		r, err := s.next(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		s.oldest.Store(r.timestamp.UnixNano())
+		if err := s.deliver(ctx, r.batch); err != nil {
+			s.oldest.Store(0)
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		s.oldest.Store(0)
+		s.readOffset += r.size
+
+		// Release the consumed bytes immediately, rather than when the
+		// segment is removed, so that a spool smaller than a segment
+		// does not fill up with consumed records.
+		s.mu.Lock()
+		s.segments[0].consumed += r.size
+		s.segments[0].events -= int64(len(r.batch))
+		s.size -= r.size
+		s.events -= int64(len(r.batch))
+		s.mu.Unlock()
+		s.eventsDelivered.Add(ctx, int64(len(r.batch)))
+		if err := s.writeCursor(); err != nil {
+			s.logger.With(logp.Error(err)).Warn("failed to record spool position")
+		}
+	}
+}
+
+func (s *Spool) deliver(ctx context.Context, batch modelpb.Batch) error {
+	backoff := minRetryBackoff
+	for {
+		err := s.cfg.Processor.ProcessBatch(ctx, &batch)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.logger.With(logp.Error(err)).Warnf(
+			"failed to process spooled events, retrying in %s", backoff,
+		)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
+
+// next blocks until the next record is available, and returns it.
+func (s *Spool) next(ctx context.Context) (record, error) {
+	for {
+		s.mu.Lock()
+		current := s.segments[0]
+		size := current.size
+		sealed := len(s.segments) > 1
+		s.mu.Unlock()
+
+		if current.id != s.readSegment {
+			// The cursor referred to a segment that no longer exists.
+			s.readSegment, s.readOffset = current.id, 0
+		}
+		if s.readOffset < size {
+			if s.readFile == nil {
+				f, err := os.Open(s.segmentPath(current.id))
+				if err != nil {
+					return record{}, fmt.Errorf("failed to open spool segment: %w", err)
+				}
+				s.readFile = f
+			}
+			r, err := readRecord(s.readFile, s.readOffset, size)
+			if err == nil {
+				return r, nil
+			}
+			// The segment is corrupt beyond this point, which may
+			// happen if the disk was modified externally. Skip the
+			// remainder of the segment.
+			s.logger.With(logp.Error(err)).Errorf(
+				"skipping corrupt spool segment %016x from offset %d",
+				current.id, s.readOffset,
+			)
+			s.mu.Lock()
+			s.size -= size - current.consumed
+			s.events -= current.events
+			current.consumed = size
+			current.events = 0
+			s.mu.Unlock()
+			s.readOffset = size
+			continue
+		}
+		if sealed {
+			if err := s.removeConsumedSegment(); err != nil {
+				return record{}, err
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return record{}, ctx.Err()
+		case <-s.notify:
+		}
+	}
+}
+
+// removeConsumedSegment removes the first segment, which has been fully
+// consumed, and advances the cursor to the start of the next segment.
+func (s *Spool) removeConsumedSegment() error {
+	if s.readFile != nil {
+		s.readFile.Close()
+		s.readFile = nil
+	}
+	s.mu.Lock()
+	consumed := s.segments[0]
+	s.segments = s.segments[1:]
+	s.size -= consumed.size - consumed.consumed
+	s.readSegment, s.readOffset = s.segments[0].id, 0
+	s.mu.Unlock()
+
+	if err := s.writeCursor(); err != nil {
+		return fmt.Errorf("failed to record spool position: %w", err)
+	}
+	if err := os.Remove(s.segmentPath(consumed.id)); err != nil {
+		return fmt.Errorf("failed to remove consumed spool segment: %w", err)
+	}
+	return nil
+}
+
+// Close closes the spool. Close must not be called until Run has returned.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return errors.Join(s.file.Sync(), s.file.Close(), s.lock.Unlock())
+}
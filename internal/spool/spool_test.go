@@ -0,0 +1,351 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package spool_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/elastic/apm-data/model/modelpb"
+	"github.com/elastic/apm-server/internal/spool"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestSpoolDeliversInOrder(t *testing.T) {
+	received := newReceiver()
+	s := newSpool(t, spool.Config{Dir: t.TempDir(), Processor: received})
+	runSpool(t, s)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, s.ProcessBatch(context.Background(), makeBatch(i, 3)))
+	}
+	assert.Equal(t, eventIDs(0, 30), received.wait(t, 30))
+}
+
+func TestSpoolReplaysAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	// Spool some batches without consuming them.
+	s := newSpool(t, spool.Config{Dir: dir, Processor: newReceiver()})
+	for i := 0; i < 5; i++ {
+		require.NoError(t, s.ProcessBatch(context.Background(), makeBatch(i, 2)))
+	}
+	require.NoError(t, s.Close())
+
+	// Consume the first three batches, then stop.
+	received := newReceiver()
+	received.limit = 3
+	s = newSpool(t, spool.Config{Dir: dir, Processor: received})
+	stop := runSpool(t, s)
+	assert.Equal(t, eventIDs(0, 6), received.wait(t, 6))
+	stop()
+	require.NoError(t, s.Close())
+
+	// The remaining batches should be delivered after restarting,
+	// followed by newly spooled batches.
+	received = newReceiver()
+	s = newSpool(t, spool.Config{Dir: dir, Processor: received})
+	runSpool(t, s)
+	require.NoError(t, s.ProcessBatch(context.Background(), makeBatch(5, 2)))
+	assert.Equal(t, eventIDs(6, 12), received.wait(t, 6))
+}
+
+func TestSpoolFull(t *testing.T) {
+	s := newSpool(t, spool.Config{Dir: t.TempDir(), MaxSize: 1024, Processor: newReceiver()})
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		err = s.ProcessBatch(context.Background(), makeBatch(i, 1))
+	}
+	assert.ErrorIs(t, err, spool.ErrFull)
+}
+
+func TestSpoolReleasesConsumedRecords(t *testing.T) {
+	for name, segmentSize := range map[string]int64{
+		"default_segment_size": 0,
+		"large_segment_size":   64 * 1024 * 1024,
+	} {
+		t.Run(name, func(t *testing.T) {
+			received := newReceiver()
+			s := newSpool(t, spool.Config{
+				Dir:         t.TempDir(),
+				MaxSize:     4096,
+				SegmentSize: segmentSize,
+				Processor:   received,
+			})
+			runSpool(t, s)
+
+			// Spool many times MaxSize in total, waiting for each batch
+			// to be delivered. Consumed records must not count towards
+			// the size of the spool.
+			for i := 0; i < 500; i++ {
+				require.NoError(t, s.ProcessBatch(context.Background(), makeBatch(i, 1)))
+				received.wait(t, i+1)
+			}
+		})
+	}
+}
+
+func TestSpoolRemovesConsumedSegments(t *testing.T) {
+	dir := t.TempDir()
+	received := newReceiver()
+	s := newSpool(t, spool.Config{Dir: dir, SegmentSize: 256, Processor: received})
+	for i := 0; i < 20; i++ {
+		require.NoError(t, s.ProcessBatch(context.Background(), makeBatch(i, 1)))
+	}
+	assert.Greater(t, len(segmentFiles(t, dir)), 2)
+
+	runSpool(t, s)
+	assert.Equal(t, eventIDs(0, 20), received.wait(t, 20))
+	assert.Eventually(t, func() bool {
+		return len(segmentFiles(t, dir)) == 1
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+func TestSpoolTruncatesIncompleteRecord(t *testing.T) {
+	dir := t.TempDir()
+	s := newSpool(t, spool.Config{Dir: dir, Processor: newReceiver()})
+	for i := 0; i < 2; i++ {
+		require.NoError(t, s.ProcessBatch(context.Background(), makeBatch(i, 1)))
+	}
+	require.NoError(t, s.Close())
+
+	// Simulate a crash part way through writing a record.
+	files := segmentFiles(t, dir)
+	require.Len(t, files, 1)
+	f, err := os.OpenFile(files[0], os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0xff, 0xff, 0, 0, 1, 2, 3})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	received := newReceiver()
+	s = newSpool(t, spool.Config{Dir: dir, Processor: received})
+	runSpool(t, s)
+	require.NoError(t, s.ProcessBatch(context.Background(), makeBatch(2, 1)))
+	assert.Equal(t, eventIDs(0, 3), received.wait(t, 3))
+}
+
+func TestSpoolRetriesProcessorErrors(t *testing.T) {
+	received := newReceiver()
+	var failures int
+	processor := modelpb.ProcessBatchFunc(func(ctx context.Context, b *modelpb.Batch) error {
+		if failures < 2 {
+			failures++
+			return errors.New("output unavailable")
+		}
+		return received.ProcessBatch(ctx, b)
+	})
+	s := newSpool(t, spool.Config{Dir: t.TempDir(), Processor: processor})
+	runSpool(t, s)
+	require.NoError(t, s.ProcessBatch(context.Background(), makeBatch(0, 2)))
+	assert.Equal(t, eventIDs(0, 2), received.wait(t, 2))
+	assert.Equal(t, 2, failures)
+}
+
+func TestSpoolMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader(sdkmetric.WithTemporalitySelector(
+		func(ik sdkmetric.InstrumentKind) metricdata.Temporality {
+			return metricdata.DeltaTemporality
+		},
+	))
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	received := newReceiver()
+	received.limit = 1
+	s := newSpool(t, spool.Config{
+		Dir:           t.TempDir(),
+		MaxSize:       4096,
+		Processor:     received,
+		MeterProvider: mp,
+	})
+	for i := 0; i < 3; i++ {
+		require.NoError(t, s.ProcessBatch(context.Background(), makeBatch(i, 2)))
+	}
+	for {
+		if err := s.ProcessBatch(context.Background(), makeBatch(3, 2)); err != nil {
+			require.ErrorIs(t, err, spool.ErrFull)
+			break
+		}
+	}
+	metrics := collectMetrics(t, reader)
+	assert.Greater(t, metrics["apm-server.spool.events.accepted"], int64(6))
+	assert.Equal(t, int64(2), metrics["apm-server.spool.events.rejected"])
+	assert.Equal(t, metrics["apm-server.spool.events.accepted"], metrics["apm-server.spool.queue.events"])
+	assert.Greater(t, metrics["apm-server.spool.queue.bytes"], int64(0))
+	assert.Equal(t, int64(0), metrics["apm-server.spool.queue.age"])
+
+	// The receiver accepts the first batch and then blocks the spool,
+	// so the second batch remains queued and ages.
+	runSpool(t, s)
+	received.wait(t, 2)
+	time.Sleep(10 * time.Millisecond)
+	metrics = collectMetrics(t, reader)
+	assert.Equal(t, int64(2), metrics["apm-server.spool.events.delivered"])
+	assert.Greater(t, metrics["apm-server.spool.queue.age"], int64(0))
+}
+
+func TestSpoolLocksDirectory(t *testing.T) {
+	dir := t.TempDir()
+	s := newSpool(t, spool.Config{Dir: dir, Processor: newReceiver()})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := spool.New(ctx, spool.Config{Dir: dir, MaxSize: 1024, Processor: newReceiver()})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Once the spool is closed, another may be created.
+	require.NoError(t, s.Close())
+	newSpool(t, spool.Config{Dir: dir, Processor: newReceiver()})
+}
+
+func newSpool(t testing.TB, cfg spool.Config) *spool.Spool {
+	t.Helper()
+	if cfg.MaxSize == 0 {
+		cfg.MaxSize = 1024 * 1024
+	}
+	cfg.Logger = logptest.NewTestingLogger(t, "")
+	s, err := spool.New(context.Background(), cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// runSpool runs s in the background, returning a function that stops it.
+// The spool is stopped at the end of the test if not stopped before.
+func runSpool(t testing.TB, s *spool.Spool) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			cancel()
+			assert.NoError(t, <-done)
+		})
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+func makeBatch(i, n int) *modelpb.Batch {
+	batch := make(modelpb.Batch, n)
+	for j := range batch {
+		batch[j] = &modelpb.APMEvent{
+			Message: eventIDs(i*n+j, i*n+j+1)[0],
+		}
+	}
+	return &batch
+}
+
+func eventIDs(from, to int) []string {
+	var ids []string
+	for i := from; i < to; i++ {
+		ids = append(ids, time.Duration(i).String())
+	}
+	return ids
+}
+
+func segmentFiles(t testing.TB, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*.segment"))
+	require.NoError(t, err)
+	return files
+}
+
+func collectMetrics(t testing.TB, reader sdkmetric.Reader) map[string]int64 {
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	metrics := make(map[string]int64)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, dp := range data.DataPoints {
+					metrics[m.Name] += dp.Value
+				}
+			case metricdata.Gauge[int64]:
+				for _, dp := range data.DataPoints {
+					metrics[m.Name] = dp.Value
+				}
+			}
+		}
+	}
+	return metrics
+}
+
+// receiver records the IDs of events it receives. If limit is non-zero,
+// the receiver blocks after receiving limit batches until the context
+// is cancelled.
+type receiver struct {
+	mu      sync.Mutex
+	ids     []string
+	batches int
+	limit   int
+	ch      chan struct{}
+}
+
+func newReceiver() *receiver {
+	return &receiver{ch: make(chan struct{}, 1)}
+}
+
+func (r *receiver) ProcessBatch(ctx context.Context, b *modelpb.Batch) error {
+	r.mu.Lock()
+	if r.limit > 0 && r.batches >= r.limit {
+		r.mu.Unlock()
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	r.batches++
+	for _, event := range *b {
+		r.ids = append(r.ids, event.GetMessage())
+	}
+	r.mu.Unlock()
+	select {
+	case r.ch <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (r *receiver) wait(t testing.TB, n int) []string {
+	t.Helper()
+	timeout := time.After(10 * time.Second)
+	for {
+		r.mu.Lock()
+		if len(r.ids) >= n {
+			ids := append([]string(nil), r.ids...)
+			r.mu.Unlock()
+			return ids
+		}
+		r.mu.Unlock()
+		select {
+		case <-r.ch:
+		case <-timeout:
+			t.Fatalf("timed out waiting for %d events", n)
+		}
+	}
+}
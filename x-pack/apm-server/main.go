@@ -8,6 +8,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"sync"
 
@@ -96,6 +97,12 @@ func newProcessors(args beater.ServerParams) ([]namedProcessor, error) {
 			return nil, fmt.Errorf("error creating %s: %w", name, err)
 		}
 		processors = append(processors, namedProcessor{name: name, processor: sampler})
+		if args.Drainer != nil {
+			// Publish pending sampling decisions once in-flight
+			// requests have been drained, before the output is
+			// flushed.
+			args.Drainer.AddFlusher(name, sampler.Flush)
+		}
 	}
 	return processors, nil
 }
@@ -113,6 +120,30 @@ func newTailSamplingProcessor(args beater.ServerParams) (*sampling.Processor, er
 		return nil, fmt.Errorf("failed to get tail-sampling database: %w", err)
 	}
 
+	storage := db.NewReadWriter(tailSamplingConfig.StorageLimitParsed, tailSamplingConfig.DiskUsageThreshold)
+	if limitRW, ok := storage.(eventstorage.StorageLimitReadWriter); ok && args.HealthChecker != nil {
+		args.HealthChecker.RegisterProbe("tail_sampling_storage", func(context.Context) error {
+			return limitRW.CheckStorageLimit()
+		})
+	}
+	if args.AdminRegistry != nil {
+		args.AdminRegistry.Register(
+			"tail_sampling.rotate_partitions",
+			"Rotate the tail-sampling storage partitions, deleting the oldest "+
+				"partition to reclaim disk space ahead of the TTL.",
+			func(context.Context, url.Values) (any, error) {
+				return nil, db.RotatePartitions()
+			},
+		)
+		args.AdminRegistry.Register(
+			"tail_sampling.flush",
+			"Flush pending tail-sampling storage writes to disk.",
+			func(context.Context, url.Values) (any, error) {
+				return nil, db.Flush()
+			},
+		)
+	}
+
 	policies := make([]sampling.Policy, len(tailSamplingConfig.Policies))
 	for i, in := range tailSamplingConfig.Policies {
 		policies[i] = sampling.Policy{
@@ -147,7 +178,7 @@ func newTailSamplingProcessor(args beater.ServerParams) (*sampling.Processor, er
 		},
 		StorageConfig: sampling.StorageConfig{
 			DB:                    db,
-			Storage:               db.NewReadWriter(tailSamplingConfig.StorageLimitParsed, tailSamplingConfig.DiskUsageThreshold),
+			Storage:               storage,
 			TTL:                   tailSamplingConfig.TTL,
 			DiscardOnWriteFailure: tailSamplingConfig.DiscardOnWriteFailure,
 		},
@@ -204,6 +235,7 @@ func runServerWithProcessors(ctx context.Context, runServer beater.RunServerFunc
 				stopctx, cancel = context.WithTimeout(stopctx, args.Config.ShutdownTimeout)
 				defer cancel()
 			}
+			args.Logger.Infof("stopping %s", p.name)
 			return p.Stop(stopctx)
 		})
 	}
@@ -262,6 +294,7 @@ func Main() error {
 				TracerProvider:  args.TracerProvider,
 				MeterProvider:   args.MeterProvider,
 				MetricsGatherer: args.MetricsGatherer,
+				MetricReader:    args.MetricReader,
 				BeatMonitoring:  args.BeatMonitoring,
 			})
 		},
@@ -97,6 +97,12 @@ func NewStorageLimitReadWriter(name string, checker storageLimitChecker, nextRW
 	}
 }
 
+// CheckStorageLimit returns an error wrapping ErrLimitReached if the
+// storage limit is reached, in which case writes are rejected.
+func (s StorageLimitReadWriter) CheckStorageLimit() error {
+	return s.checkStorageLimit()
+}
+
 func (s StorageLimitReadWriter) checkStorageLimit() error {
 	limit := s.checker.StorageLimit()
 	if limit != 0 { // unlimited storage
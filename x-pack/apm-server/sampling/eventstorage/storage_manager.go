@@ -113,6 +113,9 @@ type StorageManager struct {
 	decisionStorage *Storage
 
 	partitioner *Partitioner
+	// rotateMu serializes partition rotations, which may be triggered
+	// by the TTL GC loop or on demand through the admin API.
+	rotateMu sync.Mutex
 
 	codec Codec
 
@@ -395,13 +398,15 @@ func (sm *StorageManager) runTTLGCLoop(stopping <-chan struct{}, ttl time.Durati
 
 // RotatePartitions rotates the partitions to clean up TTL-expired entries.
 func (sm *StorageManager) RotatePartitions() error {
+	sm.rotateMu.Lock()
+	defer sm.rotateMu.Unlock()
 	newCurrentPID, newInactivePID := sm.partitioner.Rotate()
 
 	if err := sm.savePartitionID(newCurrentPID); err != nil {
 		return err
 	}
 
-	// No lock is needed here as the only writer to sm.partitioner is exactly this function.
+	// No further lock is needed here as the only writer to sm.partitioner is exactly this function.
 	lbPrefix := byte(newInactivePID)
 
 	lb := []byte{lbPrefix}
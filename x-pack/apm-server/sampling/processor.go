@@ -46,6 +46,10 @@ type Processor struct {
 	stopMu   sync.Mutex
 	stopping chan struct{}
 	stopped  chan struct{}
+
+	// flushRequests receives requests from Flush to publish
+	// local sampling decisions immediately.
+	flushRequests chan chan error
 }
 
 type eventMetrics struct {
@@ -74,6 +78,7 @@ func NewProcessor(config Config, logger *logp.Logger) (*Processor, error) {
 		eventStore:        config.Storage,
 		stopping:          make(chan struct{}),
 		stopped:           make(chan struct{}),
+		flushRequests:     make(chan chan error),
 	}
 
 	p.eventMetrics.processed, _ = meter.Int64Counter("apm-server.sampling.tail.events.processed")
@@ -269,6 +274,32 @@ func (p *Processor) Stop(ctx context.Context) error {
 	return nil
 }
 
+// Flush makes local sampling decisions and publishes them immediately,
+// rather than waiting for the next flush interval, and hands the sampled
+// trace IDs to be reported. Flush is used when draining the server.
+//
+// Flush returns once the decisions have been published, or ctx is
+// cancelled. If the processor is stopping, Flush returns immediately,
+// as decisions are published when stopping.
+func (p *Processor) Flush(ctx context.Context) error {
+	done := make(chan error, 1)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.stopping:
+		return nil
+	case <-p.stopped:
+		return nil
+	case p.flushRequests <- done:
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-done:
+		return err
+	}
+}
+
 // Run runs the tail-sampling processor. This method is responsible for:
 //
 //   - periodically making, and then publishing, local sampling decisions
@@ -402,6 +433,12 @@ func (p *Processor) Run() error {
 			select {
 			case <-p.stopping:
 				return publishDecisions()
+			case done := <-p.flushRequests:
+				err := publishDecisions()
+				done <- err
+				if err != nil {
+					return err
+				}
 			case <-ticker.C:
 				if err := publishDecisions(); err != nil {
 					return err
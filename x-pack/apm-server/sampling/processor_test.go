@@ -272,6 +272,49 @@ func TestProcessLocalTailSampling(t *testing.T) {
 
 }
 
+func TestProcessFlush(t *testing.T) {
+	tempdirConfig := newTempdirConfig(t)
+	config := tempdirConfig.Config
+	config.Policies = []sampling.Policy{{SampleRate: 1}}
+	config.FlushInterval = time.Hour
+	published := make(chan string)
+	config.Elasticsearch = pubsubtest.Client(pubsubtest.PublisherChan(published), nil)
+
+	processor, err := sampling.NewProcessor(config, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	go processor.Run()
+	defer processor.Stop(context.Background())
+
+	trace := modelpb.Trace{Id: "0102030405060708090a0b0c0d0e0f10"}
+	in := modelpb.Batch{{
+		Trace: &trace,
+		Event: &modelpb.Event{Duration: uint64(123 * time.Millisecond)},
+		Transaction: &modelpb.Transaction{
+			Type:    "type",
+			Id:      "0102030405060708",
+			Sampled: true,
+		},
+	}}
+	require.NoError(t, processor.ProcessBatch(context.Background(), &in))
+	assert.Empty(t, in)
+
+	// Flush publishes the sampling decision without waiting
+	// for the flush interval to elapse.
+	flushed := make(chan error, 1)
+	go func() { flushed <- processor.Flush(context.Background()) }()
+	select {
+	case traceID := <-published:
+		assert.Equal(t, trace.Id, traceID)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for publication")
+	}
+	assert.NoError(t, <-flushed)
+
+	// Flush returns immediately once the processor is stopping.
+	assert.NoError(t, processor.Stop(context.Background()))
+	assert.NoError(t, processor.Flush(context.Background()))
+}
+
 func TestProcessLocalTailSamplingUnsampled(t *testing.T) {
 	tempdirConfig := newTempdirConfig(t)
 	config := tempdirConfig.Config